@@ -0,0 +1,38 @@
+// Package almacenamiento guarda los archivos que sube la aplicación (por ahora
+// las imágenes de productos). Los handlers solo conocen la interfaz
+// Almacenamiento, así que el disco local puede reemplazarse por un servicio
+// compatible con S3 sin tocar el resto del código.
+package almacenamiento
+
+import (
+	"errors"
+	"path"
+	"strings"
+)
+
+// ErrClaveInvalida se devuelve cuando una clave intenta salir del directorio
+// de almacenamiento o está vacía.
+var ErrClaveInvalida = errors.New("clave de almacenamiento inválida")
+
+// Almacenamiento guarda y publica archivos identificados por una clave con
+// forma de ruta relativa, p. ej. `productos/12/ab34cd_mediana.jpg`.
+type Almacenamiento interface {
+	// Guardar escribe (o reemplaza) el archivo de la clave indicada.
+	Guardar(clave string, contenido []byte, tipoContenido string) error
+	// Eliminar borra el archivo; no falla si ya no existe.
+	Eliminar(clave string) error
+	// URL devuelve la dirección pública del archivo.
+	URL(clave string) string
+}
+
+// validarClave normaliza la clave y rechaza rutas absolutas o con `..`.
+func validarClave(clave string) (string, error) {
+	if clave == "" || strings.HasPrefix(clave, "/") || strings.Contains(clave, "\\") {
+		return "", ErrClaveInvalida
+	}
+	limpia := path.Clean(clave)
+	if limpia == "." || limpia == ".." || strings.HasPrefix(limpia, "../") {
+		return "", ErrClaveInvalida
+	}
+	return limpia, nil
+}
@@ -0,0 +1,97 @@
+package almacenamiento
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// publicado es un almacenamiento que además sirve sus archivos.
+type publicado interface {
+	Almacenamiento
+	Handler() http.Handler
+}
+
+// probarAlmacenamiento verifica el contrato de Almacenamiento de punta a
+// punta: lo que se guarda se sirve en su URL y lo eliminado deja de estarlo.
+func probarAlmacenamiento(t *testing.T, a publicado) {
+	mux := http.NewServeMux()
+	mux.Handle("/media/", a.Handler())
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	leer := func(clave string) (int, string, string) {
+		t.Helper()
+		res, err := http.Get(srv.URL + a.URL(clave))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer res.Body.Close()
+		cuerpo, _ := io.ReadAll(res.Body)
+		return res.StatusCode, res.Header.Get("Content-Type"), string(cuerpo)
+	}
+
+	if a.URL("productos/1/a.png") != "/media/productos/1/a.png" {
+		t.Errorf("URL %q", a.URL("productos/1/a.png"))
+	}
+	if err := a.Guardar("productos/1/a.png", []byte("\x89PNG\r\n\x1a\nprimera"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Guardar("productos/1/a.png", []byte("\x89PNG\r\n\x1a\nsegunda"), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	status, tipo, cuerpo := leer("productos/1/a.png")
+	if status != http.StatusOK || tipo != "image/png" || cuerpo != "\x89PNG\r\n\x1a\nsegunda" {
+		t.Errorf("GET tras reemplazar: %d %q %q", status, tipo, cuerpo)
+	}
+	if status, _, _ := leer("productos/1/"); status != http.StatusNotFound {
+		t.Errorf("listar un prefijo: %d, se esperaba 404", status)
+	}
+	if status, _, _ := leer("productos/1/otra.png"); status != http.StatusNotFound {
+		t.Errorf("archivo inexistente: %d, se esperaba 404", status)
+	}
+
+	if err := a.Eliminar("productos/1/a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if status, _, _ := leer("productos/1/a.png"); status != http.StatusNotFound {
+		t.Errorf("GET tras eliminar: %d, se esperaba 404", status)
+	}
+	if err := a.Eliminar("productos/1/a.png"); err != nil {
+		t.Errorf("eliminar dos veces: %v", err)
+	}
+
+	for _, clave := range []string{"", "/etc/passwd", "../fuera.png", "productos/../../fuera.png", `productos\a.png`} {
+		if err := a.Guardar(clave, []byte("x"), "text/plain"); !errors.Is(err, ErrClaveInvalida) {
+			t.Errorf("Guardar(%q) = %v, se esperaba ErrClaveInvalida", clave, err)
+		}
+		if err := a.Eliminar(clave); !errors.Is(err, ErrClaveInvalida) {
+			t.Errorf("Eliminar(%q) = %v, se esperaba ErrClaveInvalida", clave, err)
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	local, err := NewLocal(t.TempDir(), "/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	probarAlmacenamiento(t, local)
+}
+
+func TestMemoria(t *testing.T) {
+	memoria := NewMemoria("/media/")
+	probarAlmacenamiento(t, memoria)
+
+	// Guardar copia el contenido: el llamador puede reutilizar su slice.
+	contenido := []byte("hola")
+	if err := memoria.Guardar("a.txt", contenido, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	contenido[0] = 'H'
+	if leido, tipo, err := memoria.Leer("a.txt"); err != nil || string(leido) != "hola" || tipo != "text/plain" {
+		t.Errorf("Leer = %q %q %v", leido, tipo, err)
+	}
+}
@@ -0,0 +1,87 @@
+package almacenamiento
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Local guarda los archivos en un directorio del servidor y los publica bajo
+// un prefijo de URL (ver Handler).
+type Local struct {
+	dir     string
+	urlBase string
+}
+
+// NewLocal crea el almacenamiento en `dir` (lo crea si no existe). `urlBase`
+// es el prefijo con el que se sirven los archivos, p. ej. `/media`.
+func NewLocal(dir, urlBase string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir, urlBase: strings.TrimSuffix(urlBase, "/")}, nil
+}
+
+// Guardar escribe el archivo de forma atómica: primero en un temporal y luego
+// lo renombra, para no servir nunca una imagen a medio escribir.
+func (l *Local) Guardar(clave string, contenido []byte, tipoContenido string) error {
+	clave, err := validarClave(clave)
+	if err != nil {
+		return err
+	}
+	destino := filepath.Join(l.dir, filepath.FromSlash(clave))
+	if err := os.MkdirAll(filepath.Dir(destino), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(destino), ".subida-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(contenido); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), destino)
+}
+
+// Eliminar borra el archivo de la clave indicada.
+func (l *Local) Eliminar(clave string) error {
+	clave, err := validarClave(clave)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(filepath.Join(l.dir, filepath.FromSlash(clave)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// URL devuelve la ruta pública del archivo.
+func (l *Local) URL(clave string) string {
+	return l.urlBase + "/" + clave
+}
+
+// Handler sirve los archivos guardados. Debe montarse en `urlBase`. No lista
+// directorios.
+func (l *Local) Handler() http.Handler {
+	archivos := http.FileServer(http.Dir(l.dir))
+	return http.StripPrefix(l.urlBase+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "" || strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		archivos.ServeHTTP(w, r)
+	}))
+}
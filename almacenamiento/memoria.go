@@ -0,0 +1,95 @@
+package almacenamiento
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Memoria guarda los archivos en un mapa y los publica como lo haría un
+// bucket: cada objeto con su tipo de contenido, bajo un prefijo de URL (ver
+// Handler). Hace de sustituto del bucket remoto en pruebas con httptest y en
+// desarrollo sin disco persistente (STORAGE_DRIVER=memoria).
+type Memoria struct {
+	mu       sync.Mutex
+	urlBase  string
+	archivos map[string][]byte
+	tipos    map[string]string
+}
+
+// NewMemoria devuelve un almacenamiento en memoria vacío. `urlBase` es el
+// prefijo con el que se sirven los archivos, p. ej. `/media`.
+func NewMemoria(urlBase string) *Memoria {
+	return &Memoria{
+		urlBase:  strings.TrimSuffix(urlBase, "/"),
+		archivos: map[string][]byte{},
+		tipos:    map[string]string{},
+	}
+}
+
+// Guardar copia el contenido, así que el llamador puede reutilizar el slice.
+func (m *Memoria) Guardar(clave string, contenido []byte, tipoContenido string) error {
+	clave, err := validarClave(clave)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.archivos[clave] = append([]byte(nil), contenido...)
+	m.tipos[clave] = tipoContenido
+	return nil
+}
+
+// Eliminar borra el archivo de la clave indicada.
+func (m *Memoria) Eliminar(clave string) error {
+	clave, err := validarClave(clave)
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.archivos, clave)
+	delete(m.tipos, clave)
+	return nil
+}
+
+// URL devuelve la ruta pública del archivo.
+func (m *Memoria) URL(clave string) string {
+	return m.urlBase + "/" + clave
+}
+
+// Leer devuelve el contenido guardado en una clave y su tipo.
+func (m *Memoria) Leer(clave string) ([]byte, string, error) {
+	clave, err := validarClave(clave)
+	if err != nil {
+		return nil, "", err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	contenido, ok := m.archivos[clave]
+	if !ok {
+		return nil, "", fmt.Errorf("archivo no encontrado: %s", clave)
+	}
+	return contenido, m.tipos[clave], nil
+}
+
+// Handler sirve los archivos guardados con el tipo de contenido con que se
+// subieron. Debe montarse en `urlBase`. No lista prefijos.
+func (m *Memoria) Handler() http.Handler {
+	return http.StripPrefix(m.urlBase+"/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contenido, tipo, err := m.Leer(r.URL.Path)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", tipo)
+		w.Header().Set("Content-Length", strconv.Itoa(len(contenido)))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		if r.Method != http.MethodHead {
+			w.Write(contenido)
+		}
+	}))
+}
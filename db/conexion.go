@@ -6,43 +6,91 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"time"
 
 	_ "github.com/go-sql-driver/mysql"
-	"github.com/joho/godotenv"
 )
 
-// Connect crea y devuelve una conexión a la base de datos MySQL usando
-// variables de entorno (`DB_USER`, `DB_PASSWORD`, `DB_HOST`, `DB_PORT`, `DB_NAME`).
-// Devuelve error si la conexión o el ping fallan.
-func Connect() (*sql.DB, error) {
-	// cargar directamente los datos desde el env
-	err := godotenv.Load()
-	if err != nil {
-		return nil, err
+// Config agrupa los datos de conexión y los parámetros del pool.
+type Config struct {
+	User     string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+
+	MaxOpenConns    int           // conexiones abiertas como máximo (0 = sin límite)
+	MaxIdleConns    int           // conexiones inactivas que se conservan
+	ConnMaxLifetime time.Duration // tiempo máximo de vida de una conexión
+}
+
+// LoadConfig lee la configuración desde variables de entorno (`DB_USER`,
+// `DB_PASSWORD`, `DB_HOST`, `DB_PORT`, `DB_NAME`) y los ajustes opcionales del
+// pool (`DB_MAX_OPEN_CONNS`, `DB_MAX_IDLE_CONNS`, `DB_CONN_MAX_LIFETIME`).
+func LoadConfig() (Config, error) {
+	cfg := Config{
+		User:            os.Getenv("DB_USER"),
+		Password:        os.Getenv("DB_PASSWORD"),
+		Host:            os.Getenv("DB_HOST"),
+		Port:            os.Getenv("DB_PORT"),
+		Name:            os.Getenv("DB_NAME"),
+		MaxOpenConns:    25,
+		MaxIdleConns:    25,
+		ConnMaxLifetime: 5 * time.Minute,
+	}
+
+	var err error
+	if v := os.Getenv("DB_MAX_OPEN_CONNS"); v != "" {
+		if cfg.MaxOpenConns, err = strconv.Atoi(v); err != nil {
+			return cfg, fmt.Errorf("DB_MAX_OPEN_CONNS inválido: %w", err)
+		}
 	}
-	// loq ue hacer es configurar la de conexion con mysql
-	log.Println("root:@tcp(localhost:3306)/pooenlinea")
-	dns := fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?parseTime=true",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
+	if v := os.Getenv("DB_MAX_IDLE_CONNS"); v != "" {
+		if cfg.MaxIdleConns, err = strconv.Atoi(v); err != nil {
+			return cfg, fmt.Errorf("DB_MAX_IDLE_CONNS inválido: %w", err)
+		}
+	}
+	if v := os.Getenv("DB_CONN_MAX_LIFETIME"); v != "" {
+		if cfg.ConnMaxLifetime, err = time.ParseDuration(v); err != nil {
+			return cfg, fmt.Errorf("DB_CONN_MAX_LIFETIME inválido: %w", err)
+		}
+	}
+	return cfg, nil
+}
+
+// DSN arma la cadena de conexión para el driver de MySQL.
+func (c Config) DSN() string {
+	return fmt.Sprintf("%v:%v@tcp(%v:%v)/%v?parseTime=true",
+		c.User,
+		c.Password,
+		c.Host,
+		c.Port,
+		c.Name,
 	)
+}
 
-	// crear la conexion
-	db, err := sql.Open("mysql", dns)
+// Connect abre el pool de conexiones a MySQL con la configuración indicada.
+// Se llama una sola vez al arrancar; el *sql.DB resultante se comparte en
+// todo el proceso. Devuelve error si la conexión o el ping fallan.
+func Connect(cfg Config) (*sql.DB, error) {
+	// crear el pool
+	db, err := sql.Open("mysql", cfg.DSN())
 	if err != nil {
 		return nil, err
 	}
 
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
 	// probar que conexion esa correcta
 	if err = db.Ping(); err != nil {
+		db.Close()
 		return nil, err
 	}
 
-	log.Println("Conectado exitosamente con la base de datos")
+	log.Printf("Conectado exitosamente con la base de datos %s en %s:%s", cfg.Name, cfg.Host, cfg.Port)
 
 	return db, nil
-
 }
@@ -0,0 +1,11 @@
+-- Elimina todas las tablas del esquema inicial, en orden inverso a sus claves foráneas.
+
+DROP TABLE IF EXISTS `sesiones`;
+DROP TABLE IF EXISTS `detalles_pedido`;
+DROP TABLE IF EXISTS `pedidos`;
+DROP TABLE IF EXISTS `items_carrito`;
+DROP TABLE IF EXISTS `carritos`;
+DROP TABLE IF EXISTS `producto_categorias`;
+DROP TABLE IF EXISTS `productos`;
+DROP TABLE IF EXISTS `categorias`;
+DROP TABLE IF EXISTS `clientes`;
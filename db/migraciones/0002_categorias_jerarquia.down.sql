@@ -0,0 +1,2 @@
+ALTER TABLE `categorias` DROP FOREIGN KEY `categorias_ibfk_1`;
+ALTER TABLE `categorias` DROP KEY `id_padre`, DROP COLUMN `id_padre`;
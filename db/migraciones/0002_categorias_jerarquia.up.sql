@@ -0,0 +1,7 @@
+-- Categorías anidadas: cada categoría puede tener una categoría padre.
+-- Una categoría con subcategorías no puede eliminarse (RESTRICT).
+
+ALTER TABLE `categorias`
+  ADD COLUMN `id_padre` int DEFAULT NULL AFTER `descripcion`,
+  ADD KEY `id_padre` (`id_padre`),
+  ADD CONSTRAINT `categorias_ibfk_1` FOREIGN KEY (`id_padre`) REFERENCES `categorias` (`id_categoria`);
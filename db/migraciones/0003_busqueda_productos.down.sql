@@ -0,0 +1,2 @@
+ALTER TABLE `productos` DROP KEY `fecha_creacion`, DROP KEY `precio`;
+ALTER TABLE `productos` DROP KEY `ft_productos`;
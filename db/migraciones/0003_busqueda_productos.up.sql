@@ -0,0 +1,7 @@
+-- Índices para la búsqueda del catálogo: texto completo sobre nombre,
+-- descripción y SKU, y orden/rango por precio y fecha.
+
+ALTER TABLE `productos` ADD FULLTEXT KEY `ft_productos` (`nombre`, `descripcion`, `sku`);
+ALTER TABLE `productos`
+  ADD KEY `precio` (`precio`),
+  ADD KEY `fecha_creacion` (`fecha_creacion`);
@@ -0,0 +1,16 @@
+-- Imágenes de productos. `clave` es el prefijo en el almacenamiento; cada
+-- variante se guarda como `<clave>_<variante>.<extension>`.
+
+CREATE TABLE `imagenes_producto` (
+  `id_imagen` int NOT NULL AUTO_INCREMENT,
+  `id_producto` int NOT NULL,
+  `clave` varchar(255) NOT NULL,
+  `extension` varchar(10) NOT NULL,
+  `orden` int NOT NULL DEFAULT '0',
+  `principal` tinyint(1) NOT NULL DEFAULT '0',
+  `fecha_creacion` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_imagen`),
+  UNIQUE KEY `clave` (`clave`),
+  KEY `producto_orden` (`id_producto`, `orden`),
+  CONSTRAINT `imagenes_producto_ibfk_1` FOREIGN KEY (`id_producto`) REFERENCES `productos` (`id_producto`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,8 @@
+ALTER TABLE `detalles_pedido` DROP FOREIGN KEY `detalles_pedido_ibfk_3`;
+ALTER TABLE `detalles_pedido` DROP KEY `id_variante`, DROP COLUMN `variante`, DROP COLUMN `id_variante`;
+ALTER TABLE `items_carrito` DROP FOREIGN KEY `items_carrito_ibfk_3`;
+ALTER TABLE `items_carrito` DROP KEY `id_variante`, DROP COLUMN `id_variante`;
+DROP TABLE `variante_valores`;
+DROP TABLE `variantes_producto`;
+DROP TABLE `valores_opcion`;
+DROP TABLE `opciones_producto`;
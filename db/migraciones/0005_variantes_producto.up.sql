@@ -0,0 +1,63 @@
+-- Variantes de producto. Un producto define ejes de opciones (p. ej. Talle y
+-- Color) con sus valores; cada combinación es una variante con SKU, precio
+-- opcional y stock propios. Si un producto tiene variantes, `productos.stock`
+-- guarda la suma del stock de todas ellas.
+
+CREATE TABLE `opciones_producto` (
+  `id_opcion` int NOT NULL AUTO_INCREMENT,
+  `id_producto` int NOT NULL,
+  `nombre` varchar(50) NOT NULL,
+  `orden` int NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id_opcion`),
+  UNIQUE KEY `producto_nombre` (`id_producto`, `nombre`),
+  CONSTRAINT `opciones_producto_ibfk_1` FOREIGN KEY (`id_producto`) REFERENCES `productos` (`id_producto`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `valores_opcion` (
+  `id_valor` int NOT NULL AUTO_INCREMENT,
+  `id_opcion` int NOT NULL,
+  `valor` varchar(50) NOT NULL,
+  `orden` int NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id_valor`),
+  UNIQUE KEY `opcion_valor` (`id_opcion`, `valor`),
+  CONSTRAINT `valores_opcion_ibfk_1` FOREIGN KEY (`id_opcion`) REFERENCES `opciones_producto` (`id_opcion`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `variantes_producto` (
+  `id_variante` int NOT NULL AUTO_INCREMENT,
+  `id_producto` int NOT NULL,
+  `sku` varchar(50) DEFAULT NULL,
+  `precio` decimal(10,2) DEFAULT NULL,
+  `stock` int NOT NULL DEFAULT '0',
+  `activo` tinyint(1) NOT NULL DEFAULT '1',
+  `fecha_creacion` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_variante`),
+  UNIQUE KEY `sku` (`sku`),
+  KEY `id_producto` (`id_producto`),
+  CONSTRAINT `variantes_producto_ibfk_1` FOREIGN KEY (`id_producto`) REFERENCES `productos` (`id_producto`) ON DELETE CASCADE,
+  CONSTRAINT `variantes_producto_chk_1` CHECK ((`precio` >= 0)),
+  CONSTRAINT `variantes_producto_chk_2` CHECK ((`stock` >= 0))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `variante_valores` (
+  `id_variante` int NOT NULL,
+  `id_valor` int NOT NULL,
+  PRIMARY KEY (`id_variante`, `id_valor`),
+  KEY `id_valor` (`id_valor`),
+  CONSTRAINT `variante_valores_ibfk_1` FOREIGN KEY (`id_variante`) REFERENCES `variantes_producto` (`id_variante`) ON DELETE CASCADE,
+  CONSTRAINT `variante_valores_ibfk_2` FOREIGN KEY (`id_valor`) REFERENCES `valores_opcion` (`id_valor`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- El carrito y los pedidos apuntan a la variante elegida. Las líneas de
+-- pedido guardan además la descripción de la variante al momento de la
+-- compra, por si luego se modifica o elimina.
+ALTER TABLE `items_carrito`
+  ADD COLUMN `id_variante` int DEFAULT NULL AFTER `id_producto`,
+  ADD KEY `id_variante` (`id_variante`),
+  ADD CONSTRAINT `items_carrito_ibfk_3` FOREIGN KEY (`id_variante`) REFERENCES `variantes_producto` (`id_variante`) ON DELETE CASCADE;
+
+ALTER TABLE `detalles_pedido`
+  ADD COLUMN `id_variante` int DEFAULT NULL AFTER `id_producto`,
+  ADD COLUMN `variante` varchar(255) DEFAULT NULL AFTER `id_variante`,
+  ADD KEY `id_variante` (`id_variante`),
+  ADD CONSTRAINT `detalles_pedido_ibfk_3` FOREIGN KEY (`id_variante`) REFERENCES `variantes_producto` (`id_variante`) ON DELETE SET NULL;
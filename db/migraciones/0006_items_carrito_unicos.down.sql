@@ -0,0 +1,3 @@
+ALTER TABLE `items_carrito`
+  DROP INDEX `carrito_producto_variante`,
+  DROP COLUMN `id_variante_clave`;
@@ -0,0 +1,24 @@
+-- Un carrito tiene una sola línea por producto (y variante): agregar de nuevo
+-- suma la cantidad. Antes de crear la clave se fusionan las líneas repetidas.
+UPDATE `items_carrito` i
+  JOIN (
+    SELECT MIN(`id_item`) AS `id_item`, SUM(`cantidad`) AS `cantidad`
+    FROM `items_carrito`
+    GROUP BY `id_carrito`, `id_producto`, COALESCE(`id_variante`, 0)
+    HAVING COUNT(*) > 1
+  ) d ON d.`id_item` = i.`id_item`
+  SET i.`cantidad` = d.`cantidad`;
+
+DELETE i FROM `items_carrito` i
+  JOIN `items_carrito` o
+    ON o.`id_carrito` = i.`id_carrito`
+   AND o.`id_producto` = i.`id_producto`
+   AND COALESCE(o.`id_variante`, 0) = COALESCE(i.`id_variante`, 0)
+   AND o.`id_item` < i.`id_item`;
+
+-- Un índice único admite varios NULL, así que la clave usa una columna
+-- generada con 0 para los productos sin variantes. Es VIRTUAL porque
+-- `id_variante` tiene una clave foránea con ON DELETE CASCADE.
+ALTER TABLE `items_carrito`
+  ADD COLUMN `id_variante_clave` int GENERATED ALWAYS AS (COALESCE(`id_variante`, 0)) VIRTUAL,
+  ADD UNIQUE KEY `carrito_producto_variante` (`id_carrito`, `id_producto`, `id_variante_clave`);
@@ -0,0 +1,6 @@
+DELETE FROM `carritos` WHERE `id_cliente` IS NULL;
+ALTER TABLE `carritos`
+  DROP CHECK `carritos_chk_1`,
+  DROP INDEX `token`,
+  DROP COLUMN `token`,
+  MODIFY `id_cliente` int NOT NULL;
@@ -0,0 +1,8 @@
+-- Carritos de visitantes anónimos. Se identifican por un token aleatorio que
+-- el navegador guarda en una cookie firmada; al iniciar sesión o registrarse
+-- se fusionan con el carrito del cliente y se eliminan.
+ALTER TABLE `carritos`
+  MODIFY `id_cliente` int DEFAULT NULL,
+  ADD COLUMN `token` char(64) DEFAULT NULL AFTER `id_cliente`,
+  ADD UNIQUE KEY `token` (`token`),
+  ADD CONSTRAINT `carritos_chk_1` CHECK (((`id_cliente` IS NULL) <> (`token` IS NULL)));
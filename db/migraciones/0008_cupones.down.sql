@@ -0,0 +1,7 @@
+ALTER TABLE `detalles_pedido` DROP COLUMN `descuento`;
+ALTER TABLE `pedidos` DROP FOREIGN KEY `pedidos_ibfk_2`;
+ALTER TABLE `pedidos` DROP KEY `id_cupon`, DROP COLUMN `codigo_cupon`, DROP COLUMN `id_cupon`, DROP COLUMN `descuento`, DROP COLUMN `subtotal`;
+DROP TABLE `cupon_usos`;
+DROP TABLE `cupon_categorias`;
+DROP TABLE `cupon_productos`;
+DROP TABLE `cupones`;
@@ -0,0 +1,73 @@
+-- Cupones de descuento. Un cupón descuenta un porcentaje o un monto fijo
+-- sobre los productos elegibles (todos, o los de ciertos productos y
+-- categorías), con pedido mínimo, vigencia y límites de uso opcionales.
+CREATE TABLE `cupones` (
+  `id_cupon` int NOT NULL AUTO_INCREMENT,
+  `codigo` varchar(40) NOT NULL,
+  `descripcion` varchar(255) DEFAULT NULL,
+  `tipo` enum('PORCENTAJE','MONTO') NOT NULL,
+  `valor` decimal(10,2) NOT NULL,
+  `minimo_compra` decimal(10,2) NOT NULL DEFAULT '0.00',
+  `valido_desde` datetime DEFAULT NULL,
+  `valido_hasta` datetime DEFAULT NULL,
+  `usos_maximos` int DEFAULT NULL,
+  `usos_por_cliente` int DEFAULT NULL,
+  `usos` int NOT NULL DEFAULT '0',
+  `activo` tinyint(1) NOT NULL DEFAULT '1',
+  `fecha_creacion` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_cupon`),
+  UNIQUE KEY `codigo` (`codigo`),
+  CONSTRAINT `cupones_chk_1` CHECK ((`valor` > 0)),
+  CONSTRAINT `cupones_chk_2` CHECK (((`tipo` <> 'PORCENTAJE') OR (`valor` <= 100))),
+  CONSTRAINT `cupones_chk_3` CHECK ((`minimo_compra` >= 0))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `cupon_productos` (
+  `id_cupon` int NOT NULL,
+  `id_producto` int NOT NULL,
+  PRIMARY KEY (`id_cupon`, `id_producto`),
+  KEY `id_producto` (`id_producto`),
+  CONSTRAINT `cupon_productos_ibfk_1` FOREIGN KEY (`id_cupon`) REFERENCES `cupones` (`id_cupon`) ON DELETE CASCADE,
+  CONSTRAINT `cupon_productos_ibfk_2` FOREIGN KEY (`id_producto`) REFERENCES `productos` (`id_producto`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `cupon_categorias` (
+  `id_cupon` int NOT NULL,
+  `id_categoria` int NOT NULL,
+  PRIMARY KEY (`id_cupon`, `id_categoria`),
+  KEY `id_categoria` (`id_categoria`),
+  CONSTRAINT `cupon_categorias_ibfk_1` FOREIGN KEY (`id_cupon`) REFERENCES `cupones` (`id_cupon`) ON DELETE CASCADE,
+  CONSTRAINT `cupon_categorias_ibfk_2` FOREIGN KEY (`id_categoria`) REFERENCES `categorias` (`id_categoria`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Un registro por pedido que usó el cupón, para el límite por cliente.
+CREATE TABLE `cupon_usos` (
+  `id_uso` int NOT NULL AUTO_INCREMENT,
+  `id_cupon` int NOT NULL,
+  `id_cliente` int NOT NULL,
+  `id_pedido` int NOT NULL,
+  `fecha` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_uso`),
+  KEY `cupon_cliente` (`id_cupon`, `id_cliente`),
+  KEY `id_cliente` (`id_cliente`),
+  KEY `id_pedido` (`id_pedido`),
+  CONSTRAINT `cupon_usos_ibfk_1` FOREIGN KEY (`id_cupon`) REFERENCES `cupones` (`id_cupon`) ON DELETE CASCADE,
+  CONSTRAINT `cupon_usos_ibfk_2` FOREIGN KEY (`id_cliente`) REFERENCES `clientes` (`id_cliente`) ON DELETE CASCADE,
+  CONSTRAINT `cupon_usos_ibfk_3` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- El pedido guarda el subtotal antes del descuento, el descuento aplicado y
+-- el código usado (que sobrevive al borrado del cupón). Cada línea guarda la
+-- parte del descuento que le tocó; `total` sigue siendo lo que se cobra.
+ALTER TABLE `pedidos`
+  ADD COLUMN `subtotal` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `estado`,
+  ADD COLUMN `descuento` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `subtotal`,
+  ADD COLUMN `id_cupon` int DEFAULT NULL AFTER `transaccion_id`,
+  ADD COLUMN `codigo_cupon` varchar(40) DEFAULT NULL AFTER `id_cupon`,
+  ADD KEY `id_cupon` (`id_cupon`),
+  ADD CONSTRAINT `pedidos_ibfk_2` FOREIGN KEY (`id_cupon`) REFERENCES `cupones` (`id_cupon`) ON DELETE SET NULL;
+
+UPDATE `pedidos` SET `subtotal` = `total`;
+
+ALTER TABLE `detalles_pedido`
+  ADD COLUMN `descuento` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `precio_unitario`;
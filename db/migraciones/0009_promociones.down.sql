@@ -0,0 +1,6 @@
+ALTER TABLE `detalles_pedido` DROP COLUMN `descuento_promocion`;
+ALTER TABLE `pedidos` DROP COLUMN `descuento_promociones`;
+DROP TABLE `pedido_promociones`;
+DROP TABLE `promocion_tramos`;
+DROP TABLE `promocion_productos`;
+DROP TABLE `promociones`;
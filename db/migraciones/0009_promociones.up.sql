@@ -0,0 +1,71 @@
+-- Promociones automáticas: se evalúan sobre el carrito sin que el cliente
+-- ingrese un código. Según `tipo` se usan unas columnas u otras:
+--   LLEVA_PAGA: lleva X paga Y sobre los productos de `id_categoria`.
+--   PAQUETE:    `precio_paquete` por cada juego completo de los productos de
+--               promocion_productos.
+--   VOLUMEN:    descuento por tramos de cantidad (promocion_tramos) sobre
+--               cada producto de promocion_productos.
+--   TOTAL:      `porcentaje` sobre el carrito si supera `minimo_compra`.
+CREATE TABLE `promociones` (
+  `id_promocion` int NOT NULL AUTO_INCREMENT,
+  `nombre` varchar(100) NOT NULL,
+  `tipo` enum('LLEVA_PAGA','PAQUETE','VOLUMEN','TOTAL') NOT NULL,
+  `id_categoria` int DEFAULT NULL,
+  `lleva` int DEFAULT NULL,
+  `paga` int DEFAULT NULL,
+  `precio_paquete` decimal(10,2) DEFAULT NULL,
+  `porcentaje` decimal(5,2) DEFAULT NULL,
+  `minimo_compra` decimal(10,2) NOT NULL DEFAULT '0.00',
+  `valido_desde` datetime DEFAULT NULL,
+  `valido_hasta` datetime DEFAULT NULL,
+  `activo` tinyint(1) NOT NULL DEFAULT '1',
+  `fecha_creacion` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_promocion`),
+  KEY `id_categoria` (`id_categoria`),
+  CONSTRAINT `promociones_ibfk_1` FOREIGN KEY (`id_categoria`) REFERENCES `categorias` (`id_categoria`) ON DELETE CASCADE,
+  CONSTRAINT `promociones_chk_1` CHECK (((`lleva` IS NULL) OR (`paga` IS NULL) OR (`lleva` > `paga`))),
+  CONSTRAINT `promociones_chk_2` CHECK (((`porcentaje` IS NULL) OR ((`porcentaje` > 0) AND (`porcentaje` <= 100))))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `promocion_productos` (
+  `id_promocion` int NOT NULL,
+  `id_producto` int NOT NULL,
+  PRIMARY KEY (`id_promocion`, `id_producto`),
+  KEY `id_producto` (`id_producto`),
+  CONSTRAINT `promocion_productos_ibfk_1` FOREIGN KEY (`id_promocion`) REFERENCES `promociones` (`id_promocion`) ON DELETE CASCADE,
+  CONSTRAINT `promocion_productos_ibfk_2` FOREIGN KEY (`id_producto`) REFERENCES `productos` (`id_producto`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `promocion_tramos` (
+  `id_promocion` int NOT NULL,
+  `cantidad_minima` int NOT NULL,
+  `porcentaje` decimal(5,2) NOT NULL,
+  PRIMARY KEY (`id_promocion`, `cantidad_minima`),
+  CONSTRAINT `promocion_tramos_ibfk_1` FOREIGN KEY (`id_promocion`) REFERENCES `promociones` (`id_promocion`) ON DELETE CASCADE,
+  CONSTRAINT `promocion_tramos_chk_1` CHECK ((`cantidad_minima` > 1)),
+  CONSTRAINT `promocion_tramos_chk_2` CHECK (((`porcentaje` > 0) AND (`porcentaje` <= 100)))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Las promociones aplicadas a cada pedido, con el nombre y el ahorro del
+-- momento de la compra: el pedido se puede reconstruir aunque la promoción
+-- cambie o se elimine.
+CREATE TABLE `pedido_promociones` (
+  `id_pedido_promocion` int NOT NULL AUTO_INCREMENT,
+  `id_pedido` int NOT NULL,
+  `id_promocion` int DEFAULT NULL,
+  `nombre` varchar(100) NOT NULL,
+  `descuento` decimal(10,2) NOT NULL,
+  PRIMARY KEY (`id_pedido_promocion`),
+  KEY `id_pedido` (`id_pedido`),
+  KEY `id_promocion` (`id_promocion`),
+  CONSTRAINT `pedido_promociones_ibfk_1` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE,
+  CONSTRAINT `pedido_promociones_ibfk_2` FOREIGN KEY (`id_promocion`) REFERENCES `promociones` (`id_promocion`) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- `descuento` sigue siendo el del cupón; el total cobrado es
+-- subtotal - descuento_promociones - descuento.
+ALTER TABLE `pedidos`
+  ADD COLUMN `descuento_promociones` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `subtotal`;
+
+ALTER TABLE `detalles_pedido`
+  ADD COLUMN `descuento_promocion` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `precio_unitario`;
@@ -0,0 +1,2 @@
+DROP TABLE `pagos_eventos`;
+ALTER TABLE `pedidos` DROP KEY `transaccion_id`;
@@ -0,0 +1,24 @@
+-- Los pedidos anteriores a la pasarela guardaban un ID de transacción fijo de
+-- prueba. Se borra para poder exigir que cada transacción sea de un solo
+-- pedido: los webhooks buscan el pedido por ella.
+UPDATE `pedidos` SET `transaccion_id` = NULL WHERE `transaccion_id` = 'imulado_123';
+
+ALTER TABLE `pedidos`
+  ADD UNIQUE KEY `transaccion_id` (`transaccion_id`);
+
+-- Eventos de pago recibidos por webhook. La clave única (proveedor,
+-- id_evento) hace que un reenvío del mismo evento no se aplique dos veces.
+CREATE TABLE `pagos_eventos` (
+  `id_pago_evento` int NOT NULL AUTO_INCREMENT,
+  `proveedor` varchar(40) NOT NULL,
+  `id_evento` varchar(100) NOT NULL,
+  `tipo` enum('APROBADO','RECHAZADO','REEMBOLSADO') NOT NULL,
+  `transaccion_id` varchar(100) NOT NULL,
+  `id_pedido` int NOT NULL,
+  `monto` decimal(10,2) NOT NULL,
+  `fecha_recepcion` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_pago_evento`),
+  UNIQUE KEY `proveedor_evento` (`proveedor`, `id_evento`),
+  KEY `id_pedido` (`id_pedido`),
+  CONSTRAINT `pagos_eventos_ibfk_1` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
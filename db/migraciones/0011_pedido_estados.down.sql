@@ -0,0 +1,3 @@
+ALTER TABLE `pedidos`
+  MODIFY `estado` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') DEFAULT 'PENDIENTE';
+DROP TABLE `pedido_estados`;
@@ -0,0 +1,31 @@
+-- Historial de estados de cada pedido: quién hizo el cambio, cuándo y por qué.
+-- `estado_anterior` es NULL en la entrada que crea el pedido; `id_cliente` es
+-- NULL cuando el cambio lo hizo el sistema (p. ej. la pasarela de pago) y
+-- `responsable` conserva el nombre aunque el cliente se elimine.
+CREATE TABLE `pedido_estados` (
+  `id_pedido_estado` int NOT NULL AUTO_INCREMENT,
+  `id_pedido` int NOT NULL,
+  `estado_anterior` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') DEFAULT NULL,
+  `estado_nuevo` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') NOT NULL,
+  `id_cliente` int DEFAULT NULL,
+  `responsable` varchar(150) NOT NULL,
+  `motivo` varchar(255) DEFAULT NULL,
+  `fecha` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_pedido_estado`),
+  KEY `id_pedido` (`id_pedido`),
+  KEY `id_cliente` (`id_cliente`),
+  CONSTRAINT `pedido_estados_ibfk_1` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE,
+  CONSTRAINT `pedido_estados_ibfk_2` FOREIGN KEY (`id_cliente`) REFERENCES `clientes` (`id_cliente`) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Sin modo estricto, un estado inválido se guardaba como '' (el valor de
+-- error del enum). Esos pedidos, y los que no tienen estado, vuelven a
+-- PENDIENTE para que la máquina de estados los pueda manejar.
+UPDATE `pedidos` SET `estado` = 'PENDIENTE' WHERE `estado` IS NULL OR `estado` = '';
+
+-- Los pedidos existentes empiezan el historial con su estado actual.
+INSERT INTO `pedido_estados` (`id_pedido`, `estado_nuevo`, `responsable`, `motivo`, `fecha`)
+  SELECT `id_pedido`, `estado`, 'Sistema', 'Estado previo al historial', `fecha` FROM `pedidos`;
+
+ALTER TABLE `pedidos`
+  MODIFY `estado` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') NOT NULL DEFAULT 'PENDIENTE';
@@ -0,0 +1 @@
+ALTER TABLE `pedidos` DROP COLUMN `reembolsado`;
@@ -0,0 +1,4 @@
+-- Monto del pedido ya devuelto al cliente a través de la pasarela. Una
+-- cancelación devuelve lo que queda por reembolsar.
+ALTER TABLE `pedidos`
+  ADD COLUMN `reembolsado` decimal(10,2) NOT NULL DEFAULT 0.00 AFTER `total`;
@@ -0,0 +1,3 @@
+DROP TABLE `creditos_clientes`;
+DROP TABLE `detalles_devolucion`;
+DROP TABLE `devoluciones`;
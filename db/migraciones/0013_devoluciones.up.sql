@@ -0,0 +1,48 @@
+-- Devoluciones de pedidos entregados. El cliente elige las unidades de cada
+-- línea y el motivo; un administrador la aprueba o rechaza, la recibe y la
+-- resuelve con un reembolso o con crédito. `monto` es lo que se devuelve: lo
+-- pagado por esas unidades, con los descuentos ya restados.
+CREATE TABLE `devoluciones` (
+  `id_devolucion` int NOT NULL AUTO_INCREMENT,
+  `id_pedido` int NOT NULL,
+  `estado` enum('SOLICITADA','APROBADA','RECHAZADA','RECIBIDA','REEMBOLSADA','ACREDITADA') NOT NULL DEFAULT 'SOLICITADA',
+  `motivo` varchar(255) NOT NULL,
+  `nota` varchar(255) DEFAULT NULL,
+  `monto` decimal(10,2) NOT NULL,
+  `fecha_solicitud` datetime DEFAULT CURRENT_TIMESTAMP,
+  `fecha_actualizacion` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_devolucion`),
+  KEY `id_pedido` (`id_pedido`),
+  CONSTRAINT `devoluciones_ibfk_1` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Unidades devueltas de cada línea del pedido. `reponer_stock` indica si al
+-- recibirlas volvieron al stock.
+CREATE TABLE `detalles_devolucion` (
+  `id_detalle_devolucion` int NOT NULL AUTO_INCREMENT,
+  `id_devolucion` int NOT NULL,
+  `id_detalle` int NOT NULL,
+  `cantidad` int NOT NULL,
+  `monto` decimal(10,2) NOT NULL,
+  `reponer_stock` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id_detalle_devolucion`),
+  UNIQUE KEY `devolucion_detalle` (`id_devolucion`, `id_detalle`),
+  KEY `id_detalle` (`id_detalle`),
+  CONSTRAINT `detalles_devolucion_ibfk_1` FOREIGN KEY (`id_devolucion`) REFERENCES `devoluciones` (`id_devolucion`) ON DELETE CASCADE,
+  CONSTRAINT `detalles_devolucion_ibfk_2` FOREIGN KEY (`id_detalle`) REFERENCES `detalles_pedido` (`id_detalle`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Movimientos del crédito a favor de cada cliente; el saldo es la suma.
+CREATE TABLE `creditos_clientes` (
+  `id_credito` int NOT NULL AUTO_INCREMENT,
+  `id_cliente` int NOT NULL,
+  `monto` decimal(10,2) NOT NULL,
+  `concepto` varchar(255) NOT NULL,
+  `id_devolucion` int DEFAULT NULL,
+  `fecha` datetime DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_credito`),
+  KEY `id_cliente` (`id_cliente`),
+  KEY `id_devolucion` (`id_devolucion`),
+  CONSTRAINT `creditos_clientes_ibfk_1` FOREIGN KEY (`id_cliente`) REFERENCES `clientes` (`id_cliente`) ON DELETE CASCADE,
+  CONSTRAINT `creditos_clientes_ibfk_2` FOREIGN KEY (`id_devolucion`) REFERENCES `devoluciones` (`id_devolucion`) ON DELETE SET NULL
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,8 @@
+ALTER TABLE `pedidos` DROP FOREIGN KEY `pedidos_ibfk_3`;
+ALTER TABLE `pedidos` DROP KEY `id_metodo_envio`, DROP COLUMN `envio_telefono`, DROP COLUMN `envio_provincia`, DROP COLUMN `envio_direccion`, DROP COLUMN `envio_destinatario`, DROP COLUMN `costo_envio`, DROP COLUMN `metodo_envio`, DROP COLUMN `id_metodo_envio`;
+ALTER TABLE `productos` DROP CHECK `productos_chk_3`;
+ALTER TABLE `productos` DROP COLUMN `peso`;
+DROP TABLE `tarifas_envio`;
+DROP TABLE `metodos_envio`;
+DROP TABLE `zona_provincias`;
+DROP TABLE `zonas_envio`;
@@ -0,0 +1,65 @@
+-- Métodos de envío, zonas y tarifas. Una zona agrupa provincias; cada
+-- provincia pertenece como mucho a una zona. Las tarifas de un método dicen
+-- cuánto cuesta el envío a una zona (o a todas, con `id_zona` NULL), hasta un
+-- peso y desde un importe de compra; `gratis_desde` hace el envío gratis a
+-- partir de ese importe.
+CREATE TABLE `zonas_envio` (
+  `id_zona` int NOT NULL AUTO_INCREMENT,
+  `nombre` varchar(100) NOT NULL,
+  PRIMARY KEY (`id_zona`),
+  UNIQUE KEY `nombre` (`nombre`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `zona_provincias` (
+  `id_zona` int NOT NULL,
+  `provincia` varchar(100) NOT NULL,
+  PRIMARY KEY (`provincia`),
+  KEY `id_zona` (`id_zona`),
+  CONSTRAINT `zona_provincias_ibfk_1` FOREIGN KEY (`id_zona`) REFERENCES `zonas_envio` (`id_zona`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `metodos_envio` (
+  `id_metodo` int NOT NULL AUTO_INCREMENT,
+  `nombre` varchar(100) NOT NULL,
+  `tipo` enum('RETIRO','ESTANDAR','EXPRESS') NOT NULL,
+  `descripcion` varchar(255) DEFAULT NULL,
+  `gratis_desde` decimal(10,2) DEFAULT NULL,
+  `activo` tinyint(1) NOT NULL DEFAULT '1',
+  PRIMARY KEY (`id_metodo`),
+  CONSTRAINT `metodos_envio_chk_1` CHECK (((`gratis_desde` IS NULL) OR (`gratis_desde` > 0)))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+CREATE TABLE `tarifas_envio` (
+  `id_tarifa` int NOT NULL AUTO_INCREMENT,
+  `id_metodo` int NOT NULL,
+  `id_zona` int DEFAULT NULL,
+  `peso_hasta` decimal(8,3) DEFAULT NULL,
+  `importe_desde` decimal(10,2) NOT NULL DEFAULT '0.00',
+  `costo` decimal(10,2) NOT NULL,
+  PRIMARY KEY (`id_tarifa`),
+  KEY `id_metodo` (`id_metodo`),
+  KEY `id_zona` (`id_zona`),
+  CONSTRAINT `tarifas_envio_ibfk_1` FOREIGN KEY (`id_metodo`) REFERENCES `metodos_envio` (`id_metodo`) ON DELETE CASCADE,
+  CONSTRAINT `tarifas_envio_ibfk_2` FOREIGN KEY (`id_zona`) REFERENCES `zonas_envio` (`id_zona`) ON DELETE CASCADE,
+  CONSTRAINT `tarifas_envio_chk_1` CHECK ((`costo` >= 0)),
+  CONSTRAINT `tarifas_envio_chk_2` CHECK ((`importe_desde` >= 0))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Peso de cada producto en kg, para las tarifas por peso.
+ALTER TABLE `productos`
+  ADD COLUMN `peso` decimal(8,3) NOT NULL DEFAULT '0.000' AFTER `stock`,
+  ADD CONSTRAINT `productos_chk_3` CHECK ((`peso` >= 0));
+
+-- El pedido guarda el método elegido (su nombre sobrevive al borrado), el
+-- costo del envío, que ya está sumado en `total`, y una copia de la dirección
+-- de entrega, para que editar el perfil no cambie pedidos pasados.
+ALTER TABLE `pedidos`
+  ADD COLUMN `id_metodo_envio` int DEFAULT NULL AFTER `codigo_cupon`,
+  ADD COLUMN `metodo_envio` varchar(100) DEFAULT NULL AFTER `id_metodo_envio`,
+  ADD COLUMN `costo_envio` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `metodo_envio`,
+  ADD COLUMN `envio_destinatario` varchar(100) DEFAULT NULL AFTER `costo_envio`,
+  ADD COLUMN `envio_direccion` varchar(255) DEFAULT NULL AFTER `envio_destinatario`,
+  ADD COLUMN `envio_provincia` varchar(100) DEFAULT NULL AFTER `envio_direccion`,
+  ADD COLUMN `envio_telefono` varchar(20) DEFAULT NULL AFTER `envio_provincia`,
+  ADD KEY `id_metodo_envio` (`id_metodo_envio`),
+  ADD CONSTRAINT `pedidos_ibfk_3` FOREIGN KEY (`id_metodo_envio`) REFERENCES `metodos_envio` (`id_metodo`) ON DELETE SET NULL;
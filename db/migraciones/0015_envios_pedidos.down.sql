@@ -0,0 +1,12 @@
+-- Los pedidos despachados en parte vuelven a PAGADO, y su historial pierde
+-- las entradas de ese estado.
+UPDATE `pedidos` SET `estado` = 'PAGADO' WHERE `estado` = 'ENVIADO_PARCIAL';
+DELETE FROM `pedido_estados` WHERE `estado_nuevo` = 'ENVIADO_PARCIAL';
+UPDATE `pedido_estados` SET `estado_anterior` = 'PAGADO' WHERE `estado_anterior` = 'ENVIADO_PARCIAL';
+ALTER TABLE `pedido_estados`
+  MODIFY `estado_anterior` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') DEFAULT NULL,
+  MODIFY `estado_nuevo` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') NOT NULL;
+ALTER TABLE `pedidos`
+  MODIFY `estado` enum('PENDIENTE','PAGADO','ENVIADO','ENTREGADO','CANCELADO') NOT NULL DEFAULT 'PENDIENTE';
+DROP TABLE `detalles_envio`;
+DROP TABLE `envios`;
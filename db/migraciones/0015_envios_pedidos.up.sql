@@ -0,0 +1,47 @@
+-- Envíos de cada pedido: un pedido puede despacharse en varios paquetes, cada
+-- uno con su transportista, número de seguimiento y fechas. `fecha_entrega`
+-- es NULL hasta que el paquete se entrega.
+CREATE TABLE `envios` (
+  `id_envio` int NOT NULL AUTO_INCREMENT,
+  `id_pedido` int NOT NULL,
+  `transportista` varchar(100) NOT NULL,
+  `numero_seguimiento` varchar(100) DEFAULT NULL,
+  `fecha_envio` datetime NOT NULL,
+  `entrega_estimada` date DEFAULT NULL,
+  `fecha_entrega` datetime DEFAULT NULL,
+  PRIMARY KEY (`id_envio`),
+  KEY `id_pedido` (`id_pedido`),
+  CONSTRAINT `envios_ibfk_1` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- Unidades de cada línea del pedido que van en cada envío.
+CREATE TABLE `detalles_envio` (
+  `id_envio` int NOT NULL,
+  `id_detalle` int NOT NULL,
+  `cantidad` int NOT NULL,
+  PRIMARY KEY (`id_envio`, `id_detalle`),
+  KEY `id_detalle` (`id_detalle`),
+  CONSTRAINT `detalles_envio_ibfk_1` FOREIGN KEY (`id_envio`) REFERENCES `envios` (`id_envio`) ON DELETE CASCADE,
+  CONSTRAINT `detalles_envio_ibfk_2` FOREIGN KEY (`id_detalle`) REFERENCES `detalles_pedido` (`id_detalle`) ON DELETE CASCADE,
+  CONSTRAINT `detalles_envio_chk_1` CHECK (`cantidad` > 0)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+-- ENVIADO_PARCIAL: se despachó una parte de las unidades.
+ALTER TABLE `pedidos`
+  MODIFY `estado` enum('PENDIENTE','PAGADO','ENVIADO_PARCIAL','ENVIADO','ENTREGADO','CANCELADO') NOT NULL DEFAULT 'PENDIENTE';
+ALTER TABLE `pedido_estados`
+  MODIFY `estado_anterior` enum('PENDIENTE','PAGADO','ENVIADO_PARCIAL','ENVIADO','ENTREGADO','CANCELADO') DEFAULT NULL,
+  MODIFY `estado_nuevo` enum('PENDIENTE','PAGADO','ENVIADO_PARCIAL','ENVIADO','ENTREGADO','CANCELADO') NOT NULL;
+
+-- Los pedidos ya enviados o entregados reciben un envío con todas sus
+-- unidades y las fechas de su historial, para que su estado siga
+-- correspondiendo a sus envíos.
+INSERT INTO `envios` (`id_pedido`, `transportista`, `fecha_envio`, `fecha_entrega`)
+  SELECT p.`id_pedido`, 'Sin registrar',
+    COALESCE((SELECT MIN(e.`fecha`) FROM `pedido_estados` e WHERE e.`id_pedido` = p.`id_pedido` AND e.`estado_nuevo` = 'ENVIADO'), p.`fecha`, CURRENT_TIMESTAMP),
+    CASE WHEN p.`estado` = 'ENTREGADO' THEN
+      COALESCE((SELECT MIN(e.`fecha`) FROM `pedido_estados` e WHERE e.`id_pedido` = p.`id_pedido` AND e.`estado_nuevo` = 'ENTREGADO'), p.`fecha`, CURRENT_TIMESTAMP)
+    END
+  FROM `pedidos` p WHERE p.`estado` IN ('ENVIADO', 'ENTREGADO');
+INSERT INTO `detalles_envio` (`id_envio`, `id_detalle`, `cantidad`)
+  SELECT e.`id_envio`, d.`id_detalle`, d.`cantidad` FROM `envios` e JOIN `detalles_pedido` d ON d.`id_pedido` = e.`id_pedido` WHERE d.`cantidad` > 0;
@@ -0,0 +1,5 @@
+ALTER TABLE `detalles_pedido` DROP COLUMN `impuesto`, DROP COLUMN `impuesto_exento`, DROP COLUMN `impuesto_tasa`, DROP COLUMN `impuesto_nombre`;
+ALTER TABLE `pedidos` DROP COLUMN `impuestos_incluidos`, DROP COLUMN `impuestos`;
+ALTER TABLE `productos` DROP FOREIGN KEY `productos_ibfk_1`;
+ALTER TABLE `productos` DROP KEY `id_clase_impuesto`, DROP COLUMN `id_clase_impuesto`;
+DROP TABLE `clases_impuesto`;
@@ -0,0 +1,38 @@
+-- Clases de impuesto (IVA general, reducido, exento...). Los productos sin
+-- clase usan la predeterminada; si no hay ninguna, no pagan impuestos. Una
+-- clase exenta tiene tasa 0 y se informa aparte de las de tasa 0.
+CREATE TABLE `clases_impuesto` (
+  `id_clase` int NOT NULL AUTO_INCREMENT,
+  `nombre` varchar(100) NOT NULL,
+  `tasa` decimal(5,2) NOT NULL DEFAULT '0.00',
+  `exenta` tinyint(1) NOT NULL DEFAULT '0',
+  `predeterminada` tinyint(1) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`id_clase`),
+  UNIQUE KEY `nombre` (`nombre`),
+  CONSTRAINT `clases_impuesto_chk_1` CHECK (((`tasa` >= 0) AND (`tasa` <= 100))),
+  CONSTRAINT `clases_impuesto_chk_2` CHECK (((`exenta` = 0) OR (`tasa` = 0)))
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
+
+INSERT INTO `clases_impuesto` (`nombre`, `tasa`, `exenta`, `predeterminada`) VALUES
+  ('IVA 21%', 21.00, 0, 1),
+  ('IVA 10,5%', 10.50, 0, 0),
+  ('Exento', 0.00, 1, 0);
+
+ALTER TABLE `productos`
+  ADD COLUMN `id_clase_impuesto` int DEFAULT NULL AFTER `peso`,
+  ADD KEY `id_clase_impuesto` (`id_clase_impuesto`),
+  ADD CONSTRAINT `productos_ibfk_1` FOREIGN KEY (`id_clase_impuesto`) REFERENCES `clases_impuesto` (`id_clase`) ON DELETE SET NULL;
+
+-- El pedido guarda el impuesto total y si los precios lo incluían: si no lo
+-- incluían, ya está sumado en `total`. Cada línea guarda una copia de la
+-- clase aplicada y su impuesto, calculado sobre lo que se cobró por ella.
+-- Los pedidos anteriores quedan sin impuestos.
+ALTER TABLE `pedidos`
+  ADD COLUMN `impuestos` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `costo_envio`,
+  ADD COLUMN `impuestos_incluidos` tinyint(1) NOT NULL DEFAULT '1' AFTER `impuestos`;
+
+ALTER TABLE `detalles_pedido`
+  ADD COLUMN `impuesto_nombre` varchar(100) DEFAULT NULL AFTER `descuento`,
+  ADD COLUMN `impuesto_tasa` decimal(5,2) NOT NULL DEFAULT '0.00' AFTER `impuesto_nombre`,
+  ADD COLUMN `impuesto_exento` tinyint(1) NOT NULL DEFAULT '0' AFTER `impuesto_tasa`,
+  ADD COLUMN `impuesto` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `impuesto_exento`;
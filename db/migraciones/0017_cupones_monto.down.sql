@@ -0,0 +1,9 @@
+ALTER TABLE `cupones` DROP CHECK `cupones_chk_4`;
+ALTER TABLE `cupones` ADD COLUMN `valor` decimal(10,2) NOT NULL DEFAULT '0.00' AFTER `tipo`;
+UPDATE `cupones` SET `valor` = COALESCE(`porcentaje`, `monto`);
+ALTER TABLE `cupones`
+  ALTER COLUMN `valor` DROP DEFAULT,
+  DROP COLUMN `monto`,
+  DROP COLUMN `porcentaje`,
+  ADD CONSTRAINT `cupones_chk_1` CHECK ((`valor` > 0)),
+  ADD CONSTRAINT `cupones_chk_2` CHECK (((`tipo` <> 'PORCENTAJE') OR (`valor` <= 100)));
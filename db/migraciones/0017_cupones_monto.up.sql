@@ -0,0 +1,16 @@
+-- El valor del cupón se separa según su tipo: `porcentaje` para los de
+-- PORCENTAJE y `monto`, exacto en centavos, para los de MONTO. La otra
+-- columna queda en NULL.
+ALTER TABLE `cupones`
+  ADD COLUMN `porcentaje` decimal(5,2) DEFAULT NULL AFTER `tipo`,
+  ADD COLUMN `monto` decimal(10,2) DEFAULT NULL AFTER `porcentaje`;
+
+UPDATE `cupones` SET
+  `porcentaje` = IF(`tipo` = 'PORCENTAJE', `valor`, NULL),
+  `monto` = IF(`tipo` = 'MONTO', `valor`, NULL);
+
+ALTER TABLE `cupones` DROP CHECK `cupones_chk_1`, DROP CHECK `cupones_chk_2`;
+ALTER TABLE `cupones`
+  DROP COLUMN `valor`,
+  ADD CONSTRAINT `cupones_chk_4` CHECK (((`tipo` = 'PORCENTAJE') AND (`porcentaje` > 0) AND (`porcentaje` <= 100) AND (`monto` IS NULL))
+    OR ((`tipo` = 'MONTO') AND (`monto` > 0) AND (`porcentaje` IS NULL)));
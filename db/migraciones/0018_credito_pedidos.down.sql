@@ -0,0 +1,3 @@
+ALTER TABLE `creditos_clientes` DROP FOREIGN KEY `creditos_clientes_ibfk_3`;
+ALTER TABLE `creditos_clientes` DROP KEY `id_pedido`, DROP COLUMN `id_pedido`;
+ALTER TABLE `pedidos` DROP COLUMN `credito`;
@@ -0,0 +1,11 @@
+-- Crédito a favor usado para pagar el pedido. Ya está restado de lo que se
+-- cobra por la pasarela, pero no de `total`. Cada uso descuenta el saldo
+-- con un movimiento negativo en `creditos_clientes`, y cancelar el pedido
+-- lo devuelve con otro positivo.
+ALTER TABLE `pedidos`
+  ADD COLUMN `credito` decimal(10,2) NOT NULL DEFAULT 0.00 AFTER `total`;
+
+ALTER TABLE `creditos_clientes`
+  ADD COLUMN `id_pedido` int DEFAULT NULL AFTER `id_devolucion`,
+  ADD KEY `id_pedido` (`id_pedido`),
+  ADD CONSTRAINT `creditos_clientes_ibfk_3` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE SET NULL;
@@ -0,0 +1,25 @@
+-- Reembolsos y anulaciones que hay que pedir a la pasarela. Se registran
+-- PENDIENTES en la misma transacción que el cambio que los origina (la
+-- cancelación de un pedido o una devolución reembolsada) y se piden a la
+-- pasarela después de confirmarla; cuando responde bien pasan a HECHO y, si
+-- falla, `error` guarda el motivo y se reintentan. Cada fila es una clave de
+-- idempotencia para la pasarela, así que reintentar no devuelve dos veces.
+-- `pedidos.reembolsado` ya incluye los reembolsos pendientes.
+CREATE TABLE `reembolsos` (
+  `id_reembolso` int NOT NULL AUTO_INCREMENT,
+  `id_pedido` int NOT NULL,
+  `id_devolucion` int DEFAULT NULL,
+  `operacion` enum('REEMBOLSO','ANULACION') NOT NULL,
+  `transaccion_id` varchar(100) NOT NULL,
+  `monto` decimal(10,2) NOT NULL DEFAULT 0.00,
+  `estado` enum('PENDIENTE','HECHO') NOT NULL DEFAULT 'PENDIENTE',
+  `error` text,
+  `fecha_creacion` datetime DEFAULT CURRENT_TIMESTAMP,
+  `fecha_actualizacion` datetime DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (`id_reembolso`),
+  UNIQUE KEY `id_devolucion` (`id_devolucion`),
+  KEY `pedido_estado` (`id_pedido`, `estado`),
+  KEY `estado` (`estado`),
+  CONSTRAINT `reembolsos_ibfk_1` FOREIGN KEY (`id_pedido`) REFERENCES `pedidos` (`id_pedido`) ON DELETE CASCADE,
+  CONSTRAINT `reembolsos_ibfk_2` FOREIGN KEY (`id_devolucion`) REFERENCES `devoluciones` (`id_devolucion`) ON DELETE CASCADE
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_0900_ai_ci;
@@ -0,0 +1,322 @@
+// Package migraciones versiona el esquema de la base de datos. Cada cambio es
+// un par de archivos `NNNN_nombre.up.sql` / `NNNN_nombre.down.sql` embebidos
+// en el binario; las versiones aplicadas se registran en `schema_migrations`.
+package migraciones
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed *.sql
+var archivos embed.FS
+
+// nombreLock es el nombre del lock de MySQL que impide que dos instancias
+// migren a la vez.
+const nombreLock = "ecommerce_schema_migrations"
+
+// esperaLock es cuánto se espera a que otra instancia libere el lock.
+const esperaLock = 60 * time.Second
+
+var patronArchivo = regexp.MustCompile(`^(\d+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+// Migracion es una versión del esquema con sus scripts de subida y bajada.
+type Migracion struct {
+	Version  int
+	Nombre   string
+	Up       string
+	Down     string
+	Checksum string // SHA-256 del script de subida
+}
+
+// Estado describe una migración conocida y si está aplicada en la base.
+type Estado struct {
+	Migracion
+	Aplicada        bool
+	FechaAplicacion time.Time
+	// Modificada indica que el script embebido ya no coincide con el que se aplicó.
+	Modificada bool
+}
+
+// Cargar lee y valida las migraciones embebidas, ordenadas por versión.
+func Cargar() ([]Migracion, error) {
+	return cargarDesde(archivos)
+}
+
+func cargarDesde(fsys fs.FS) ([]Migracion, error) {
+	entradas, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	porVersion := map[int]*Migracion{}
+	for _, e := range entradas {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), ".sql") {
+			continue
+		}
+		partes := patronArchivo.FindStringSubmatch(e.Name())
+		if partes == nil {
+			return nil, fmt.Errorf("nombre de migración inválido: %s", e.Name())
+		}
+		version, _ := strconv.Atoi(partes[1])
+		contenido, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := porVersion[version]
+		if !ok {
+			m = &Migracion{Version: version, Nombre: partes[2]}
+			porVersion[version] = m
+		} else if m.Nombre != partes[2] {
+			return nil, fmt.Errorf("versión %d duplicada: %s y %s", version, m.Nombre, partes[2])
+		}
+		if partes[3] == "up" {
+			m.Up = string(contenido)
+			suma := sha256.Sum256(contenido)
+			m.Checksum = hex.EncodeToString(suma[:])
+		} else {
+			m.Down = string(contenido)
+		}
+	}
+
+	migraciones := make([]Migracion, 0, len(porVersion))
+	for _, m := range porVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("la migración %04d_%s necesita archivos up y down", m.Version, m.Nombre)
+		}
+		migraciones = append(migraciones, *m)
+	}
+	sort.Slice(migraciones, func(i, j int) bool { return migraciones[i].Version < migraciones[j].Version })
+	return migraciones, nil
+}
+
+// Migrador aplica y revierte migraciones sobre una base de datos.
+type Migrador struct {
+	db          *sql.DB
+	migraciones []Migracion
+}
+
+// New crea un migrador con las migraciones embebidas en el binario.
+func New(db *sql.DB) (*Migrador, error) {
+	migraciones, err := Cargar()
+	if err != nil {
+		return nil, err
+	}
+	return &Migrador{db: db, migraciones: migraciones}, nil
+}
+
+// aplicada es una fila de `schema_migrations`.
+type aplicada struct {
+	checksum string
+	fecha    time.Time
+}
+
+// conLock ejecuta fn sobre una conexión dedicada que tiene tomado el lock de
+// migraciones. GET_LOCK es por conexión, por eso no se usa el pool directamente.
+func (m *Migrador) conLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var obtenido sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", nombreLock, int(esperaLock/time.Second)).Scan(&obtenido); err != nil {
+		return fmt.Errorf("error obteniendo lock de migraciones: %w", err)
+	}
+	if obtenido.Int64 != 1 {
+		return fmt.Errorf("otra instancia está migrando la base de datos (lock %q ocupado)", nombreLock)
+	}
+	defer conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", nombreLock)
+
+	if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version int NOT NULL,
+		nombre varchar(150) NOT NULL,
+		checksum char(64) NOT NULL,
+		fecha_aplicacion datetime DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (version)
+	) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4`); err != nil {
+		return fmt.Errorf("error creando schema_migrations: %w", err)
+	}
+
+	return fn(conn)
+}
+
+// leerAplicadas devuelve las versiones registradas en `schema_migrations`.
+func leerAplicadas(conn *sql.Conn) (map[int]aplicada, error) {
+	rows, err := conn.QueryContext(context.Background(), "SELECT version, checksum, fecha_aplicacion FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aplicadas := map[int]aplicada{}
+	for rows.Next() {
+		var version int
+		var a aplicada
+		var fecha sql.NullTime
+		if err := rows.Scan(&version, &a.checksum, &fecha); err != nil {
+			return nil, err
+		}
+		a.fecha = fecha.Time
+		aplicadas[version] = a
+	}
+	return aplicadas, rows.Err()
+}
+
+// verificar comprueba que las migraciones aplicadas no hayan cambiado y que la
+// base no tenga versiones desconocidas para este binario.
+func (m *Migrador) verificar(aplicadas map[int]aplicada) error {
+	conocidas := map[int]bool{}
+	for _, mig := range m.migraciones {
+		conocidas[mig.Version] = true
+		if a, ok := aplicadas[mig.Version]; ok && a.checksum != mig.Checksum {
+			return fmt.Errorf("la migración %04d_%s fue modificada después de aplicarse (checksum distinto)", mig.Version, mig.Nombre)
+		}
+	}
+	for version := range aplicadas {
+		if !conocidas[version] {
+			return fmt.Errorf("la base tiene aplicada la versión %04d, que este binario no conoce", version)
+		}
+	}
+	return nil
+}
+
+// Up aplica hasta `n` migraciones pendientes en orden (todas si n <= 0) y
+// devuelve cuántas se aplicaron.
+func (m *Migrador) Up(n int) (int, error) {
+	aplicadasAhora := 0
+	err := m.conLock(func(conn *sql.Conn) error {
+		aplicadas, err := leerAplicadas(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verificar(aplicadas); err != nil {
+			return err
+		}
+
+		for _, mig := range m.migraciones {
+			if _, ok := aplicadas[mig.Version]; ok {
+				continue
+			}
+			if n > 0 && aplicadasAhora >= n {
+				break
+			}
+			log.Printf("Aplicando migración %04d_%s", mig.Version, mig.Nombre)
+			if err := ejecutarScript(conn, mig.Up); err != nil {
+				return fmt.Errorf("migración %04d_%s: %w", mig.Version, mig.Nombre, err)
+			}
+			if _, err := conn.ExecContext(context.Background(), "INSERT INTO schema_migrations (version, nombre, checksum) VALUES (?, ?, ?)", mig.Version, mig.Nombre, mig.Checksum); err != nil {
+				return fmt.Errorf("error registrando migración %04d: %w", mig.Version, err)
+			}
+			aplicadasAhora++
+		}
+		return nil
+	})
+	return aplicadasAhora, err
+}
+
+// Down revierte las últimas `n` migraciones aplicadas (como mínimo una) y
+// devuelve cuántas se revirtieron.
+func (m *Migrador) Down(n int) (int, error) {
+	if n <= 0 {
+		n = 1
+	}
+	revertidas := 0
+	err := m.conLock(func(conn *sql.Conn) error {
+		aplicadas, err := leerAplicadas(conn)
+		if err != nil {
+			return err
+		}
+		if err := m.verificar(aplicadas); err != nil {
+			return err
+		}
+
+		for i := len(m.migraciones) - 1; i >= 0 && revertidas < n; i-- {
+			mig := m.migraciones[i]
+			if _, ok := aplicadas[mig.Version]; !ok {
+				continue
+			}
+			log.Printf("Revirtiendo migración %04d_%s", mig.Version, mig.Nombre)
+			if err := ejecutarScript(conn, mig.Down); err != nil {
+				return fmt.Errorf("migración %04d_%s: %w", mig.Version, mig.Nombre, err)
+			}
+			if _, err := conn.ExecContext(context.Background(), "DELETE FROM schema_migrations WHERE version = ?", mig.Version); err != nil {
+				return fmt.Errorf("error desregistrando migración %04d: %w", mig.Version, err)
+			}
+			revertidas++
+		}
+		return nil
+	})
+	return revertidas, err
+}
+
+// Status devuelve el estado de cada migración conocida.
+func (m *Migrador) Status() ([]Estado, error) {
+	var estados []Estado
+	err := m.conLock(func(conn *sql.Conn) error {
+		aplicadas, err := leerAplicadas(conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migraciones {
+			e := Estado{Migracion: mig}
+			if a, ok := aplicadas[mig.Version]; ok {
+				e.Aplicada = true
+				e.FechaAplicacion = a.fecha
+				e.Modificada = a.checksum != mig.Checksum
+			}
+			estados = append(estados, e)
+		}
+		return nil
+	})
+	return estados, err
+}
+
+// ejecutarScript ejecuta las sentencias de un archivo de migración una a una.
+// MySQL no admite DDL transaccional: si una sentencia falla, las anteriores
+// quedan aplicadas y la versión no se registra.
+func ejecutarScript(conn *sql.Conn, script string) error {
+	for _, sentencia := range dividirSentencias(script) {
+		if _, err := conn.ExecContext(context.Background(), sentencia); err != nil {
+			return fmt.Errorf("%w\n%s", err, sentencia)
+		}
+	}
+	return nil
+}
+
+// dividirSentencias separa un script en sentencias terminadas en `;` al final
+// de línea, descartando líneas de comentario `--`.
+func dividirSentencias(script string) []string {
+	var sentencias []string
+	var actual strings.Builder
+	for _, linea := range strings.Split(script, "\n") {
+		recortada := strings.TrimSpace(linea)
+		if recortada == "" || strings.HasPrefix(recortada, "--") {
+			continue
+		}
+		actual.WriteString(linea)
+		actual.WriteString("\n")
+		if strings.HasSuffix(recortada, ";") {
+			sentencias = append(sentencias, strings.TrimSuffix(strings.TrimSpace(actual.String()), ";"))
+			actual.Reset()
+		}
+	}
+	if resto := strings.TrimSpace(actual.String()); resto != "" {
+		sentencias = append(sentencias, resto)
+	}
+	return sentencias
+}
@@ -0,0 +1,133 @@
+package migraciones
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDividirSentencias(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		script   string
+		esperado []string
+	}{
+		{
+			"descarta comentarios y líneas vacías",
+			"-- Tabla de prueba\n\nCREATE TABLE a (id int);\n  -- comentario con sangría\nDROP TABLE b;\n",
+			[]string{"CREATE TABLE a (id int)", "DROP TABLE b"},
+		},
+		{
+			"una sentencia en varias líneas",
+			"CREATE TABLE a (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n);",
+			[]string{"CREATE TABLE a (\n  `id` int NOT NULL,\n  PRIMARY KEY (`id`)\n)"},
+		},
+		{
+			"solo corta en el ; del final de la línea",
+			"INSERT INTO t VALUES ('a;b');\nSELECT 1; SELECT 2\n;",
+			[]string{"INSERT INTO t VALUES ('a;b')", "SELECT 1; SELECT 2\n"},
+		},
+		{
+			"espacios y fin de línea de Windows después del ;",
+			"SELECT 1;   \r\nSELECT 2;\r\n",
+			[]string{"SELECT 1", "SELECT 2"},
+		},
+		{
+			"la última sentencia sin ;",
+			"SELECT 1;\nSELECT 2\n",
+			[]string{"SELECT 1", "SELECT 2"},
+		},
+		{"solo comentarios", "-- nada\n-- que hacer\n", nil},
+		{"vacío", "", nil},
+	}
+	for _, c := range casos {
+		if got := dividirSentencias(c.script); !reflect.DeepEqual(got, c.esperado) {
+			t.Errorf("%s: dividirSentencias = %q; se esperaba %q", c.nombre, got, c.esperado)
+		}
+	}
+}
+
+func TestCargarDesde(t *testing.T) {
+	up := "CREATE TABLE b (id int);\n"
+	migraciones, err := cargarDesde(fstest.MapFS{
+		"0002_tabla_b.up.sql":   {Data: []byte(up)},
+		"0002_tabla_b.down.sql": {Data: []byte("DROP TABLE b;\n")},
+		"0001_tabla_a.up.sql":   {Data: []byte("CREATE TABLE a (id int);\n")},
+		"0001_tabla_a.down.sql": {Data: []byte("DROP TABLE a;\n")},
+		"LEEME.md":              {Data: []byte("no es una migración")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migraciones) != 2 || migraciones[0].Version != 1 || migraciones[1].Version != 2 {
+		t.Fatalf("migraciones = %+v", migraciones)
+	}
+	b := migraciones[1]
+	suma := sha256.Sum256([]byte(up))
+	if b.Nombre != "tabla_b" || b.Up != up || b.Down != "DROP TABLE b;\n" || b.Checksum != hex.EncodeToString(suma[:]) {
+		t.Errorf("migración 2 = %+v", b)
+	}
+
+	invalidos := []struct {
+		nombre string
+		fsys   fstest.MapFS
+	}{
+		{"sin down", fstest.MapFS{"0001_a.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"sin up", fstest.MapFS{"0001_a.down.sql": {Data: []byte("SELECT 1;")}}},
+		{"nombre inválido", fstest.MapFS{"1-a.up.sql": {Data: []byte("SELECT 1;")}}},
+		{"versión duplicada", fstest.MapFS{
+			"0001_a.up.sql": {Data: []byte("SELECT 1;")}, "0001_a.down.sql": {Data: []byte("SELECT 1;")},
+			"0001_b.up.sql": {Data: []byte("SELECT 1;")}, "0001_b.down.sql": {Data: []byte("SELECT 1;")},
+		}},
+	}
+	for _, c := range invalidos {
+		if _, err := cargarDesde(c.fsys); err == nil {
+			t.Errorf("%s: se esperaba un error", c.nombre)
+		}
+	}
+}
+
+func TestCargarMigracionesEmbebidas(t *testing.T) {
+	migraciones, err := Cargar()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migraciones {
+		if m.Version != i+1 {
+			t.Errorf("la migración %04d_%s está en el lugar %d: las versiones deben ser consecutivas", m.Version, m.Nombre, i+1)
+		}
+		if len(dividirSentencias(m.Up)) == 0 || len(dividirSentencias(m.Down)) == 0 {
+			t.Errorf("la migración %04d_%s tiene un script sin sentencias", m.Version, m.Nombre)
+		}
+	}
+}
+
+func TestVerificar(t *testing.T) {
+	m := &Migrador{migraciones: []Migracion{
+		{Version: 1, Nombre: "a", Checksum: "aaa"},
+		{Version: 2, Nombre: "b", Checksum: "bbb"},
+	}}
+	casos := []struct {
+		nombre    string
+		aplicadas map[int]aplicada
+		error     string
+	}{
+		{"nada aplicado", map[int]aplicada{}, ""},
+		{"pendiente la última", map[int]aplicada{1: {checksum: "aaa"}}, ""},
+		{"todo aplicado", map[int]aplicada{1: {checksum: "aaa"}, 2: {checksum: "bbb"}}, ""},
+		{"script modificado", map[int]aplicada{1: {checksum: "aaa"}, 2: {checksum: "otro"}}, "0002_b fue modificada después de aplicarse (checksum distinto)"},
+		{"versión desconocida", map[int]aplicada{1: {checksum: "aaa"}, 3: {checksum: "ccc"}}, "versión 0003, que este binario no conoce"},
+	}
+	for _, c := range casos {
+		err := m.verificar(c.aplicadas)
+		switch {
+		case c.error == "" && err != nil:
+			t.Errorf("%s: %v", c.nombre, err)
+		case c.error != "" && (err == nil || !strings.Contains(err.Error(), c.error)):
+			t.Errorf("%s: err = %v; se esperaba %q", c.nombre, err, c.error)
+		}
+	}
+}
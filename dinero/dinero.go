@@ -0,0 +1,237 @@
+// Package dinero representa los importes de la tienda (precios, totales,
+// descuentos, reembolsos) como un número entero de centavos, así las sumas y
+// los redondeos son exactos. En la base de datos los importes son
+// DECIMAL(10,2) y se leen y escriben como texto, sin pasar por float64.
+//
+// Reglas de redondeo: las operaciones que pueden dar fracciones de centavo
+// (porcentajes, prorrateos, impuestos) redondean al centavo más cercano y los
+// medios centavos se alejan del cero (0,005 → 0,01 y -0,005 → -0,01).
+package dinero
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ErrFormato se devuelve al leer un importe mal escrito.
+var ErrFormato = errors.New("importe mal escrito")
+
+// Monto es un importe en centavos.
+type Monto int64
+
+// Centavos arma un importe a partir de una cantidad de centavos.
+func Centavos(n int64) Monto {
+	return Monto(n)
+}
+
+// Pesos arma un importe entero, sin centavos.
+func Pesos(n int64) Monto {
+	return Monto(n * 100)
+}
+
+// DesdeFloat convierte un número de punto flotante, redondeado al centavo.
+// Solo para datos que ya llegan como float64 de afuera; los importes de la
+// tienda se leen con Parse.
+func DesdeFloat(f float64) Monto {
+	return Monto(math.Round(f * 100))
+}
+
+// Parse lee un importe escrito con punto o coma decimal y hasta dos decimales,
+// p. ej. "1234", "1234.5" o "-0,99". Rechaza el texto vacío, los separadores de
+// miles, la notación científica y cualquier otro carácter: un precio mal
+// escrito es un error, nunca 0.
+func Parse(s string) (Monto, error) {
+	texto := strings.TrimSpace(s)
+	negativo := strings.HasPrefix(texto, "-")
+	texto = strings.TrimPrefix(texto, "-")
+
+	enteros, decimales := texto, ""
+	if i := strings.IndexAny(texto, ".,"); i >= 0 {
+		enteros, decimales = texto[:i], texto[i+1:]
+		if decimales == "" {
+			return 0, fmt.Errorf("%w: %q", ErrFormato, s)
+		}
+	}
+	if enteros == "" || len(decimales) > 2 || !soloDigitos(enteros) || !soloDigitos(decimales) {
+		return 0, fmt.Errorf("%w: %q", ErrFormato, s)
+	}
+	for len(decimales) < 2 {
+		decimales += "0"
+	}
+	n, err := strconv.ParseInt(enteros+decimales, 10, 64)
+	if err != nil || n > math.MaxInt64/10000 {
+		return 0, fmt.Errorf("%w: %q es demasiado grande", ErrFormato, s)
+	}
+	if negativo {
+		n = -n
+	}
+	return Monto(n), nil
+}
+
+func soloDigitos(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Centavos devuelve el importe en centavos.
+func (m Monto) Centavos() int64 {
+	return int64(m)
+}
+
+// Float64 devuelve el importe como número de punto flotante, para las APIs
+// que lo piden. No debe usarse para hacer cuentas.
+func (m Monto) Float64() float64 {
+	return float64(m) / 100
+}
+
+// Por multiplica el importe por una cantidad de unidades.
+func (m Monto) Por(cantidad int) Monto {
+	return m * Monto(cantidad)
+}
+
+// Porcentaje devuelve el `porcentaje` % del importe, redondeado. El
+// porcentaje se toma con dos decimales (10,5 para el 10,5%).
+func (m Monto) Porcentaje(porcentaje float64) Monto {
+	return m.Proporcion(centesimos(porcentaje), 10000)
+}
+
+// ImpuestoIncluido devuelve el impuesto que contiene un importe que ya lo
+// incluye, a la tasa `tasa` %: importe × tasa / (100 + tasa), redondeado.
+func (m Monto) ImpuestoIncluido(tasa float64) Monto {
+	t := centesimos(tasa)
+	return m.Proporcion(t, 10000+t)
+}
+
+// Proporcion devuelve importe × parte / total, redondeado. Sirve para
+// prorratear, p. ej. el reembolso de 2 de 3 unidades. Con total 0 devuelve 0.
+func (m Monto) Proporcion(parte, total int64) Monto {
+	if total == 0 {
+		return 0
+	}
+	return Monto(dividir(int64(m)*parte, total))
+}
+
+// centesimos pasa un porcentaje a centésimos de punto (10,5 → 1050).
+func centesimos(porcentaje float64) int64 {
+	return int64(math.Round(porcentaje * 100))
+}
+
+// dividir divide redondeando al entero más cercano; los medios se alejan del
+// cero.
+func dividir(a, b int64) int64 {
+	if b < 0 {
+		a, b = -a, -b
+	}
+	q, r := a/b, a%b
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= b {
+		if a < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
+
+// Min devuelve el menor de dos importes.
+func Min(a, b Monto) Monto {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// String devuelve el importe con punto decimal y dos decimales, sin moneda
+// ("1234.50"), como lo esperan los formularios y la base de datos.
+func (m Monto) String() string {
+	signo := ""
+	n := int64(m)
+	if n < 0 {
+		signo, n = "-", -n
+	}
+	return fmt.Sprintf("%s%d.%02d", signo, n/100, n%100)
+}
+
+// Formato devuelve el importe para mostrarlo, con el símbolo y los
+// separadores de la moneda de la tienda (ver SetMoneda), p. ej. "$ 1.234,50".
+func (m Monto) Formato() string {
+	signo := ""
+	n := int64(m)
+	if n < 0 {
+		signo, n = "-", -n
+	}
+	enteros := strconv.FormatInt(n/100, 10)
+	var b strings.Builder
+	for i, c := range enteros {
+		if i > 0 && (len(enteros)-i)%3 == 0 {
+			b.WriteString(moneda.Miles)
+		}
+		b.WriteRune(c)
+	}
+	return fmt.Sprintf("%s%s %s%s%02d", signo, moneda.Simbolo, b.String(), moneda.Decimal, n%100)
+}
+
+// Scan lee una columna DECIMAL. El driver de MySQL la entrega como texto;
+// también se aceptan enteros y, redondeados, números de punto flotante.
+func (m *Monto) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*m = 0
+		return nil
+	case []byte:
+		return m.scanTexto(string(v))
+	case string:
+		return m.scanTexto(v)
+	case int64:
+		*m = Pesos(v)
+		return nil
+	case float64:
+		*m = DesdeFloat(v)
+		return nil
+	}
+	return fmt.Errorf("dinero: no se puede leer %T como importe", src)
+}
+
+// scanTexto lee el texto de una columna DECIMAL(n,2) con Parse, sin pasar
+// por punto flotante. Un texto con más decimales (p. ej. de un AVG) es un
+// error: redondearlo en silencio escondería la columna mal declarada.
+func (m *Monto) scanTexto(s string) error {
+	v, err := Parse(s)
+	if err != nil {
+		return fmt.Errorf("dinero: %w", err)
+	}
+	*m = v
+	return nil
+}
+
+// Value escribe el importe como texto decimal, que MySQL guarda exacto en una
+// columna DECIMAL.
+func (m Monto) Value() (driver.Value, error) {
+	return m.String(), nil
+}
+
+// MarshalJSON escribe el importe como número JSON con dos decimales.
+func (m Monto) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON lee un número JSON con hasta dos decimales.
+func (m *Monto) UnmarshalJSON(b []byte) error {
+	v, err := Parse(string(b))
+	if err != nil {
+		return err
+	}
+	*m = v
+	return nil
+}
@@ -0,0 +1,202 @@
+package dinero
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	validos := []struct {
+		src      interface{}
+		esperado Monto
+	}{
+		{[]byte("1234.50"), 123450},
+		{"-0.99", -99},
+		{"7", 700},
+		{int64(3), 300},
+		{nil, 0},
+	}
+	for _, v := range validos {
+		var m Monto
+		if err := m.Scan(v.src); err != nil || m != v.esperado {
+			t.Errorf("Scan(%#v) = %d, %v; se esperaba %d", v.src, m, err, v.esperado)
+		}
+	}
+	for _, src := range []interface{}{"1.005", "1e3", "NaN", "Inf", "", []byte("12,3.4")} {
+		m := Monto(42)
+		if err := m.Scan(src); !errors.Is(err, ErrFormato) || m != 42 {
+			t.Errorf("Scan(%#v) = %d, %v; se esperaba ErrFormato sin tocar el importe", src, m, err)
+		}
+	}
+}
+
+func TestDividir(t *testing.T) {
+	casos := []struct{ a, b, esperado int64 }{
+		{6, 3, 2},
+		{4, 3, 1},
+		{5, 3, 2},
+		{-4, 3, -1},
+		{-5, 3, -2},
+		// Los medios se alejan del cero.
+		{5, 2, 3},
+		{3, 2, 2},
+		{-5, 2, -3},
+		{-3, 2, -2},
+		{5, -2, -3},
+		{-5, -2, 3},
+		{1, 3, 0},
+		{0, 7, 0},
+	}
+	for _, c := range casos {
+		if got := dividir(c.a, c.b); got != c.esperado {
+			t.Errorf("dividir(%d, %d) = %d; se esperaba %d", c.a, c.b, got, c.esperado)
+		}
+	}
+}
+
+func TestPorcentaje(t *testing.T) {
+	casos := []struct {
+		m          Monto
+		porcentaje float64
+		esperado   Monto
+	}{
+		{1000, 10, 100},
+		{1005, 10, 101},
+		{-1005, 10, -101},
+		{1, 50, 1},
+		{-1, 50, -1},
+		{999, 10.5, 105},
+		{200, 33.33, 67},
+		{12345, 0, 0},
+		{12345, 100, 12345},
+	}
+	for _, c := range casos {
+		if got := c.m.Porcentaje(c.porcentaje); got != c.esperado {
+			t.Errorf("Monto(%d).Porcentaje(%v) = %d; se esperaba %d", c.m, c.porcentaje, got, c.esperado)
+		}
+	}
+}
+
+func TestImpuestoIncluido(t *testing.T) {
+	casos := []struct {
+		m        Monto
+		tasa     float64
+		esperado Monto
+	}{
+		{12100, 21, 2100},
+		{1000, 21, 174},
+		{-1000, 21, -174},
+		{100, 21, 17},
+		{11050, 10.5, 1050},
+		{1000, 10.5, 95},
+		{-1000, 10.5, -95},
+		{1000, 0, 0},
+	}
+	for _, c := range casos {
+		if got := c.m.ImpuestoIncluido(c.tasa); got != c.esperado {
+			t.Errorf("Monto(%d).ImpuestoIncluido(%v) = %d; se esperaba %d", c.m, c.tasa, got, c.esperado)
+		}
+	}
+}
+
+func TestProporcion(t *testing.T) {
+	casos := []struct {
+		m            Monto
+		parte, total int64
+		esperado     Monto
+	}{
+		{1000, 2, 3, 667},
+		{1000, 1, 3, 333},
+		{-1000, 2, 3, -667},
+		{5, 1, 2, 3},
+		{-5, 1, 2, -3},
+		{1000, 3, 3, 1000},
+		{1000, 1, 0, 0},
+	}
+	for _, c := range casos {
+		if got := c.m.Proporcion(c.parte, c.total); got != c.esperado {
+			t.Errorf("Monto(%d).Proporcion(%d, %d) = %d; se esperaba %d", c.m, c.parte, c.total, got, c.esperado)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	validos := []struct {
+		texto    string
+		esperado Monto
+	}{
+		{"1234", 123400},
+		{"1234.5", 123450},
+		{"1234,5", 123450},
+		{"-0,99", -99},
+		{" 12.30 ", 1230},
+		{"0.05", 5},
+		{"-0", 0},
+		{"007", 700},
+	}
+	for _, v := range validos {
+		if m, err := Parse(v.texto); err != nil || m != v.esperado {
+			t.Errorf("Parse(%q) = %d, %v; se esperaba %d", v.texto, m, err, v.esperado)
+		}
+	}
+	for _, texto := range []string{"", " ", "-", "1.", ".5", "1.234", "1.000,00", "1,000.00", "1e3", "+5", "--1", "1 000", "12a", "$10", "10000000000000", "99999999999999999999"} {
+		if m, err := Parse(texto); !errors.Is(err, ErrFormato) || m != 0 {
+			t.Errorf("Parse(%q) = %d, %v; se esperaba ErrFormato", texto, m, err)
+		}
+	}
+}
+
+func TestFormato(t *testing.T) {
+	anterior := moneda
+	defer func() { moneda = anterior }()
+
+	casos := []struct {
+		moneda   string
+		m        Monto
+		esperado string
+	}{
+		{"ARS", 123456789, "$ 1.234.567,89"},
+		{"ARS", 100000, "$ 1.000,00"},
+		{"ARS", 99999, "$ 999,99"},
+		{"ARS", 5, "$ 0,05"},
+		{"ARS", 0, "$ 0,00"},
+		{"ARS", -150000, "-$ 1.500,00"},
+		{"USD", 123456789, "US$ 1,234,567.89"},
+		{"MXN", -5, "-$ 0.05"},
+		{"EUR", 123450, "€ 1.234,50"},
+		{"UYU", 1234500, "$U 12.345,00"},
+	}
+	for _, c := range casos {
+		if err := SetMoneda(c.moneda); err != nil {
+			t.Fatal(err)
+		}
+		if got := c.m.Formato(); got != c.esperado {
+			t.Errorf("%s: Monto(%d).Formato() = %q; se esperaba %q", c.moneda, c.m, got, c.esperado)
+		}
+	}
+
+	if err := SetMoneda(" usd "); err != nil || MonedaActual().Codigo != "USD" {
+		t.Errorf("SetMoneda(\" usd \") = %v; moneda %s", err, MonedaActual().Codigo)
+	}
+	if err := SetMoneda("XYZ"); err == nil || MonedaActual().Codigo != "USD" {
+		t.Errorf("SetMoneda(\"XYZ\") = %v; no debía cambiar la moneda", err)
+	}
+}
+
+func TestString(t *testing.T) {
+	casos := []struct {
+		m        Monto
+		esperado string
+	}{
+		{123450, "1234.50"},
+		{5, "0.05"},
+		{-5, "-0.05"},
+		{-123400, "-1234.00"},
+		{0, "0.00"},
+	}
+	for _, c := range casos {
+		if got := c.m.String(); got != c.esperado {
+			t.Errorf("Monto(%d).String() = %q; se esperaba %q", c.m, got, c.esperado)
+		}
+	}
+}
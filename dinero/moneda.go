@@ -0,0 +1,49 @@
+package dinero
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Moneda es cómo se muestran los importes: el símbolo y los separadores de
+// miles y de decimales. Todas las monedas admitidas usan dos decimales.
+type Moneda struct {
+	Codigo  string
+	Simbolo string
+	Miles   string
+	Decimal string
+}
+
+// monedas son las monedas que se pueden elegir con SetMoneda.
+var monedas = map[string]Moneda{
+	"ARS": {Codigo: "ARS", Simbolo: "$", Miles: ".", Decimal: ","},
+	"UYU": {Codigo: "UYU", Simbolo: "$U", Miles: ".", Decimal: ","},
+	"EUR": {Codigo: "EUR", Simbolo: "€", Miles: ".", Decimal: ","},
+	"USD": {Codigo: "USD", Simbolo: "US$", Miles: ",", Decimal: "."},
+	"MXN": {Codigo: "MXN", Simbolo: "$", Miles: ",", Decimal: "."},
+}
+
+// moneda es la moneda de la tienda. Se ajusta con SetMoneda (p. ej. desde la
+// variable `MONEDA`).
+var moneda = monedas["ARS"]
+
+// SetMoneda elige la moneda de la tienda por su código ISO 4217.
+func SetMoneda(codigo string) error {
+	m, ok := monedas[strings.ToUpper(strings.TrimSpace(codigo))]
+	if !ok {
+		codigos := make([]string, 0, len(monedas))
+		for c := range monedas {
+			codigos = append(codigos, c)
+		}
+		sort.Strings(codigos)
+		return fmt.Errorf("moneda desconocida %q (se admiten %s)", codigo, strings.Join(codigos, ", "))
+	}
+	moneda = m
+	return nil
+}
+
+// MonedaActual devuelve la moneda de la tienda.
+func MonedaActual() Moneda {
+	return moneda
+}
@@ -1,10 +1,21 @@
 package main
 
 import (
+	"Go-Sistemas-de-Gestion-empresarial/almacenamiento"
+	"Go-Sistemas-de-Gestion-empresarial/db"
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
 	"Go-Sistemas-de-Gestion-empresarial/handlers"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/notificaciones"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -18,41 +29,167 @@ func main() {
 		log.Println("Nota: No se pudo cargar el archivo .env, usando variables de entorno del sistema")
 	}
 
-	r := mux.NewRouter()
+	cfg, err := db.LoadConfig()
+	if err != nil {
+		log.Fatal("Configuración de base de datos inválida: ", err)
+	}
+	pool, err := db.Connect(cfg)
+	if err != nil {
+		log.Fatal("No se pudo conectar con la base de datos: ", err)
+	}
+	defer pool.Close()
+	models.SetDB(pool)
 
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	// `ecommerce migrate up|down|status` administra el esquema y termina.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(os.Args[2:], pool); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if os.Getenv("MIGRATE_ON_START") == "true" {
+		if err := runMigrate([]string{"up"}, pool); err != nil {
+			log.Fatal("Error aplicando migraciones: ", err)
+		}
+	}
 
-	r.HandleFunc("/", handlers.HomeHandler).Methods("GET")
-	r.HandleFunc("/login", handlers.LoginHandler).Methods("GET", "POST")
-	r.HandleFunc("/register", handlers.RegisterHandler).Methods("GET", "POST")
-	r.HandleFunc("/logout", handlers.LogoutHandler).Methods("GET")
-	r.HandleFunc("/producto/{id:[0-9]+}", handlers.ClientProductDetail).Methods("GET")
-
-	r.HandleFunc("/carrito", handlers.ClientCart).Methods("GET")
-	r.HandleFunc("/producto/agregar-carrito", handlers.AgregarItemCarrito).Methods("POST")
-	r.HandleFunc("/carrito/eliminar/{id:[0-9]+}", handlers.RemoveItemFromCart).Methods("GET", "POST") // Allow POST for better practice, but kept GET to match link
-	r.HandleFunc("/checkout", handlers.ClientCheckout).Methods("GET")
-	r.HandleFunc("/checkout", handlers.ProcessCheckout).Methods("POST")
-
-	r.HandleFunc("/perfil", handlers.ClientProfile).Methods("GET")
-	r.HandleFunc("/perfil/editar", handlers.ClientProfileEdit).Methods("GET", "POST")
-	r.HandleFunc("/pedidos/{id:[0-9]+}", handlers.ClientOrderDetail).Methods("GET")
-
-	r.HandleFunc("/admin/dashboard", handlers.AdminDashboard).Methods("GET")
-	r.HandleFunc("/admin/productos", handlers.AdminProducts).Methods("GET")
-	r.HandleFunc("/admin/productos/nuevo", handlers.AdminProductCreate).Methods("GET", "POST")
-	r.HandleFunc("/admin/productos/editar/{id}", handlers.AdminProductEdit).Methods("GET", "POST")
-	r.HandleFunc("/admin/productos/eliminar/{id}", handlers.AdminProductDelete)
-	r.HandleFunc("/admin/pedidos", handlers.AdminOrders).Methods("GET")
-	r.HandleFunc("/admin/pedidos/{id}", handlers.AdminOrderDetail).Methods("GET")
-	r.HandleFunc("/admin/pedidos/{id}/status", handlers.AdminOrderStatus).Methods("POST")
-	r.HandleFunc("/admin/clientes", handlers.AdminClients).Methods("GET")
+	if cost := os.Getenv("BCRYPT_COST"); cost != "" {
+		n, err := strconv.Atoi(cost)
+		if err != nil {
+			log.Fatal("BCRYPT_COST inválido: ", cost)
+		}
+		if err := models.SetBcryptCost(n); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if incluidos := os.Getenv("PRECIOS_CON_IMPUESTOS"); incluidos != "" {
+		b, err := strconv.ParseBool(incluidos)
+		if err != nil {
+			log.Fatal("PRECIOS_CON_IMPUESTOS inválido: ", incluidos)
+		}
+		models.SetPreciosConImpuestos(b)
+	}
+	if moneda := os.Getenv("MONEDA"); moneda != "" {
+		if err := dinero.SetMoneda(moneda); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	sessionKey := []byte(os.Getenv("SESSION_KEY"))
+	if len(sessionKey) < 32 {
+		log.Println("Aviso: SESSION_KEY ausente o menor a 32 bytes, se genera una clave temporal (las sesiones no sobrevivirán un reinicio)")
+		sessionKey = securecookie.GenerateRandomKey(32)
+	}
+	// Las imágenes subidas se guardan en disco (o en memoria, en desarrollo)
+	// y se sirven bajo STORAGE_URL.
+	storageURL := os.Getenv("STORAGE_URL")
+	if storageURL == "" {
+		storageURL = "/media"
+	}
+	var almacen almacenamiento.Almacenamiento
+	var media http.Handler
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "", "local":
+		storageDir := os.Getenv("STORAGE_DIR")
+		if storageDir == "" {
+			storageDir = "uploads"
+		}
+		local, err := almacenamiento.NewLocal(storageDir, storageURL)
+		if err != nil {
+			log.Fatal("No se pudo preparar el almacenamiento de archivos: ", err)
+		}
+		almacen, media = local, local.Handler()
+	case "memoria":
+		log.Println("Aviso: STORAGE_DRIVER=memoria, las imágenes subidas se pierden al reiniciar")
+		memoria := almacenamiento.NewMemoria(storageURL)
+		almacen, media = memoria, memoria.Handler()
+	default:
+		log.Fatal("STORAGE_DRIVER desconocido: ", driver)
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
 	}
 
+	// Pasarela de pago. Por ahora solo existe el proveedor simulado, que se
+	// configura para aprobar, rechazar o diferir los cobros.
+	if proveedor := os.Getenv("PAGOS_PROVEEDOR"); proveedor != "" && proveedor != "simulado" {
+		log.Fatal("PAGOS_PROVEEDOR desconocido: ", proveedor)
+	}
+	secretoPagos := []byte(os.Getenv("PAGOS_WEBHOOK_SECRETO"))
+	if len(secretoPagos) < 32 {
+		log.Println("Aviso: PAGOS_WEBHOOK_SECRETO ausente o menor a 32 bytes, se genera un secreto temporal")
+		secretoPagos = securecookie.GenerateRandomKey(32)
+	}
+	retrasoPagos := 10 * time.Second
+	if v := os.Getenv("PAGOS_SIMULADO_RETRASO"); v != "" {
+		if retrasoPagos, err = time.ParseDuration(v); err != nil {
+			log.Fatal("PAGOS_SIMULADO_RETRASO inválido: ", v)
+		}
+	}
+	urlWebhook := os.Getenv("PAGOS_WEBHOOK_URL")
+	if urlWebhook == "" {
+		urlWebhook = "http://localhost:" + port + "/webhooks/pagos/simulado"
+	}
+	pasarela, err := pagos.NewSimulado(pagos.ConfigSimulado{
+		Modo:       os.Getenv("PAGOS_SIMULADO_MODO"),
+		Secreto:    secretoPagos,
+		Retraso:    retrasoPagos,
+		URLWebhook: urlWebhook,
+	})
+	if err != nil {
+		log.Fatal("Configuración de pagos inválida: ", err)
+	}
+
+	// Avisos a los clientes: por correo si hay servidor SMTP configurado y,
+	// si no, al log.
+	var notificador notificaciones.Notificador = notificaciones.Log{}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		puerto := os.Getenv("SMTP_PORT")
+		if puerto == "" {
+			puerto = "587"
+		}
+		remitente := os.Getenv("SMTP_FROM")
+		if remitente == "" {
+			log.Fatal("SMTP_FROM es obligatorio si se configura SMTP_HOST")
+		}
+		notificador = notificaciones.NewSMTP(host, puerto, os.Getenv("SMTP_USER"), os.Getenv("SMTP_PASSWORD"), remitente)
+	}
+
+	repos := models.NewRepositoriosMySQL()
+	h := handlers.New(repos, almacen, pasarela, notificador, sessionKey, os.Getenv("COOKIE_SECURE") == "true")
+
+	// Limpieza periódica de sesiones expiradas y carritos de invitado vencidos.
+	go func() {
+		for range time.Tick(time.Hour) {
+			if n, err := repos.Sesiones.DeleteExpired(); err != nil {
+				log.Println("Error limpiando sesiones expiradas:", err)
+			} else if n > 0 {
+				log.Println("Sesiones expiradas eliminadas:", n)
+			}
+			if n, err := repos.Carritos.DeleteInvitadosAntiguos(handlers.CarritoInvitadoDuracion); err != nil {
+				log.Println("Error limpiando carritos de invitado:", err)
+			} else if n > 0 {
+				log.Println("Carritos de invitado eliminados:", n)
+			}
+		}
+	}()
+
+	// Reintento de los reembolsos que la pasarela no pudo hacer.
+	go func() {
+		for range time.Tick(5 * time.Minute) {
+			h.ReintentarReembolsos()
+		}
+	}()
+
+	r := mux.NewRouter()
+
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("static"))))
+	r.PathPrefix(strings.TrimSuffix(storageURL, "/") + "/").Handler(media)
+
+	h.Rutas(r)
+
 	log.Println("Servidor iniciado en puerto :" + port)
 	log.Fatal(http.ListenAndServe(":"+port, r))
 }
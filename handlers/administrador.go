@@ -1,29 +1,30 @@
 package handlers
 
 import (
-	"Go-Sistemas-de-Gestion-empresarial/db"
+	"Go-Sistemas-de-Gestion-empresarial/imagenes"
 	"Go-Sistemas-de-Gestion-empresarial/models"
-	"database/sql"
-	"html/template"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 )
 
-func AdminDashboard(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	// AdminDashboard muestra el dashboard de administración con estadísticas generales.
-	_, perfil, _ := GetSessionData(r)
+	_, perfil, _ := h.GetSessionData(r)
 
-	stats, err := getAdminStats()
+	stats, err := h.Estadisticas.Get()
 	if err != nil {
 		log.Println("Error obteniendo estadísticas:", err)
 		http.Error(w, "Error interno", http.StatusInternalServerError)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/dashboard.html")
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/dashboard.html")
 	if err != nil {
 		log.Println("Error cargando templates admin:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -31,12 +32,18 @@ func AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Perfil          string
-		Stats           AdminStats
-		DashboardActive bool
-		ProductosActive bool
-		PedidosActive   bool
-		ClientesActive  bool
+		Perfil             string
+		Stats              models.Estadisticas
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
 	}{
 		Perfil:          perfil,
 		Stats:           stats,
@@ -46,53 +53,18 @@ func AdminDashboard(w http.ResponseWriter, r *http.Request) {
 	tmpl.ExecuteTemplate(w, "layout", data)
 }
 
-type AdminStats struct {
-	TotalClientes  int
-	TotalProductos int
-	TotalPedidos   int
-	TotalVentas    float64
-}
-
-// sqlNullFloat64 es un wrapper para sql.NullFloat64 usado internamente.
-
-type sqlNullFloat64 struct {
-	sql.NullFloat64
-}
-
-func getAdminStats() (AdminStats, error) {
-	// getAdminStats obtiene estadísticas agregadas de la base de datos para el admin.
-	var stats AdminStats
-	database, err := db.Connect()
-	if err != nil {
-		return stats, err
-	}
-	defer database.Close()
-
-	database.QueryRow("SELECT COUNT(*) FROM clientes").Scan(&stats.TotalClientes)
-
-	database.QueryRow("SELECT COUNT(*) FROM productos").Scan(&stats.TotalProductos)
-
-	database.QueryRow("SELECT COUNT(*) FROM pedidos").Scan(&stats.TotalPedidos)
-
-	var total sql.NullFloat64
-	database.QueryRow("SELECT SUM(total) FROM pedidos").Scan(&total)
-	stats.TotalVentas = total.Float64
-
-	return stats, nil
-}
-
-func AdminProducts(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminProducts(w http.ResponseWriter, r *http.Request) {
 	// AdminProducts lista todos los productos en la vista de administración.
-	_, perfil, _ := GetSessionData(r)
+	_, perfil, _ := h.GetSessionData(r)
 
-	productos, err := models.GetAllProductos()
+	productos, err := h.Productos.GetAll()
 	if err != nil {
 		log.Println("Error obteniendo productos:", err)
 		http.Error(w, "Error interno", http.StatusInternalServerError)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/productos.html")
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/productos.html")
 	if err != nil {
 		log.Println("Error cargando templates admin products:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -100,12 +72,18 @@ func AdminProducts(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Perfil          string
-		Productos       []models.Producto
-		DashboardActive bool
-		ProductosActive bool
-		PedidosActive   bool
-		ClientesActive  bool
+		Perfil             string
+		Productos          []models.Producto
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
 	}{
 		Perfil:          perfil,
 		Productos:       productos,
@@ -115,60 +93,42 @@ func AdminProducts(w http.ResponseWriter, r *http.Request) {
 	tmpl.ExecuteTemplate(w, "layout", data)
 }
 
-func AdminProductCreate(w http.ResponseWriter, r *http.Request) {
-	// AdminProductCreate maneja la creación de productos desde el panel admin.
-	_, perfil, _ := GetSessionData(r)
-
+func (h *Handler) AdminProductCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminProductCreate maneja la creación de productos desde el panel admin,
+	// incluidas sus categorías e imágenes.
 	if r.Method == "POST" {
-		nombre := r.FormValue("nombre")
-		descripcion := r.FormValue("descripcion")
-		precio, _ := strconv.ParseFloat(r.FormValue("precio"), 64)
-		stock, _ := strconv.Atoi(r.FormValue("stock"))
-		sku := r.FormValue("sku")
-		activo := r.FormValue("activo") == "on"
-
-		err := models.CreateProducto(nombre, descripcion, precio, stock, sku, activo)
+		producto, errores := h.productoDesdeFormulario(r)
+		// Un número mal escrito se rechaza en lugar de guardarse como 0.
+		if len(errores) > 0 {
+			h.renderFormularioProducto(w, r, false, producto, errores)
+			return
+		}
+		id, err := h.Productos.Create(producto)
 		if err != nil {
 			log.Println("Error creando producto:", err)
 			http.Error(w, "Error creando producto", http.StatusInternalServerError)
 			return
 		}
+		producto.ID = id
+		if err := h.Categorias.SetProducto(id, parseIDs(r.Form["categorias"])); err != nil {
+			log.Println("Error asignando categorías al producto:", err)
+			http.Error(w, "Error asignando categorías", http.StatusInternalServerError)
+			return
+		}
+		if errores := h.guardarImagenes(id, archivosImagen(r)); len(errores) > 0 {
+			// El producto ya existe: se muestra su edición con los rechazos.
+			h.renderFormularioProducto(w, r, true, producto, errores)
+			return
+		}
 		http.Redirect(w, r, "/admin/productos", http.StatusSeeOther)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/formulario_producto.html")
-	if err != nil {
-		log.Println("Error cargando template admin product form:", err)
-		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
-		return
-	}
-
-	data := struct {
-		Perfil          string
-		IsEdit          bool
-		Producto        models.Producto
-		ProductosActive bool
-		DashboardActive bool
-		PedidosActive   bool
-		ClientesActive  bool
-	}{
-		Perfil:          perfil,
-		IsEdit:          false,
-		Producto:        models.Producto{},
-		ProductosActive: true,
-	}
-
-	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
-		log.Println("Error ejecutando template admin product form:", err)
-		http.Error(w, "Error ejecutando template", http.StatusInternalServerError)
-		return
-	}
+	h.renderFormularioProducto(w, r, false, models.Producto{}, nil)
 }
 
-func AdminProductEdit(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminProductEdit(w http.ResponseWriter, r *http.Request) {
 	// AdminProductEdit permite editar un producto existente o mostrar el formulario.
-	_, perfil, _ := GetSessionData(r)
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
@@ -178,84 +138,225 @@ func AdminProductEdit(w http.ResponseWriter, r *http.Request) {
 
 	switch r.Method {
 	case "POST":
-		nombre := r.FormValue("nombre")
-		descripcion := r.FormValue("descripcion")
-		precio, _ := strconv.ParseFloat(r.FormValue("precio"), 64)
-		stock, _ := strconv.Atoi(r.FormValue("stock"))
-		sku := r.FormValue("sku")
-		activo := r.FormValue("activo") == "on"
-
-		err := models.UpdateProducto(id, nombre, descripcion, precio, stock, sku, activo)
+		producto, errores := h.productoDesdeFormulario(r)
+		producto.ID = id
+		if len(errores) > 0 {
+			// Los números rechazados se muestran con el valor guardado.
+			if actual, err := h.Productos.GetByID(id); err == nil {
+				producto.Precio = actual.Precio
+				producto.Stock = actual.Stock
+				producto.Peso = actual.Peso
+				producto.IDClaseImpuesto = actual.IDClaseImpuesto
+			}
+			h.renderFormularioProducto(w, r, true, producto, errores)
+			return
+		}
+		// Con variantes el stock es la suma del de cada una y no se edita aquí.
+		if variantes, err := h.Variantes.GetByProductoID(id); err == nil && len(variantes) > 0 {
+			if actual, err := h.Productos.GetByID(id); err == nil {
+				producto.Stock = actual.Stock
+			}
+		}
+		err := h.Productos.Update(producto)
 		if err != nil {
 			log.Println("Error actualizando producto:", err)
 			http.Error(w, "Error actualizando producto", http.StatusInternalServerError)
 			return
 		}
+		if err := h.Categorias.SetProducto(id, parseIDs(r.Form["categorias"])); err != nil {
+			log.Println("Error asignando categorías al producto:", err)
+			http.Error(w, "Error asignando categorías", http.StatusInternalServerError)
+			return
+		}
+		if errores := h.guardarImagenes(id, archivosImagen(r)); len(errores) > 0 {
+			h.renderFormularioProducto(w, r, true, producto, errores)
+			return
+		}
 		http.Redirect(w, r, "/admin/productos", http.StatusSeeOther)
 
 	case "GET":
-		producto, err := models.GetProductoByID(id)
+		producto, err := h.Productos.GetByID(id)
 		if err != nil {
 			http.Error(w, "Producto no encontrado", http.StatusNotFound)
 			return
 		}
+		h.renderFormularioProducto(w, r, true, producto, nil)
+
+	default:
+		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	}
+}
 
-		tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/formulario_producto.html")
+// productoDesdeFormulario lee los campos del formulario de producto.
+// Devuelve también los errores de formato de los campos numéricos y los de
+// validación.
+func (h *Handler) productoDesdeFormulario(r *http.Request) (models.Producto, []string) {
+	f := &lectorFormulario{r: r}
+	producto := models.Producto{
+		Nombre:      r.FormValue("nombre"),
+		Descripcion: r.FormValue("descripcion"),
+		Precio:      f.importe("precio", "El precio", true),
+		Stock:       f.entero("stock", "El stock"),
+		Peso:        f.decimal("peso", "El peso", false),
+		SKU:         r.FormValue("sku"),
+		Activo:      r.FormValue("activo") == "on",
+
+		IDClaseImpuesto: f.entero("id_clase_impuesto", "La clase de impuesto"),
+	}
+	if producto.Stock < 0 {
+		f.errores = append(f.errores, "El stock no puede ser negativo")
+	}
+	if producto.Peso < 0 {
+		f.errores = append(f.errores, "El peso no puede ser negativo")
+	}
+	if producto.IDClaseImpuesto != 0 {
+		if _, err := h.Impuestos.GetByID(producto.IDClaseImpuesto); err != nil {
+			f.errores = append(f.errores, "La clase de impuesto elegida no existe")
+		}
+	}
+	return producto, f.errores
+}
+
+// renderFormularioProducto dibuja el formulario de alta o edición de un
+// producto con sus categorías e imágenes. Si hay errores responde 400.
+func (h *Handler) renderFormularioProducto(w http.ResponseWriter, r *http.Request, isEdit bool, producto models.Producto, errores []string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	var idsAsignadas []int
+	var vistas []imagenVista
+	var opciones []models.OpcionProducto
+	var variantes []models.VarianteProducto
+	if isEdit {
+		asignadas, err := h.Categorias.GetByProductoID(producto.ID)
 		if err != nil {
-			log.Println("Error cargando template admin product form:", err)
-			http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+			log.Println("Error obteniendo categorías del producto:", err)
+			http.Error(w, "Error interno", http.StatusInternalServerError)
 			return
 		}
-
-		data := struct {
-			Perfil          string
-			IsEdit          bool
-			Producto        models.Producto
-			DashboardActive bool
-			ProductosActive bool
-			PedidosActive   bool
-			ClientesActive  bool
-		}{
-			Perfil:          perfil,
-			IsEdit:          true,
-			Producto:        producto,
-			ProductosActive: true,
+		for _, c := range asignadas {
+			idsAsignadas = append(idsAsignadas, c.ID)
 		}
-
-		err = tmpl.ExecuteTemplate(w, "layout", data)
+		vistas, err = h.imagenesProducto(producto.ID)
+		if err != nil {
+			log.Println("Error obteniendo imágenes del producto:", err)
+			http.Error(w, "Error interno", http.StatusInternalServerError)
+			return
+		}
+		opciones, err = h.Variantes.GetOpciones(producto.ID)
 		if err != nil {
-			log.Println("Error ejecutando template admin product form:", err)
+			log.Println("Error obteniendo opciones del producto:", err)
+			http.Error(w, "Error interno", http.StatusInternalServerError)
+			return
+		}
+		variantes, err = h.Variantes.GetByProductoID(producto.ID)
+		if err != nil {
+			log.Println("Error obteniendo variantes del producto:", err)
+			http.Error(w, "Error interno", http.StatusInternalServerError)
+			return
 		}
+	}
 
-	default:
-		http.Error(w, "Método no permitido", http.StatusMethodNotAllowed)
+	clases, err := h.Impuestos.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo clases de impuesto:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_producto.html")
+	if err != nil {
+		log.Println("Error cargando template admin product form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Producto           models.Producto
+		Categorias         []opcionCategoria
+		Imagenes           []imagenVista
+		Opciones           string
+		TieneOpciones      bool
+		Variantes          []models.VarianteProducto
+		ClasesImpuesto     []models.ClaseImpuesto
+		MaxImagenes        int
+		MaxMB              int
+		Errores            []string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:          perfil,
+		IsEdit:          isEdit,
+		Producto:        producto,
+		Categorias:      opcionesCategoria(categorias, idsAsignadas),
+		Imagenes:        vistas,
+		Opciones:        textoOpciones(opciones),
+		TieneOpciones:   len(opciones) > 0,
+		Variantes:       variantes,
+		ClasesImpuesto:  clases,
+		MaxImagenes:     maxImagenesPorEnvio,
+		MaxMB:           imagenes.MaxBytes >> 20,
+		Errores:         errores,
+		ProductosActive: true,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin product form:", err)
 	}
 }
 
-func AdminProductDelete(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminProductDelete(w http.ResponseWriter, r *http.Request) {
 	// AdminProductDelete elimina un producto por su ID y redirige a la lista.
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	err := models.DeleteProducto(id)
+	// Las filas de imágenes se borran en cascada; los archivos, después.
+	existentes, err := h.Imagenes.GetByProductoID(id)
+	if err != nil {
+		log.Println("Error obteniendo imágenes del producto:", err)
+	}
+	err = h.Productos.Delete(id)
 	if err != nil {
 		log.Println("Error eliminando producto:", err)
+	} else {
+		for _, imagen := range existentes {
+			h.eliminarArchivosImagen(imagen)
+		}
 	}
 	http.Redirect(w, r, "/admin/productos", http.StatusSeeOther)
 }
 
-func AdminOrders(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminOrders(w http.ResponseWriter, r *http.Request) {
 	// AdminOrders lista todos los pedidos en la vista de administración.
-	_, perfil, _ := GetSessionData(r)
+	_, perfil, _ := h.GetSessionData(r)
 
-	pedidos, err := models.GetAllPedidos()
+	pedidos, err := h.Pedidos.GetAll()
 	if err != nil {
 		log.Println("Error obteniendo pedidos:", err)
 		http.Error(w, "Error interno", http.StatusInternalServerError)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/ordenes.html")
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/ordenes.html")
 	if err != nil {
 		log.Println("Error cargando templates admin orders:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -263,12 +364,18 @@ func AdminOrders(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Perfil          string
-		Pedidos         []models.Pedido
-		DashboardActive bool
-		ProductosActive bool
-		PedidosActive   bool
-		ClientesActive  bool
+		Perfil             string
+		Pedidos            []models.Pedido
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
 	}{
 		Perfil:        perfil,
 		Pedidos:       pedidos,
@@ -281,29 +388,54 @@ func AdminOrders(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminOrderDetail(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminOrderDetail(w http.ResponseWriter, r *http.Request) {
 	// AdminOrderDetail muestra los detalles de un pedido específico en admin.
-	_, perfil, _ := GetSessionData(r)
+	_, perfil, _ := h.GetSessionData(r)
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	pedido, err := models.GetPedidoByID(id)
+	pedido, err := h.Pedidos.GetByID(id)
 	if err != nil {
 		http.Error(w, "Pedido no encontrado", http.StatusNotFound)
 		return
 	}
 
-	detalles, err := models.GetDetallesByPedidoID(id)
+	detalles, err := h.Pedidos.GetDetalles(id)
 	if err != nil {
 		log.Println("Error obteniendo detalles del pedido:", err)
 	}
 
-	cliente, err := models.GetClienteByID(pedido.IDCliente)
+	promociones, err := h.Pedidos.GetPromociones(id)
+	if err != nil {
+		log.Println("Error obteniendo promociones del pedido:", err)
+	}
+
+	historial, err := h.Pedidos.GetHistorial(id)
+	if err != nil {
+		log.Println("Error obteniendo historial del pedido:", err)
+	}
+
+	devoluciones, err := h.Devoluciones.GetByPedidoID(id)
+	if err != nil {
+		log.Println("Error obteniendo devoluciones del pedido:", err)
+	}
+
+	reembolsos, err := h.Pedidos.GetReembolsos(id)
+	if err != nil {
+		log.Println("Error obteniendo reembolsos del pedido:", err)
+	}
+
+	envios, err := h.Envios.GetEnviosPedido(id)
+	if err != nil {
+		log.Println("Error obteniendo envíos del pedido:", err)
+	}
+
+	cliente, err := h.Clientes.GetByID(pedido.IDCliente)
 	if err != nil {
 		log.Println("Error obteniendo cliente:", err)
 	}
 
-	tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/detalle_orden.html")
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/detalle_orden.html")
 	if err != nil {
 		log.Println("Error cargando template admin order detail:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -311,18 +443,40 @@ func AdminOrderDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Perfil          string
-		Pedido          models.Pedido
-		Detalles        []models.DetallePedido
-		Cliente         models.Cliente
-		DashboardActive bool
-		ProductosActive bool
-		PedidosActive   bool
-		ClientesActive  bool
+		Perfil             string
+		Pedido             models.Pedido
+		Detalles           []models.DetallePedido
+		Promociones        []models.PromocionAplicada
+		Impuestos          models.DesgloseImpuestos
+		Historial          []models.CambioEstado
+		Devoluciones       []models.Devolucion
+		Reembolsos         []models.Reembolso
+		Envios             []envioVista
+		PorEnviar          []lineaPorEnviar
+		PuedeEnviar        bool
+		Cliente            models.Cliente
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
 	}{
 		Perfil:        perfil,
 		Pedido:        pedido,
 		Detalles:      detalles,
+		Promociones:   promociones,
+		Impuestos:     models.DesgloseDePedido(pedido, detalles),
+		Historial:     historial,
+		Devoluciones:  devoluciones,
+		Reembolsos:    reembolsos,
+		Envios:        h.enviosVista(envios),
+		PorEnviar:     h.lineasPorEnviar(detalles, envios),
+		PuedeEnviar:   pedido.Estado == models.EstadoPagado || pedido.Estado == models.EstadoEnviadoParcial,
 		Cliente:       cliente,
 		PedidosActive: true,
 	}
@@ -333,18 +487,18 @@ func AdminOrderDetail(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminClients(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AdminClients(w http.ResponseWriter, r *http.Request) {
 	// AdminClients lista todos los clientes en el panel de administración.
-	_, perfil, _ := GetSessionData(r)
+	_, perfil, _ := h.GetSessionData(r)
 
-	clientes, err := models.GetAllClientes()
+	clientes, err := h.Clientes.GetAll()
 	if err != nil {
 		log.Println("Error obteniendo clientes:", err)
 		http.Error(w, "Error interno", http.StatusInternalServerError)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/admin/layout.html", "templates/admin/clientes.html")
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/clientes.html")
 	if err != nil {
 		log.Println("Error cargando templates admin clients:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -352,12 +506,18 @@ func AdminClients(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Perfil          string
-		Clientes        []models.Cliente
-		DashboardActive bool
-		ProductosActive bool
-		PedidosActive   bool
-		ClientesActive  bool
+		Perfil             string
+		Clientes           []models.Cliente
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
 	}{
 		Perfil:         perfil,
 		Clientes:       clientes,
@@ -370,19 +530,67 @@ func AdminClients(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func AdminOrderStatus(w http.ResponseWriter, r *http.Request) {
-	// AdminOrderStatus actualiza el estado de un pedido (p.ej. PAGADO, ENTREGADO).
-	vars := mux.Vars(r)
-	id, _ := strconv.Atoi(vars["id"])
+func (h *Handler) AdminOrderStatus(w http.ResponseWriter, r *http.Request) {
+	// AdminOrderStatus cambia el estado de un pedido según la máquina de
+	// estados de models y avisa al cliente. Cancelar exige un motivo, que
+	// queda en el historial, repone el stock y devuelve el pago.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, err := h.Pedidos.GetByID(id); err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Pedido no encontrado", "El pedido no existe.")
+		return
+	}
 
-	if r.Method == "POST" {
-		nuevoEstado := r.FormValue("estado") // PAGADO, ENTREGADO
-		err := models.UpdatePedidoStatus(id, nuevoEstado)
-		if err != nil {
-			log.Println("Error actualizando estado del pedido:", err)
-			http.Error(w, "Error actualizando estado", http.StatusInternalServerError)
+	estado := r.FormValue("estado")
+	motivo := strings.TrimSpace(r.FormValue("motivo"))
+	if estado == models.EstadoCancelado && motivo == "" {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Falta el motivo", "Indica el motivo de la cancelación.")
+		return
+	}
+	if utf8.RuneCountInString(motivo) > 255 {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Motivo demasiado largo", "El motivo admite hasta 255 caracteres.")
+		return
+	}
+
+	admin, _ := h.GetSessionCliente(r)
+	cambio, err := h.Pedidos.CambiarEstado(models.SolicitudCambioEstado{
+		IDPedido:     id,
+		Estado:       estado,
+		IDCliente:    admin.ID,
+		Responsable:  admin.Nombre + " (administrador)",
+		Motivo:       motivo,
+		DevolverPago: true,
+	})
+	if err != nil {
+		if errors.Is(err, models.ErrTransicionInvalida) {
+			h.renderError(w, r, http.StatusConflict, "Cambio de estado no permitido", err.Error())
 			return
 		}
+		log.Println("Error actualizando estado del pedido:", err)
+		http.Error(w, "Error actualizando estado", http.StatusInternalServerError)
+		return
+	}
+	h.notificarCambioEstado(cambio)
+	if estado == models.EstadoCancelado {
+		// Si la pasarela falla el reembolso queda pendiente, a la vista en
+		// el detalle del pedido.
+		h.reembolsarPedido(id)
+	}
+
+	destino := "/admin/pedidos"
+	if volver := r.FormValue("volver"); volver != "" {
+		destino = safeRedirect(volver)
+	}
+	http.Redirect(w, r, destino, http.StatusSeeOther)
+}
+
+func (h *Handler) AdminOrderRefundRetry(w http.ResponseWriter, r *http.Request) {
+	// AdminOrderRefundRetry vuelve a pedir a la pasarela los reembolsos
+	// pendientes del pedido; el resultado se ve en el detalle.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, err := h.Pedidos.GetByID(id); err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Pedido no encontrado", "El pedido no existe.")
+		return
 	}
-	http.Redirect(w, r, "/admin/pedidos", http.StatusSeeOther)
+	h.reembolsarPedido(id)
+	http.Redirect(w, r, "/admin/pedidos/"+strconv.Itoa(id), http.StatusSeeOther)
 }
@@ -2,55 +2,39 @@ package handlers
 
 import (
 	"Go-Sistemas-de-Gestion-empresarial/models"
-	"fmt"
-	"html/template"
 	"log"
 	"net/http"
-	"time"
+	"net/url"
 )
 
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	// LoginHandler procesa el inicio de sesión: verifica credenciales y crea cookies
-	// de sesión con `user_id`, `user_perfil` y `token` si el login es exitoso.
+func (h *Handler) LoginHandler(w http.ResponseWriter, r *http.Request) {
+	// LoginHandler procesa el inicio de sesión: verifica credenciales y, si son
+	// correctas, asocia el cliente a una sesión nueva en el servidor y le pasa
+	// el carrito que armó como invitado.
 	if r.Method == "POST" {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
+		next := safeRedirect(r.FormValue("next"))
 
-		cliente, err := models.Login(email, password)
+		cliente, err := models.Login(h.Clientes, email, password)
 		if err != nil {
 			log.Println("Error de login:", err)
-			http.Redirect(w, r, "/login?error=invalid_credentials", http.StatusSeeOther)
+			http.Redirect(w, r, "/login?error=invalid_credentials&next="+url.QueryEscape(next), http.StatusSeeOther)
 			return
 		}
 
-		expiration := time.Now().Add(24 * time.Hour)
-		http.SetCookie(w, &http.Cookie{
-			Name:     "user_id",
-			Value:    fmt.Sprintf("%d", cliente.ID),
-			Expires:  expiration,
-			Path:     "/",
-			HttpOnly: true,
-		})
-		http.SetCookie(w, &http.Cookie{
-			Name:     "user_perfil",
-			Value:    cliente.Perfil,
-			Expires:  expiration,
-			Path:     "/",
-			HttpOnly: true,
-		})
-		http.SetCookie(w, &http.Cookie{
-			Name:     "token",
-			Value:    "true",
-			Expires:  expiration,
-			Path:     "/",
-			HttpOnly: true,
-		})
+		if err := h.iniciarSesion(w, r, cliente); err != nil {
+			log.Println("Error al crear la sesión:", err)
+			http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+			return
+		}
+		h.fusionarCarritoInvitado(w, r, cliente.ID)
 
-		http.Redirect(w, r, "/", http.StatusSeeOther)
+		http.Redirect(w, r, next, http.StatusSeeOther)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/login.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/login.html")
 	if err != nil {
 		log.Println("Error al cargar el template de login", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -60,11 +44,13 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Error      bool
 		Registered bool
+		Next       string
 		LoginToken bool
 		Perfil     string
 	}{
 		Error:      r.URL.Query().Get("error") != "",
 		Registered: r.URL.Query().Get("registered") == "true",
+		Next:       safeRedirect(r.URL.Query().Get("next")),
 	}
 
 	err = tmpl.ExecuteTemplate(w, "base", data)
@@ -73,22 +59,49 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	// RegisterHandler maneja el registro de nuevos usuarios. En POST crea el cliente
 	// y redirige al login; en GET muestra el formulario de registro.
 	if r.Method == "POST" {
-		err := models.CreateCliente(r.FormValue("nombre"), r.FormValue("email"), r.FormValue("password"), r.FormValue("direccion"), r.FormValue("telefono"))
+		password := r.FormValue("password")
+		if password == "" || password != r.FormValue("confirm_password") {
+			http.Redirect(w, r, "/register?error=password_mismatch", http.StatusSeeOther)
+			return
+		}
+
+		hash, err := models.HashPassword(password)
+		if err != nil {
+			log.Println("Error al generar hash de contraseña:", err)
+			http.Redirect(w, r, "/register?error=register_failed", http.StatusSeeOther)
+			return
+		}
+
+		err = h.Clientes.Create(models.Cliente{
+			Nombre:       r.FormValue("nombre"),
+			Email:        r.FormValue("email"),
+			PasswordHash: hash,
+			Direccion:    r.FormValue("direccion"),
+			Telefono:     r.FormValue("telefono"),
+			Perfil:       "cliente",
+		})
 		if err != nil {
 			log.Println("Error al registrar:", err)
 			http.Redirect(w, r, "/register?error=register_failed", http.StatusSeeOther)
 			return
 		}
 
+		// El carrito armado como invitado pasa a la cuenta nueva.
+		if cliente, err := h.Clientes.GetByEmail(r.FormValue("email")); err == nil {
+			h.fusionarCarritoInvitado(w, r, cliente.ID)
+		} else {
+			log.Println("Error obteniendo el cliente registrado:", err)
+		}
+
 		http.Redirect(w, r, "/login?registered=true", http.StatusSeeOther)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/register.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/register.html")
 	if err != nil {
 		log.Println("Error al cargar el template de registro", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -109,49 +122,10 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	// LogoutHandler limpia las cookies de sesión y redirige a la página principal.
-
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_id",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		Path:     "/",
-		HttpOnly: true,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     "user_perfil",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		Path:     "/",
-		HttpOnly: true,
-	})
-	http.SetCookie(w, &http.Cookie{
-		Name:     "token",
-		Value:    "",
-		Expires:  time.Now().Add(-1 * time.Hour),
-		Path:     "/",
-		HttpOnly: true,
-	})
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
-
-func GetSessionData(r *http.Request) (bool, string, string) {
-	// GetSessionData devuelve (loggedIn, perfil, id) consultando las cookies de sesión.
-	// `loggedIn` es true si existe la cookie `token` con valor "true".
-	tokenCookie, err := r.Cookie("token")
-	if err != nil || tokenCookie.Value != "true" {
-		return false, "", ""
-	}
-	perfilCookie, err := r.Cookie("user_perfil")
-	perfil := ""
-	if err == nil {
-		perfil = perfilCookie.Value
+func (h *Handler) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	// LogoutHandler invalida la sesión en el servidor y redirige a la página principal.
+	if err := h.cerrarSesion(w, r); err != nil {
+		log.Println("Error al cerrar la sesión:", err)
 	}
-	idCookie, err := r.Cookie("user_id")
-	id := ""
-	if err == nil {
-		id = idCookie.Value
-	}
-	return true, perfil, id
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
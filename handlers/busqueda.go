@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// opcionOrden es una entrada del selector de orden de la búsqueda.
+type opcionOrden struct {
+	Valor    string
+	Etiqueta string
+}
+
+var opcionesOrden = []opcionOrden{
+	{models.OrdenRelevancia, "Relevancia"},
+	{models.OrdenRecientes, "Más nuevos"},
+	{models.OrdenMasVendidos, "Más vendidos"},
+	{models.OrdenPrecioAsc, "Precio: menor a mayor"},
+	{models.OrdenPrecioDesc, "Precio: mayor a menor"},
+}
+
+// parsePagina lee `?pagina=N`; valores ausentes o inválidos devuelven 1.
+func parsePagina(r *http.Request) int {
+	pagina, err := strconv.Atoi(r.URL.Query().Get("pagina"))
+	if err != nil || pagina < 1 {
+		return 1
+	}
+	return pagina
+}
+
+// parsePrecio lee un precio opcional del query string. Devuelve 0 (sin filtro)
+// si está vacío, es inválido o es negativo.
+func parsePrecio(valor string) dinero.Monto {
+	precio, err := dinero.Parse(valor)
+	if err != nil || precio < 0 {
+		return 0
+	}
+	return precio
+}
+
+// urlPagina devuelve la URL actual con `pagina` reemplazada, conservando el
+// resto de los filtros.
+func urlPagina(r *http.Request, pagina int) string {
+	query := r.URL.Query()
+	query.Del("added")
+	if pagina <= 1 {
+		query.Del("pagina")
+	} else {
+		query.Set("pagina", strconv.Itoa(pagina))
+	}
+	if len(query) == 0 {
+		return r.URL.Path
+	}
+	return r.URL.Path + "?" + query.Encode()
+}
+
+func (h *Handler) SearchProducts(w http.ResponseWriter, r *http.Request) {
+	// SearchProducts atiende /buscar: texto libre sobre nombre, descripción y
+	// SKU, rango de precios, categoría (con subcategorías), solo disponibles,
+	// orden y paginación.
+	loggedIn, perfil, _ := h.GetSessionData(r)
+	query := r.URL.Query()
+
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error al obtener las categorías", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	filtros := parseIDs(query["categoria"])
+	busqueda := models.BusquedaProductos{
+		Texto:        query.Get("q"),
+		PrecioMin:    parsePrecio(query.Get("precio_min")),
+		PrecioMax:    parsePrecio(query.Get("precio_max")),
+		Categorias:   expandirCategorias(categorias, filtros),
+		SoloActivos:  true,
+		SoloConStock: query.Get("disponibles") == "1",
+		Orden:        query.Get("orden"),
+		Pagina:       parsePagina(r),
+	}
+
+	resultado, err := h.Productos.Buscar(busqueda)
+	if err != nil {
+		log.Println("Error al buscar productos", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/buscar.html", "templates/cliente/grilla_productos.html")
+	if err != nil {
+		log.Println("Error al cargar el template de búsqueda", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
+	}
+
+	orden := query.Get("orden")
+	if orden == "" {
+		orden = models.OrdenRelevancia
+	}
+
+	data := struct {
+		Busqueda           models.BusquedaProductos
+		Resultado          models.ResultadoBusqueda
+		Imagenes           map[int]string
+		ConVariantes       map[int]bool
+		PaginaAnteriorURL  string
+		PaginaSiguienteURL string
+		Categorias         []opcionCategoria
+		Ordenes            []opcionOrden
+		Orden              string
+		LoginToken         bool
+		Perfil             string
+	}{
+		Busqueda:           busqueda,
+		Resultado:          resultado,
+		Imagenes:           h.urlsPrincipales(resultado.Productos, "mediana"),
+		ConVariantes:       h.productosConVariantes(resultado.Productos),
+		PaginaAnteriorURL:  urlPagina(r, resultado.Pagina-1),
+		PaginaSiguienteURL: urlPagina(r, resultado.Pagina+1),
+		Categorias:         opcionesCategoria(categorias, filtros),
+		Ordenes:            opcionesOrden,
+		Orden:              orden,
+		LoginToken:         loggedIn,
+		Perfil:             perfil,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		log.Println("Error al ejecutar el template", err)
+	}
+}
@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// carritoCookieName es la cookie con el token firmado del carrito de invitado.
+	carritoCookieName = "carrito"
+	// CarritoInvitadoDuracion es la vida de un carrito de invitado; pasado
+	// ese plazo vence la cookie y el carrito puede eliminarse.
+	CarritoInvitadoDuracion = 30 * 24 * time.Hour
+)
+
+// tokenCarritoInvitado devuelve el token de la cookie del carrito de
+// invitado, o "" si no hay cookie o la firma no es válida.
+func (h *Handler) tokenCarritoInvitado(r *http.Request) string {
+	c, err := r.Cookie(carritoCookieName)
+	if err != nil {
+		return ""
+	}
+	var token string
+	if err := h.carritoCookie.Decode(carritoCookieName, c.Value, &token); err != nil {
+		log.Println("Cookie de carrito inválida:", err)
+		return ""
+	}
+	return token
+}
+
+// cookieCarrito escribe (o, con MaxAge < 0, expira) la cookie del carrito de invitado.
+func (h *Handler) cookieCarrito(w http.ResponseWriter, valor string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     carritoCookieName,
+		Value:    valor,
+		Path:     "/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   h.secureCookies,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// propietarioCarrito identifica a quien hace la petición como dueño de un
+// carrito: el cliente autenticado o el token de la cookie de invitado. Las
+// modificaciones de items se limitan a sus carritos.
+func (h *Handler) propietarioCarrito(r *http.Request) models.PropietarioCarrito {
+	if loggedIn, _, userIDStr := h.GetSessionData(r); loggedIn {
+		userID, _ := strconv.Atoi(userIDStr)
+		return models.PropietarioCarrito{IDCliente: userID}
+	}
+	return models.PropietarioCarrito{Token: h.tokenCarritoInvitado(r)}
+}
+
+// carritoActual devuelve el carrito de quien hace la petición: el del cliente
+// autenticado o, para un visitante anónimo, el de su cookie. Con `crear` el
+// carrito se crea si no existe (y al invitado se le entrega la cookie); sin
+// él, un visitante sin carrito recibe un Carrito con ID 0.
+func (h *Handler) carritoActual(w http.ResponseWriter, r *http.Request, crear bool) (models.Carrito, error) {
+	if loggedIn, _, userIDStr := h.GetSessionData(r); loggedIn {
+		userID, _ := strconv.Atoi(userIDStr)
+		if crear {
+			if err := h.Carritos.Create(userID); err != nil {
+				return models.Carrito{}, err
+			}
+		}
+		carrito, err := h.Carritos.GetByClienteID(userID)
+		if err != nil && !crear {
+			return models.Carrito{}, nil
+		}
+		return carrito, err
+	}
+
+	if token := h.tokenCarritoInvitado(r); token != "" {
+		if carrito, err := h.Carritos.GetByToken(token); err == nil {
+			return carrito, nil
+		}
+	}
+	if !crear {
+		return models.Carrito{}, nil
+	}
+
+	token, err := models.NewTokenCarrito()
+	if err != nil {
+		return models.Carrito{}, err
+	}
+	if err := h.Carritos.CreateInvitado(token); err != nil {
+		return models.Carrito{}, err
+	}
+	valor, err := h.carritoCookie.Encode(carritoCookieName, token)
+	if err != nil {
+		return models.Carrito{}, err
+	}
+	h.cookieCarrito(w, valor, int(CarritoInvitadoDuracion/time.Second))
+	return h.Carritos.GetByToken(token)
+}
+
+// fusionarCarritoInvitado pasa el carrito de invitado de la cookie al del
+// cliente que acaba de identificarse y expira la cookie. Un fallo no impide
+// el login: se registra y el carrito de invitado queda para otro intento.
+func (h *Handler) fusionarCarritoInvitado(w http.ResponseWriter, r *http.Request, idCliente int) {
+	token := h.tokenCarritoInvitado(r)
+	if token == "" {
+		return
+	}
+	if err := h.Carritos.Fusionar(token, idCliente); err != nil {
+		log.Println("Error fusionando carrito de invitado:", err)
+		return
+	}
+	h.cookieCarrito(w, "", -1)
+}
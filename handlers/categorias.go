@@ -0,0 +1,271 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// opcionCategoria es una categoría del árbol marcada como seleccionada o no,
+// para los filtros de la tienda y los selects del panel.
+type opcionCategoria struct {
+	models.NodoCategoria
+	Seleccionada bool
+}
+
+// opcionesCategoria arma el árbol de categorías marcando las seleccionadas.
+func opcionesCategoria(categorias []models.Categoria, seleccionadas []int) []opcionCategoria {
+	marcadas := map[int]bool{}
+	for _, id := range seleccionadas {
+		marcadas[id] = true
+	}
+	var opciones []opcionCategoria
+	for _, nodo := range models.ArbolCategorias(categorias) {
+		opciones = append(opciones, opcionCategoria{NodoCategoria: nodo, Seleccionada: marcadas[nodo.ID]})
+	}
+	return opciones
+}
+
+// parseIDs convierte una lista de valores de formulario en IDs, ignorando los
+// inválidos y los repetidos.
+func parseIDs(valores []string) []int {
+	var ids []int
+	vistos := map[int]bool{}
+	for _, v := range valores {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 || vistos[id] {
+			continue
+		}
+		vistos[id] = true
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (h *Handler) AdminCategories(w http.ResponseWriter, r *http.Request) {
+	// AdminCategories lista el árbol de categorías en el panel de administración.
+	h.renderAdminCategorias(w, r, "")
+}
+
+// renderAdminCategorias dibuja el listado de categorías con un mensaje de
+// error opcional (p. ej. al intentar borrar una categoría con subcategorías).
+func (h *Handler) renderAdminCategorias(w http.ResponseWriter, r *http.Request, mensajeError string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/categorias.html")
+	if err != nil {
+		log.Println("Error cargando templates admin categories:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		Categorias         []models.NodoCategoria
+		Error              string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:           perfil,
+		Categorias:       models.ArbolCategorias(categorias),
+		Error:            mensajeError,
+		CategoriasActive: true,
+	}
+
+	if mensajeError != "" {
+		w.WriteHeader(http.StatusConflict)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin categories:", err)
+	}
+}
+
+// categoriaDesdeFormulario lee los campos del formulario de categoría.
+func categoriaDesdeFormulario(r *http.Request) models.Categoria {
+	idPadre, _ := strconv.Atoi(r.FormValue("id_padre"))
+	return models.Categoria{
+		Nombre:      strings.TrimSpace(r.FormValue("nombre")),
+		Descripcion: strings.TrimSpace(r.FormValue("descripcion")),
+		IDPadre:     idPadre,
+	}
+}
+
+func (h *Handler) AdminCategoryCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminCategoryCreate muestra el formulario y crea categorías nuevas.
+	if r.Method == "POST" {
+		categoria := categoriaDesdeFormulario(r)
+		if categoria.Nombre == "" {
+			h.renderFormularioCategoria(w, r, false, categoria, "El nombre es obligatorio")
+			return
+		}
+		if err := h.Categorias.Create(categoria); err != nil {
+			log.Println("Error creando categoría:", err)
+			h.renderFormularioCategoria(w, r, false, categoria, "No se pudo crear la categoría: "+err.Error())
+			return
+		}
+		http.Redirect(w, r, "/admin/categorias", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioCategoria(w, r, false, models.Categoria{}, "")
+}
+
+func (h *Handler) AdminCategoryEdit(w http.ResponseWriter, r *http.Request) {
+	// AdminCategoryEdit edita el nombre, la descripción o el padre de una categoría.
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "ID de categoría inválido", http.StatusBadRequest)
+		return
+	}
+	existente, err := h.Categorias.GetByID(id)
+	if err != nil {
+		http.Error(w, "Categoría no encontrada", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		categoria := categoriaDesdeFormulario(r)
+		categoria.ID = id
+		if categoria.Nombre == "" {
+			h.renderFormularioCategoria(w, r, true, categoria, "El nombre es obligatorio")
+			return
+		}
+		if err := h.Categorias.Update(categoria); err != nil {
+			log.Println("Error actualizando categoría:", err)
+			h.renderFormularioCategoria(w, r, true, categoria, "No se pudo actualizar la categoría: "+err.Error())
+			return
+		}
+		http.Redirect(w, r, "/admin/categorias", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioCategoria(w, r, true, existente, "")
+}
+
+// renderFormularioCategoria dibuja el formulario de alta o edición. Como padre
+// solo se ofrecen categorías que no generen un ciclo.
+func (h *Handler) renderFormularioCategoria(w http.ResponseWriter, r *http.Request, isEdit bool, categoria models.Categoria, mensajeError string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	excluidas := map[int]bool{}
+	if isEdit {
+		for _, id := range models.Descendientes(categorias, categoria.ID) {
+			excluidas[id] = true
+		}
+	}
+	var padres []opcionCategoria
+	for _, opcion := range opcionesCategoria(categorias, []int{categoria.IDPadre}) {
+		if !excluidas[opcion.ID] {
+			padres = append(padres, opcion)
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_categoria.html")
+	if err != nil {
+		log.Println("Error cargando template admin category form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Categoria          models.Categoria
+		Padres             []opcionCategoria
+		Error              string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:           perfil,
+		IsEdit:           isEdit,
+		Categoria:        categoria,
+		Padres:           padres,
+		Error:            mensajeError,
+		CategoriasActive: true,
+	}
+
+	if mensajeError != "" {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin category form:", err)
+	}
+}
+
+func (h *Handler) AdminCategoryDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminCategoryDelete elimina una categoría sin subcategorías. Los productos
+	// asignados solo pierden la asignación.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Categorias.Delete(id); err != nil {
+		log.Println("Error eliminando categoría:", err)
+		if errors.Is(err, models.ErrCategoriaConSubcategorias) {
+			h.renderAdminCategorias(w, r, "No se puede eliminar una categoría que tiene subcategorías. Elimina o mueve primero sus subcategorías.")
+			return
+		}
+		h.renderAdminCategorias(w, r, "No se pudo eliminar la categoría.")
+		return
+	}
+	http.Redirect(w, r, "/admin/categorias", http.StatusSeeOther)
+}
+
+func (h *Handler) CategoryProducts(w http.ResponseWriter, r *http.Request) {
+	// CategoryProducts muestra los productos disponibles de una categoría y de
+	// todas sus subcategorías.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	categoria, err := h.Categorias.GetByID(id)
+	if err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Categoría no encontrada", "La categoría que buscas no existe.")
+		return
+	}
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	busqueda := models.BusquedaProductos{
+		Categorias:   models.Descendientes(categorias, id),
+		SoloActivos:  true,
+		SoloConStock: true,
+		Orden:        r.URL.Query().Get("orden"),
+		Pagina:       parsePagina(r),
+	}
+	h.renderCatalogo(w, r, busqueda, categorias, nil, categoria)
+}
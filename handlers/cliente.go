@@ -1,29 +1,66 @@
 package handlers
 
 import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
 	"Go-Sistemas-de-Gestion-empresarial/models"
-	"html/template"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 )
 
-func ClientProductDetail(w http.ResponseWriter, r *http.Request) {
+// opcionVariante es una variante ofrecida en el selector del detalle de
+// producto, con su precio de venta ya resuelto.
+type opcionVariante struct {
+	models.VarianteProducto
+	Precio dinero.Monto
+}
+
+func (h *Handler) ClientProductDetail(w http.ResponseWriter, r *http.Request) {
 	// ClientProductDetail muestra la página de detalle de un producto al cliente.
 	// Carga el producto por ID y renderiza el template correspondiente.
-	loggedIn, perfil, _ := GetSessionData(r)
+	loggedIn, perfil, _ := h.GetSessionData(r)
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	producto, err := models.GetProductoByID(id)
+	producto, err := h.Productos.GetByID(id)
 	if err != nil {
 		http.Error(w, "Producto no encontrado", http.StatusNotFound)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/detalle_producto.html")
+	imagenes, err := h.imagenesProducto(id)
+	if err != nil {
+		log.Println("Error obteniendo imágenes del producto:", err)
+	}
+	var principal imagenVista
+	for _, imagen := range imagenes {
+		if imagen.Principal {
+			principal = imagen
+		}
+	}
+
+	// Solo se ofrecen las variantes activas; las agotadas se muestran deshabilitadas.
+	variantes, err := h.Variantes.GetByProductoID(id)
+	if err != nil {
+		log.Println("Error obteniendo variantes del producto:", err)
+	}
+	var opcionesVariante []opcionVariante
+	hayVariantes := len(variantes) > 0
+	for _, v := range variantes {
+		if v.Activo {
+			opcionesVariante = append(opcionesVariante, opcionVariante{VarianteProducto: v, Precio: v.PrecioPara(producto)})
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/detalle_producto.html")
 	if err != nil {
 		log.Println("Error cargando template client product detail:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -31,66 +68,102 @@ func ClientProductDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Producto   models.Producto
-		LoginToken bool
-		Perfil     string
+		Producto     models.Producto
+		Imagenes     []imagenVista
+		Principal    imagenVista
+		HayVariantes bool
+		Variantes    []opcionVariante
+		ElegirOpcion bool
+		ConImpuestos bool
+		LoginToken   bool
+		Perfil       string
 	}{
-		Producto:   producto,
-		LoginToken: loggedIn,
-		Perfil:     perfil,
+		Producto:     producto,
+		Imagenes:     imagenes,
+		Principal:    principal,
+		HayVariantes: hayVariantes,
+		Variantes:    opcionesVariante,
+		ElegirOpcion: r.URL.Query().Get("variante") == "requerida",
+		ConImpuestos: models.PreciosConImpuestos(),
+		LoginToken:   loggedIn,
+		Perfil:       perfil,
 	}
 
 	tmpl.ExecuteTemplate(w, "base", data)
 }
 
-func ClientCart(w http.ResponseWriter, r *http.Request) {
-	// ClientCart muestra el carrito del cliente autenticado, calculando subtotales
-	// y el total del carrito antes de renderizar la vista.
-	loggedIn, perfil, userIDStr := GetSessionData(r)
-	if !loggedIn {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	userID, _ := strconv.Atoi(userIDStr)
+// CartItemDetail es un item del carrito con su producto, la variante elegida
+// (si la hay) y el precio de venta resuelto.
+type CartItemDetail struct {
+	models.ItemCarrito
+	Producto models.Producto
+	Variante models.VarianteProducto
+	Precio   dinero.Monto
+	// Disponible es el stock actual de la variante o, si no la hay, del producto.
+	Disponible int
+	Subtotal   dinero.Monto
+	// Descuento es el ahorro de las promociones en la línea (ver promocionesCarrito)
+	// y DescuentoCupon su parte del cupón (ver descuentoCupon).
+	Descuento      dinero.Monto
+	DescuentoCupon dinero.Monto
+}
 
-	models.CreateCarrito(userID)
+// detallesCarrito completa los items del carrito con producto y variante y
+// devuelve también el total.
+func (h *Handler) detallesCarrito(items []models.ItemCarrito) ([]CartItemDetail, dinero.Monto) {
+	var detalles []CartItemDetail
+	var total dinero.Monto
+	for _, item := range items {
+		detalle := CartItemDetail{ItemCarrito: item}
+		detalle.Producto, _ = h.Productos.GetByID(item.IDProducto)
+		detalle.Precio = detalle.Producto.Precio
+		detalle.Disponible = detalle.Producto.Stock
+		if item.IDVariante != 0 {
+			detalle.Variante, _ = h.Variantes.GetByID(item.IDVariante)
+			detalle.Precio = detalle.Variante.PrecioPara(detalle.Producto)
+			detalle.Disponible = detalle.Variante.Stock
+		}
+		detalle.Subtotal = detalle.Precio.Por(item.Cantidad)
+		detalles = append(detalles, detalle)
+		total += detalle.Subtotal
+	}
+	return detalles, total
+}
 
-	carrito, err := models.GetCarritoByClienteID(userID)
+func (h *Handler) ClientCart(w http.ResponseWriter, r *http.Request) {
+	// ClientCart muestra el carrito del cliente o del visitante, calculando
+	// subtotales y el total del carrito antes de renderizar la vista.
+	carrito, err := h.carritoActual(w, r, false)
 	if err != nil {
 		log.Println("Error obteniendo carrito:", err)
 		http.Error(w, "Error obteniendo carrito", http.StatusInternalServerError)
 		return
 	}
+	h.renderCarrito(w, r, carrito, http.StatusOK, nil)
+}
 
-	items, err := models.GetItemsByCarritoID(carrito.ID)
-	if err != nil {
-		log.Println("Error obteniendo items del carrito:", err)
-		http.Error(w, "Error obteniendo items", http.StatusInternalServerError)
-		return
-	}
+// renderCarrito dibuja el carrito con el estado indicado y, si los hay, los
+// errores de la última actualización de cantidades. Un carrito con ID 0 se
+// muestra vacío.
+func (h *Handler) renderCarrito(w http.ResponseWriter, r *http.Request, carrito models.Carrito, status int, errores []string) {
+	loggedIn, perfil, _ := h.GetSessionData(r)
 
-	type CartItemDetail struct {
-		models.ItemCarrito
-		Producto models.Producto
-		Subtotal float64
+	var items []models.ItemCarrito
+	var err error
+	if carrito.ID != 0 {
+		items, err = h.Carritos.GetItems(carrito.ID)
+		if err != nil {
+			log.Println("Error obteniendo items del carrito:", err)
+			http.Error(w, "Error obteniendo items", http.StatusInternalServerError)
+			return
+		}
 	}
 
-	var cartDetails []CartItemDetail
-	var totalCart float64
-
-	for _, item := range items {
-		prod, _ := models.GetProductoByID(item.IDProducto)
-		subtotal := float64(item.Cantidad) * prod.Precio
-		cartDetails = append(cartDetails, CartItemDetail{
-			ItemCarrito: item,
-			Producto:    prod,
-			Subtotal:    subtotal,
-		})
-		totalCart += subtotal
-	}
+	cartDetails, subtotal := h.detallesCarrito(items)
+	promocion := h.promocionesCarrito(cartDetails)
+	impuestos := h.impuestosCarrito(cartDetails)
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/carrito.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/carrito.html")
 	if err != nil {
 		log.Println("Error cargando template client cart:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -98,26 +171,122 @@ func ClientCart(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		CartItems  []CartItemDetail
-		Total      float64
-		LoginToken bool
-		Perfil     string
+		CartItems   []CartItemDetail
+		Subtotal    dinero.Monto
+		Promociones []models.PromocionAplicada
+		Ahorro      dinero.Monto
+		Impuestos   *models.DesgloseImpuestos
+		Total       dinero.Monto
+		Errores     []string
+		LoginToken  bool
+		Perfil      string
 	}{
-		CartItems:  cartDetails,
-		Total:      totalCart,
-		LoginToken: loggedIn,
-		Perfil:     perfil,
+		CartItems:   cartDetails,
+		Subtotal:    subtotal,
+		Promociones: promocion.Aplicadas,
+		Ahorro:      promocion.Total,
+		Impuestos:   impuestos,
+		Total:       subtotal - promocion.Total + impuestos.Adicional(),
+		Errores:     errores,
+		LoginToken:  loggedIn,
+		Perfil:      perfil,
+	}
+
+	w.WriteHeader(status)
+	tmpl.ExecuteTemplate(w, "base", data)
+}
+
+func (h *Handler) UpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	// UpdateCartItem fija la cantidad de una línea del carrito. Una cantidad 0
+	// quita la línea; si no, se valida contra el stock actual y que el
+	// producto (y la variante) sigan a la venta. Funciona igual para el
+	// carrito de invitado.
+
+	// Solo se aceptan líneas del carrito de quien hace la petición.
+	carrito, err := h.carritoActual(w, r, false)
+	if err != nil {
+		log.Println("Error obteniendo carrito:", err)
+		http.Error(w, "Error obteniendo carrito", http.StatusInternalServerError)
+		return
 	}
 
-	tmpl.ExecuteTemplate(w, "base", data)
+	idItem, _ := strconv.Atoi(r.FormValue("id_item"))
+	cantidad, err := strconv.Atoi(strings.TrimSpace(r.FormValue("cantidad")))
+	if err != nil || cantidad < 0 {
+		h.renderCarrito(w, r, carrito, http.StatusBadRequest, []string{"La cantidad debe ser un número entero no negativo"})
+		return
+	}
+	var items []models.ItemCarrito
+	if carrito.ID != 0 {
+		items, err = h.Carritos.GetItems(carrito.ID)
+		if err != nil {
+			log.Println("Error obteniendo items del carrito:", err)
+			http.Error(w, "Error obteniendo items", http.StatusInternalServerError)
+			return
+		}
+	}
+	var item models.ItemCarrito
+	for _, i := range items {
+		if i.ID == idItem {
+			item = i
+		}
+	}
+	if item.ID == 0 {
+		h.renderError(w, r, http.StatusNotFound, "Producto no encontrado", "El producto no está en tu carrito.")
+		return
+	}
+
+	propietario := h.propietarioCarrito(r)
+	if cantidad == 0 {
+		err = h.Carritos.RemoveItem(propietario, item.ID)
+	} else {
+		detalles, _ := h.detallesCarrito([]models.ItemCarrito{item})
+		if msg := validarCantidad(detalles[0], cantidad); msg != "" {
+			h.renderCarrito(w, r, carrito, http.StatusConflict, []string{msg})
+			return
+		}
+		err = h.Carritos.UpdateItem(propietario, item.ID, cantidad)
+	}
+	if errors.Is(err, models.ErrItemCarritoNoEncontrado) {
+		h.renderError(w, r, http.StatusNotFound, "Producto no encontrado", "El producto no está en tu carrito.")
+		return
+	}
+	if err != nil {
+		log.Println("Error actualizando item del carrito:", err)
+		http.Error(w, "Error actualizando item", http.StatusInternalServerError)
+		return
+	}
+
+	http.Redirect(w, r, "/carrito", http.StatusSeeOther)
+}
+
+// validarCantidad comprueba que la línea pueda llevar `cantidad` unidades.
+// Devuelve el mensaje para el cliente, o "" si es válida.
+func validarCantidad(detalle CartItemDetail, cantidad int) string {
+	nombre := detalle.Producto.Nombre
+	if detalle.Variante.ID != 0 {
+		nombre += " (" + detalle.Variante.Descripcion() + ")"
+	}
+	if !detalle.Producto.Activo || (detalle.Variante.ID != 0 && !detalle.Variante.Activo) {
+		return nombre + " ya no está a la venta; quítalo del carrito"
+	}
+	if cantidad > detalle.Disponible {
+		return fmt.Sprintf("%s: solo quedan %d unidades", nombre, detalle.Disponible)
+	}
+	return ""
 }
 
-func RemoveItemFromCart(w http.ResponseWriter, r *http.Request) {
-	// RemoveItemFromCart elimina un item del carrito por su ID y redirige al carrito.
+func (h *Handler) RemoveItemFromCart(w http.ResponseWriter, r *http.Request) {
+	// RemoveItemFromCart elimina un item del carrito de quien hace la petición
+	// y redirige al carrito. Los items de otros carritos responden 404.
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	err := models.RemoveItemFromCarrito(id)
+	err := h.Carritos.RemoveItem(h.propietarioCarrito(r), id)
+	if errors.Is(err, models.ErrItemCarritoNoEncontrado) {
+		h.renderError(w, r, http.StatusNotFound, "Producto no encontrado", "El producto no está en tu carrito.")
+		return
+	}
 	if err != nil {
 		log.Println("Error eliminando item del carrito:", err)
 		http.Error(w, "Error eliminando item", http.StatusInternalServerError)
@@ -127,35 +296,160 @@ func RemoveItemFromCart(w http.ResponseWriter, r *http.Request) {
 	http.Redirect(w, r, "/carrito", http.StatusSeeOther)
 }
 
-func ClientCheckout(w http.ResponseWriter, r *http.Request) {
-	// ClientCheckout muestra la página de checkout con el total calculado del carrito.
-	loggedIn, perfil, userIDStr := GetSessionData(r)
+func (h *Handler) ClientCheckout(w http.ResponseWriter, r *http.Request) {
+	// ClientCheckout muestra la página de checkout con el total calculado del
+	// carrito y el costo del envío elegido.
+	loggedIn, perfil, userIDStr := h.GetSessionData(r)
 	if !loggedIn {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
 	userID, _ := strconv.Atoi(userIDStr)
-	carrito, err := models.GetCarritoByClienteID(userID)
+	h.renderCheckout(w, r, userID, perfil, r.URL.Query().Get("cupon"), leerFormularioEnvio(r), nil)
+}
+
+// formularioEnvio es el método y la dirección de entrega elegidos en el
+// checkout. Error es el motivo por el que no sirvieron, si lo hay.
+type formularioEnvio struct {
+	IDMetodo  int
+	Direccion models.DireccionEnvio
+	Error     string
+}
+
+// leerFormularioEnvio lee el método y la dirección de entrega del formulario
+// o de la consulta.
+func leerFormularioEnvio(r *http.Request) formularioEnvio {
+	id, _ := strconv.Atoi(r.FormValue("envio"))
+	return formularioEnvio{
+		IDMetodo: id,
+		Direccion: models.DireccionEnvio{
+			Destinatario: strings.TrimSpace(r.FormValue("destinatario")),
+			Direccion:    strings.TrimSpace(r.FormValue("direccion")),
+			Provincia:    models.NormalizarProvincia(r.FormValue("provincia")),
+			Telefono:     strings.TrimSpace(r.FormValue("telefono")),
+		},
+	}
+}
+
+// OpcionEnvio es un método de envío del checkout con su costo para el
+// carrito y la provincia elegida.
+type OpcionEnvio struct {
+	models.MetodoEnvio
+	Costo        dinero.Monto
+	Disponible   bool
+	Seleccionado bool
+}
+
+// opcionesEnvio cotiza los métodos activos para la provincia, el peso y el
+// importe del carrito. Marca como seleccionado el método `idMetodo` si está
+// disponible o, si no, el primero que lo esté, y devuelve su costo.
+func (h *Handler) opcionesEnvio(idMetodo int, provincia string, peso float64, importe dinero.Monto) ([]OpcionEnvio, []string, dinero.Monto, error) {
+	metodos, err := h.Envios.GetMetodosActivos()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	zonas, err := h.Envios.GetZonas()
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	var provincias []string
+	for _, z := range zonas {
+		provincias = append(provincias, z.Provincias...)
+	}
+	sort.Strings(provincias)
+
+	idZona := models.ZonaDeProvincia(zonas, provincia)
+	opciones := make([]OpcionEnvio, len(metodos))
+	elegida := -1
+	for i, m := range metodos {
+		opciones[i].MetodoEnvio = m
+		opciones[i].Costo, opciones[i].Disponible = m.Cotizar(idZona, peso, importe)
+		if opciones[i].Disponible && (elegida == -1 || m.ID == idMetodo) {
+			elegida = i
+		}
+	}
+	if elegida == -1 {
+		return opciones, provincias, 0, nil
+	}
+	opciones[elegida].Seleccionado = true
+	return opciones, provincias, opciones[elegida].Costo, nil
+}
+
+// renderCheckout dibuja la página de checkout con el total actual del carrito,
+// el descuento del cupón `codigo` (si lo hay), las opciones de envío y, si los
+// hay, los errores del último intento de compra.
+func (h *Handler) renderCheckout(w http.ResponseWriter, r *http.Request, userID int, perfil, codigo string, envio formularioEnvio, errores []string) {
+	carrito, err := h.Carritos.GetByClienteID(userID)
 	if err != nil {
 		log.Println("Error obteniendo carrito:", err)
 		http.Error(w, "Error al obtener carrito", http.StatusInternalServerError)
 		return
 	}
-	items, err := models.GetItemsByCarritoID(carrito.ID)
+	items, err := h.Carritos.GetItems(carrito.ID)
 	if err != nil {
 		log.Println("Error obteniendo items:", err)
 		http.Error(w, "Error al obtener items", http.StatusInternalServerError)
 		return
 	}
 
-	var totalCart float64
-	for _, item := range items {
-		prod, _ := models.GetProductoByID(item.IDProducto)
-		totalCart += float64(item.Cantidad) * prod.Precio
+	detalles, subtotal := h.detallesCarrito(items)
+	promocion := h.promocionesCarrito(detalles)
+
+	// El cupón no válido se informa junto al campo y no impide comprar sin él.
+	var descuento dinero.Monto
+	var errorCupon string
+	codigo = models.NormalizarCodigo(codigo)
+	if codigo != "" {
+		descuento, err = h.descuentoCupon(codigo, userID, detalles, subtotal-promocion.Total)
+		if err != nil {
+			if !errors.Is(err, models.ErrCuponInvalido) {
+				log.Println("Error calculando el descuento del cupón:", err)
+			}
+			errorCupon = err.Error()
+			descuento = 0
+		}
+	}
+
+	// La primera vez se propone la dirección del perfil; después se respeta
+	// lo que escribió el cliente.
+	if r.Method == "GET" {
+		if cliente, err := h.Clientes.GetByID(userID); err == nil {
+			if envio.Direccion.Destinatario == "" {
+				envio.Direccion.Destinatario = cliente.Nombre
+			}
+			if envio.Direccion.Direccion == "" {
+				envio.Direccion.Direccion = cliente.Direccion
+			}
+			if envio.Direccion.Telefono == "" {
+				envio.Direccion.Telefono = cliente.Telefono
+			}
+		}
+	}
+
+	var peso float64
+	for _, d := range detalles {
+		peso += d.Producto.Peso * float64(d.Cantidad)
+	}
+	importe := subtotal - promocion.Total - descuento
+	impuestos := h.impuestosCarrito(detalles)
+	opciones, provincias, costoEnvio, err := h.opcionesEnvio(envio.IDMetodo, envio.Direccion.Provincia, peso, importe)
+	if err != nil {
+		log.Println("Error cotizando envíos:", err)
+		http.Error(w, "Error al cotizar envíos", http.StatusInternalServerError)
+		return
+	}
+
+	// El crédito a favor se aplica solo; si no se puede leer el saldo se
+	// muestra el total y el checkout lo aplica igual.
+	total := importe + impuestos.Adicional() + costoEnvio
+	saldo, err := h.Devoluciones.SaldoCredito(userID)
+	if err != nil {
+		log.Println("Error obteniendo crédito del cliente:", err)
 	}
+	credito := models.CreditoAplicable(saldo, total)
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/checkout.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/checkout.html")
 	if err != nil {
 		log.Println("Error cargando template client checkout:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -163,22 +457,57 @@ func ClientCheckout(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Total      float64
-		LoginToken bool
-		Perfil     string
+		Subtotal    dinero.Monto
+		Promociones []models.PromocionAplicada
+		Descuento   dinero.Monto
+		CostoEnvio  dinero.Monto
+		Impuestos   *models.DesgloseImpuestos
+		Total       dinero.Monto
+		Credito     dinero.Monto
+		APagar      dinero.Monto
+		Cupon       string
+		ErrorCupon  string
+		Envios      []OpcionEnvio
+		Envio       formularioEnvio
+		Provincias  []string
+		Errores     []string
+		LoginToken  bool
+		Perfil      string
 	}{
-		Total:      totalCart,
-		LoginToken: loggedIn,
-		Perfil:     perfil,
+		Subtotal:    subtotal,
+		Promociones: promocion.Aplicadas,
+		Descuento:   descuento,
+		CostoEnvio:  costoEnvio,
+		Impuestos:   impuestos,
+		Total:       total,
+		Credito:     credito,
+		APagar:      total - credito,
+		Cupon:       codigo,
+		ErrorCupon:  errorCupon,
+		Envios:      opciones,
+		Envio:       envio,
+		Provincias:  provincias,
+		Errores:     errores,
+		LoginToken:  true,
+		Perfil:      perfil,
+	}
+
+	switch {
+	case len(errores) > 0:
+		w.WriteHeader(http.StatusConflict)
+	case (errorCupon != "" || envio.Error != "") && r.Method == "POST":
+		w.WriteHeader(http.StatusUnprocessableEntity)
 	}
-
 	tmpl.ExecuteTemplate(w, "base", data)
 }
 
-func ProcessCheckout(w http.ResponseWriter, r *http.Request) {
-	// ProcessCheckout procesa la compra: crea el pedido, los detalles, actualiza stock
-	// y vacía el carrito. Redirige al perfil del usuario tras completar el pedido.
-	loggedIn, _, userIDStr := GetSessionData(r)
+func (h *Handler) ProcessCheckout(w http.ResponseWriter, r *http.Request) {
+	// ProcessCheckout crea el pedido en una sola transacción (ver
+	// models.ProcesarCheckout) y, ya confirmado, cobra el total en la
+	// pasarela. Si falta stock vuelve a mostrar el checkout con un mensaje por
+	// producto, si el cupón no aplica, el envío no sirve o el pago se rechaza,
+	// con el motivo; si no, redirige al perfil del usuario.
+	loggedIn, perfil, userIDStr := h.GetSessionData(r)
 	if !loggedIn {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
@@ -188,72 +517,89 @@ func ProcessCheckout(w http.ResponseWriter, r *http.Request) {
 		userID, _ := strconv.Atoi(userIDStr)
 		metodoPago := r.FormValue("metodo_pago") // tarjeta, transferencia, etc
 
-		carrito, err := models.GetCarritoByClienteID(userID)
-		if err != nil {
-			log.Println("Error obteniendo carrito:", err)
-			http.Error(w, "Error interno", http.StatusInternalServerError)
-			return
-		}
-		items, err := models.GetItemsByCarritoID(carrito.ID)
+		codigo := r.FormValue("cupon")
+		envio := leerFormularioEnvio(r)
+		id, err := h.Pedidos.Checkout(models.SolicitudCheckout{
+			IDCliente:     userID,
+			MetodoPago:    metodoPago,
+			CodigoCupon:   codigo,
+			IDMetodoEnvio: envio.IDMetodo,
+			Direccion:     envio.Direccion,
+		})
 		if err != nil {
-			log.Println("Error obteniendo items:", err)
-			http.Error(w, "Error interno", http.StatusInternalServerError)
+			var sinStock *models.StockInsuficienteError
+			switch {
+			case errors.As(err, &sinStock):
+				errores := make([]string, len(sinStock.Items))
+				for i, item := range sinStock.Items {
+					errores[i] = item.Mensaje()
+				}
+				h.renderCheckout(w, r, userID, perfil, codigo, envio, errores)
+			case errors.Is(err, models.ErrCuponInvalido):
+				// El cupón dejó de valer desde la vista previa (venció, se
+				// agotó...): se muestra el motivo junto al campo.
+				h.renderCheckout(w, r, userID, perfil, codigo, envio, nil)
+			case errors.Is(err, models.ErrEnvioInvalido):
+				envio.Error = err.Error()
+				h.renderCheckout(w, r, userID, perfil, codigo, envio, nil)
+			case errors.Is(err, models.ErrCarritoVacio):
+				http.Redirect(w, r, "/carrito", http.StatusSeeOther)
+			default:
+				log.Println("Error procesando checkout:", err)
+				http.Error(w, "Error procesando pedido", http.StatusInternalServerError)
+			}
 			return
 		}
 
-		var totalCart float64
-		for _, item := range items {
-			prod, _ := models.GetProductoByID(item.IDProducto)
-			totalCart += float64(item.Cantidad) * prod.Precio
-		}
-
-		transaccionID := "imulado_123" // Simulado
-		pedidoID, err := models.CreatePedido(userID, totalCart, metodoPago, transaccionID)
+		pedido, err := h.Pedidos.GetByID(id)
 		if err != nil {
-			log.Println("Error creando pedido:", err)
+			log.Println("Error obteniendo el pedido creado:", err)
 			http.Error(w, "Error procesando pedido", http.StatusInternalServerError)
 			return
 		}
-
-		for _, item := range items {
-			prod, _ := models.GetProductoByID(item.IDProducto)
-			models.CreateDetallePedido(pedidoID, item.IDProducto, item.Cantidad, prod.Precio)
-
-			newStock := prod.Stock - item.Cantidad
-			models.UpdateProducto(prod.ID, prod.Nombre, prod.Descripcion, prod.Precio, newStock, prod.SKU, prod.Activo)
-		}
-
-		err = models.EmptyCarrito(carrito.ID)
-		if err != nil {
-			log.Println("Error vaciando carrito:", err)
+		if pedido.Estado == models.EstadoPendiente {
+			// Si el cobro falla el pedido se cancela y los productos vuelven
+			// al carrito, así que el checkout se muestra como estaba.
+			if err := h.cobrarPedido(pedido); err != nil {
+				if !errors.Is(err, pagos.ErrPagoRechazado) {
+					log.Println("Error cobrando el pedido", id, err)
+					err = errors.New("no se pudo procesar el pago")
+				}
+				h.renderCheckout(w, r, userID, perfil, codigo, envio, []string{"La pasarela respondió: " + err.Error() + ". Prueba con otro método de pago."})
+				return
+			}
 		}
 
 		http.Redirect(w, r, "/perfil?order_success=true", http.StatusSeeOther)
 	}
 }
 
-func ClientProfile(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ClientProfile(w http.ResponseWriter, r *http.Request) {
 	// ClientProfile muestra el perfil del cliente autenticado junto con sus pedidos.
-	loggedIn, perfil, userIDStr := GetSessionData(r)
+	loggedIn, perfil, userIDStr := h.GetSessionData(r)
 	if !loggedIn {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
 	userID, _ := strconv.Atoi(userIDStr)
-	cliente, err := models.GetClienteByID(userID)
+	cliente, err := h.Clientes.GetByID(userID)
 	if err != nil {
 		log.Println("Error obteniendo cliente:", err)
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
-	myPedidos, err := models.GetPedidosByClienteID(userID)
+	myPedidos, err := h.Pedidos.GetByClienteID(userID)
 	if err != nil {
 		log.Println("Error obteniendo pedidos del cliente:", err)
 	}
+	credito, err := h.Devoluciones.SaldoCredito(userID)
+	if err != nil {
+		log.Println("Error obteniendo crédito del cliente:", err)
+	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/perfil.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/perfil.html")
 	if err != nil {
 		log.Println("Error cargando template client profile:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -263,12 +609,14 @@ func ClientProfile(w http.ResponseWriter, r *http.Request) {
 	data := struct {
 		Cliente    models.Cliente
 		Pedidos    []models.Pedido
+		Credito    dinero.Monto
 		LoginToken bool
 		Perfil     string
 		Success    bool
 	}{
 		Cliente:    cliente,
 		Pedidos:    myPedidos,
+		Credito:    credito,
 		LoginToken: loggedIn,
 		Perfil:     perfil,
 		Success:    r.URL.Query().Get("order_success") == "true",
@@ -277,9 +625,9 @@ func ClientProfile(w http.ResponseWriter, r *http.Request) {
 	tmpl.ExecuteTemplate(w, "base", data)
 }
 
-func ClientProfileEdit(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ClientProfileEdit(w http.ResponseWriter, r *http.Request) {
 	// ClientProfileEdit permite editar los datos del perfil del cliente autenticado.
-	loggedIn, perfil, userIDStr := GetSessionData(r)
+	loggedIn, perfil, userIDStr := h.GetSessionData(r)
 	if !loggedIn {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
@@ -292,7 +640,13 @@ func ClientProfileEdit(w http.ResponseWriter, r *http.Request) {
 		telefono := r.FormValue("telefono")
 		direccion := r.FormValue("direccion")
 
-		err := models.UpdateCliente(userID, nombre, email, direccion, telefono)
+		err := h.Clientes.Update(models.Cliente{
+			ID:        userID,
+			Nombre:    nombre,
+			Email:     email,
+			Direccion: direccion,
+			Telefono:  telefono,
+		})
 		if err != nil {
 			log.Println("Error actualizando perfil:", err)
 			http.Error(w, "Error actualizando perfil", http.StatusInternalServerError)
@@ -302,14 +656,14 @@ func ClientProfileEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cliente, err := models.GetClienteByID(userID)
+	cliente, err := h.Clientes.GetByID(userID)
 	if err != nil {
 		log.Println("Error obteniendo cliente:", err)
 		http.Error(w, "Error al cargar perfil", http.StatusInternalServerError)
 		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/editar_perfil.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/editar_perfil.html")
 	if err != nil {
 		log.Println("Error cargando template client profile edit:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -329,9 +683,9 @@ func ClientProfileEdit(w http.ResponseWriter, r *http.Request) {
 	tmpl.ExecuteTemplate(w, "base", data)
 }
 
-func ClientOrderDetail(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) ClientOrderDetail(w http.ResponseWriter, r *http.Request) {
 	// ClientOrderDetail muestra los detalles de un pedido del cliente autenticado.
-	loggedIn, perfil, userIDStr := GetSessionData(r)
+	loggedIn, perfil, userIDStr := h.GetSessionData(r)
 	if !loggedIn {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
@@ -341,7 +695,7 @@ func ClientOrderDetail(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	orderID, _ := strconv.Atoi(vars["id"])
 
-	pedido, err := models.GetPedidoByID(orderID)
+	pedido, err := h.Pedidos.GetByID(orderID)
 	if err != nil {
 		http.Error(w, "Pedido no encontrado", http.StatusNotFound)
 		return
@@ -352,14 +706,41 @@ func ClientOrderDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	detalles, err := models.GetDetallesByPedidoID(orderID)
+	detalles, err := h.Pedidos.GetDetalles(orderID)
 	if err != nil {
 		log.Println("Error obteniendo detalles:", err)
 		http.Error(w, "Error al cargar detalles de la orden", http.StatusInternalServerError)
 		return
 	}
+	promociones, err := h.Pedidos.GetPromociones(orderID)
+	if err != nil {
+		log.Println("Error obteniendo promociones del pedido:", err)
+	}
+	historial, err := h.Pedidos.GetHistorial(orderID)
+	if err != nil {
+		log.Println("Error obteniendo historial del pedido:", err)
+	}
+	envios, err := h.Envios.GetEnviosPedido(orderID)
+	if err != nil {
+		log.Println("Error obteniendo envíos del pedido:", err)
+	}
+	devoluciones, err := h.Devoluciones.GetByPedidoID(orderID)
+	if err != nil {
+		log.Println("Error obteniendo devoluciones del pedido:", err)
+	}
+	// Se ofrece devolver mientras quede alguna unidad sin devolución abierta
+	// o resuelta.
+	puedeDevolver := false
+	if pedido.Estado == models.EstadoEntregado && err == nil {
+		for _, n := range models.Devolvibles(detalles, devoluciones) {
+			if n > 0 {
+				puedeDevolver = true
+				break
+			}
+		}
+	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/detalle_orden.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/detalle_orden.html")
 	if err != nil {
 		log.Println("Error cargando template client order detail:", err)
 		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
@@ -367,16 +748,79 @@ func ClientOrderDetail(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Pedido     models.Pedido
-		Detalles   []models.DetallePedido
-		LoginToken bool
-		Perfil     string
+		Pedido        models.Pedido
+		Detalles      []models.DetallePedido
+		Promociones   []models.PromocionAplicada
+		Impuestos     models.DesgloseImpuestos
+		Historial     []models.CambioEstado
+		Envios        []envioVista
+		Devoluciones  []models.Devolucion
+		PuedeDevolver bool
+		LoginToken    bool
+		Perfil        string
 	}{
-		Pedido:     pedido,
-		Detalles:   detalles,
-		LoginToken: loggedIn,
-		Perfil:     perfil,
+		Pedido:        pedido,
+		Detalles:      detalles,
+		Promociones:   promociones,
+		Impuestos:     models.DesgloseDePedido(pedido, detalles),
+		Historial:     historial,
+		Envios:        h.enviosVista(envios),
+		Devoluciones:  devoluciones,
+		PuedeDevolver: puedeDevolver,
+		LoginToken:    loggedIn,
+		Perfil:        perfil,
 	}
 
 	tmpl.ExecuteTemplate(w, "base", data)
 }
+
+func (h *Handler) ClientOrderCancel(w http.ResponseWriter, r *http.Request) {
+	// ClientOrderCancel cancela un pedido del cliente que todavía no se envió:
+	// repone el stock, devuelve el pago y guarda el motivo en el historial.
+	cliente, ok := h.GetSessionCliente(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	pedido, err := h.Pedidos.GetByID(id)
+	if err != nil || pedido.IDCliente != cliente.ID {
+		h.renderError(w, r, http.StatusNotFound, "Pedido no encontrado", "El pedido no existe.")
+		return
+	}
+
+	motivo := strings.TrimSpace(r.FormValue("motivo"))
+	if motivo == "" {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Falta el motivo", "Cuéntanos por qué cancelas el pedido.")
+		return
+	}
+	if utf8.RuneCountInString(motivo) > 255 {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Motivo demasiado largo", "El motivo admite hasta 255 caracteres.")
+		return
+	}
+
+	cambio, err := h.Pedidos.CambiarEstado(models.SolicitudCambioEstado{
+		IDPedido:     id,
+		Estado:       models.EstadoCancelado,
+		IDCliente:    cliente.ID,
+		Responsable:  cliente.Nombre,
+		Motivo:       motivo,
+		DevolverPago: true,
+	})
+	switch {
+	case errors.Is(err, models.ErrTransicionInvalida):
+		h.renderError(w, r, http.StatusConflict, "No se puede cancelar el pedido", "Solo se pueden cancelar los pedidos que todavía no se enviaron.")
+		return
+	case err != nil:
+		log.Println("Error cancelando el pedido:", err)
+		http.Error(w, "Error cancelando el pedido", http.StatusInternalServerError)
+		return
+	}
+	h.notificarCambioEstado(cambio)
+	// El pedido ya está cancelado: si la pasarela falla, el reembolso queda
+	// pendiente y se reintenta solo.
+	h.reembolsarPedido(id)
+
+	http.Redirect(w, r, fmt.Sprintf("/pedidos/%d", id), http.StatusSeeOther)
+}
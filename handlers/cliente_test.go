@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCheckoutCreaPedidoPagado(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	remera := e.producto("Remera", dinero.Pesos(10), 5)
+	pan := e.producto("Pan", dinero.Centavos(10), 10)
+
+	n := e.login("bea@test")
+	n.agregar(remera, 2)
+	n.agregar(pan, 3)
+	id := n.comprar(nil)
+
+	p := e.pedido(id)
+	if p.Estado != models.EstadoPagado || p.TransaccionID == "" {
+		t.Errorf("pedido %s con transacción %q, se esperaba PAGADO con transacción", p.Estado, p.TransaccionID)
+	}
+	if want := dinero.Centavos(20_30); p.Subtotal != want || p.Total != want {
+		t.Errorf("subtotal %s y total %s, se esperaba %s", p.Subtotal, p.Total, want)
+	}
+	if e.stock(remera) != 3 || e.stock(pan) != 7 {
+		t.Errorf("stock %d y %d, se esperaba 3 y 7", e.stock(remera), e.stock(pan))
+	}
+	detalles, _ := e.repos.Pedidos.GetDetalles(id)
+	if len(detalles) != 2 {
+		t.Fatalf("%d detalles, se esperaban 2", len(detalles))
+	}
+	carrito, _ := e.repos.Carritos.GetByClienteID(p.IDCliente)
+	if items, _ := e.repos.Carritos.GetItems(carrito.ID); len(items) != 0 {
+		t.Errorf("el carrito quedó con %d items", len(items))
+	}
+	historial, _ := e.repos.Pedidos.GetHistorial(id)
+	if len(historial) == 0 || historial[len(historial)-1].EstadoNuevo != models.EstadoPagado {
+		t.Errorf("historial %+v, se esperaba terminar en PAGADO", historial)
+	}
+}
+
+func TestCheckoutSinStockNoCreaPedido(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 2)
+	// Otro cliente compra antes y deja una sola unidad.
+	if err := e.repos.Productos.Update(models.Producto{ID: taza, Nombre: "Taza", SKU: "TAZA", Precio: dinero.Pesos(5), Stock: 1, Activo: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	status, _, cuerpo := n.post("/checkout", url.Values{"metodo_pago": {"tarjeta"}})
+	if status != http.StatusConflict || !strings.Contains(cuerpo, "Taza: pediste 2 unidades pero solo quedan 1") {
+		t.Fatalf("checkout sin stock: %d, se esperaba el checkout con el aviso de stock", status)
+	}
+	if pedidos, _ := e.repos.Pedidos.GetAll(); len(pedidos) != 0 {
+		t.Errorf("se crearon %d pedidos", len(pedidos))
+	}
+	if e.stock(taza) != 1 {
+		t.Errorf("stock %d, se esperaba 1", e.stock(taza))
+	}
+}
+
+func TestCheckoutConCuponEImpuestos(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	if err := e.repos.Impuestos.Create(models.ClaseImpuesto{Nombre: "IVA 21%", Tasa: 21, Predeterminada: true}); err != nil {
+		t.Fatal(err)
+	}
+	mate := e.producto("Mate", dinero.Pesos(121), 10)
+	if err := e.repos.Cupones.Create(models.Cupon{Codigo: "DIEZ", Tipo: models.CuponPorcentaje, Porcentaje: 10, Activo: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := e.login("bea@test")
+	n.agregar(mate, 1)
+	id := n.comprar(url.Values{"cupon": {"diez"}})
+
+	// Los precios incluyen el IVA: el cupón baja el total a 108,90 y el
+	// impuesto se calcula sobre lo cobrado.
+	p := e.pedido(id)
+	if p.Descuento != dinero.Centavos(12_10) || p.Total != dinero.Centavos(108_90) {
+		t.Errorf("descuento %s y total %s, se esperaba 12.10 y 108.90", p.Descuento, p.Total)
+	}
+	if p.Impuestos != dinero.Centavos(18_90) || !p.ImpuestosIncluidos {
+		t.Errorf("impuestos %s (incluidos %v), se esperaba 18.90 incluidos", p.Impuestos, p.ImpuestosIncluidos)
+	}
+	cupon, _ := e.repos.Cupones.GetByCodigo("DIEZ")
+	if cupon.Usos != 1 {
+		t.Errorf("el cupón tiene %d usos, se esperaba 1", cupon.Usos)
+	}
+}
+
+func TestCheckoutPagoRechazadoAnulaPedido(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoRechazar)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+	if err := e.repos.Cupones.Create(models.Cupon{Codigo: "DIEZ", Tipo: models.CuponPorcentaje, Porcentaje: 10, Activo: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := e.login("bea@test")
+	n.agregar(taza, 2)
+	status, _, cuerpo := n.post("/checkout", url.Values{"metodo_pago": {"tarjeta"}, "cupon": {"DIEZ"}})
+	if status != http.StatusConflict || !strings.Contains(cuerpo, "fondos insuficientes") {
+		t.Fatalf("pago rechazado: %d, se esperaba el checkout con el motivo", status)
+	}
+
+	// El pedido se creó antes de cobrar y quedó cancelado con el motivo.
+	pedidos, _ := e.repos.Pedidos.GetAll()
+	if len(pedidos) != 1 || pedidos[0].Estado != models.EstadoCancelado {
+		t.Fatalf("pedidos %+v, se esperaba uno CANCELADO", pedidos)
+	}
+	historial, _ := e.repos.Pedidos.GetHistorial(pedidos[0].ID)
+	if len(historial) != 2 || !strings.Contains(historial[1].Motivo, "fondos insuficientes") {
+		t.Errorf("historial %+v, se esperaba la cancelación con el motivo", historial)
+	}
+	if e.stock(taza) != 3 {
+		t.Errorf("stock %d, se esperaba 3", e.stock(taza))
+	}
+	if cupon, _ := e.repos.Cupones.GetByCodigo("DIEZ"); cupon.Usos != 0 {
+		t.Errorf("el cupón quedó con %d usos", cupon.Usos)
+	}
+	if _, cuerpo := n.get("/carrito"); !strings.Contains(cuerpo, "Taza") {
+		t.Error("el carrito no recuperó sus items")
+	}
+
+	// Con el carrito recuperado se puede reintentar.
+	if err := e.pasarela.SetModo(pagos.ModoAprobar); err != nil {
+		t.Fatal(err)
+	}
+	if p := e.pedido(n.comprar(url.Values{"cupon": {"DIEZ"}})); p.Estado != models.EstadoPagado || p.Total != dinero.Pesos(9) {
+		t.Errorf("reintento: pedido %s por %s, se esperaba PAGADO por 9.00", p.Estado, p.Total)
+	}
+}
+
+func TestCheckoutWebhookDeCapturaNoDuplicaElPago(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 1)
+	p := e.pedido(n.comprar(nil))
+
+	// El webhook de la captura llega después de que el checkout marcó el
+	// pedido PAGADO: encuentra el pedido y no lo vuelve a cambiar.
+	if status := e.webhook(pagos.Evento{ID: "evt_1", Tipo: pagos.EventoAprobado, TransaccionID: p.TransaccionID, Monto: p.Total}); status != http.StatusOK {
+		t.Fatalf("webhook: %d, se esperaba 200", status)
+	}
+	historial, _ := e.repos.Pedidos.GetHistorial(p.ID)
+	if len(historial) != 2 || historial[0].EstadoNuevo != models.EstadoPendiente || historial[1].EstadoNuevo != models.EstadoPagado {
+		t.Errorf("historial %+v, se esperaba PENDIENTE y luego PAGADO", historial)
+	}
+	if avisos := e.notificador.Enviados(); len(avisos) != 1 {
+		t.Errorf("%d avisos al cliente, se esperaba uno por el pago", len(avisos))
+	}
+}
+
+func TestClienteCancelaPedidoPagado(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Otro", "otro@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 2)
+	id := n.comprar(nil)
+	ruta := "/pedidos/" + strconv.Itoa(id) + "/cancelar"
+
+	if status, _, _ := e.login("otro@test").post(ruta, url.Values{"motivo": {"ajeno"}}); status != http.StatusNotFound {
+		t.Errorf("cancelar un pedido ajeno: %d, se esperaba 404", status)
+	}
+	if status, _, _ := n.post(ruta, nil); status != http.StatusUnprocessableEntity {
+		t.Errorf("cancelar sin motivo: %d, se esperaba 422", status)
+	}
+	if status, _, _ := n.post(ruta, url.Values{"motivo": {strings.Repeat("ñ", 256)}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("cancelar con un motivo de 256 caracteres: %d, se esperaba 422", status)
+	}
+	// El límite es de caracteres, no de bytes.
+	if status, _, _ := n.post(ruta, url.Values{"motivo": {strings.Repeat("ñ", 255)}}); status != http.StatusSeeOther {
+		t.Fatalf("cancelar: %d, se esperaba 303", status)
+	}
+
+	p := e.pedido(id)
+	if p.Estado != models.EstadoCancelado || p.Reembolsado != p.Total {
+		t.Errorf("pedido %s con %s reembolsado de %s, se esperaba CANCELADO y reembolso total", p.Estado, p.Reembolsado, p.Total)
+	}
+	if e.stock(taza) != 3 {
+		t.Errorf("stock %d, se esperaba 3", e.stock(taza))
+	}
+	if status, _, _ := n.post(ruta, url.Values{"motivo": {"otra vez"}}); status != http.StatusConflict {
+		t.Errorf("cancelar dos veces: %d, se esperaba 409", status)
+	}
+}
+
+func TestCarritoAjenoResponde404(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	idBea := e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Otro", "otro@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+
+	e.login("bea@test").agregar(taza, 2)
+	carrito, _ := e.repos.Carritos.GetByClienteID(idBea)
+	items, _ := e.repos.Carritos.GetItems(carrito.ID)
+	if len(items) != 1 {
+		t.Fatalf("%d items en el carrito de bea, se esperaba 1", len(items))
+	}
+	item := strconv.Itoa(items[0].ID)
+
+	for _, intruso := range []*navegador{e.login("otro@test"), e.navegador()} {
+		if status, _, cuerpo := intruso.post("/carrito/actualizar", url.Values{"id_item": {item}, "cantidad": {"5"}}); status != http.StatusNotFound || !strings.Contains(cuerpo, "no está en tu carrito") {
+			t.Errorf("cambiar un item ajeno: %d, se esperaba la página 404", status)
+		}
+		if status, _, _ := intruso.post("/carrito/actualizar", url.Values{"id_item": {item}, "cantidad": {"0"}}); status != http.StatusNotFound {
+			t.Errorf("vaciar un item ajeno: %d, se esperaba 404", status)
+		}
+		if status, _, _ := intruso.post("/carrito/eliminar/"+item, nil); status != http.StatusNotFound {
+			t.Errorf("eliminar un item ajeno: %d, se esperaba 404", status)
+		}
+	}
+
+	items, _ = e.repos.Carritos.GetItems(carrito.ID)
+	if len(items) != 1 || items[0].Cantidad != 2 {
+		t.Errorf("el carrito de bea quedó con %+v, se esperaba la taza con 2 unidades", items)
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"path/filepath"
+)
+
+const (
+	// claveCSRF es la clave de session.Values con el token CSRF de la sesión.
+	claveCSRF = "csrf_token"
+	// csrfFieldName es el nombre del campo oculto que envían los formularios.
+	csrfFieldName = "csrf_token"
+	// csrfHeaderName permite enviar el token en peticiones que no son formularios.
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// csrfContextKey es la clave del token CSRF en el contexto de la petición.
+type csrfContextKey struct{}
+
+// CSRF es un middleware que emite un token por sesión en las peticiones
+// seguras (GET, HEAD, OPTIONS) y exige ese mismo token, en el campo
+// `csrf_token` o en la cabecera `X-CSRF-Token`, en cualquier otro método.
+func (h *Handler) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := h.getSession(r)
+		token, _ := session.Values[claveCSRF].(string)
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			if token == "" {
+				var err error
+				token, err = newCSRFToken()
+				if err != nil {
+					log.Println("Error generando token CSRF:", err)
+					http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+					return
+				}
+				session.Values[claveCSRF] = token
+				if err := session.Save(r, w); err != nil {
+					log.Println("Error guardando token CSRF en la sesión:", err)
+				}
+			}
+		default:
+			// El formulario se lee aquí por primera vez: si el cuerpo supera el
+			// límite de LimitarCuerpo se responde 413 en lugar de un CSRF inválido.
+			var demasiadoGrande *http.MaxBytesError
+			if err := r.ParseMultipartForm(32 << 20); errors.As(err, &demasiadoGrande) {
+				h.renderError(w, r, http.StatusRequestEntityTooLarge, "Envío demasiado grande", "Los datos enviados superan el tamaño permitido. Si subiste imágenes, envía menos o más livianas.")
+				return
+			}
+			sent := r.Header.Get(csrfHeaderName)
+			if sent == "" {
+				sent = r.FormValue(csrfFieldName)
+			}
+			if token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(sent)) != 1 {
+				log.Println("Token CSRF inválido en", r.Method, r.URL.Path)
+				h.renderError(w, r, http.StatusForbidden, "Solicitud rechazada", "El formulario expiró o no es válido. Vuelve a cargar la página e inténtalo de nuevo.")
+				return
+			}
+		}
+
+		ctx := context.WithValue(r.Context(), csrfContextKey{}, token)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// newCSRFToken genera un token aleatorio de 256 bits.
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// csrfToken devuelve el token CSRF que el middleware CSRF dejó en el contexto.
+func csrfToken(r *http.Request) string {
+	token, _ := r.Context().Value(csrfContextKey{}).(string)
+	return token
+}
+
+// parseTemplates carga los templates indicados registrando las funciones
+// `csrfToken` y `csrfField`, disponibles en todas las vistas que usan
+// `base` o `layout`.
+func parseTemplates(r *http.Request, files ...string) (*template.Template, error) {
+	token := csrfToken(r)
+	funcs := template.FuncMap{
+		"csrfToken": func() string { return token },
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + csrfFieldName + `" value="` + template.HTMLEscapeString(token) + `">`)
+		},
+	}
+	return template.New(filepath.Base(files[0])).Funcs(funcs).ParseFiles(files...)
+}
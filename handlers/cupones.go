@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// opcionProducto es un producto marcado como seleccionado o no, para los
+// selects del panel.
+type opcionProducto struct {
+	models.Producto
+	Seleccionado bool
+}
+
+// opcionesProducto arma la lista de productos marcando los seleccionados.
+func opcionesProducto(productos []models.Producto, seleccionados []int) []opcionProducto {
+	marcados := map[int]bool{}
+	for _, id := range seleccionados {
+		marcados[id] = true
+	}
+	opciones := make([]opcionProducto, len(productos))
+	for i, p := range productos {
+		opciones[i] = opcionProducto{Producto: p, Seleccionado: marcados[p.ID]}
+	}
+	return opciones
+}
+
+func (h *Handler) AdminCoupons(w http.ResponseWriter, r *http.Request) {
+	// AdminCoupons lista los cupones con su vigencia y sus usos.
+	_, perfil, _ := h.GetSessionData(r)
+
+	cupones, err := h.Cupones.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo cupones:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/cupones.html")
+	if err != nil {
+		log.Println("Error cargando templates admin coupons:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		Cupones            []models.Cupon
+		Ahora              time.Time
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:        perfil,
+		Cupones:       cupones,
+		Ahora:         time.Now(),
+		CuponesActive: true,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin coupons:", err)
+	}
+}
+
+// cuponDesdeFormulario lee los campos del formulario de cupón. Devuelve
+// también los errores de formato de los campos numéricos y de fecha.
+func cuponDesdeFormulario(r *http.Request) (models.Cupon, []string) {
+	r.ParseForm()
+	cupon := models.Cupon{
+		Codigo:      models.NormalizarCodigo(r.FormValue("codigo")),
+		Descripcion: strings.TrimSpace(r.FormValue("descripcion")),
+		Tipo:        r.FormValue("tipo"),
+		Activo:      r.FormValue("activo") == "on",
+		Productos:   parseIDs(r.Form["productos"]),
+		Categorias:  parseIDs(r.Form["categorias"]),
+	}
+
+	f := &lectorFormulario{r: r}
+	if cupon.Tipo == models.CuponMonto {
+		cupon.Monto = f.importe("valor", "El monto del descuento", true)
+	} else {
+		cupon.Porcentaje = f.decimal("valor", "El porcentaje de descuento", true)
+	}
+	cupon.MinimoCompra = f.importe("minimo_compra", "El pedido mínimo", false)
+	cupon.UsosMaximos = f.entero("usos_maximos", "El límite de usos")
+	cupon.UsosPorCliente = f.entero("usos_por_cliente", "El límite por cliente")
+	cupon.ValidoDesde = f.fecha("valido_desde", "La fecha de inicio")
+	cupon.ValidoHasta = f.fecha("valido_hasta", "La fecha de fin")
+
+	if len(f.errores) == 0 {
+		if err := models.ValidarCupon(cupon); err != nil {
+			f.errores = append(f.errores, err.Error())
+		}
+	}
+	return cupon, f.errores
+}
+
+func (h *Handler) AdminCouponCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminCouponCreate muestra el formulario y crea cupones nuevos.
+	if r.Method == "POST" {
+		cupon, errores := cuponDesdeFormulario(r)
+		if len(errores) == 0 {
+			if err := h.Cupones.Create(cupon); err != nil {
+				log.Println("Error creando cupón:", err)
+				errores = append(errores, "No se pudo crear el cupón: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioCupon(w, r, false, cupon, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/cupones", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioCupon(w, r, false, models.Cupon{Tipo: models.CuponPorcentaje, Activo: true}, nil)
+}
+
+func (h *Handler) AdminCouponEdit(w http.ResponseWriter, r *http.Request) {
+	// AdminCouponEdit edita un cupón. El contador de usos no se modifica.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	existente, err := h.Cupones.GetByID(id)
+	if err != nil {
+		http.Error(w, "Cupón no encontrado", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		cupon, errores := cuponDesdeFormulario(r)
+		cupon.ID = id
+		cupon.Usos = existente.Usos
+		if len(errores) == 0 {
+			if err := h.Cupones.Update(cupon); err != nil {
+				log.Println("Error actualizando cupón:", err)
+				errores = append(errores, "No se pudo actualizar el cupón: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioCupon(w, r, true, cupon, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/cupones", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioCupon(w, r, true, existente, nil)
+}
+
+// renderFormularioCupon dibuja el formulario de alta o edición con los
+// productos y categorías a los que se puede restringir el cupón.
+func (h *Handler) renderFormularioCupon(w http.ResponseWriter, r *http.Request, isEdit bool, cupon models.Cupon, errores []string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	productos, err := h.Productos.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo productos:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_cupon.html")
+	if err != nil {
+		log.Println("Error cargando template admin coupon form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Cupon              models.Cupon
+		ValidoDesde        string
+		ValidoHasta        string
+		Productos          []opcionProducto
+		Categorias         []opcionCategoria
+		Errores            []string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:        perfil,
+		IsEdit:        isEdit,
+		Cupon:         cupon,
+		ValidoDesde:   fechaFormulario(cupon.ValidoDesde),
+		ValidoHasta:   fechaFormulario(cupon.ValidoHasta),
+		Productos:     opcionesProducto(productos, cupon.Productos),
+		Categorias:    opcionesCategoria(categorias, cupon.Categorias),
+		Errores:       errores,
+		CuponesActive: true,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin coupon form:", err)
+	}
+}
+
+func (h *Handler) AdminCouponDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminCouponDelete elimina un cupón. Los pedidos que lo usaron conservan
+	// el código y el descuento.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Cupones.Delete(id); err != nil {
+		log.Println("Error eliminando cupón:", err)
+		http.Error(w, "Error eliminando cupón", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/cupones", http.StatusSeeOther)
+}
+
+// descuentoCupon calcula, para mostrarlo antes de confirmar, el descuento que
+// el cupón daría sobre las líneas del carrito, ya con las promociones
+// aplicadas, y deja en cada una su parte; `subtotal` es lo que queda a pagar
+// tras ellas. El checkout lo vuelve a calcular dentro de la transacción, así
+// que esto es solo una vista previa.
+func (h *Handler) descuentoCupon(codigo string, idCliente int, detalles []CartItemDetail, subtotal dinero.Monto) (dinero.Monto, error) {
+	cupon, err := h.Cupones.GetByCodigo(codigo)
+	if err != nil {
+		return 0, err
+	}
+	usos, err := h.Cupones.UsosCliente(cupon.ID, idCliente)
+	if err != nil {
+		return 0, err
+	}
+	if err := cupon.Verificar(time.Now(), subtotal, usos); err != nil {
+		return 0, err
+	}
+
+	var categorias []models.Categoria
+	var porLinea [][]int
+	if len(cupon.Categorias) > 0 {
+		if categorias, porLinea, err = h.categoriasDetalles(detalles); err != nil {
+			return 0, err
+		}
+	}
+	lineas := make([]models.LineaDescuento, len(detalles))
+	for i, d := range detalles {
+		// Como en el checkout, el cupón se calcula después de las promociones.
+		lineas[i] = models.LineaDescuento{IDProducto: d.IDProducto, Subtotal: d.Subtotal - d.Descuento}
+		if porLinea != nil {
+			lineas[i].Categorias = porLinea[i]
+		}
+	}
+	descuentos, descuento, err := cupon.Aplicar(lineas, categorias)
+	if err != nil {
+		return 0, err
+	}
+	for i := range detalles {
+		detalles[i].DescuentoCupon = descuentos[i]
+	}
+	return descuento, nil
+}
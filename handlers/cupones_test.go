@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestAdminCreaCuponesPorTipo(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Ana", "ana@test", "admin")
+	admin := e.login("ana@test")
+
+	for _, c := range []struct{ codigo, tipo, valor, error string }{
+		{"MAL1", models.CuponMonto, "5.005", "El monto del descuento debe ser un importe"},
+		{"MAL2", models.CuponMonto, "1e3", "El monto del descuento debe ser un importe"},
+		{"MAL3", models.CuponPorcentaje, "NaN", "El porcentaje de descuento debe ser un número"},
+		{"MAL4", models.CuponPorcentaje, "150", "no puede superar el 100%"},
+	} {
+		status, _, cuerpo := admin.post("/admin/cupones/nuevo", url.Values{"codigo": {c.codigo}, "tipo": {c.tipo}, "valor": {c.valor}, "activo": {"on"}})
+		if status == http.StatusSeeOther || !strings.Contains(cuerpo, c.error) {
+			t.Errorf("cupón %s de %q: %d, se esperaba el error %q", c.tipo, c.valor, status, c.error)
+		}
+	}
+
+	for _, form := range []url.Values{
+		{"codigo": {"cinco"}, "tipo": {models.CuponMonto}, "valor": {"5,50"}, "activo": {"on"}},
+		{"codigo": {"diez"}, "tipo": {models.CuponPorcentaje}, "valor": {"10.5"}, "activo": {"on"}},
+	} {
+		if status, _, cuerpo := admin.post("/admin/cupones/nuevo", form); status != http.StatusSeeOther {
+			t.Fatalf("crear %s: %d\n%s", form.Get("codigo"), status, cuerpo)
+		}
+	}
+	cupones, _ := e.repos.Cupones.GetAll()
+	if len(cupones) != 2 {
+		t.Fatalf("%d cupones, se esperaban 2", len(cupones))
+	}
+	for _, c := range cupones {
+		switch c.Codigo {
+		case "CINCO":
+			if c.Monto != dinero.Pesos(5)+50 || c.Porcentaje != 0 {
+				t.Errorf("CINCO con monto %s y porcentaje %v, se esperaba 5.50", c.Monto, c.Porcentaje)
+			}
+		case "DIEZ":
+			if c.Porcentaje != 10.5 || c.Monto != 0 {
+				t.Errorf("DIEZ con porcentaje %v y monto %s, se esperaba 10.5%%", c.Porcentaje, c.Monto)
+			}
+		}
+	}
+}
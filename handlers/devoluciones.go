@@ -0,0 +1,437 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/notificaciones"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+)
+
+// lineaDevolvible es una línea del pedido en el formulario de devolución:
+// cuántas unidades quedan por devolver y cuántas eligió el cliente.
+type lineaDevolvible struct {
+	models.DetallePedido
+	Nombre     string
+	Disponible int
+	Cantidad   int
+}
+
+// lineaDevolucionVista es una línea de una devolución con el nombre del
+// producto.
+type lineaDevolucionVista struct {
+	models.LineaDevolucion
+	Nombre string
+}
+
+// nombreProducto devuelve el nombre actual del producto o, si ya no existe,
+// su número.
+func (h *Handler) nombreProducto(id int) string {
+	p, err := h.Productos.GetByID(id)
+	if err != nil {
+		return fmt.Sprintf("Producto #%d", id)
+	}
+	return p.Nombre
+}
+
+// lineasDevolucionVista agrega el nombre del producto a cada línea.
+func (h *Handler) lineasDevolucionVista(d models.Devolucion) []lineaDevolucionVista {
+	lineas := make([]lineaDevolucionVista, len(d.Lineas))
+	for i, l := range d.Lineas {
+		lineas[i] = lineaDevolucionVista{LineaDevolucion: l, Nombre: h.nombreProducto(l.IDProducto)}
+	}
+	return lineas
+}
+
+// mensajeDevolucion arma el aviso al cliente para el estado de su
+// devolución.
+func mensajeDevolucion(d models.Devolucion) (string, string) {
+	asunto := fmt.Sprintf("Devolución #%d del pedido #%d", d.ID, d.IDPedido)
+	var cuerpo string
+	switch d.Estado {
+	case models.DevolucionSolicitada:
+		cuerpo = fmt.Sprintf("Recibimos tu solicitud de devolución #%d. Te avisaremos cuando la revisemos.", d.ID)
+	case models.DevolucionAprobada:
+		cuerpo = fmt.Sprintf("Aprobamos tu devolución #%d. Envíanos los productos para que podamos procesarla.", d.ID)
+	case models.DevolucionRechazada:
+		cuerpo = fmt.Sprintf("Tu devolución #%d fue rechazada.", d.ID)
+	case models.DevolucionRecibida:
+		cuerpo = fmt.Sprintf("Recibimos los productos de tu devolución #%d.", d.ID)
+	case models.DevolucionReembolsada:
+		cuerpo = fmt.Sprintf("Te devolvimos %s al medio de pago por la devolución #%d.", d.Monto.Formato(), d.ID)
+	case models.DevolucionAcreditada:
+		cuerpo = fmt.Sprintf("Sumamos %s a tu crédito en la tienda por la devolución #%d.", d.Monto.Formato(), d.ID)
+	default:
+		cuerpo = fmt.Sprintf("Tu devolución #%d pasó a %s.", d.ID, d.Estado)
+	}
+	if d.Nota != "" {
+		cuerpo += "\nComentario: " + d.Nota
+	}
+	return asunto, cuerpo
+}
+
+// notificarDevolucion avisa al cliente del estado de su devolución. Si el
+// aviso falla se registra en el log.
+func (h *Handler) notificarDevolucion(d models.Devolucion) {
+	cliente, err := h.Clientes.GetByID(d.IDCliente)
+	if err != nil {
+		log.Println("Error obteniendo cliente para notificar:", err)
+		return
+	}
+	asunto, cuerpo := mensajeDevolucion(d)
+	if err := h.notificador.Enviar(notificaciones.Mensaje{Para: cliente.Email, Asunto: asunto, Cuerpo: cuerpo}); err != nil {
+		log.Println("Error notificando la devolución", d.ID, err)
+	}
+}
+
+func (h *Handler) ClientReturnRequest(w http.ResponseWriter, r *http.Request) {
+	// ClientReturnRequest muestra el formulario para devolver unidades de un
+	// pedido entregado y registra la solicitud.
+	cliente, ok := h.GetSessionCliente(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	pedido, err := h.Pedidos.GetByID(id)
+	if err != nil || pedido.IDCliente != cliente.ID {
+		h.renderError(w, r, http.StatusNotFound, "Pedido no encontrado", "El pedido no existe.")
+		return
+	}
+	if pedido.Estado != models.EstadoEntregado {
+		h.renderError(w, r, http.StatusConflict, "No se puede devolver", "Solo se pueden devolver pedidos entregados.")
+		return
+	}
+	detalles, err := h.Pedidos.GetDetalles(id)
+	if err != nil {
+		log.Println("Error obteniendo detalles:", err)
+		http.Error(w, "Error al cargar el pedido", http.StatusInternalServerError)
+		return
+	}
+	devoluciones, err := h.Devoluciones.GetByPedidoID(id)
+	if err != nil {
+		log.Println("Error obteniendo devoluciones del pedido:", err)
+		http.Error(w, "Error al cargar el pedido", http.StatusInternalServerError)
+		return
+	}
+
+	var errores []string
+	motivo := ""
+	cantidades := map[int]int{}
+	if r.Method == "POST" {
+		motivo = strings.TrimSpace(r.FormValue("motivo"))
+		for _, d := range detalles {
+			valor := strings.TrimSpace(r.FormValue(fmt.Sprintf("cantidad_%d", d.ID)))
+			if valor == "" {
+				continue
+			}
+			n, err := strconv.Atoi(valor)
+			if err != nil {
+				errores = append(errores, "Las cantidades deben ser números enteros")
+				break
+			}
+			cantidades[d.ID] = n
+		}
+
+		if len(errores) == 0 {
+			idDevolucion, err := h.Devoluciones.Solicitar(models.SolicitudDevolucion{
+				IDCliente:  cliente.ID,
+				IDPedido:   id,
+				Motivo:     motivo,
+				Cantidades: cantidades,
+			})
+			if err == nil {
+				if d, err := h.Devoluciones.GetByID(idDevolucion); err == nil {
+					h.notificarDevolucion(d)
+				}
+				http.Redirect(w, r, fmt.Sprintf("/devoluciones/%d", idDevolucion), http.StatusSeeOther)
+				return
+			}
+			if !errors.Is(err, models.ErrDevolucionInvalida) {
+				log.Println("Error solicitando la devolución:", err)
+				http.Error(w, "Error registrando la devolución", http.StatusInternalServerError)
+				return
+			}
+			errores = append(errores, err.Error())
+		}
+	}
+
+	disponibles := models.Devolvibles(detalles, devoluciones)
+	var lineas []lineaDevolvible
+	for _, d := range detalles {
+		lineas = append(lineas, lineaDevolvible{
+			DetallePedido: d,
+			Nombre:        h.nombreProducto(d.IDProducto),
+			Disponible:    disponibles[d.ID],
+			Cantidad:      cantidades[d.ID],
+		})
+	}
+
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/solicitar_devolucion.html")
+	if err != nil {
+		log.Println("Error cargando template client return request:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Pedido     models.Pedido
+		Lineas     []lineaDevolvible
+		Motivo     string
+		Errores    []string
+		LoginToken bool
+		Perfil     string
+	}{
+		Pedido:     pedido,
+		Lineas:     lineas,
+		Motivo:     motivo,
+		Errores:    errores,
+		LoginToken: true,
+		Perfil:     cliente.Perfil,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	}
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		log.Println("Error ejecutando template client return request:", err)
+	}
+}
+
+func (h *Handler) ClientReturns(w http.ResponseWriter, r *http.Request) {
+	// ClientReturns lista las devoluciones del cliente y su crédito a favor.
+	cliente, ok := h.GetSessionCliente(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	devoluciones, err := h.Devoluciones.GetByClienteID(cliente.ID)
+	if err != nil {
+		log.Println("Error obteniendo devoluciones del cliente:", err)
+	}
+	credito, err := h.Devoluciones.SaldoCredito(cliente.ID)
+	if err != nil {
+		log.Println("Error obteniendo crédito del cliente:", err)
+	}
+
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/devoluciones.html")
+	if err != nil {
+		log.Println("Error cargando template client returns:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Devoluciones []models.Devolucion
+		Credito      dinero.Monto
+		LoginToken   bool
+		Perfil       string
+	}{
+		Devoluciones: devoluciones,
+		Credito:      credito,
+		LoginToken:   true,
+		Perfil:       cliente.Perfil,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		log.Println("Error ejecutando template client returns:", err)
+	}
+}
+
+func (h *Handler) ClientReturnDetail(w http.ResponseWriter, r *http.Request) {
+	// ClientReturnDetail muestra una devolución del cliente autenticado.
+	cliente, ok := h.GetSessionCliente(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	devolucion, err := h.Devoluciones.GetByID(id)
+	if err != nil || devolucion.IDCliente != cliente.ID {
+		h.renderError(w, r, http.StatusNotFound, "Devolución no encontrada", "La devolución no existe.")
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/detalle_devolucion.html")
+	if err != nil {
+		log.Println("Error cargando template client return detail:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Devolucion models.Devolucion
+		Lineas     []lineaDevolucionVista
+		LoginToken bool
+		Perfil     string
+	}{
+		Devolucion: devolucion,
+		Lineas:     h.lineasDevolucionVista(devolucion),
+		LoginToken: true,
+		Perfil:     cliente.Perfil,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		log.Println("Error ejecutando template client return detail:", err)
+	}
+}
+
+func (h *Handler) AdminReturns(w http.ResponseWriter, r *http.Request) {
+	// AdminReturns lista todas las devoluciones, de la más reciente a la más
+	// antigua.
+	_, perfil, _ := h.GetSessionData(r)
+
+	devoluciones, err := h.Devoluciones.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo devoluciones:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/devoluciones.html")
+	if err != nil {
+		log.Println("Error cargando templates admin returns:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		Devoluciones       []models.Devolucion
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:             perfil,
+		Devoluciones:       devoluciones,
+		DevolucionesActive: true,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin returns:", err)
+	}
+}
+
+func (h *Handler) AdminReturnDetail(w http.ResponseWriter, r *http.Request) {
+	// AdminReturnDetail muestra una devolución con sus líneas y las acciones
+	// que admite su estado.
+	_, perfil, _ := h.GetSessionData(r)
+
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	devolucion, err := h.Devoluciones.GetByID(id)
+	if err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Devolución no encontrada", "La devolución no existe.")
+		return
+	}
+	pedido, err := h.Pedidos.GetByID(devolucion.IDPedido)
+	if err != nil {
+		log.Println("Error obteniendo pedido de la devolución:", err)
+	}
+	cliente, err := h.Clientes.GetByID(devolucion.IDCliente)
+	if err != nil {
+		log.Println("Error obteniendo cliente:", err)
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/detalle_devolucion.html")
+	if err != nil {
+		log.Println("Error cargando templates admin return detail:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		Devolucion         models.Devolucion
+		Lineas             []lineaDevolucionVista
+		Pedido             models.Pedido
+		Cliente            models.Cliente
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:             perfil,
+		Devolucion:         devolucion,
+		Lineas:             h.lineasDevolucionVista(devolucion),
+		Pedido:             pedido,
+		Cliente:            cliente,
+		DevolucionesActive: true,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin return detail:", err)
+	}
+}
+
+func (h *Handler) AdminReturnStatus(w http.ResponseWriter, r *http.Request) {
+	// AdminReturnStatus avanza una devolución: aprobarla o rechazarla (con
+	// un comentario), recibirla eligiendo qué líneas vuelven al stock y
+	// resolverla con un reembolso o con crédito. Avisa al cliente.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, err := h.Devoluciones.GetByID(id); err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Devolución no encontrada", "La devolución no existe.")
+		return
+	}
+
+	r.ParseForm()
+	estado := r.FormValue("estado")
+	nota := strings.TrimSpace(r.FormValue("nota"))
+	if estado == models.DevolucionRechazada && nota == "" {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Falta el comentario", "Indica por qué se rechaza la devolución.")
+		return
+	}
+	if utf8.RuneCountInString(nota) > 255 {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Comentario demasiado largo", "El comentario admite hasta 255 caracteres.")
+		return
+	}
+
+	devolucion, err := h.Devoluciones.CambiarEstado(models.SolicitudEstadoDevolucion{
+		ID:      id,
+		Estado:  estado,
+		Nota:    nota,
+		Reponer: parseIDs(r.Form["reponer"]),
+	})
+	switch {
+	case errors.Is(err, models.ErrTransicionInvalida):
+		h.renderError(w, r, http.StatusConflict, "Cambio de estado no permitido", err.Error())
+		return
+	case errors.Is(err, models.ErrDevolucionInvalida):
+		h.renderError(w, r, http.StatusUnprocessableEntity, "No se puede resolver la devolución", err.Error())
+		return
+	case err != nil:
+		log.Println("Error actualizando la devolución:", err)
+		http.Error(w, "Error actualizando la devolución", http.StatusInternalServerError)
+		return
+	}
+	h.notificarDevolucion(devolucion)
+	if devolucion.Estado == models.DevolucionReembolsada {
+		// Si la pasarela falla el reembolso queda pendiente, a la vista en
+		// el detalle del pedido.
+		h.reembolsarPedido(devolucion.IDPedido)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/devoluciones/%d", id), http.StatusSeeOther)
+}
@@ -0,0 +1,246 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// pedidoEntregado compra `cantidad` unidades del producto como bea@test y
+// lo entrega en un solo envío. Devuelve el pedido y su único detalle.
+func pedidoEntregado(e *entorno, n, admin *navegador, producto, cantidad int) (int, models.DetallePedido) {
+	e.t.Helper()
+	n.agregar(producto, cantidad)
+	id := n.comprar(nil)
+	detalles, _ := e.repos.Pedidos.GetDetalles(id)
+	form := url.Values{fmt.Sprintf("cantidad_%d", detalles[0].ID): {strconv.Itoa(cantidad)}, "transportista": {"Correo"}, "entregado": {"1"}}
+	if status, _, _ := admin.post(fmt.Sprintf("/admin/pedidos/%d/envios", id), form); status != http.StatusSeeOther {
+		e.t.Fatalf("envío: %d", status)
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoEntregado {
+		e.t.Fatalf("pedido %s, se esperaba ENTREGADO", p.Estado)
+	}
+	return id, detalles[0]
+}
+
+// solicitarDevolucion pide devolver `cantidad` unidades del detalle y
+// devuelve el ID de la devolución.
+func solicitarDevolucion(e *entorno, n *navegador, idPedido int, d models.DetallePedido, cantidad int) int {
+	e.t.Helper()
+	form := url.Values{fmt.Sprintf("cantidad_%d", d.ID): {strconv.Itoa(cantidad)}, "motivo": {"No me gustó"}}
+	status, destino, cuerpo := n.post(fmt.Sprintf("/pedidos/%d/devolucion", idPedido), form)
+	if status != http.StatusSeeOther {
+		e.t.Fatalf("solicitar devolución: %d\n%s", status, cuerpo)
+	}
+	id, _ := strconv.Atoi(strings.TrimPrefix(destino, "/devoluciones/"))
+	return id
+}
+
+func TestDevolucionConCredito(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	idPedido, detalle := pedidoEntregado(e, n, admin, taza, 3)
+
+	ruta := fmt.Sprintf("/pedidos/%d/devolucion", idPedido)
+	if status, _, _ := n.post(ruta, url.Values{fmt.Sprintf("cantidad_%d", detalle.ID): {"4"}, "motivo": {"x"}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("devolver de más: %d, se esperaba 422", status)
+	}
+	// Los límites del motivo son de caracteres, no de bytes.
+	if status, _, _ := n.post(ruta, url.Values{fmt.Sprintf("cantidad_%d", detalle.ID): {"1"}, "motivo": {strings.Repeat("ñ", 256)}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("motivo de 256 caracteres: %d, se esperaba 422", status)
+	}
+	if status, _, cuerpo := n.post(ruta, url.Values{fmt.Sprintf("cantidad_%d", detalle.ID): {"1"}, "motivo": {strings.Repeat("ñ", 255)}}); status != http.StatusSeeOther {
+		t.Fatalf("motivo de 255 caracteres: %d, se esperaba 303\n%s", status, cuerpo)
+	}
+	id := solicitarDevolucion(e, n, idPedido, detalle, 2)
+	solicitada, _ := e.repos.Devoluciones.GetByID(id)
+
+	estado := fmt.Sprintf("/admin/devoluciones/%d/estado", id)
+	if status, _, _ := admin.post(estado, url.Values{"estado": {models.DevolucionRecibida}}); status != http.StatusConflict {
+		t.Errorf("recibir sin aprobar: %d, se esperaba 409", status)
+	}
+	for _, paso := range []url.Values{
+		{"estado": {models.DevolucionAprobada}},
+		{"estado": {models.DevolucionRecibida}, "reponer": {strconv.Itoa(solicitada.Lineas[0].ID)}},
+		{"estado": {models.DevolucionAcreditada}},
+	} {
+		if status, _, _ := admin.post(estado, paso); status != http.StatusSeeOther {
+			t.Fatalf("pasar a %s: %d, se esperaba 303", paso.Get("estado"), status)
+		}
+	}
+
+	d, _ := e.repos.Devoluciones.GetByID(id)
+	if d.Estado != models.DevolucionAcreditada || d.Monto != dinero.Pesos(10) {
+		t.Errorf("devolución %s por %s, se esperaba ACREDITADA por 10.00", d.Estado, d.Monto)
+	}
+	if e.stock(taza) != 9 {
+		t.Errorf("stock %d, se esperaba 9", e.stock(taza))
+	}
+	if saldo, _ := e.repos.Devoluciones.SaldoCredito(d.IDCliente); saldo != dinero.Pesos(10) {
+		t.Errorf("crédito %s, se esperaba 10.00", saldo)
+	}
+	if p := e.pedido(idPedido); p.Reembolsado != 0 {
+		t.Errorf("se reembolsaron %s de un pedido acreditado", p.Reembolsado)
+	}
+}
+
+func TestDevolucionConReembolso(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	idPedido, detalle := pedidoEntregado(e, n, admin, taza, 3)
+	id := solicitarDevolucion(e, n, idPedido, detalle, 1)
+
+	estado := fmt.Sprintf("/admin/devoluciones/%d/estado", id)
+	for _, paso := range []string{models.DevolucionAprobada, models.DevolucionRecibida, models.DevolucionReembolsada} {
+		if paso == models.DevolucionReembolsada {
+			// La pasarela devuelve el dinero pero la respuesta se pierde.
+			e.pasarela.fallos(false, true)
+		}
+		if status, _, _ := admin.post(estado, url.Values{"estado": {paso}}); status != http.StatusSeeOther {
+			t.Fatalf("pasar a %s: %d, se esperaba 303", paso, status)
+		}
+	}
+	reembolsos, _ := e.repos.Pedidos.GetReembolsos(idPedido)
+	if len(reembolsos) != 1 || !reembolsos[0].Pendiente() || reembolsos[0].IDDevolucion != id || reembolsos[0].Clave() != fmt.Sprintf("devolucion-%d", id) {
+		t.Fatalf("reembolsos %+v, se esperaba uno pendiente con la clave de la devolución", reembolsos)
+	}
+	// Reintentar con la misma clave no devuelve dos veces.
+	e.pasarela.fallos(false, false)
+	if status, _, _ := admin.post(fmt.Sprintf("/admin/pedidos/%d/reembolsos", idPedido), nil); status != http.StatusSeeOther {
+		t.Fatalf("reintentar: %d, se esperaba 303", status)
+	}
+	if reembolsos, _ := e.repos.Pedidos.GetReembolsos(idPedido); reembolsos[0].Pendiente() {
+		t.Errorf("reembolso %+v, se esperaba hecho", reembolsos[0])
+	}
+	if devuelto := e.pasarela.devuelto(e.pedido(idPedido).TransaccionID); devuelto != dinero.Pesos(5) {
+		t.Errorf("la pasarela devolvió %s, se esperaba 5.00", devuelto)
+	}
+
+	// Sin marcar la línea para reponer, la unidad no vuelve al stock.
+	if e.stock(taza) != 7 {
+		t.Errorf("stock %d, se esperaba 7", e.stock(taza))
+	}
+	if p := e.pedido(idPedido); p.Reembolsado != dinero.Pesos(5) {
+		t.Errorf("reembolsado %s, se esperaba 5.00", p.Reembolsado)
+	}
+	// Lo ya devuelto no se puede volver a pedir.
+	ruta := fmt.Sprintf("/pedidos/%d/devolucion", idPedido)
+	if status, _, _ := n.post(ruta, url.Values{fmt.Sprintf("cantidad_%d", detalle.ID): {"3"}, "motivo": {"x"}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("devolver unidades ya devueltas: %d, se esperaba 422", status)
+	}
+}
+
+func TestDevolucionRechazadaPideComentario(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	idPedido, detalle := pedidoEntregado(e, n, admin, taza, 1)
+	id := solicitarDevolucion(e, n, idPedido, detalle, 1)
+
+	estado := fmt.Sprintf("/admin/devoluciones/%d/estado", id)
+	if status, _, _ := admin.post(estado, url.Values{"estado": {models.DevolucionRechazada}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("rechazar sin comentario: %d, se esperaba 422", status)
+	}
+	if status, _, _ := admin.post(estado, url.Values{"estado": {models.DevolucionRechazada}, "nota": {strings.Repeat("ñ", 256)}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("rechazar con un comentario de 256 caracteres: %d, se esperaba 422", status)
+	}
+	if status, _, _ := admin.post(estado, url.Values{"estado": {models.DevolucionRechazada}, "nota": {"Fuera de plazo"}}); status != http.StatusSeeOther {
+		t.Fatalf("rechazar: %d, se esperaba 303", status)
+	}
+	if d, _ := e.repos.Devoluciones.GetByID(id); d.Estado != models.DevolucionRechazada || d.Nota != "Fuera de plazo" {
+		t.Errorf("devolución %s con nota %q", d.Estado, d.Nota)
+	}
+	if _, cuerpo := e.login("ana@test").get(fmt.Sprintf("/devoluciones/%d", id)); strings.Contains(cuerpo, "Fuera de plazo") {
+		t.Error("otro usuario ve la devolución de bea")
+	}
+}
+
+// acreditarDevolucion entrega a bea@test un pedido de `cantidad` unidades del
+// producto y le acredita la devolución de todas.
+func acreditarDevolucion(e *entorno, n, admin *navegador, producto, cantidad int) {
+	e.t.Helper()
+	idPedido, detalle := pedidoEntregado(e, n, admin, producto, cantidad)
+	id := solicitarDevolucion(e, n, idPedido, detalle, cantidad)
+	estado := fmt.Sprintf("/admin/devoluciones/%d/estado", id)
+	for _, paso := range []string{models.DevolucionAprobada, models.DevolucionRecibida, models.DevolucionAcreditada} {
+		if status, _, _ := admin.post(estado, url.Values{"estado": {paso}}); status != http.StatusSeeOther {
+			e.t.Fatalf("pasar a %s: %d, se esperaba 303", paso, status)
+		}
+	}
+}
+
+func TestCheckoutUsaCreditoAFavor(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	idBea := e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	acreditarDevolucion(e, n, admin, taza, 2)
+
+	n.agregar(taza, 3)
+	if _, cuerpo := n.get("/checkout"); !strings.Contains(cuerpo, "Crédito a favor") || !strings.Contains(cuerpo, "Confirmar Pedido ("+dinero.Pesos(5).Formato()+")") {
+		t.Error("el checkout no descuenta el crédito del total a pagar")
+	}
+	id := n.comprar(nil)
+	p := e.pedido(id)
+	if p.Estado != models.EstadoPagado || p.Total != dinero.Pesos(15) || p.Credito != dinero.Pesos(10) {
+		t.Fatalf("pedido %s de %s con %s de crédito, se esperaba PAGADO de 15.00 con 10.00", p.Estado, p.Total, p.Credito)
+	}
+	if saldo, _ := e.repos.Devoluciones.SaldoCredito(idBea); saldo != 0 {
+		t.Errorf("crédito %s tras usarlo, se esperaba 0", saldo)
+	}
+
+	// Al cancelar se reembolsa lo cobrado y el crédito vuelve al saldo.
+	if status, _, _ := n.post(fmt.Sprintf("/pedidos/%d/cancelar", id), url.Values{"motivo": {"Me equivoqué"}}); status != http.StatusSeeOther {
+		t.Fatalf("cancelar: %d, se esperaba 303", status)
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoCancelado || p.Reembolsado != dinero.Pesos(5) {
+		t.Errorf("pedido %s con %s reembolsado, se esperaba CANCELADO con 5.00", p.Estado, p.Reembolsado)
+	}
+	if saldo, _ := e.repos.Devoluciones.SaldoCredito(idBea); saldo != dinero.Pesos(10) {
+		t.Errorf("crédito %s tras cancelar, se esperaba 10.00", saldo)
+	}
+}
+
+func TestCheckoutPagadoConCredito(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	idBea := e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	acreditarDevolucion(e, n, admin, taza, 2)
+
+	// Con la pasarela rechazando todo, el pedido se paga igual: no hay nada
+	// que cobrarle.
+	e.pasarela.SetModo(pagos.ModoRechazar)
+	n.agregar(taza, 1)
+	p := e.pedido(n.comprar(nil))
+	if p.Estado != models.EstadoPagado || p.Credito != dinero.Pesos(5) || p.TransaccionID != "" {
+		t.Errorf("pedido %s con %s de crédito y transacción %q, se esperaba PAGADO con 5.00 sin transacción", p.Estado, p.Credito, p.TransaccionID)
+	}
+	if saldo, _ := e.repos.Devoluciones.SaldoCredito(idBea); saldo != dinero.Pesos(5) {
+		t.Errorf("crédito %s, se esperaba 5.00", saldo)
+	}
+
+	// Cancelarlo devuelve el crédito sin pasar por la pasarela.
+	if status, _, _ := n.post(fmt.Sprintf("/pedidos/%d/cancelar", p.ID), url.Values{"motivo": {"Me equivoqué"}}); status != http.StatusSeeOther {
+		t.Fatalf("cancelar: %d, se esperaba 303", status)
+	}
+	if saldo, _ := e.repos.Devoluciones.SaldoCredito(idBea); saldo != dinero.Pesos(10) {
+		t.Errorf("crédito %s tras cancelar, se esperaba 10.00", saldo)
+	}
+}
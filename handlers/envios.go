@@ -0,0 +1,454 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// filasTarifaVacias es la cantidad de filas en blanco que el formulario de
+// método agrega para cargar tarifas nuevas.
+const filasTarifaVacias = 3
+
+// filaMetodoEnvio es un método del listado con sus tarifas en palabras.
+type filaMetodoEnvio struct {
+	models.MetodoEnvio
+	Tarifas []string
+}
+
+// describirTarifa explica una tarifa para el listado del panel.
+func describirTarifa(t models.TarifaEnvio, zonas map[int]string) string {
+	texto := "Todas las zonas"
+	if t.IDZona != 0 {
+		texto = zonas[t.IDZona]
+	}
+	if t.PesoHasta > 0 {
+		texto += fmt.Sprintf(", hasta %g kg", t.PesoHasta)
+	}
+	if t.ImporteDesde > 0 {
+		texto += fmt.Sprintf(", desde %s", t.ImporteDesde.Formato())
+	}
+	return texto + ": " + t.Costo.Formato()
+}
+
+func (h *Handler) AdminShipping(w http.ResponseWriter, r *http.Request) {
+	// AdminShipping lista los métodos de envío con sus tarifas y las zonas.
+	_, perfil, _ := h.GetSessionData(r)
+
+	metodos, err := h.Envios.GetMetodos()
+	if err != nil {
+		log.Println("Error obteniendo métodos de envío:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	zonas, err := h.Envios.GetZonas()
+	if err != nil {
+		log.Println("Error obteniendo zonas de envío:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	nombresZona := map[int]string{}
+	for _, z := range zonas {
+		nombresZona[z.ID] = z.Nombre
+	}
+	filas := make([]filaMetodoEnvio, len(metodos))
+	for i, m := range metodos {
+		filas[i] = filaMetodoEnvio{MetodoEnvio: m}
+		for _, t := range m.Tarifas {
+			filas[i].Tarifas = append(filas[i].Tarifas, describirTarifa(t, nombresZona))
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/envios.html")
+	if err != nil {
+		log.Println("Error cargando templates admin shipping:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		Metodos            []filaMetodoEnvio
+		Zonas              []models.ZonaEnvio
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:       perfil,
+		Metodos:      filas,
+		Zonas:        zonas,
+		EnviosActive: true,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin shipping:", err)
+	}
+}
+
+// filaTarifa es una fila del formulario de tarifas tal como se escribió, para
+// volver a mostrarla si hay errores.
+type filaTarifa struct {
+	IDZona       int
+	PesoHasta    string
+	ImporteDesde string
+	Costo        string
+}
+
+// filasTarifa convierte las tarifas en filas del formulario y agrega las
+// filas en blanco.
+func filasTarifa(tarifas []models.TarifaEnvio) []filaTarifa {
+	filas := make([]filaTarifa, 0, len(tarifas)+filasTarifaVacias)
+	for _, t := range tarifas {
+		f := filaTarifa{IDZona: t.IDZona, Costo: t.Costo.String()}
+		if t.PesoHasta > 0 {
+			f.PesoHasta = strconv.FormatFloat(t.PesoHasta, 'f', -1, 64)
+		}
+		if t.ImporteDesde > 0 {
+			f.ImporteDesde = t.ImporteDesde.String()
+		}
+		filas = append(filas, f)
+	}
+	for i := 0; i < filasTarifaVacias; i++ {
+		filas = append(filas, filaTarifa{})
+	}
+	return filas
+}
+
+// parseTarifas lee las filas de tarifas del formulario. Las filas sin costo
+// se ignoran; los campos vacíos de peso e importe no limitan.
+func parseTarifas(r *http.Request) ([]models.TarifaEnvio, []filaTarifa, []string) {
+	zonas := r.Form["tarifa_zona"]
+	pesos := r.Form["tarifa_peso"]
+	importes := r.Form["tarifa_importe"]
+	costos := r.Form["tarifa_costo"]
+	valor := func(lista []string, i int) string {
+		if i < len(lista) {
+			return strings.TrimSpace(lista[i])
+		}
+		return ""
+	}
+
+	var tarifas []models.TarifaEnvio
+	var filas []filaTarifa
+	var errores []string
+	for i := range costos {
+		idZona, _ := strconv.Atoi(valor(zonas, i))
+		f := filaTarifa{IDZona: idZona, PesoHasta: valor(pesos, i), ImporteDesde: valor(importes, i), Costo: valor(costos, i)}
+		if f.Costo == "" {
+			continue
+		}
+		filas = append(filas, f)
+		t := models.TarifaEnvio{IDZona: idZona}
+		var err error
+		if t.Costo, err = dinero.Parse(f.Costo); err != nil {
+			errores = append(errores, fmt.Sprintf("tarifa %d: el costo debe ser un número con hasta dos decimales", len(filas)))
+		}
+		if f.PesoHasta != "" {
+			if t.PesoHasta, err = numeroDecimal(f.PesoHasta); err != nil {
+				errores = append(errores, fmt.Sprintf("tarifa %d: el peso debe ser un número", len(filas)))
+			}
+		}
+		if f.ImporteDesde != "" {
+			if t.ImporteDesde, err = dinero.Parse(f.ImporteDesde); err != nil {
+				errores = append(errores, fmt.Sprintf("tarifa %d: el importe debe ser un número con hasta dos decimales", len(filas)))
+			}
+		}
+		tarifas = append(tarifas, t)
+	}
+	for i := 0; i < filasTarifaVacias; i++ {
+		filas = append(filas, filaTarifa{})
+	}
+	return tarifas, filas, errores
+}
+
+// metodoEnvioDesdeFormulario lee los campos del formulario de método de
+// envío. Devuelve también las filas de tarifas y los errores de formato y de
+// validación.
+func metodoEnvioDesdeFormulario(r *http.Request) (models.MetodoEnvio, []filaTarifa, []string) {
+	r.ParseForm()
+	metodo := models.MetodoEnvio{
+		Nombre:      strings.TrimSpace(r.FormValue("nombre")),
+		Tipo:        r.FormValue("tipo"),
+		Descripcion: strings.TrimSpace(r.FormValue("descripcion")),
+		Activo:      r.FormValue("activo") == "on",
+	}
+
+	f := &lectorFormulario{r: r}
+	metodo.GratisDesde = f.importe("gratis_desde", "El importe para envío gratis", false)
+	tarifas, filas, errores := parseTarifas(r)
+	metodo.Tarifas = tarifas
+	f.errores = append(f.errores, errores...)
+
+	if len(f.errores) == 0 {
+		if err := models.ValidarMetodoEnvio(metodo); err != nil {
+			f.errores = append(f.errores, err.Error())
+		}
+	}
+	return metodo, filas, f.errores
+}
+
+func (h *Handler) AdminShippingMethodCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminShippingMethodCreate muestra el formulario y crea métodos de envío.
+	if r.Method == "POST" {
+		metodo, filas, errores := metodoEnvioDesdeFormulario(r)
+		if len(errores) == 0 {
+			if err := h.Envios.CreateMetodo(metodo); err != nil {
+				log.Println("Error creando método de envío:", err)
+				errores = append(errores, "No se pudo crear el método: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioMetodoEnvio(w, r, false, metodo, filas, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/envios", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioMetodoEnvio(w, r, false, models.MetodoEnvio{Tipo: models.EnvioEstandar, Activo: true}, filasTarifa(nil), nil)
+}
+
+func (h *Handler) AdminShippingMethodEdit(w http.ResponseWriter, r *http.Request) {
+	// AdminShippingMethodEdit edita un método de envío y sus tarifas. Los
+	// pedidos ya hechos conservan el costo que se cobró.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	existente, err := h.Envios.GetMetodoByID(id)
+	if err != nil {
+		http.Error(w, "Método de envío no encontrado", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		metodo, filas, errores := metodoEnvioDesdeFormulario(r)
+		metodo.ID = id
+		if len(errores) == 0 {
+			if err := h.Envios.UpdateMetodo(metodo); err != nil {
+				log.Println("Error actualizando método de envío:", err)
+				errores = append(errores, "No se pudo actualizar el método: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioMetodoEnvio(w, r, true, metodo, filas, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/envios", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioMetodoEnvio(w, r, true, existente, filasTarifa(existente.Tarifas), nil)
+}
+
+// renderFormularioMetodoEnvio dibuja el formulario de alta o edición de un
+// método con sus filas de tarifas.
+func (h *Handler) renderFormularioMetodoEnvio(w http.ResponseWriter, r *http.Request, isEdit bool, metodo models.MetodoEnvio, filas []filaTarifa, errores []string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	zonas, err := h.Envios.GetZonas()
+	if err != nil {
+		log.Println("Error obteniendo zonas de envío:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_metodo_envio.html")
+	if err != nil {
+		log.Println("Error cargando template admin shipping method form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Metodo             models.MetodoEnvio
+		Tarifas            []filaTarifa
+		Zonas              []models.ZonaEnvio
+		Errores            []string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:       perfil,
+		IsEdit:       isEdit,
+		Metodo:       metodo,
+		Tarifas:      filas,
+		Zonas:        zonas,
+		Errores:      errores,
+		EnviosActive: true,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin shipping method form:", err)
+	}
+}
+
+func (h *Handler) AdminShippingMethodDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminShippingMethodDelete elimina un método de envío. Los pedidos
+	// conservan su nombre y el costo cobrado.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Envios.DeleteMetodo(id); err != nil {
+		log.Println("Error eliminando método de envío:", err)
+		http.Error(w, "Error eliminando método de envío", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/envios", http.StatusSeeOther)
+}
+
+// parseProvincias interpreta el texto de provincias del formulario: una por
+// línea o separadas por comas.
+func parseProvincias(texto string) []string {
+	var provincias []string
+	for _, linea := range strings.FieldsFunc(texto, func(r rune) bool { return r == '\n' || r == ',' }) {
+		if p := models.NormalizarProvincia(linea); p != "" {
+			provincias = append(provincias, p)
+		}
+	}
+	return provincias
+}
+
+// zonaEnvioDesdeFormulario lee los campos del formulario de zona. Devuelve
+// también el texto de provincias tal cual y los errores de validación.
+func zonaEnvioDesdeFormulario(r *http.Request) (models.ZonaEnvio, string, []string) {
+	provincias := r.FormValue("provincias")
+	zona := models.ZonaEnvio{
+		Nombre:     strings.TrimSpace(r.FormValue("nombre")),
+		Provincias: parseProvincias(provincias),
+	}
+	var errores []string
+	if err := models.ValidarZonaEnvio(zona); err != nil {
+		errores = append(errores, err.Error())
+	}
+	return zona, provincias, errores
+}
+
+func (h *Handler) AdminShippingZoneCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminShippingZoneCreate muestra el formulario y crea zonas de envío.
+	if r.Method == "POST" {
+		zona, provincias, errores := zonaEnvioDesdeFormulario(r)
+		if len(errores) == 0 {
+			if err := h.Envios.CreateZona(zona); err != nil {
+				log.Println("Error creando zona de envío:", err)
+				errores = append(errores, "No se pudo crear la zona: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioZonaEnvio(w, r, false, zona, provincias, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/envios", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioZonaEnvio(w, r, false, models.ZonaEnvio{}, "", nil)
+}
+
+func (h *Handler) AdminShippingZoneEdit(w http.ResponseWriter, r *http.Request) {
+	// AdminShippingZoneEdit edita el nombre y las provincias de una zona.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	existente, err := h.Envios.GetZonaByID(id)
+	if err != nil {
+		http.Error(w, "Zona de envío no encontrada", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		zona, provincias, errores := zonaEnvioDesdeFormulario(r)
+		zona.ID = id
+		if len(errores) == 0 {
+			if err := h.Envios.UpdateZona(zona); err != nil {
+				log.Println("Error actualizando zona de envío:", err)
+				errores = append(errores, "No se pudo actualizar la zona: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioZonaEnvio(w, r, true, zona, provincias, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/envios", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioZonaEnvio(w, r, true, existente, strings.Join(existente.Provincias, "\n"), nil)
+}
+
+// renderFormularioZonaEnvio dibuja el formulario de alta o edición de una
+// zona. `provincias` es el texto del campo, que se conserva tal cual si tuvo
+// errores.
+func (h *Handler) renderFormularioZonaEnvio(w http.ResponseWriter, r *http.Request, isEdit bool, zona models.ZonaEnvio, provincias string, errores []string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_zona_envio.html")
+	if err != nil {
+		log.Println("Error cargando template admin shipping zone form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Zona               models.ZonaEnvio
+		Provincias         string
+		Errores            []string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:       perfil,
+		IsEdit:       isEdit,
+		Zona:         zona,
+		Provincias:   provincias,
+		Errores:      errores,
+		EnviosActive: true,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin shipping zone form:", err)
+	}
+}
+
+func (h *Handler) AdminShippingZoneDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminShippingZoneDelete elimina una zona y las tarifas que la usan.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Envios.DeleteZona(id); err != nil {
+		log.Println("Error eliminando zona de envío:", err)
+		http.Error(w, "Error eliminando zona de envío", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/envios", http.StatusSeeOther)
+}
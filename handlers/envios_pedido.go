@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/notificaciones"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// envioVista es un envío del pedido con el nombre de cada producto.
+type envioVista struct {
+	models.Envio
+	Productos []lineaEnvioVista
+}
+
+// lineaEnvioVista es una línea de un envío con el nombre del producto.
+type lineaEnvioVista struct {
+	models.LineaEnvio
+	Nombre string
+}
+
+// lineaPorEnviar es una línea del pedido en el formulario de envío nuevo.
+type lineaPorEnviar struct {
+	models.DetallePedido
+	Nombre    string
+	Pendiente int
+}
+
+// enviosVista agrega el nombre del producto a las líneas de cada envío.
+func (h *Handler) enviosVista(envios []models.Envio) []envioVista {
+	vista := make([]envioVista, len(envios))
+	for i, e := range envios {
+		vista[i] = envioVista{Envio: e, Productos: make([]lineaEnvioVista, len(e.Lineas))}
+		for j, l := range e.Lineas {
+			vista[i].Productos[j] = lineaEnvioVista{LineaEnvio: l, Nombre: h.nombreProducto(l.IDProducto)}
+		}
+	}
+	return vista
+}
+
+// lineasPorEnviar devuelve las líneas del pedido a las que les quedan
+// unidades por despachar.
+func (h *Handler) lineasPorEnviar(detalles []models.DetallePedido, envios []models.Envio) []lineaPorEnviar {
+	pendientes := models.PorEnviar(detalles, envios)
+	var lineas []lineaPorEnviar
+	for _, d := range detalles {
+		if pendientes[d.ID] > 0 {
+			lineas = append(lineas, lineaPorEnviar{DetallePedido: d, Nombre: h.nombreProducto(d.IDProducto), Pendiente: pendientes[d.ID]})
+		}
+	}
+	return lineas
+}
+
+// mensajeEnvio arma el aviso al cliente por un envío que no cambia el estado
+// del pedido, p. ej. el segundo de varios parciales.
+func mensajeEnvio(e models.Envio) (string, string) {
+	asunto := fmt.Sprintf("Nuevo envío de tu pedido #%d", e.IDPedido)
+	cuerpo := fmt.Sprintf("Despachamos otra parte de tu pedido #%d con %s.", e.IDPedido, e.Transportista)
+	if e.NumeroSeguimiento != "" {
+		cuerpo += "\nNúmero de seguimiento: " + e.NumeroSeguimiento
+	}
+	return asunto, cuerpo
+}
+
+// notificarEnvio avisa al cliente de los cambios de estado que provocó el
+// envío o, si no hubo ninguno y el envío es nuevo, del envío en sí.
+func (h *Handler) notificarEnvio(e models.Envio, cambios []models.CambioEstado, nuevo bool) {
+	for _, c := range cambios {
+		h.notificarCambioEstado(c)
+	}
+	if len(cambios) > 0 || !nuevo {
+		return
+	}
+	pedido, err := h.Pedidos.GetByID(e.IDPedido)
+	if err != nil {
+		log.Println("Error obteniendo pedido para notificar:", err)
+		return
+	}
+	cliente, err := h.Clientes.GetByID(pedido.IDCliente)
+	if err != nil {
+		log.Println("Error obteniendo cliente para notificar:", err)
+		return
+	}
+	asunto, cuerpo := mensajeEnvio(e)
+	if err := h.notificador.Enviar(notificaciones.Mensaje{Para: cliente.Email, Asunto: asunto, Cuerpo: cuerpo}); err != nil {
+		log.Println("Error notificando el envío", e.ID, err)
+	}
+}
+
+// leerDatosEnvio lee del formulario el transportista, el seguimiento y las
+// fechas de un envío.
+func leerDatosEnvio(r *http.Request, f *lectorFormulario) models.SolicitudEnvio {
+	s := models.SolicitudEnvio{
+		Transportista:     r.FormValue("transportista"),
+		NumeroSeguimiento: r.FormValue("numero_seguimiento"),
+		FechaEnvio:        f.fecha("fecha_envio", "La fecha de envío"),
+		EntregaEstimada:   f.dia("entrega_estimada", "La entrega estimada"),
+		FechaEntrega:      f.fecha("fecha_entrega", "La fecha de entrega"),
+	}
+	if r.FormValue("entregado") != "" && s.FechaEntrega.IsZero() {
+		s.FechaEntrega = time.Now()
+	}
+	return s
+}
+
+// guardarEnvio registra o modifica el envío, avisa al cliente y vuelve al
+// detalle del pedido. Los errores de la solicitud se muestran con 422 y los
+// cambios de estado no admitidos con 409.
+func (h *Handler) guardarEnvio(w http.ResponseWriter, r *http.Request, s models.SolicitudEnvio) {
+	admin, _ := h.GetSessionCliente(r)
+	s.IDCliente = admin.ID
+	s.Responsable = admin.Nombre + " (administrador)"
+
+	var envio models.Envio
+	var cambios []models.CambioEstado
+	var err error
+	if s.ID == 0 {
+		envio, cambios, err = h.Envios.RegistrarEnvio(s)
+	} else {
+		envio, cambios, err = h.Envios.ActualizarEnvio(s)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, models.ErrEnvioPedidoInvalido):
+			h.renderError(w, r, http.StatusUnprocessableEntity, "Envío no válido", err.Error())
+		case errors.Is(err, models.ErrTransicionInvalida):
+			h.renderError(w, r, http.StatusConflict, "Cambio de estado no permitido", err.Error())
+		default:
+			log.Println("Error guardando el envío del pedido", s.IDPedido, err)
+			http.Error(w, "Error guardando el envío", http.StatusInternalServerError)
+		}
+		return
+	}
+	h.notificarEnvio(envio, cambios, s.ID == 0)
+	http.Redirect(w, r, fmt.Sprintf("/admin/pedidos/%d", s.IDPedido), http.StatusSeeOther)
+}
+
+func (h *Handler) AdminShipmentCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminShipmentCreate registra un envío con las unidades elegidas del
+	// pedido. El estado del pedido pasa a ENVIADO_PARCIAL o ENVIADO según lo
+	// que quede por despachar.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	if _, err := h.Pedidos.GetByID(id); err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Pedido no encontrado", "El pedido no existe.")
+		return
+	}
+	detalles, err := h.Pedidos.GetDetalles(id)
+	if err != nil {
+		log.Println("Error obteniendo detalles:", err)
+		http.Error(w, "Error al cargar el pedido", http.StatusInternalServerError)
+		return
+	}
+
+	f := &lectorFormulario{r: r}
+	s := leerDatosEnvio(r, f)
+	s.IDPedido = id
+	s.Cantidades = map[int]int{}
+	for _, d := range detalles {
+		if n := f.entero(fmt.Sprintf("cantidad_%d", d.ID), "La cantidad"); n != 0 {
+			s.Cantidades[d.ID] = n
+		}
+	}
+	if len(f.errores) > 0 {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Envío no válido", strings.Join(f.errores, ". "))
+		return
+	}
+	h.guardarEnvio(w, r, s)
+}
+
+func (h *Handler) AdminShipmentUpdate(w http.ResponseWriter, r *http.Request) {
+	// AdminShipmentUpdate corrige el transportista, el seguimiento y las
+	// fechas de un envío, o registra su entrega. Cuando llegaron todos los
+	// paquetes el pedido pasa a ENTREGADO.
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+	idEnvio, _ := strconv.Atoi(vars["idEnvio"])
+	if _, err := h.Pedidos.GetByID(id); err != nil {
+		h.renderError(w, r, http.StatusNotFound, "Pedido no encontrado", "El pedido no existe.")
+		return
+	}
+	envios, err := h.Envios.GetEnviosPedido(id)
+	if err != nil {
+		log.Println("Error obteniendo envíos del pedido:", err)
+		http.Error(w, "Error al cargar el pedido", http.StatusInternalServerError)
+		return
+	}
+	existe := false
+	for _, e := range envios {
+		existe = existe || e.ID == idEnvio
+	}
+	if !existe {
+		h.renderError(w, r, http.StatusNotFound, "Envío no encontrado", "El envío no es de este pedido.")
+		return
+	}
+
+	f := &lectorFormulario{r: r}
+	s := leerDatosEnvio(r, f)
+	s.ID = idEnvio
+	s.IDPedido = id
+	if len(f.errores) > 0 {
+		h.renderError(w, r, http.StatusUnprocessableEntity, "Envío no válido", strings.Join(f.errores, ". "))
+		return
+	}
+	h.guardarEnvio(w, r, s)
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+)
+
+func TestEnviosParcialesHastaEntregado(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 3)
+	id := n.comprar(nil)
+	detalles, _ := e.repos.Pedidos.GetDetalles(id)
+	cantidad := fmt.Sprintf("cantidad_%d", detalles[0].ID)
+	ruta := fmt.Sprintf("/admin/pedidos/%d/envios", id)
+
+	admin := e.login("ana@test")
+	if status, _, _ := admin.post(ruta, url.Values{cantidad: {"4"}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("enviar de más: %d, se esperaba 422", status)
+	}
+	if status, _, _ := admin.post(ruta, url.Values{cantidad: {"1"}, "transportista": {"Correo"}}); status != http.StatusSeeOther {
+		t.Fatalf("primer envío: %d, se esperaba 303", status)
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoEnviadoParcial {
+		t.Errorf("pedido %s, se esperaba ENVIADO_PARCIAL", p.Estado)
+	}
+	if status, _, _ := admin.post(ruta, url.Values{cantidad: {"2"}, "transportista": {"Correo"}}); status != http.StatusSeeOther {
+		t.Fatalf("segundo envío: %d, se esperaba 303", status)
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoEnviado {
+		t.Errorf("pedido %s, se esperaba ENVIADO", p.Estado)
+	}
+
+	envios, _ := e.repos.Envios.GetEnviosPedido(id)
+	if len(envios) != 2 {
+		t.Fatalf("%d envíos, se esperaban 2", len(envios))
+	}
+	for i, envio := range envios {
+		status, _, _ := admin.post(fmt.Sprintf("%s/%d", ruta, envio.ID), url.Values{"transportista": {"Correo"}, "entregado": {"1"}})
+		if status != http.StatusSeeOther {
+			t.Fatalf("entregar el envío %d: %d, se esperaba 303", envio.ID, status)
+		}
+		if p := e.pedido(id); i == 0 && p.Estado != models.EstadoEnviado {
+			t.Errorf("con un paquete entregado el pedido quedó %s, se esperaba ENVIADO", p.Estado)
+		}
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoEntregado {
+		t.Errorf("pedido %s, se esperaba ENTREGADO", p.Estado)
+	}
+	if status, _, _ := admin.post(ruta, url.Values{cantidad: {"1"}}); status != http.StatusUnprocessableEntity {
+		t.Errorf("enviar un pedido ya despachado: %d, se esperaba 422", status)
+	}
+}
+
+func TestEnvioSoloAdministrador(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 1)
+	id := n.comprar(nil)
+	detalles, _ := e.repos.Pedidos.GetDetalles(id)
+
+	status, _, _ := n.post(fmt.Sprintf("/admin/pedidos/%d/envios", id), url.Values{fmt.Sprintf("cantidad_%d", detalles[0].ID): {"1"}, "transportista": {"Correo"}})
+	if status != http.StatusForbidden {
+		t.Errorf("envío registrado por un cliente: %d, se esperaba 403", status)
+	}
+	if envios, _ := e.repos.Envios.GetEnviosPedido(id); len(envios) != 0 {
+		t.Errorf("se registraron %d envíos", len(envios))
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoPagado {
+		t.Errorf("pedido %s, se esperaba PAGADO", p.Estado)
+	}
+}
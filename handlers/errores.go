@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+)
+
+// renderError muestra una página de error con el layout de la tienda y el
+// código de estado indicado (p. ej. 403 o 404).
+func (h *Handler) renderError(w http.ResponseWriter, r *http.Request, status int, titulo, mensaje string) {
+	loggedIn, perfil, _ := h.GetSessionData(r)
+
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/error.html")
+	if err != nil {
+		log.Println("Error cargando template de error:", err)
+		http.Error(w, mensaje, status)
+		return
+	}
+
+	data := struct {
+		Status     int
+		Titulo     string
+		Mensaje    string
+		LoginToken bool
+		Perfil     string
+	}{
+		Status:     status,
+		Titulo:     titulo,
+		Mensaje:    mensaje,
+		LoginToken: loggedIn,
+		Perfil:     perfil,
+	}
+
+	w.WriteHeader(status)
+	if err := tmpl.ExecuteTemplate(w, "base", data); err != nil {
+		log.Println("Error ejecutando template de error:", err)
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/notificaciones"
+	"fmt"
+	"log"
+)
+
+// mensajeEstado arma el aviso al cliente para un cambio de estado.
+func mensajeEstado(pedido models.Pedido, c models.CambioEstado) (string, string) {
+	var asunto, cuerpo string
+	switch c.EstadoNuevo {
+	case models.EstadoPagado:
+		asunto = fmt.Sprintf("Pago recibido - pedido #%d", pedido.ID)
+		cuerpo = fmt.Sprintf("Recibimos el pago de tu pedido #%d por %s. Pronto lo prepararemos para el envío.", pedido.ID, pedido.Total.Formato())
+	case models.EstadoEnviadoParcial:
+		asunto = fmt.Sprintf("Pedido #%d enviado en parte", pedido.ID)
+		cuerpo = fmt.Sprintf("Despachamos una parte de tu pedido #%d; el resto sale en otro envío.", pedido.ID)
+	case models.EstadoEnviado:
+		asunto = fmt.Sprintf("Pedido #%d enviado", pedido.ID)
+		cuerpo = fmt.Sprintf("Tu pedido #%d ya está en camino.", pedido.ID)
+	case models.EstadoEntregado:
+		asunto = fmt.Sprintf("Pedido #%d entregado", pedido.ID)
+		cuerpo = fmt.Sprintf("Tu pedido #%d fue entregado. ¡Gracias por tu compra!", pedido.ID)
+	case models.EstadoCancelado:
+		asunto = fmt.Sprintf("Pedido #%d cancelado", pedido.ID)
+		cuerpo = fmt.Sprintf("Tu pedido #%d fue cancelado.", pedido.ID)
+		if pedido.Reembolsado > 0 {
+			cuerpo += fmt.Sprintf(" Te devolvimos %s al medio de pago.", pedido.Reembolsado.Formato())
+		}
+	default:
+		asunto = fmt.Sprintf("Pedido #%d: %s", pedido.ID, c.EstadoNuevo)
+		cuerpo = fmt.Sprintf("Tu pedido #%d pasó a %s.", pedido.ID, c.EstadoNuevo)
+	}
+	switch {
+	case c.Motivo == "":
+	case models.EsEstadoDeEnvio(c.EstadoNuevo):
+		// El motivo de los estados de envío es el envío que los provocó.
+		cuerpo += "\n" + c.Motivo
+	default:
+		cuerpo += "\nMotivo: " + c.Motivo
+	}
+	return asunto, cuerpo
+}
+
+// notificarCambioEstado avisa al cliente del nuevo estado de su pedido. Si el
+// aviso falla se registra en el log; el cambio ya está hecho.
+func (h *Handler) notificarCambioEstado(c models.CambioEstado) {
+	pedido, err := h.Pedidos.GetByID(c.IDPedido)
+	if err != nil {
+		log.Println("Error obteniendo pedido para notificar:", err)
+		return
+	}
+	cliente, err := h.Clientes.GetByID(pedido.IDCliente)
+	if err != nil {
+		log.Println("Error obteniendo cliente para notificar:", err)
+		return
+	}
+	asunto, cuerpo := mensajeEstado(pedido, c)
+	if err := h.notificador.Enviar(notificaciones.Mensaje{Para: cliente.Email, Asunto: asunto, Cuerpo: cuerpo}); err != nil {
+		log.Println("Error notificando el cambio de estado del pedido", pedido.ID, err)
+	}
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// formatoFechaFormulario es el formato de los campos datetime-local.
+const formatoFechaFormulario = "2006-01-02T15:04"
+
+// formatoDiaFormulario es el formato de los campos date.
+const formatoDiaFormulario = "2006-01-02"
+
+// importeMaximo es el mayor importe que cabe en las columnas DECIMAL(10,2).
+const importeMaximo = dinero.Monto(99999999_99)
+
+// fechaFormulario da formato a una fecha para un campo datetime-local; la
+// fecha vacía deja el campo vacío.
+func fechaFormulario(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Local().Format(formatoFechaFormulario)
+}
+
+// lectorFormulario lee campos numéricos y de fecha de un formulario y junta
+// los errores de formato para mostrarlos todos de una vez. Los campos
+// opcionales vacíos valen 0 (o la fecha vacía).
+type lectorFormulario struct {
+	r       *http.Request
+	errores []string
+}
+
+// numeroDecimal lee un número escrito con punto o coma decimal, p. ej.
+// "10", "10.5" o "-0,25". A diferencia de strconv.ParseFloat rechaza NaN, los
+// infinitos, la notación científica y los números hexadecimales: en un
+// formulario solo pueden ser un error de tipeo.
+func numeroDecimal(texto string) (float64, error) {
+	texto = strings.Replace(strings.TrimSpace(texto), ",", ".", 1)
+	if !numeroDecimalRe.MatchString(texto) {
+		return 0, fmt.Errorf("%q no es un número decimal", texto)
+	}
+	return strconv.ParseFloat(texto, 64)
+}
+
+var numeroDecimalRe = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// decimal lee un número decimal (ver numeroDecimal).
+func (f *lectorFormulario) decimal(campo, nombre string, obligatorio bool) float64 {
+	valor := strings.TrimSpace(f.r.FormValue(campo))
+	if valor == "" && !obligatorio {
+		return 0
+	}
+	v, err := numeroDecimal(valor)
+	if err != nil {
+		f.errores = append(f.errores, nombre+" debe ser un número")
+	}
+	return v
+}
+
+// importe lee un importe de dinero con hasta dos decimales (ver dinero.Parse).
+// Los importes del formulario no pueden ser negativos.
+func (f *lectorFormulario) importe(campo, nombre string, obligatorio bool) dinero.Monto {
+	valor := strings.TrimSpace(f.r.FormValue(campo))
+	if valor == "" && !obligatorio {
+		return 0
+	}
+	v, err := dinero.Parse(valor)
+	switch {
+	case err != nil:
+		f.errores = append(f.errores, nombre+" debe ser un importe con hasta dos decimales, p. ej. 1234.50")
+	case v < 0:
+		f.errores = append(f.errores, nombre+" no puede ser negativo")
+	case v > importeMaximo:
+		f.errores = append(f.errores, nombre+" no puede superar "+importeMaximo.Formato())
+	}
+	return v
+}
+
+func (f *lectorFormulario) entero(campo, nombre string) int {
+	valor := strings.TrimSpace(f.r.FormValue(campo))
+	if valor == "" {
+		return 0
+	}
+	v, err := strconv.Atoi(valor)
+	if err != nil {
+		f.errores = append(f.errores, nombre+" debe ser un número entero o quedar vacío")
+	}
+	return v
+}
+
+func (f *lectorFormulario) fecha(campo, nombre string) time.Time {
+	valor := strings.TrimSpace(f.r.FormValue(campo))
+	if valor == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(formatoFechaFormulario, valor, time.Local)
+	if err != nil {
+		f.errores = append(f.errores, nombre+" no es una fecha válida")
+	}
+	return t
+}
+
+func (f *lectorFormulario) dia(campo, nombre string) time.Time {
+	valor := strings.TrimSpace(f.r.FormValue(campo))
+	if valor == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(formatoDiaFormulario, valor, time.Local)
+	if err != nil {
+		f.errores = append(f.errores, nombre+" no es una fecha válida")
+	}
+	return t
+}
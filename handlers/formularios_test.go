@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestNumeroDecimal(t *testing.T) {
+	validos := map[string]float64{"10": 10, "10.5": 10.5, "10,5": 10.5, " -0.25 ": -0.25, "007": 7}
+	for texto, esperado := range validos {
+		if v, err := numeroDecimal(texto); err != nil || v != esperado {
+			t.Errorf("numeroDecimal(%q) = %v, %v; se esperaba %v", texto, v, err, esperado)
+		}
+	}
+	for _, texto := range []string{"", "NaN", "nan", "Inf", "+Inf", "-inf", "1e3", "1E-2", "0x1p3", "1_000", "1.", ".5", "1.2.3", "1,2,3", "+5", "10%"} {
+		if v, err := numeroDecimal(texto); err == nil {
+			t.Errorf("numeroDecimal(%q) = %v, se esperaba un error", texto, v)
+		}
+	}
+}
+
+func TestLectorFormularioDecimal(t *testing.T) {
+	form := url.Values{"tasa": {"Inf"}, "peso": {"1,5"}, "vacio": {" "}}
+	r := httptest.NewRequest("POST", "/", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	f := &lectorFormulario{r: r}
+
+	if v := f.decimal("peso", "El peso", true); v != 1.5 {
+		t.Errorf("peso %v, se esperaba 1.5", v)
+	}
+	if v := f.decimal("vacio", "El opcional", false); v != 0 {
+		t.Errorf("opcional vacío %v, se esperaba 0", v)
+	}
+	if len(f.errores) != 0 {
+		t.Fatalf("errores %v", f.errores)
+	}
+	f.decimal("tasa", "La tasa", false)
+	f.decimal("vacio", "El obligatorio", true)
+	if len(f.errores) != 2 || f.errores[0] != "La tasa debe ser un número" {
+		t.Errorf("errores %v, se esperaban la tasa y el obligatorio", f.errores)
+	}
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/almacenamiento"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/notificaciones"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
+
+// Handler agrupa las dependencias de los controladores HTTP. Los repositorios
+// se inyectan al construirlo, lo que permite probar los handlers con httptest
+// usando models.NewRepositoriosMemoria en lugar de MySQL.
+type Handler struct {
+	models.Repositorios
+	store   *sessionStore
+	almacen almacenamiento.Almacenamiento
+	// pasarela cobra los pedidos y verifica sus webhooks.
+	pasarela pagos.PaymentGateway
+	// notificador avisa a los clientes de los cambios de sus pedidos.
+	notificador notificaciones.Notificador
+	// carritoCookie firma la cookie con el token del carrito de invitado.
+	carritoCookie *securecookie.SecureCookie
+	secureCookies bool
+}
+
+// New crea los handlers con los repositorios indicados. `almacen` guarda las
+// imágenes subidas, `pasarela` cobra los pedidos y `notificador` avisa a los
+// clientes. `sessionKey` firma las cookies de sesión y debe ser estable entre
+// reinicios; `secureCookies` activa el flag Secure de las cookies.
+func New(repos models.Repositorios, almacen almacenamiento.Almacenamiento, pasarela pagos.PaymentGateway, notificador notificaciones.Notificador, sessionKey []byte, secureCookies bool) *Handler {
+	return &Handler{
+		Repositorios:  repos,
+		store:         newSessionStore(repos.Sesiones, sessionKey, secureCookies),
+		almacen:       almacen,
+		pasarela:      pasarela,
+		notificador:   notificador,
+		carritoCookie: securecookie.New(sessionKey, nil).MaxAge(int(CarritoInvitadoDuracion / time.Second)),
+		secureCookies: secureCookies,
+	}
+}
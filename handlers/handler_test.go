@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/almacenamiento"
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/notificaciones"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// claveTest es el secreto de las cookies y de los webhooks en las pruebas.
+var claveTest = []byte("0123456789abcdef0123456789abcdef")
+
+func TestMain(m *testing.M) {
+	// Las plantillas se leen con rutas relativas a la raíz del repositorio.
+	if err := os.Chdir(".."); err != nil {
+		log.Fatal(err)
+	}
+	if err := models.SetBcryptCost(bcrypt.MinCost); err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// entorno es la tienda completa (rutas, middlewares y plantillas) sobre los
+// repositorios en memoria, servida con httptest.
+type entorno struct {
+	t           *testing.T
+	repos       models.Repositorios
+	almacen     *almacenamiento.Memoria
+	pasarela    *pasarelaTest
+	notificador *notificaciones.Memoria
+	srv         *httptest.Server
+}
+
+// nuevoEntorno arma una tienda vacía con la pasarela simulada en `modo`. La
+// pasarela no envía webhooks: las pruebas los mandan con webhook.
+func nuevoEntorno(t *testing.T, modo string) *entorno {
+	t.Helper()
+	simulado, err := pagos.NewSimulado(pagos.ConfigSimulado{Modo: modo, Secreto: claveTest, Retraso: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pasarela := &pasarelaTest{Simulado: simulado, reembolsado: map[string]dinero.Monto{}}
+	e := &entorno{
+		t:           t,
+		repos:       models.NewRepositoriosMemoria(),
+		almacen:     almacenamiento.NewMemoria("/media"),
+		pasarela:    pasarela,
+		notificador: &notificaciones.Memoria{},
+	}
+	h := New(e.repos, e.almacen, pasarela, e.notificador, claveTest, false)
+	r := mux.NewRouter()
+	h.Rutas(r)
+	e.srv = httptest.NewServer(r)
+	t.Cleanup(e.srv.Close)
+	return e
+}
+
+// errPasarelaTest es el error de los fallos provocados en pasarelaTest.
+var errPasarelaTest = errors.New("la pasarela no responde")
+
+// pasarelaTest es la pasarela simulada con fallos a pedido en las
+// devoluciones: con `fallar` los reembolsos y las anulaciones no llegan a la
+// pasarela; con `perderRespuesta` el reembolso se hace pero la respuesta se
+// pierde, como en un corte de red. `reembolsado` es lo devuelto de cada
+// transacción según la pasarela.
+type pasarelaTest struct {
+	*pagos.Simulado
+
+	mu              sync.Mutex
+	fallar          bool
+	perderRespuesta bool
+	reembolsado     map[string]dinero.Monto
+}
+
+// fallos configura los fallos de las devoluciones siguientes.
+func (p *pasarelaTest) fallos(fallar, perderRespuesta bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fallar, p.perderRespuesta = fallar, perderRespuesta
+}
+
+// devuelto es lo reembolsado de la transacción según la pasarela.
+func (p *pasarelaTest) devuelto(transaccionID string) dinero.Monto {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.reembolsado[transaccionID]
+}
+
+func (p *pasarelaTest) Refund(transaccionID string, monto dinero.Monto, clave string) (pagos.Transaccion, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fallar {
+		return pagos.Transaccion{}, errPasarelaTest
+	}
+	t, err := p.Simulado.Refund(transaccionID, monto, clave)
+	if err != nil {
+		return t, err
+	}
+	p.reembolsado[transaccionID] = t.Reembolsado
+	if p.perderRespuesta {
+		return pagos.Transaccion{}, errPasarelaTest
+	}
+	return t, nil
+}
+
+func (p *pasarelaTest) Void(transaccionID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fallar {
+		return errPasarelaTest
+	}
+	return p.Simulado.Void(transaccionID)
+}
+
+// cliente registra un cliente con contraseña "clave" y devuelve su ID.
+func (e *entorno) cliente(nombre, email, perfil string) int {
+	e.t.Helper()
+	hash, err := models.HashPassword("clave")
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	c := models.Cliente{Nombre: nombre, Email: email, PasswordHash: hash, Perfil: perfil, Direccion: "Calle 1", Telefono: "555"}
+	if err := e.repos.Clientes.Create(c); err != nil {
+		e.t.Fatal(err)
+	}
+	c, err = e.repos.Clientes.GetByEmail(email)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return c.ID
+}
+
+// producto da de alta un producto activo y devuelve su ID.
+func (e *entorno) producto(nombre string, precio dinero.Monto, stock int) int {
+	e.t.Helper()
+	id, err := e.repos.Productos.Create(models.Producto{Nombre: nombre, SKU: strings.ToUpper(nombre), Precio: precio, Stock: stock, Activo: true})
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return id
+}
+
+// stock devuelve el stock actual de un producto.
+func (e *entorno) stock(id int) int {
+	e.t.Helper()
+	p, err := e.repos.Productos.GetByID(id)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return p.Stock
+}
+
+// pedido devuelve un pedido.
+func (e *entorno) pedido(id int) models.Pedido {
+	e.t.Helper()
+	p, err := e.repos.Pedidos.GetByID(id)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	return p
+}
+
+// webhook envía a la tienda una notificación firmada de la pasarela y
+// devuelve el código de respuesta.
+func (e *entorno) webhook(ev pagos.Evento) int {
+	e.t.Helper()
+	cuerpo, cabeceras := e.pasarela.Webhook(ev)
+	req, err := http.NewRequest(http.MethodPost, e.srv.URL+"/webhooks/pagos/simulado", strings.NewReader(string(cuerpo)))
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	req.Header = cabeceras
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+// navegador es un visitante con sus cookies. Envía el token CSRF de su
+// sesión en cada POST.
+type navegador struct {
+	e     *entorno
+	cli   *http.Client
+	token string
+}
+
+var tokenRe = regexp.MustCompile(`name="csrf-token" content="([^"]+)"`)
+
+// navegador abre una sesión anónima.
+func (e *entorno) navegador() *navegador {
+	e.t.Helper()
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	n := &navegador{e: e, cli: &http.Client{
+		Jar:           jar,
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}}
+	n.renovarToken()
+	return n
+}
+
+// login abre una sesión con las credenciales de un cliente de prueba.
+func (e *entorno) login(email string) *navegador {
+	e.t.Helper()
+	n := e.navegador()
+	if status, destino, _ := n.post("/login", url.Values{"email": {email}, "password": {"clave"}}); status != http.StatusSeeOther || destino == "/login" {
+		e.t.Fatalf("login de %s: %d %s", email, status, destino)
+	}
+	// El login regenera la sesión y con ella el token.
+	n.renovarToken()
+	return n
+}
+
+func (n *navegador) renovarToken() {
+	n.e.t.Helper()
+	_, cuerpo := n.get("/")
+	m := tokenRe.FindStringSubmatch(cuerpo)
+	if m == nil {
+		n.e.t.Fatal("la página de inicio no trae el token CSRF")
+	}
+	n.token = m[1]
+}
+
+// get devuelve el código y el cuerpo de la respuesta.
+func (n *navegador) get(ruta string) (int, string) {
+	n.e.t.Helper()
+	res, err := n.cli.Get(n.e.srv.URL + ruta)
+	if err != nil {
+		n.e.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	cuerpo, _ := io.ReadAll(res.Body)
+	return res.StatusCode, string(cuerpo)
+}
+
+// post envía el formulario y devuelve el código, la redirección (si hay) y
+// el cuerpo de la respuesta.
+func (n *navegador) post(ruta string, form url.Values) (int, string, string) {
+	n.e.t.Helper()
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set(csrfFieldName, n.token)
+	res, err := n.cli.PostForm(n.e.srv.URL+ruta, form)
+	if err != nil {
+		n.e.t.Fatal(err)
+	}
+	defer res.Body.Close()
+	cuerpo, _ := io.ReadAll(res.Body)
+	return res.StatusCode, res.Header.Get("Location"), string(cuerpo)
+}
+
+// agregar pone `cantidad` unidades del producto en el carrito.
+func (n *navegador) agregar(idProducto, cantidad int) {
+	n.e.t.Helper()
+	status, _, _ := n.post("/producto/agregar-carrito", url.Values{"id_producto": {strconv.Itoa(idProducto)}, "cantidad": {strconv.Itoa(cantidad)}})
+	if status != http.StatusSeeOther {
+		n.e.t.Fatalf("agregar al carrito: %d", status)
+	}
+}
+
+// comprar confirma el checkout con tarjeta y devuelve el ID del pedido
+// creado. Falla la prueba si no se redirige al perfil.
+func (n *navegador) comprar(form url.Values) int {
+	n.e.t.Helper()
+	if form == nil {
+		form = url.Values{}
+	}
+	form.Set("metodo_pago", "tarjeta")
+	status, destino, cuerpo := n.post("/checkout", form)
+	if status != http.StatusSeeOther || !strings.HasPrefix(destino, "/perfil") {
+		n.e.t.Fatalf("checkout: %d %s\n%s", status, destino, cuerpo)
+	}
+	pedidos, err := n.e.repos.Pedidos.GetAll()
+	if err != nil || len(pedidos) == 0 {
+		n.e.t.Fatal("el checkout no creó el pedido", err)
+	}
+	return pedidos[len(pedidos)-1].ID
+}
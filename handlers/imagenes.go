@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/imagenes"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// maxImagenesPorEnvio limita cuántos archivos se procesan en un mismo envío
+// del formulario de producto.
+const maxImagenesPorEnvio = 10
+
+// imagenVista es una imagen de producto con las URLs de sus variantes, lista
+// para usar en los templates.
+type imagenVista struct {
+	models.ImagenProducto
+	Miniatura string
+	Mediana   string
+	Grande    string
+}
+
+// vistaImagen resuelve las URLs públicas de las variantes de una imagen.
+func (h *Handler) vistaImagen(imagen models.ImagenProducto) imagenVista {
+	return imagenVista{
+		ImagenProducto: imagen,
+		Miniatura:      h.almacen.URL(imagen.ClaveVariante("miniatura")),
+		Mediana:        h.almacen.URL(imagen.ClaveVariante("mediana")),
+		Grande:         h.almacen.URL(imagen.ClaveVariante("grande")),
+	}
+}
+
+// imagenesProducto devuelve las imágenes de un producto en su orden.
+func (h *Handler) imagenesProducto(idProducto int) ([]imagenVista, error) {
+	registros, err := h.Imagenes.GetByProductoID(idProducto)
+	if err != nil {
+		return nil, err
+	}
+	vistas := make([]imagenVista, 0, len(registros))
+	for _, imagen := range registros {
+		vistas = append(vistas, h.vistaImagen(imagen))
+	}
+	return vistas, nil
+}
+
+// urlsPrincipales devuelve, por ID de producto, la URL de la variante pedida
+// de su imagen principal. Los productos sin imágenes no aparecen en el mapa.
+func (h *Handler) urlsPrincipales(productos []models.Producto, variante string) map[int]string {
+	ids := make([]int, 0, len(productos))
+	for _, p := range productos {
+		ids = append(ids, p.ID)
+	}
+	urls := map[int]string{}
+	principales, err := h.Imagenes.GetPrincipales(ids)
+	if err != nil {
+		// Sin imágenes la tienda sigue funcionando con el marcador de posición.
+		log.Println("Error obteniendo imágenes principales:", err)
+		return urls
+	}
+	for id, imagen := range principales {
+		urls[id] = h.almacen.URL(imagen.ClaveVariante(variante))
+	}
+	return urls
+}
+
+// archivosImagen devuelve los archivos enviados en el campo `imagenes` de un
+// formulario multipart, o nil si el formulario no era multipart.
+func archivosImagen(r *http.Request) []*multipart.FileHeader {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.File["imagenes"]
+}
+
+// guardarImagenes valida, redimensiona y guarda las imágenes subidas para un
+// producto. Los archivos inválidos se saltan; devuelve un mensaje por cada uno.
+func (h *Handler) guardarImagenes(idProducto int, archivos []*multipart.FileHeader) []string {
+	var errores []string
+	for i, archivo := range archivos {
+		if archivo.Filename == "" && archivo.Size == 0 {
+			// Input de archivo vacío: el formulario se envió sin imágenes.
+			continue
+		}
+		if i >= maxImagenesPorEnvio {
+			errores = append(errores, fmt.Sprintf("%s: se pueden subir como máximo %d imágenes por vez", archivo.Filename, maxImagenesPorEnvio))
+			continue
+		}
+		if err := h.guardarImagen(idProducto, archivo); err != nil {
+			log.Println("Error guardando imagen", archivo.Filename, "del producto", idProducto, err)
+			errores = append(errores, archivo.Filename+": "+mensajeImagen(err))
+		}
+	}
+	return errores
+}
+
+// guardarImagen procesa un archivo, sube sus variantes y registra la imagen.
+// Si el registro falla se borran las variantes ya subidas.
+func (h *Handler) guardarImagen(idProducto int, archivo *multipart.FileHeader) error {
+	if archivo.Size > imagenes.MaxBytes {
+		return imagenes.ErrDemasiadoGrande
+	}
+	f, err := archivo.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	datos, err := io.ReadAll(io.LimitReader(f, imagenes.MaxBytes+1))
+	if err != nil {
+		return err
+	}
+	procesada, err := imagenes.Procesar(datos)
+	if err != nil {
+		return err
+	}
+
+	sufijo := make([]byte, 8)
+	if _, err := rand.Read(sufijo); err != nil {
+		return err
+	}
+	imagen := models.ImagenProducto{
+		IDProducto: idProducto,
+		Clave:      "productos/" + strconv.Itoa(idProducto) + "/" + hex.EncodeToString(sufijo),
+		Extension:  procesada.Extension,
+	}
+	for _, v := range imagenes.Variantes {
+		if err := h.almacen.Guardar(imagen.ClaveVariante(v.Nombre), procesada.Variantes[v.Nombre], procesada.TipoContenido); err != nil {
+			h.eliminarArchivosImagen(imagen)
+			return err
+		}
+	}
+	if _, err := h.Imagenes.Create(idProducto, imagen.Clave, imagen.Extension); err != nil {
+		h.eliminarArchivosImagen(imagen)
+		return err
+	}
+	return nil
+}
+
+// mensajeImagen traduce los errores de validación a un texto para el
+// administrador; el resto se informa de forma genérica.
+func mensajeImagen(err error) string {
+	switch {
+	case errors.Is(err, imagenes.ErrFormatoNoSoportado), errors.Is(err, imagenes.ErrDemasiadoGrande), errors.Is(err, imagenes.ErrDimensiones):
+		return err.Error()
+	default:
+		return "no se pudo procesar la imagen"
+	}
+}
+
+// eliminarArchivosImagen borra del almacenamiento todas las variantes de una
+// imagen. Los fallos solo se registran: un archivo huérfano no rompe la tienda.
+func (h *Handler) eliminarArchivosImagen(imagen models.ImagenProducto) {
+	for _, v := range imagenes.Variantes {
+		if err := h.almacen.Eliminar(imagen.ClaveVariante(v.Nombre)); err != nil {
+			log.Println("Error eliminando archivo de imagen:", err)
+		}
+	}
+}
+
+// imagenDeRuta lee `{id}` e `{idImagen}` de la ruta y comprueba que la imagen
+// pertenezca al producto. Responde 404 si no es así.
+func (h *Handler) imagenDeRuta(w http.ResponseWriter, r *http.Request) (models.ImagenProducto, bool) {
+	vars := mux.Vars(r)
+	idProducto, _ := strconv.Atoi(vars["id"])
+	idImagen, _ := strconv.Atoi(vars["idImagen"])
+
+	imagen, err := h.Imagenes.GetByID(idImagen)
+	if err != nil || imagen.IDProducto != idProducto {
+		http.Error(w, "Imagen no encontrada", http.StatusNotFound)
+		return models.ImagenProducto{}, false
+	}
+	return imagen, true
+}
+
+// redirigirEdicionProducto vuelve al formulario de edición del producto.
+func redirigirEdicionProducto(w http.ResponseWriter, r *http.Request, idProducto int) {
+	http.Redirect(w, r, "/admin/productos/editar/"+strconv.Itoa(idProducto), http.StatusSeeOther)
+}
+
+func (h *Handler) AdminProductImageDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminProductImageDelete elimina una imagen del producto y sus archivos.
+	imagen, ok := h.imagenDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Imagenes.Delete(imagen.ID); err != nil {
+		log.Println("Error eliminando imagen:", err)
+		http.Error(w, "Error eliminando imagen", http.StatusInternalServerError)
+		return
+	}
+	h.eliminarArchivosImagen(imagen)
+	redirigirEdicionProducto(w, r, imagen.IDProducto)
+}
+
+func (h *Handler) AdminProductImagePrimary(w http.ResponseWriter, r *http.Request) {
+	// AdminProductImagePrimary marca la imagen como principal del producto.
+	imagen, ok := h.imagenDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Imagenes.SetPrincipal(imagen.IDProducto, imagen.ID); err != nil {
+		log.Println("Error marcando imagen principal:", err)
+		http.Error(w, "Error actualizando imagen", http.StatusInternalServerError)
+		return
+	}
+	redirigirEdicionProducto(w, r, imagen.IDProducto)
+}
+
+func (h *Handler) AdminProductImageMove(w http.ResponseWriter, r *http.Request) {
+	// AdminProductImageMove sube o baja una posición la imagen según el campo
+	// `direccion` ("arriba" o "abajo").
+	imagen, ok := h.imagenDeRuta(w, r)
+	if !ok {
+		return
+	}
+	actuales, err := h.Imagenes.GetByProductoID(imagen.IDProducto)
+	if err != nil {
+		log.Println("Error obteniendo imágenes del producto:", err)
+		http.Error(w, "Error actualizando imagen", http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]int, len(actuales))
+	pos := -1
+	for i, img := range actuales {
+		ids[i] = img.ID
+		if img.ID == imagen.ID {
+			pos = i
+		}
+	}
+	destino := pos + 1
+	if r.FormValue("direccion") == "arriba" {
+		destino = pos - 1
+	}
+	if pos >= 0 && destino >= 0 && destino < len(ids) {
+		ids[pos], ids[destino] = ids[destino], ids[pos]
+		if err := h.Imagenes.Reordenar(imagen.IDProducto, ids); err != nil {
+			log.Println("Error reordenando imágenes:", err)
+			http.Error(w, "Error actualizando imagen", http.StatusInternalServerError)
+			return
+		}
+	}
+	redirigirEdicionProducto(w, r, imagen.IDProducto)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/imagenes"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"bytes"
+	"fmt"
+	"image"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+func TestImagenesProductoEnAlmacenamiento(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Ana", "ana@test", "admin")
+	admin := e.login("ana@test")
+
+	var foto bytes.Buffer
+	if err := png.Encode(&foto, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	var cuerpo bytes.Buffer
+	form := multipart.NewWriter(&cuerpo)
+	for campo, valor := range map[string]string{"nombre": "Taza", "sku": "TAZA", "precio": "5", "stock": "3", "activo": "on"} {
+		form.WriteField(campo, valor)
+	}
+	archivo, _ := form.CreateFormFile("imagenes", "taza.png")
+	archivo.Write(foto.Bytes())
+	form.Close()
+
+	req, _ := http.NewRequest(http.MethodPost, e.srv.URL+"/admin/productos/nuevo", &cuerpo)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	req.Header.Set(csrfHeaderName, admin.token)
+	res, err := admin.cli.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusSeeOther {
+		t.Fatalf("crear producto con imagen: %d, se esperaba 303", res.StatusCode)
+	}
+
+	productos, _ := e.repos.Productos.GetAll()
+	imagenesProducto, _ := e.repos.Imagenes.GetByProductoID(productos[0].ID)
+	if len(imagenesProducto) != 1 {
+		t.Fatalf("%d imágenes, se esperaba 1", len(imagenesProducto))
+	}
+	imagen := imagenesProducto[0]
+	for _, v := range imagenes.Variantes {
+		if _, tipo, err := e.almacen.Leer(imagen.ClaveVariante(v.Nombre)); err != nil || tipo != "image/png" {
+			t.Errorf("variante %s: tipo %q, %v", v.Nombre, tipo, err)
+		}
+	}
+
+	ruta := fmt.Sprintf("/admin/productos/%d/imagenes/%d/eliminar", imagen.IDProducto, imagen.ID)
+	if status, _, _ := admin.post(ruta, nil); status != http.StatusSeeOther {
+		t.Fatalf("eliminar imagen: %d, se esperaba 303", status)
+	}
+	for _, v := range imagenes.Variantes {
+		if _, _, err := e.almacen.Leer(imagen.ClaveVariante(v.Nombre)); err == nil {
+			t.Errorf("la variante %s sigue en el almacenamiento", v.Nombre)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// impuestosCarrito calcula, para mostrarlo antes de confirmar, el impuesto de
+// cada línea sobre lo que queda a pagar tras las promociones y el cupón. El
+// checkout lo vuelve a calcular dentro de la transacción.
+func (h *Handler) impuestosCarrito(detalles []CartItemDetail) *models.DesgloseImpuestos {
+	impuestos := models.NuevoDesgloseImpuestos()
+	clases, err := h.Impuestos.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo clases de impuesto:", err)
+		return impuestos
+	}
+	for _, d := range detalles {
+		impuestos.Agregar(models.ClaseDeProducto(clases, d.Producto.IDClaseImpuesto), d.Subtotal-d.Descuento-d.DescuentoCupon)
+	}
+	return impuestos
+}
+
+func (h *Handler) AdminTaxes(w http.ResponseWriter, r *http.Request) {
+	// AdminTaxes lista las clases de impuesto e indica si los precios del
+	// catálogo los incluyen.
+	_, perfil, _ := h.GetSessionData(r)
+
+	clases, err := h.Impuestos.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo clases de impuesto:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/impuestos.html")
+	if err != nil {
+		log.Println("Error cargando templates admin taxes:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil              string
+		Clases              []models.ClaseImpuesto
+		PreciosConImpuestos bool
+		DashboardActive     bool
+		ProductosActive     bool
+		CategoriasActive    bool
+		PedidosActive       bool
+		ClientesActive      bool
+		CuponesActive       bool
+		PromocionesActive   bool
+		DevolucionesActive  bool
+		EnviosActive        bool
+		ImpuestosActive     bool
+	}{
+		Perfil:              perfil,
+		Clases:              clases,
+		PreciosConImpuestos: models.PreciosConImpuestos(),
+		ImpuestosActive:     true,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin taxes:", err)
+	}
+}
+
+// claseImpuestoDesdeFormulario lee y valida los campos del formulario de
+// clase de impuesto.
+func claseImpuestoDesdeFormulario(r *http.Request) (models.ClaseImpuesto, []string) {
+	f := &lectorFormulario{r: r}
+	clase := models.ClaseImpuesto{
+		Nombre:         strings.TrimSpace(r.FormValue("nombre")),
+		Tasa:           f.decimal("tasa", "La tasa", false),
+		Exenta:         r.FormValue("exenta") == "on",
+		Predeterminada: r.FormValue("predeterminada") == "on",
+	}
+	if len(f.errores) == 0 {
+		if err := models.ValidarClaseImpuesto(clase); err != nil {
+			f.errores = append(f.errores, err.Error())
+		}
+	}
+	return clase, f.errores
+}
+
+func (h *Handler) AdminTaxClassCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminTaxClassCreate muestra el formulario y crea clases de impuesto.
+	if r.Method == "POST" {
+		clase, errores := claseImpuestoDesdeFormulario(r)
+		if len(errores) == 0 {
+			if err := h.Impuestos.Create(clase); err != nil {
+				log.Println("Error creando clase de impuesto:", err)
+				errores = append(errores, "No se pudo crear la clase: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioClaseImpuesto(w, r, false, clase, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/impuestos", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioClaseImpuesto(w, r, false, models.ClaseImpuesto{}, nil)
+}
+
+func (h *Handler) AdminTaxClassEdit(w http.ResponseWriter, r *http.Request) {
+	// AdminTaxClassEdit edita una clase de impuesto. Los pedidos ya hechos
+	// conservan la tasa con la que se cobraron.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	existente, err := h.Impuestos.GetByID(id)
+	if err != nil {
+		http.Error(w, "Clase de impuesto no encontrada", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		clase, errores := claseImpuestoDesdeFormulario(r)
+		clase.ID = id
+		if len(errores) == 0 {
+			if err := h.Impuestos.Update(clase); err != nil {
+				log.Println("Error actualizando clase de impuesto:", err)
+				errores = append(errores, "No se pudo actualizar la clase: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioClaseImpuesto(w, r, true, clase, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/impuestos", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioClaseImpuesto(w, r, true, existente, nil)
+}
+
+// renderFormularioClaseImpuesto dibuja el formulario de alta o edición de
+// una clase de impuesto.
+func (h *Handler) renderFormularioClaseImpuesto(w http.ResponseWriter, r *http.Request, isEdit bool, clase models.ClaseImpuesto, errores []string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_impuesto.html")
+	if err != nil {
+		log.Println("Error cargando template admin tax class form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Clase              models.ClaseImpuesto
+		Errores            []string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:          perfil,
+		IsEdit:          isEdit,
+		Clase:           clase,
+		Errores:         errores,
+		ImpuestosActive: true,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin tax class form:", err)
+	}
+}
+
+func (h *Handler) AdminTaxClassDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminTaxClassDelete elimina una clase de impuesto; sus productos pasan
+	// a usar la predeterminada.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Impuestos.Delete(id); err != nil {
+		log.Println("Error eliminando clase de impuesto:", err)
+		http.Error(w, "Error eliminando clase de impuesto", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/impuestos", http.StatusSeeOther)
+}
@@ -2,30 +2,56 @@ package handlers
 
 import (
 	"Go-Sistemas-de-Gestion-empresarial/models"
-	"html/template"
 	"log"
 	"net/http"
 )
 
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	// HomeHandler muestra la página principal con los productos activos disponibles.
-	// Filtra productos por `Activo` y `Stock > 0`, carga templates y renderiza la vista.
-	productos, err := models.GetAllProductos()
+	// Acepta uno o más filtros `?categoria=ID`; cada uno incluye sus subcategorías.
+	// El filtrado y la paginación se resuelven en el repositorio.
+	categorias, err := h.Categorias.GetAll()
 	if err != nil {
-		log.Println("Error al obtener los productos", err)
+		log.Println("Error al obtener las categorías", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
 		return
 	}
 
-	loggedIn, perfil, _ := GetSessionData(r)
+	filtros := parseIDs(r.URL.Query()["categoria"])
+	busqueda := models.BusquedaProductos{
+		Categorias:   expandirCategorias(categorias, filtros),
+		SoloActivos:  true,
+		SoloConStock: true,
+		Orden:        r.URL.Query().Get("orden"),
+		Pagina:       parsePagina(r),
+	}
 
-	var activeProductos []models.Producto
-	for _, p := range productos {
-		if p.Activo && p.Stock > 0 {
-			activeProductos = append(activeProductos, p)
-		}
+	h.renderCatalogo(w, r, busqueda, categorias, filtros, models.Categoria{})
+}
+
+// expandirCategorias agrega a cada categoría filtrada todas sus subcategorías.
+func expandirCategorias(categorias []models.Categoria, filtros []int) []int {
+	var ids []int
+	for _, id := range filtros {
+		ids = append(ids, models.Descendientes(categorias, id)...)
+	}
+	return ids
+}
+
+// renderCatalogo ejecuta la búsqueda y dibuja el listado de productos de la
+// tienda. Si `actual` tiene ID, la vista muestra la categoría con sus migas de
+// pan y subcategorías.
+func (h *Handler) renderCatalogo(w http.ResponseWriter, r *http.Request, busqueda models.BusquedaProductos, categorias []models.Categoria, filtros []int, actual models.Categoria) {
+	loggedIn, perfil, _ := h.GetSessionData(r)
+
+	resultado, err := h.Productos.Buscar(busqueda)
+	if err != nil {
+		log.Println("Error al obtener los productos", err)
+		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
+		return
 	}
 
-	tmpl, err := template.ParseFiles("templates/base.html", "templates/cliente/productos.html")
+	tmpl, err := parseTemplates(r, "templates/base.html", "templates/cliente/productos.html", "templates/cliente/grilla_productos.html")
 	if err != nil {
 		log.Println("Error al cargar el template de home", err)
 		http.Error(w, "Error interno del servidor", http.StatusInternalServerError)
@@ -33,15 +59,33 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := struct {
-		Productos  []models.Producto
-		LoginToken bool
-		Perfil     string
-		ItemAdded  bool
+		Resultado          models.ResultadoBusqueda
+		Imagenes           map[int]string
+		ConVariantes       map[int]bool
+		PaginaAnteriorURL  string
+		PaginaSiguienteURL string
+		Categorias         []opcionCategoria
+		Filtrado           bool
+		Categoria          models.Categoria
+		Ruta               []models.Categoria
+		Subcategorias      []models.Categoria
+		LoginToken         bool
+		Perfil             string
+		ItemAdded          bool
 	}{
-		Productos:  activeProductos,
-		LoginToken: loggedIn,
-		Perfil:     perfil,
-		ItemAdded:  r.URL.Query().Get("added") == "true",
+		Resultado:          resultado,
+		Imagenes:           h.urlsPrincipales(resultado.Productos, "mediana"),
+		ConVariantes:       h.productosConVariantes(resultado.Productos),
+		PaginaAnteriorURL:  urlPagina(r, resultado.Pagina-1),
+		PaginaSiguienteURL: urlPagina(r, resultado.Pagina+1),
+		Categorias:         opcionesCategoria(categorias, filtros),
+		Filtrado:           len(filtros) > 0,
+		Categoria:          actual,
+		Ruta:               models.RutaCategoria(categorias, actual.ID),
+		Subcategorias:      models.Subcategorias(categorias, actual.ID),
+		LoginToken:         loggedIn,
+		Perfil:             perfil,
+		ItemAdded:          r.URL.Query().Get("added") == "true",
 	}
 
 	err = tmpl.ExecuteTemplate(w, "base", data)
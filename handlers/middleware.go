@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/imagenes"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// RequireAdmin es un middleware para las rutas de administración. Exige una
+// sesión válida cuyo cliente tenga perfil "admin" según la base de datos:
+// los visitantes anónimos se redirigen al login con `next` y los clientes
+// sin permisos reciben una página 403.
+func (h *Handler) RequireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cliente, ok := h.GetSessionCliente(r)
+		if !ok {
+			redirectToLogin(w, r)
+			return
+		}
+		if cliente.Perfil != "admin" {
+			h.renderError(w, r, http.StatusForbidden, "Acceso denegado", "No tienes permisos para acceder al panel de administración.")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redirectToLogin envía al visitante al login recordando la página pedida,
+// para volver a ella tras autenticarse. Solo se recuerdan peticiones GET.
+func redirectToLogin(w http.ResponseWriter, r *http.Request) {
+	target := "/login"
+	if r.Method == http.MethodGet {
+		target += "?next=" + url.QueryEscape(r.URL.RequestURI())
+	}
+	http.Redirect(w, r, target, http.StatusSeeOther)
+}
+
+// safeRedirect valida un destino de redirección recibido del usuario. Solo
+// admite rutas locales para evitar redirecciones abiertas (p. ej. "//evil.com").
+func safeRedirect(next string) string {
+	if next == "" || !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		return "/"
+	}
+	u, err := url.Parse(next)
+	if err != nil || u.IsAbs() || u.Host != "" {
+		return "/"
+	}
+	return next
+}
+
+const (
+	// maxCuerpoFormulario limita el cuerpo de los formularios comunes.
+	maxCuerpoFormulario = 1 << 20
+	// maxCuerpoMultipart admite un envío completo de imágenes más los campos.
+	maxCuerpoMultipart = maxImagenesPorEnvio*imagenes.MaxBytes + maxCuerpoFormulario
+)
+
+// LimitarCuerpo acota el tamaño del cuerpo de las peticiones. Los formularios
+// multipart (subida de imágenes) tienen un límite mayor. Debe ir antes de CSRF,
+// que es el primero en leer el formulario.
+func LimitarCuerpo(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limite := int64(maxCuerpoFormulario)
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			limite = maxCuerpoMultipart
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limite)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// cobrarPedido cobra en la pasarela un pedido ya creado y PENDIENTE:
+// autoriza lo que no cubre el crédito (ver Pedido.ACobrar), guarda la
+// transacción en el pedido para que los webhooks lo encuentren y, si quedó
+// autorizada, la captura y marca el pedido PAGADO.
+// Un cobro pendiente (p. ej. una transferencia) se confirma después por
+// webhook. Si la pasarela rechaza el cobro o algo falla antes de capturarlo,
+// anula la transacción y el pedido (ver anularCheckout) y devuelve el error.
+func (h *Handler) cobrarPedido(p models.Pedido) error {
+	t, err := h.pasarela.Authorize(pagos.Cargo{
+		Monto:      p.ACobrar(),
+		Metodo:     p.MetodoPago,
+		Referencia: fmt.Sprintf("pedido-%d", p.ID),
+	})
+	if err != nil {
+		h.anularCheckout(p, "", err)
+		return err
+	}
+	cobro := models.Cobro{Proveedor: h.pasarela.Nombre(), TransaccionID: t.ID}
+	if _, err := h.Pedidos.RegistrarCobro(p.ID, cobro); err != nil {
+		h.anularCheckout(p, t.ID, err)
+		return err
+	}
+	if t.Estado != pagos.EstadoAutorizada {
+		return nil
+	}
+	if _, err := h.pasarela.Capture(t.ID); err != nil {
+		h.anularCheckout(p, t.ID, err)
+		return err
+	}
+
+	cobro.Pagado = true
+	cambio, err := h.Pedidos.RegistrarCobro(p.ID, cobro)
+	if err != nil {
+		// El dinero ya se cobró y la transacción está en el pedido: el
+		// webhook de la captura lo marcará PAGADO.
+		log.Println("Error registrando el pago del pedido", p.ID, err)
+		return nil
+	}
+	if cambio != nil {
+		h.notificarCambioEstado(*cambio)
+	}
+	return nil
+}
+
+// anularCheckout anula en la pasarela la transacción sin capturar (si la
+// hay) y cancela el pedido devolviendo sus productos al carrito. Los fallos
+// solo se registran: el pedido queda PENDIENTE y un administrador puede
+// cancelarlo.
+func (h *Handler) anularCheckout(p models.Pedido, transaccionID string, causa error) {
+	if transaccionID != "" {
+		if err := h.pasarela.Void(transaccionID); err != nil {
+			log.Println("Error anulando la transacción", transaccionID, err)
+		}
+	}
+	motivo := "No se pudo cobrar: " + causa.Error()
+	if errors.Is(causa, pagos.ErrPagoRechazado) {
+		motivo = "Pago rechazado: " + causa.Error()
+	}
+	if _, err := h.Pedidos.AnularCheckout(p.ID, models.ResponsablePasarela(h.pasarela.Nombre()), motivo); err != nil {
+		log.Println("Error anulando el pedido", p.ID, err)
+	}
+}
+
+// devolverPago pide a la pasarela un reembolso registrado por models: anula
+// la transacción si el pago todavía estaba pendiente o devuelve el monto
+// con la clave del reembolso, así que repetirlo no devuelve dos veces.
+func (h *Handler) devolverPago(r models.Reembolso) error {
+	if r.Operacion == models.OperacionAnulacion {
+		return h.pasarela.Void(r.TransaccionID)
+	}
+	_, err := h.pasarela.Refund(r.TransaccionID, r.Monto, r.Clave())
+	return err
+}
+
+// procesarReembolsos pide a la pasarela los reembolsos pendientes de la
+// lista y guarda el resultado de cada uno. Los que fallan quedan pendientes
+// para el próximo intento (ver ReintentarReembolsos). Devuelve el primer
+// error de la pasarela.
+func (h *Handler) procesarReembolsos(reembolsos []models.Reembolso) error {
+	var primero error
+	for _, r := range reembolsos {
+		if !r.Pendiente() {
+			continue
+		}
+		err := h.devolverPago(r)
+		if err != nil {
+			log.Printf("Error devolviendo el pago del pedido %d (reembolso %d): %v", r.IDPedido, r.ID, err)
+			if primero == nil {
+				primero = err
+			}
+		}
+		if err := h.Pedidos.RegistrarResultadoReembolso(r.ID, err); err != nil {
+			log.Println("Error registrando el resultado del reembolso", r.ID, err)
+		}
+	}
+	return primero
+}
+
+// reembolsarPedido pide a la pasarela los reembolsos pendientes del pedido,
+// después de confirmar el cambio que los registró.
+func (h *Handler) reembolsarPedido(idPedido int) error {
+	reembolsos, err := h.Pedidos.GetReembolsos(idPedido)
+	if err != nil {
+		log.Println("Error obteniendo los reembolsos del pedido", idPedido, err)
+		return err
+	}
+	return h.procesarReembolsos(reembolsos)
+}
+
+// ReintentarReembolsos pide a la pasarela los reembolsos que siguen
+// pendientes en todos los pedidos: los que fallaron y los de pagos aprobados
+// después de cancelar el pedido. Se llama periódicamente.
+func (h *Handler) ReintentarReembolsos() {
+	reembolsos, err := h.Pedidos.GetReembolsosPendientes()
+	if err != nil {
+		log.Println("Error obteniendo los reembolsos pendientes:", err)
+		return
+	}
+	h.procesarReembolsos(reembolsos)
+}
+
+// tipoEventoPago traduce el tipo de evento de la pasarela al de models.
+func tipoEventoPago(tipo string) (string, bool) {
+	switch tipo {
+	case pagos.EventoAprobado:
+		return models.PagoAprobado, true
+	case pagos.EventoRechazado:
+		return models.PagoRechazado, true
+	case pagos.EventoReembolsado:
+		return models.PagoReembolsado, true
+	}
+	return "", false
+}
+
+func (h *Handler) PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	// PaymentWebhook recibe las notificaciones de la pasarela. No usa sesión
+	// ni CSRF: la autenticidad la da la firma HMAC. Un pago aprobado marca el
+	// pedido PAGADO y uno rechazado lo cancela, y se avisa al cliente. Los
+	// reenvíos de un evento ya aplicado responden 200 sin cambiar nada; 404 y
+	// 5xx hacen que la pasarela reintente.
+	if mux.Vars(r)["provider"] != h.pasarela.Nombre() {
+		http.NotFound(w, r)
+		return
+	}
+
+	cuerpo, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Cuerpo inválido", http.StatusBadRequest)
+		return
+	}
+	evento, err := h.pasarela.ParseWebhook(r.Header, cuerpo)
+	if err != nil {
+		log.Println("Webhook de pago rechazado:", err)
+		if errors.Is(err, pagos.ErrFirmaInvalida) {
+			http.Error(w, "Firma inválida", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Evento inválido", http.StatusBadRequest)
+		return
+	}
+
+	tipo, ok := tipoEventoPago(evento.Tipo)
+	if !ok {
+		log.Println("Webhook de pago ignorado, tipo desconocido:", evento.Tipo)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	aplicado, cambio, err := h.Pedidos.RegistrarEventoPago(models.EventoPago{
+		Proveedor:     h.pasarela.Nombre(),
+		IDEvento:      evento.ID,
+		Tipo:          tipo,
+		TransaccionID: evento.TransaccionID,
+		Monto:         evento.Monto,
+	})
+	switch {
+	case errors.Is(err, models.ErrTransaccionSinPedido):
+		http.Error(w, "Transacción desconocida", http.StatusNotFound)
+	case errors.Is(err, models.ErrMontoPago):
+		log.Println("Webhook de pago con monto incorrecto:", err)
+		http.Error(w, "Monto incorrecto", http.StatusUnprocessableEntity)
+	case err != nil:
+		log.Println("Error registrando evento de pago:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+	default:
+		if !aplicado {
+			log.Println("Webhook de pago repetido:", evento.ID)
+		}
+		if cambio != nil {
+			h.notificarCambioEstado(*cambio)
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
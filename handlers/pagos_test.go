@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWebhookApruebaPagoDiferido(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoDiferir)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 2)
+	id := n.comprar(nil)
+	p := e.pedido(id)
+	if p.Estado != models.EstadoPendiente || p.TransaccionID == "" {
+		t.Fatalf("pedido %s con transacción %q, se esperaba PENDIENTE con transacción", p.Estado, p.TransaccionID)
+	}
+
+	aprobado := pagos.Evento{ID: "evt_1", Tipo: pagos.EventoAprobado, TransaccionID: p.TransaccionID, Monto: p.Total}
+	if status := e.webhook(pagos.Evento{ID: "evt_0", Tipo: pagos.EventoAprobado, TransaccionID: p.TransaccionID, Monto: p.Total - 1}); status != http.StatusUnprocessableEntity {
+		t.Errorf("webhook con otro monto: %d, se esperaba 422", status)
+	}
+	if status := e.webhook(aprobado); status != http.StatusOK {
+		t.Fatalf("webhook: %d, se esperaba 200", status)
+	}
+	if p := e.pedido(id); p.Estado != models.EstadoPagado {
+		t.Errorf("pedido %s, se esperaba PAGADO", p.Estado)
+	}
+	// Un reenvío no cambia nada ni vuelve a avisar.
+	avisos := len(e.notificador.Enviados())
+	if status := e.webhook(aprobado); status != http.StatusOK {
+		t.Errorf("webhook repetido: %d, se esperaba 200", status)
+	}
+	if len(e.notificador.Enviados()) != avisos {
+		t.Error("el webhook repetido volvió a avisar al cliente")
+	}
+	historial, _ := e.repos.Pedidos.GetHistorial(id)
+	if len(historial) != 2 || !strings.Contains(historial[1].Motivo, "evt_1") {
+		t.Errorf("historial %+v, se esperaban la creación y el pago", historial)
+	}
+}
+
+func TestWebhookRechazoCancelaYReponeStock(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoDiferir)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+
+	n := e.login("bea@test")
+	n.agregar(taza, 2)
+	p := e.pedido(n.comprar(nil))
+	if e.stock(taza) != 1 {
+		t.Fatalf("stock %d, se esperaba 1 mientras el pago está pendiente", e.stock(taza))
+	}
+
+	if status := e.webhook(pagos.Evento{ID: "evt_1", Tipo: pagos.EventoRechazado, TransaccionID: p.TransaccionID}); status != http.StatusOK {
+		t.Fatalf("webhook: %d, se esperaba 200", status)
+	}
+	if p := e.pedido(p.ID); p.Estado != models.EstadoCancelado {
+		t.Errorf("pedido %s, se esperaba CANCELADO", p.Estado)
+	}
+	if e.stock(taza) != 3 {
+		t.Errorf("stock %d, se esperaba 3", e.stock(taza))
+	}
+}
+
+func TestWebhookRechazaFirmaYTransaccionDesconocida(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+
+	if status := e.webhook(pagos.Evento{ID: "evt_1", Tipo: pagos.EventoAprobado, TransaccionID: "sim_nada", Monto: 100}); status != http.StatusNotFound {
+		t.Errorf("transacción desconocida: %d, se esperaba 404", status)
+	}
+
+	cuerpo, cabeceras := e.pasarela.Webhook(pagos.Evento{ID: "evt_2", Tipo: pagos.EventoAprobado, TransaccionID: "sim_nada", Monto: 100})
+	cabeceras.Set(pagos.CabeceraFirmaSimulado, strings.Replace(cabeceras.Get(pagos.CabeceraFirmaSimulado), "v1=", "v1=00", 1))
+	req, _ := http.NewRequest(http.MethodPost, e.srv.URL+"/webhooks/pagos/simulado", strings.NewReader(string(cuerpo)))
+	req.Header = cabeceras
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnauthorized {
+		t.Errorf("firma inválida: %d, se esperaba 401", res.StatusCode)
+	}
+}
+
+func TestWebhookCobraSoloLoQueNoCubreElCredito(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 10)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	acreditarDevolucion(e, n, admin, taza, 1)
+
+	e.pasarela.SetModo(pagos.ModoDiferir)
+	n.agregar(taza, 3)
+	p := e.pedido(n.comprar(nil))
+	if p.Estado != models.EstadoPendiente || p.ACobrar() != dinero.Pesos(10) {
+		t.Fatalf("pedido %s con %s a cobrar, se esperaba PENDIENTE con 10.00", p.Estado, p.ACobrar())
+	}
+	if status := e.webhook(pagos.Evento{ID: "evt_0", Tipo: pagos.EventoAprobado, TransaccionID: p.TransaccionID, Monto: p.Total}); status != http.StatusUnprocessableEntity {
+		t.Errorf("webhook por el total sin el crédito: %d, se esperaba 422", status)
+	}
+	if status := e.webhook(pagos.Evento{ID: "evt_1", Tipo: pagos.EventoAprobado, TransaccionID: p.TransaccionID, Monto: dinero.Pesos(10)}); status != http.StatusOK {
+		t.Fatalf("webhook: %d, se esperaba 200", status)
+	}
+	if p := e.pedido(p.ID); p.Estado != models.EstadoPagado {
+		t.Errorf("pedido %s, se esperaba PAGADO", p.Estado)
+	}
+}
+
+func TestCancelacionReembolsaDespuesDeConfirmar(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Bea", "bea@test", "cliente")
+	e.cliente("Ana", "ana@test", "admin")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+	n, admin := e.login("bea@test"), e.login("ana@test")
+	n.agregar(taza, 2)
+	id := n.comprar(nil)
+	transaccion := e.pedido(id).TransaccionID
+
+	// La pasarela devuelve el dinero pero la respuesta no llega: el pedido
+	// se cancela igual y el reembolso queda pendiente.
+	e.pasarela.fallos(false, true)
+	if status, _, _ := n.post("/pedidos/"+strconv.Itoa(id)+"/cancelar", url.Values{"motivo": {"Me equivoqué"}}); status != http.StatusSeeOther {
+		t.Fatalf("cancelar: %d, se esperaba 303", status)
+	}
+	p := e.pedido(id)
+	if p.Estado != models.EstadoCancelado || p.Reembolsado != p.Total || e.stock(taza) != 3 {
+		t.Errorf("pedido %s con %s reembolsado y stock %d, se esperaba CANCELADO, %s y 3", p.Estado, p.Reembolsado, e.stock(taza), p.Total)
+	}
+	reembolsos, _ := e.repos.Pedidos.GetReembolsos(id)
+	if len(reembolsos) != 1 || !reembolsos[0].Pendiente() || reembolsos[0].Error == "" || reembolsos[0].Monto != p.Total {
+		t.Fatalf("reembolsos %+v, se esperaba uno pendiente por el total con el error", reembolsos)
+	}
+	if _, cuerpo := admin.get("/admin/pedidos/" + strconv.Itoa(id)); !strings.Contains(cuerpo, "Reintentar reembolso") {
+		t.Error("el detalle del pedido no ofrece reintentar el reembolso")
+	}
+
+	// El reintento usa la misma clave: la pasarela no devuelve otra vez.
+	e.pasarela.fallos(false, false)
+	if status, _, _ := admin.post("/admin/pedidos/"+strconv.Itoa(id)+"/reembolsos", nil); status != http.StatusSeeOther {
+		t.Fatalf("reintentar: %d, se esperaba 303", status)
+	}
+	reembolsos, _ = e.repos.Pedidos.GetReembolsos(id)
+	if len(reembolsos) != 1 || reembolsos[0].Pendiente() {
+		t.Errorf("reembolsos %+v, se esperaba el reembolso hecho", reembolsos)
+	}
+	if devuelto := e.pasarela.devuelto(transaccion); devuelto != p.Total {
+		t.Errorf("la pasarela devolvió %s, se esperaba %s", devuelto, p.Total)
+	}
+}
+
+func TestPagoAprobadoTrasCancelarSeReembolsa(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoDiferir)
+	e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+	n := e.login("bea@test")
+	n.agregar(taza, 2)
+	p := e.pedido(n.comprar(nil))
+
+	// La anulación no llega a la pasarela y el pago se aprueba después.
+	e.pasarela.fallos(true, false)
+	if status, _, _ := n.post("/pedidos/"+strconv.Itoa(p.ID)+"/cancelar", url.Values{"motivo": {"Tarda mucho"}}); status != http.StatusSeeOther {
+		t.Fatalf("cancelar: %d, se esperaba 303", status)
+	}
+	reembolsos, _ := e.repos.Pedidos.GetReembolsos(p.ID)
+	if len(reembolsos) != 1 || reembolsos[0].Operacion != models.OperacionAnulacion || !reembolsos[0].Pendiente() {
+		t.Fatalf("reembolsos %+v, se esperaba la anulación pendiente", reembolsos)
+	}
+
+	for _, evento := range []string{"evt_1", "evt_2"} {
+		if status := e.webhook(pagos.Evento{ID: evento, Tipo: pagos.EventoAprobado, TransaccionID: p.TransaccionID, Monto: p.Total}); status != http.StatusOK {
+			t.Fatalf("webhook %s: %d, se esperaba 200", evento, status)
+		}
+	}
+	p = e.pedido(p.ID)
+	if p.Estado != models.EstadoCancelado || p.Reembolsado != p.Total {
+		t.Errorf("pedido %s con %s reembolsado, se esperaba CANCELADO con %s", p.Estado, p.Reembolsado, p.Total)
+	}
+	reembolsos, _ = e.repos.Pedidos.GetReembolsos(p.ID)
+	if len(reembolsos) != 1 || reembolsos[0].Operacion != models.OperacionReembolso || reembolsos[0].Monto != p.Total || !reembolsos[0].Pendiente() {
+		t.Errorf("reembolsos %+v, se esperaba un solo reembolso pendiente por el total", reembolsos)
+	}
+}
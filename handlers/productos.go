@@ -7,40 +7,66 @@ import (
 	"strconv"
 )
 
-func AgregarItemCarrito(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) AgregarItemCarrito(w http.ResponseWriter, r *http.Request) {
 	// AgregarItemCarrito procesa la solicitud POST para añadir un producto
-	// al carrito del cliente autenticado. Crea un carrito si no existe.
+	// al carrito del cliente o del visitante. Crea un carrito si no existe.
+	// Si el producto ya no está a la venta o la línea superaría el stock,
+	// muestra el carrito con el aviso y no agrega nada.
 
 	if r.Method == "POST" {
-		loggedIn, _, userIDStr := GetSessionData(r)
-		if !loggedIn {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		// Los visitantes anónimos usan un carrito de invitado que se fusiona
+		// con el suyo al iniciar sesión.
+		carrito, err := h.carritoActual(w, r, true)
+		if err != nil {
+			log.Println("Error al obtener el carrito:", err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
 			return
 		}
 
-		id, _ := strconv.Atoi(userIDStr)
-		carrito, _ := models.GetCarritoByClienteID(id)
-		log.Println("Carrito ID encontrado:", carrito.ID)
-
-		if carrito.ID == 0 {
-			log.Println("Carrito no encontrado, creando nuevo carrito para cliente:", id)
-			errCarrito := models.CreateCarrito(id)
-			if errCarrito != nil {
-				log.Println("Error al crear el carrito:", errCarrito)
-				http.Redirect(w, r, "/", http.StatusSeeOther)
-				return
-			}
-			carrito, _ = models.GetCarritoByClienteID(id)
-		}
-
 		rawID := r.FormValue("id_producto")
 		idProducto, _ := strconv.Atoi(rawID)
 		cantidad, _ := strconv.Atoi(r.FormValue("cantidad"))
+		if cantidad < 1 {
+			// Las cantidades se suman a la línea existente; nunca restan.
+			cantidad = 1
+		}
 
 		log.Println("DEBUG: Raw id_producto form value:", rawID)
 		log.Println("Agregando producto:", idProducto, "Cantidad:", cantidad, "a Carrito:", carrito.ID)
 
-		err := models.AgregarItemCarrito(carrito.ID, idProducto, cantidad)
+		idVariante, err := h.resolverVariante(idProducto, r.FormValue("id_variante"))
+		if err != nil {
+			// El detalle del producto muestra el selector de variantes.
+			log.Println("Variante inválida al agregar al carrito:", err)
+			http.Redirect(w, r, "/producto/"+strconv.Itoa(idProducto)+"?variante=requerida", http.StatusSeeOther)
+			return
+		}
+
+		// La cantidad se suma a la línea que ya hubiera, así que se valida
+		// el total contra el stock como al actualizar el carrito.
+		items, err := h.Carritos.GetItems(carrito.ID)
+		if err != nil {
+			log.Println("Error obteniendo items del carrito:", err)
+			http.Redirect(w, r, "/", http.StatusSeeOther)
+			return
+		}
+		linea := models.ItemCarrito{IDCarrito: carrito.ID, IDProducto: idProducto, IDVariante: idVariante}
+		for _, item := range items {
+			if item.IDProducto == idProducto && item.IDVariante == idVariante {
+				linea.Cantidad = item.Cantidad
+			}
+		}
+		detalles, _ := h.detallesCarrito([]models.ItemCarrito{linea})
+		if detalles[0].Producto.ID == 0 {
+			h.renderError(w, r, http.StatusNotFound, "Producto no encontrado", "El producto que buscas no existe.")
+			return
+		}
+		if msg := validarCantidad(detalles[0], linea.Cantidad+cantidad); msg != "" {
+			h.renderCarrito(w, r, carrito, http.StatusConflict, []string{msg})
+			return
+		}
+
+		err = h.Carritos.AddItem(carrito.ID, idProducto, idVariante, cantidad)
 		if err != nil {
 			log.Println("Error al registrar item en carrito:", err)
 			http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -52,3 +78,24 @@ func AgregarItemCarrito(w http.ResponseWriter, r *http.Request) {
 	}
 
 }
+
+// resolverVariante valida la variante elegida para un producto. Los productos
+// sin variantes devuelven 0; los que tienen exigen una variante activa propia.
+func (h *Handler) resolverVariante(idProducto int, valor string) (int, error) {
+	conVariantes, err := h.Variantes.ConVariantes([]int{idProducto})
+	if err != nil {
+		return 0, err
+	}
+	if !conVariantes[idProducto] {
+		return 0, nil
+	}
+	idVariante, _ := strconv.Atoi(valor)
+	if idVariante == 0 {
+		return 0, models.ErrVarianteRequerida
+	}
+	variante, err := h.Variantes.GetByID(idVariante)
+	if err != nil || variante.IDProducto != idProducto || !variante.Activo {
+		return 0, models.ErrVarianteInvalida
+	}
+	return idVariante, nil
+}
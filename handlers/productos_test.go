@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"Go-Sistemas-de-Gestion-empresarial/pagos"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestAgregarAlCarritoValidaStockYVenta(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	idBea := e.cliente("Bea", "bea@test", "cliente")
+	taza := e.producto("Taza", dinero.Pesos(5), 3)
+	mate := e.producto("Mate", dinero.Pesos(8), 5)
+	if err := e.repos.Productos.Update(models.Producto{ID: mate, Nombre: "Mate", SKU: "MATE", Precio: dinero.Pesos(8), Stock: 5, Activo: false}); err != nil {
+		t.Fatal(err)
+	}
+
+	n := e.login("bea@test")
+	agregar := func(id, cantidad int) (int, string) {
+		status, _, cuerpo := n.post("/producto/agregar-carrito", url.Values{"id_producto": {strconv.Itoa(id)}, "cantidad": {strconv.Itoa(cantidad)}})
+		return status, cuerpo
+	}
+	n.agregar(taza, 2)
+	// La cantidad se suma a la línea existente: 2 + 2 supera el stock.
+	if status, cuerpo := agregar(taza, 2); status != http.StatusConflict || !strings.Contains(cuerpo, "Taza: solo quedan 3 unidades") {
+		t.Errorf("agregar más que el stock: %d, se esperaba el carrito con el aviso", status)
+	}
+	if status, cuerpo := agregar(mate, 1); status != http.StatusConflict || !strings.Contains(cuerpo, "Mate ya no está a la venta") {
+		t.Errorf("agregar un producto inactivo: %d, se esperaba el carrito con el aviso", status)
+	}
+	if status, _ := agregar(9999, 1); status != http.StatusNotFound {
+		t.Errorf("agregar un producto inexistente: %d, se esperaba 404", status)
+	}
+	n.agregar(taza, 1)
+
+	carrito, _ := e.repos.Carritos.GetByClienteID(idBea)
+	items, _ := e.repos.Carritos.GetItems(carrito.ID)
+	if len(items) != 1 || items[0].IDProducto != taza || items[0].Cantidad != 3 {
+		t.Errorf("carrito %+v, se esperaban 3 tazas", items)
+	}
+}
+
+func TestAdminProductoRechazaNumerosMalEscritos(t *testing.T) {
+	e := nuevoEntorno(t, pagos.ModoAprobar)
+	e.cliente("Ana", "ana@test", "admin")
+	if err := e.repos.Impuestos.Create(models.ClaseImpuesto{Nombre: "IVA 21%", Tasa: 21}); err != nil {
+		t.Fatal(err)
+	}
+	clases, _ := e.repos.Impuestos.GetAll()
+	idClase := strconv.Itoa(clases[0].ID)
+	admin := e.login("ana@test")
+	form := func(campo, valor string) url.Values {
+		f := url.Values{"nombre": {"Taza"}, "sku": {"TAZA"}, "precio": {"5"}, "stock": {"3"}, "peso": {"0.4"}, "id_clase_impuesto": {idClase}}
+		f.Set(campo, valor)
+		return f
+	}
+
+	for _, c := range []struct{ campo, valor, error string }{
+		{"stock", "tres", "El stock debe ser un número entero"},
+		{"stock", "-1", "El stock no puede ser negativo"},
+		{"peso", "Inf", "El peso debe ser un número"},
+		{"peso", "1e3", "El peso debe ser un número"},
+		{"id_clase_impuesto", "x", "La clase de impuesto debe ser un número entero"},
+		{"id_clase_impuesto", "999", "La clase de impuesto elegida no existe"},
+	} {
+		status, _, cuerpo := admin.post("/admin/productos/nuevo", form(c.campo, c.valor))
+		if status != http.StatusBadRequest || !strings.Contains(cuerpo, c.error) {
+			t.Errorf("%s = %q: %d, se esperaba 400 con %q", c.campo, c.valor, status, c.error)
+		}
+	}
+	if productos, _ := e.repos.Productos.GetAll(); len(productos) != 0 {
+		t.Fatalf("se crearon %d productos con datos inválidos", len(productos))
+	}
+
+	if status, _, cuerpo := admin.post("/admin/productos/nuevo", form("peso", "0,4")); status != http.StatusSeeOther {
+		t.Fatalf("crear: %d\n%s", status, cuerpo)
+	}
+	productos, _ := e.repos.Productos.GetAll()
+	if len(productos) != 1 {
+		t.Fatalf("%d productos, se esperaba 1", len(productos))
+	}
+	p := productos[0]
+	if p.Stock != 3 || p.Peso != 0.4 || p.IDClaseImpuesto != clases[0].ID {
+		t.Errorf("producto con stock %d, peso %v y clase %d", p.Stock, p.Peso, p.IDClaseImpuesto)
+	}
+
+	// Al editar, un stock mal escrito no pisa el guardado.
+	ruta := "/admin/productos/editar/" + strconv.Itoa(p.ID)
+	if status, _, _ := admin.post(ruta, form("stock", "NaN")); status != http.StatusBadRequest {
+		t.Errorf("editar con stock NaN: %d, se esperaba 400", status)
+	}
+	if e.stock(p.ID) != 3 {
+		t.Errorf("stock %d tras una edición rechazada, se esperaba 3", e.stock(p.ID))
+	}
+}
@@ -0,0 +1,384 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// categoriasDetalles devuelve el árbol de categorías y, por cada línea del
+// carrito, los IDs de las categorías de su producto.
+func (h *Handler) categoriasDetalles(detalles []CartItemDetail) ([]models.Categoria, [][]int, error) {
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		return nil, nil, err
+	}
+	porLinea := make([][]int, len(detalles))
+	for i, d := range detalles {
+		delProducto, err := h.Categorias.GetByProductoID(d.IDProducto)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, c := range delProducto {
+			porLinea[i] = append(porLinea[i], c.ID)
+		}
+	}
+	return categorias, porLinea, nil
+}
+
+// promocionesCarrito evalúa las promociones vigentes sobre las líneas del
+// carrito y deja en cada una su ahorro. Es el mismo cálculo que hace el
+// checkout; si las promociones no se pueden leer, el carrito se muestra sin
+// ellas.
+func (h *Handler) promocionesCarrito(detalles []CartItemDetail) models.ResultadoPromociones {
+	promociones, err := h.Promociones.GetActivas()
+	if err != nil {
+		log.Println("Error obteniendo promociones:", err)
+		return models.ResultadoPromociones{}
+	}
+	if len(promociones) == 0 || len(detalles) == 0 {
+		return models.ResultadoPromociones{}
+	}
+
+	var categorias []models.Categoria
+	var porLinea [][]int
+	for _, p := range promociones {
+		if p.Tipo == models.PromocionLlevaPaga {
+			if categorias, porLinea, err = h.categoriasDetalles(detalles); err != nil {
+				log.Println("Error obteniendo categorías del carrito:", err)
+				return models.ResultadoPromociones{}
+			}
+			break
+		}
+	}
+	lineas := make([]models.LineaPromocion, len(detalles))
+	for i, d := range detalles {
+		lineas[i] = models.LineaPromocion{IDProducto: d.IDProducto, Precio: d.Precio, Cantidad: d.Cantidad}
+		if porLinea != nil {
+			lineas[i].Categorias = porLinea[i]
+		}
+	}
+
+	resultado := models.EvaluarPromociones(promociones, lineas, categorias, time.Now())
+	for i := range detalles {
+		detalles[i].Descuento = resultado.PorLinea[i]
+	}
+	return resultado
+}
+
+// filaPromocion es una promoción del listado con su regla en palabras.
+type filaPromocion struct {
+	models.Promocion
+	Regla   string
+	Vigente bool
+}
+
+// reglaPromocion describe la promoción para el listado del panel.
+func reglaPromocion(p models.Promocion, categorias map[int]string, productos map[int]models.Producto) string {
+	nombres := func() string {
+		var n []string
+		for _, id := range p.Productos {
+			if producto, ok := productos[id]; ok {
+				n = append(n, producto.Nombre)
+			}
+		}
+		return strings.Join(n, ", ")
+	}
+	switch p.Tipo {
+	case models.PromocionLlevaPaga:
+		return fmt.Sprintf("Lleva %d, paga %d en %s", p.Lleva, p.Paga, categorias[p.IDCategoria])
+	case models.PromocionPaquete:
+		return fmt.Sprintf("%s por %s", nombres(), p.PrecioPaquete.Formato())
+	case models.PromocionVolumen:
+		tramos := make([]string, len(p.Tramos))
+		for i, t := range p.Tramos {
+			tramos[i] = fmt.Sprintf("%d+ u.: %g%%", t.CantidadMinima, t.Porcentaje)
+		}
+		return nombres() + " (" + strings.Join(tramos, "; ") + ")"
+	case models.PromocionTotal:
+		return fmt.Sprintf("%g%% desde %s", p.Porcentaje, p.MinimoCompra.Formato())
+	}
+	return p.Tipo
+}
+
+func (h *Handler) AdminPromotions(w http.ResponseWriter, r *http.Request) {
+	// AdminPromotions lista las promociones automáticas con su regla.
+	_, perfil, _ := h.GetSessionData(r)
+
+	promociones, err := h.Promociones.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo promociones:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	productos, err := h.Productos.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo productos:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	nombresCategoria := map[int]string{}
+	for _, c := range categorias {
+		nombresCategoria[c.ID] = c.Nombre
+	}
+	porID := map[int]models.Producto{}
+	for _, p := range productos {
+		porID[p.ID] = p
+	}
+	ahora := time.Now()
+	filas := make([]filaPromocion, len(promociones))
+	for i, p := range promociones {
+		filas[i] = filaPromocion{Promocion: p, Regla: reglaPromocion(p, nombresCategoria, porID), Vigente: p.Vigente(ahora)}
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/promociones.html")
+	if err != nil {
+		log.Println("Error cargando templates admin promotions:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		Promociones        []filaPromocion
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:            perfil,
+		Promociones:       filas,
+		PromocionesActive: true,
+	}
+
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin promotions:", err)
+	}
+}
+
+// parseTramos interpreta el texto de tramos del formulario: una línea por
+// tramo con el formato `cantidad: porcentaje` (p. ej. `10: 5`).
+func parseTramos(texto string) ([]models.TramoVolumen, error) {
+	var tramos []models.TramoVolumen
+	for n, linea := range strings.Split(texto, "\n") {
+		linea = strings.TrimSpace(linea)
+		if linea == "" {
+			continue
+		}
+		cantidad, porcentaje, ok := strings.Cut(linea, ":")
+		if !ok {
+			return nil, fmt.Errorf("tramo %d: usa el formato \"cantidad: porcentaje\"", n+1)
+		}
+		var t models.TramoVolumen
+		var err error
+		if t.CantidadMinima, err = strconv.Atoi(strings.TrimSpace(cantidad)); err != nil {
+			return nil, fmt.Errorf("tramo %d: la cantidad debe ser un número entero", n+1)
+		}
+		if t.Porcentaje, err = numeroDecimal(strings.TrimSuffix(strings.TrimSpace(porcentaje), "%")); err != nil {
+			return nil, fmt.Errorf("tramo %d: el porcentaje debe ser un número", n+1)
+		}
+		tramos = append(tramos, t)
+	}
+	return tramos, nil
+}
+
+// textoTramos es la inversa de parseTramos, para rellenar el formulario.
+func textoTramos(tramos []models.TramoVolumen) string {
+	lineas := make([]string, len(tramos))
+	for i, t := range tramos {
+		lineas[i] = fmt.Sprintf("%d: %g", t.CantidadMinima, t.Porcentaje)
+	}
+	return strings.Join(lineas, "\n")
+}
+
+// promocionDesdeFormulario lee los campos del formulario de promoción.
+// Devuelve también los errores de formato y de validación.
+func promocionDesdeFormulario(r *http.Request) (models.Promocion, string, []string) {
+	r.ParseForm()
+	idCategoria, _ := strconv.Atoi(r.FormValue("id_categoria"))
+	promocion := models.Promocion{
+		Nombre:      strings.TrimSpace(r.FormValue("nombre")),
+		Tipo:        r.FormValue("tipo"),
+		IDCategoria: idCategoria,
+		Activo:      r.FormValue("activo") == "on",
+		Productos:   parseIDs(r.Form["productos"]),
+	}
+
+	f := &lectorFormulario{r: r}
+	switch promocion.Tipo {
+	case models.PromocionLlevaPaga:
+		promocion.Lleva = f.entero("lleva", "\"Lleva\"")
+		promocion.Paga = f.entero("paga", "\"Paga\"")
+	case models.PromocionPaquete:
+		promocion.PrecioPaquete = f.importe("precio_paquete", "El precio del paquete", true)
+	case models.PromocionTotal:
+		promocion.Porcentaje = f.decimal("porcentaje", "El porcentaje", true)
+		promocion.MinimoCompra = f.importe("minimo_compra", "El importe mínimo", false)
+	}
+	promocion.ValidoDesde = f.fecha("valido_desde", "La fecha de inicio")
+	promocion.ValidoHasta = f.fecha("valido_hasta", "La fecha de fin")
+
+	tramos := r.FormValue("tramos")
+	if promocion.Tipo == models.PromocionVolumen {
+		parseados, err := parseTramos(tramos)
+		if err != nil {
+			f.errores = append(f.errores, err.Error())
+		}
+		promocion.Tramos = parseados
+	}
+
+	if len(f.errores) == 0 {
+		if err := models.ValidarPromocion(promocion); err != nil {
+			f.errores = append(f.errores, err.Error())
+		}
+	}
+	return promocion, tramos, f.errores
+}
+
+func (h *Handler) AdminPromotionCreate(w http.ResponseWriter, r *http.Request) {
+	// AdminPromotionCreate muestra el formulario y crea promociones nuevas.
+	if r.Method == "POST" {
+		promocion, tramos, errores := promocionDesdeFormulario(r)
+		if len(errores) == 0 {
+			if err := h.Promociones.Create(promocion); err != nil {
+				log.Println("Error creando promoción:", err)
+				errores = append(errores, "No se pudo crear la promoción: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioPromocion(w, r, false, promocion, tramos, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/promociones", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioPromocion(w, r, false, models.Promocion{Tipo: models.PromocionLlevaPaga, Lleva: 2, Paga: 1, Activo: true}, "", nil)
+}
+
+func (h *Handler) AdminPromotionEdit(w http.ResponseWriter, r *http.Request) {
+	// AdminPromotionEdit edita una promoción. Los pedidos ya hechos conservan
+	// el ahorro calculado al comprar.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	existente, err := h.Promociones.GetByID(id)
+	if err != nil {
+		http.Error(w, "Promoción no encontrada", http.StatusNotFound)
+		return
+	}
+
+	if r.Method == "POST" {
+		promocion, tramos, errores := promocionDesdeFormulario(r)
+		promocion.ID = id
+		if len(errores) == 0 {
+			if err := h.Promociones.Update(promocion); err != nil {
+				log.Println("Error actualizando promoción:", err)
+				errores = append(errores, "No se pudo actualizar la promoción: "+err.Error())
+			}
+		}
+		if len(errores) > 0 {
+			h.renderFormularioPromocion(w, r, true, promocion, tramos, errores)
+			return
+		}
+		http.Redirect(w, r, "/admin/promociones", http.StatusSeeOther)
+		return
+	}
+
+	h.renderFormularioPromocion(w, r, true, existente, textoTramos(existente.Tramos), nil)
+}
+
+// renderFormularioPromocion dibuja el formulario de alta o edición. `tramos`
+// es el texto del campo de tramos, que se conserva tal cual si tuvo errores.
+func (h *Handler) renderFormularioPromocion(w http.ResponseWriter, r *http.Request, isEdit bool, promocion models.Promocion, tramos string, errores []string) {
+	_, perfil, _ := h.GetSessionData(r)
+
+	productos, err := h.Productos.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo productos:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+	categorias, err := h.Categorias.GetAll()
+	if err != nil {
+		log.Println("Error obteniendo categorías:", err)
+		http.Error(w, "Error interno", http.StatusInternalServerError)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "templates/admin/layout.html", "templates/admin/formulario_promocion.html")
+	if err != nil {
+		log.Println("Error cargando template admin promotion form:", err)
+		http.Error(w, "Error cargando templates", http.StatusInternalServerError)
+		return
+	}
+
+	data := struct {
+		Perfil             string
+		IsEdit             bool
+		Promocion          models.Promocion
+		Tramos             string
+		ValidoDesde        string
+		ValidoHasta        string
+		Productos          []opcionProducto
+		Categorias         []opcionCategoria
+		Errores            []string
+		DashboardActive    bool
+		ProductosActive    bool
+		CategoriasActive   bool
+		PedidosActive      bool
+		ClientesActive     bool
+		CuponesActive      bool
+		PromocionesActive  bool
+		DevolucionesActive bool
+		EnviosActive       bool
+		ImpuestosActive    bool
+	}{
+		Perfil:            perfil,
+		IsEdit:            isEdit,
+		Promocion:         promocion,
+		Tramos:            tramos,
+		ValidoDesde:       fechaFormulario(promocion.ValidoDesde),
+		ValidoHasta:       fechaFormulario(promocion.ValidoHasta),
+		Productos:         opcionesProducto(productos, promocion.Productos),
+		Categorias:        opcionesCategoria(categorias, []int{promocion.IDCategoria}),
+		Errores:           errores,
+		PromocionesActive: true,
+	}
+
+	if len(errores) > 0 {
+		w.WriteHeader(http.StatusBadRequest)
+	}
+	if err := tmpl.ExecuteTemplate(w, "layout", data); err != nil {
+		log.Println("Error ejecutando template admin promotion form:", err)
+	}
+}
+
+func (h *Handler) AdminPromotionDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminPromotionDelete elimina una promoción. Los pedidos conservan su
+	// nombre y el ahorro aplicado.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := h.Promociones.Delete(id); err != nil {
+		log.Println("Error eliminando promoción:", err)
+		http.Error(w, "Error eliminando promoción", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/admin/promociones", http.StatusSeeOther)
+}
@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// Rutas registra en `r` los webhooks y todas las rutas de la aplicación. Los
+// archivos estáticos y las imágenes subidas los registra main, que conoce
+// dónde se sirven.
+func (h *Handler) Rutas(r *mux.Router) {
+	// Los webhooks de pago quedan fuera de la protección CSRF: los envía la
+	// pasarela, sin sesión, y se autentican con la firma HMAC.
+	r.Handle("/webhooks/pagos/{provider}", LimitarCuerpo(http.HandlerFunc(h.PaymentWebhook))).Methods("POST")
+
+	// Rutas de la aplicación: todas pasan por la protección CSRF. Los archivos
+	// estáticos quedan fuera para no crear sesiones innecesarias.
+	app := r.NewRoute().Subrouter()
+	app.Use(LimitarCuerpo, h.CSRF)
+
+	app.HandleFunc("/", h.HomeHandler).Methods("GET")
+	app.HandleFunc("/login", h.LoginHandler).Methods("GET", "POST")
+	app.HandleFunc("/register", h.RegisterHandler).Methods("GET", "POST")
+	app.HandleFunc("/logout", h.LogoutHandler).Methods("POST")
+	app.HandleFunc("/producto/{id:[0-9]+}", h.ClientProductDetail).Methods("GET")
+	app.HandleFunc("/categoria/{id:[0-9]+}", h.CategoryProducts).Methods("GET")
+	app.HandleFunc("/buscar", h.SearchProducts).Methods("GET")
+
+	app.HandleFunc("/carrito", h.ClientCart).Methods("GET")
+	app.HandleFunc("/producto/agregar-carrito", h.AgregarItemCarrito).Methods("POST")
+	app.HandleFunc("/carrito/eliminar/{id:[0-9]+}", h.RemoveItemFromCart).Methods("POST")
+	app.HandleFunc("/carrito/actualizar", h.UpdateCartItem).Methods("POST")
+	app.HandleFunc("/checkout", h.ClientCheckout).Methods("GET")
+	app.HandleFunc("/checkout", h.ProcessCheckout).Methods("POST")
+
+	app.HandleFunc("/perfil", h.ClientProfile).Methods("GET")
+	app.HandleFunc("/perfil/editar", h.ClientProfileEdit).Methods("GET", "POST")
+	app.HandleFunc("/pedidos/{id:[0-9]+}", h.ClientOrderDetail).Methods("GET")
+	app.HandleFunc("/pedidos/{id:[0-9]+}/cancelar", h.ClientOrderCancel).Methods("POST")
+	app.HandleFunc("/pedidos/{id:[0-9]+}/devolucion", h.ClientReturnRequest).Methods("GET", "POST")
+	app.HandleFunc("/devoluciones", h.ClientReturns).Methods("GET")
+	app.HandleFunc("/devoluciones/{id:[0-9]+}", h.ClientReturnDetail).Methods("GET")
+
+	// Todas las rutas /admin pasan por RequireAdmin.
+	admin := app.PathPrefix("/admin").Subrouter()
+	admin.Use(h.RequireAdmin)
+	admin.Handle("", http.RedirectHandler("/admin/dashboard", http.StatusSeeOther)).Methods("GET")
+	admin.HandleFunc("/dashboard", h.AdminDashboard).Methods("GET")
+	admin.HandleFunc("/productos", h.AdminProducts).Methods("GET")
+	admin.HandleFunc("/productos/nuevo", h.AdminProductCreate).Methods("GET", "POST")
+	admin.HandleFunc("/productos/editar/{id}", h.AdminProductEdit).Methods("GET", "POST")
+	admin.HandleFunc("/productos/eliminar/{id}", h.AdminProductDelete).Methods("POST", "DELETE")
+	admin.HandleFunc("/productos/{id:[0-9]+}/imagenes/{idImagen:[0-9]+}/eliminar", h.AdminProductImageDelete).Methods("POST")
+	admin.HandleFunc("/productos/{id:[0-9]+}/imagenes/{idImagen:[0-9]+}/principal", h.AdminProductImagePrimary).Methods("POST")
+	admin.HandleFunc("/productos/{id:[0-9]+}/imagenes/{idImagen:[0-9]+}/mover", h.AdminProductImageMove).Methods("POST")
+	admin.HandleFunc("/productos/{id:[0-9]+}/opciones", h.AdminProductOptions).Methods("POST")
+	admin.HandleFunc("/productos/{id:[0-9]+}/variantes/generar", h.AdminProductVariantsGenerate).Methods("POST")
+	admin.HandleFunc("/productos/{id:[0-9]+}/variantes/{idVariante:[0-9]+}", h.AdminProductVariantUpdate).Methods("POST")
+	admin.HandleFunc("/productos/{id:[0-9]+}/variantes/{idVariante:[0-9]+}/eliminar", h.AdminProductVariantDelete).Methods("POST")
+	admin.HandleFunc("/categorias", h.AdminCategories).Methods("GET")
+	admin.HandleFunc("/categorias/nueva", h.AdminCategoryCreate).Methods("GET", "POST")
+	admin.HandleFunc("/categorias/editar/{id:[0-9]+}", h.AdminCategoryEdit).Methods("GET", "POST")
+	admin.HandleFunc("/categorias/eliminar/{id:[0-9]+}", h.AdminCategoryDelete).Methods("POST")
+	admin.HandleFunc("/pedidos", h.AdminOrders).Methods("GET")
+	admin.HandleFunc("/pedidos/{id}", h.AdminOrderDetail).Methods("GET")
+	admin.HandleFunc("/pedidos/{id}/status", h.AdminOrderStatus).Methods("POST")
+	admin.HandleFunc("/pedidos/{id:[0-9]+}/reembolsos", h.AdminOrderRefundRetry).Methods("POST")
+	admin.HandleFunc("/pedidos/{id:[0-9]+}/envios", h.AdminShipmentCreate).Methods("POST")
+	admin.HandleFunc("/pedidos/{id:[0-9]+}/envios/{idEnvio:[0-9]+}", h.AdminShipmentUpdate).Methods("POST")
+	admin.HandleFunc("/clientes", h.AdminClients).Methods("GET")
+	admin.HandleFunc("/cupones", h.AdminCoupons).Methods("GET")
+	admin.HandleFunc("/cupones/nuevo", h.AdminCouponCreate).Methods("GET", "POST")
+	admin.HandleFunc("/cupones/editar/{id:[0-9]+}", h.AdminCouponEdit).Methods("GET", "POST")
+	admin.HandleFunc("/cupones/eliminar/{id:[0-9]+}", h.AdminCouponDelete).Methods("POST")
+	admin.HandleFunc("/promociones", h.AdminPromotions).Methods("GET")
+	admin.HandleFunc("/promociones/nueva", h.AdminPromotionCreate).Methods("GET", "POST")
+	admin.HandleFunc("/promociones/editar/{id:[0-9]+}", h.AdminPromotionEdit).Methods("GET", "POST")
+	admin.HandleFunc("/promociones/eliminar/{id:[0-9]+}", h.AdminPromotionDelete).Methods("POST")
+	admin.HandleFunc("/devoluciones", h.AdminReturns).Methods("GET")
+	admin.HandleFunc("/devoluciones/{id:[0-9]+}", h.AdminReturnDetail).Methods("GET")
+	admin.HandleFunc("/devoluciones/{id:[0-9]+}/estado", h.AdminReturnStatus).Methods("POST")
+	admin.HandleFunc("/envios", h.AdminShipping).Methods("GET")
+	admin.HandleFunc("/envios/metodos/nuevo", h.AdminShippingMethodCreate).Methods("GET", "POST")
+	admin.HandleFunc("/envios/metodos/editar/{id:[0-9]+}", h.AdminShippingMethodEdit).Methods("GET", "POST")
+	admin.HandleFunc("/envios/metodos/eliminar/{id:[0-9]+}", h.AdminShippingMethodDelete).Methods("POST")
+	admin.HandleFunc("/envios/zonas/nueva", h.AdminShippingZoneCreate).Methods("GET", "POST")
+	admin.HandleFunc("/envios/zonas/editar/{id:[0-9]+}", h.AdminShippingZoneEdit).Methods("GET", "POST")
+	admin.HandleFunc("/envios/zonas/eliminar/{id:[0-9]+}", h.AdminShippingZoneDelete).Methods("POST")
+	admin.HandleFunc("/impuestos", h.AdminTaxes).Methods("GET")
+	admin.HandleFunc("/impuestos/nueva", h.AdminTaxClassCreate).Methods("GET", "POST")
+	admin.HandleFunc("/impuestos/editar/{id:[0-9]+}", h.AdminTaxClassEdit).Methods("GET", "POST")
+	admin.HandleFunc("/impuestos/eliminar/{id:[0-9]+}", h.AdminTaxClassDelete).Methods("POST")
+}
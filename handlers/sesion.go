@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
+)
+
+const (
+	// sessionName es el nombre de la cookie que guarda el ID de sesión firmado.
+	sessionName = "sesion"
+	// sessionDuration es la vida de una sesión desde su último guardado.
+	sessionDuration = 24 * time.Hour
+	// claveCliente es la clave de session.Values con el ID del cliente autenticado.
+	claveCliente = "id_cliente"
+)
+
+// sessionStore implementa sessions.Store guardando los datos en un
+// SesionRepository (la tabla `sesiones` en producción). La cookie solo
+// contiene un ID aleatorio firmado con HMAC, por lo que el cliente no puede
+// alterar su perfil ni su ID de usuario.
+type sessionStore struct {
+	repo    models.SesionRepository
+	codecs  []securecookie.Codec
+	options *sessions.Options
+}
+
+// newSessionStore configura el almacén de sesiones. `hashKey` firma las
+// cookies; `secure` activa el flag Secure.
+func newSessionStore(repo models.SesionRepository, hashKey []byte, secure bool) *sessionStore {
+	s := &sessionStore{
+		repo:   repo,
+		codecs: securecookie.CodecsFromPairs(hashKey),
+		options: &sessions.Options{
+			Path:     "/",
+			MaxAge:   int(sessionDuration / time.Second),
+			HttpOnly: true,
+			Secure:   secure,
+			SameSite: http.SameSiteLaxMode,
+		},
+	}
+	for _, c := range s.codecs {
+		if sc, ok := c.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(s.options.MaxAge)
+		}
+	}
+	return s
+}
+
+// Get devuelve la sesión de la petición, cacheada durante la misma petición.
+func (s *sessionStore) Get(r *http.Request, name string) (*sessions.Session, error) {
+	return sessions.GetRegistry(r).Get(s, name)
+}
+
+// New carga la sesión indicada por la cookie o crea una nueva vacía si la
+// cookie falta, no es válida o la sesión expiró en el servidor.
+func (s *sessionStore) New(r *http.Request, name string) (*sessions.Session, error) {
+	session := sessions.NewSession(s, name)
+	opts := *s.options
+	session.Options = &opts
+	session.IsNew = true
+
+	c, err := r.Cookie(name)
+	if err != nil {
+		return session, nil
+	}
+
+	var id string
+	if err := securecookie.DecodeMulti(name, c.Value, &id, s.codecs...); err != nil {
+		log.Println("Cookie de sesión inválida:", err)
+		return session, nil
+	}
+
+	sesion, err := s.repo.GetByID(id)
+	if err != nil {
+		return session, nil
+	}
+	if len(sesion.Datos) > 0 {
+		if err := (securecookie.GobEncoder{}).Deserialize(sesion.Datos, &session.Values); err != nil {
+			log.Println("Error decodificando datos de sesión:", err)
+			return session, nil
+		}
+	}
+	session.ID = sesion.ID
+	session.IsNew = false
+	return session, nil
+}
+
+// Save persiste la sesión y escribe la cookie. Con MaxAge < 0 la sesión se
+// elimina del servidor y la cookie se expira.
+func (s *sessionStore) Save(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if session.Options.MaxAge < 0 {
+		if session.ID != "" {
+			if err := s.repo.Delete(session.ID); err != nil {
+				return err
+			}
+		}
+		http.SetCookie(w, sessions.NewCookie(session.Name(), "", session.Options))
+		return nil
+	}
+
+	if session.ID == "" {
+		id, err := models.NewSesionID()
+		if err != nil {
+			return err
+		}
+		session.ID = id
+	}
+
+	datos, err := (securecookie.GobEncoder{}).Serialize(session.Values)
+	if err != nil {
+		return err
+	}
+	idCliente, _ := session.Values[claveCliente].(int)
+	sesion := models.Sesion{ID: session.ID, IDCliente: idCliente, Datos: datos}
+	if err := s.repo.Save(sesion, time.Duration(session.Options.MaxAge)*time.Second); err != nil {
+		return err
+	}
+
+	encoded, err := securecookie.EncodeMulti(session.Name(), session.ID, s.codecs...)
+	if err != nil {
+		return err
+	}
+	http.SetCookie(w, sessions.NewCookie(session.Name(), encoded, session.Options))
+	return nil
+}
+
+// getSession devuelve la sesión de la petición actual.
+func (h *Handler) getSession(r *http.Request) *sessions.Session {
+	session, err := h.store.Get(r, sessionName)
+	if err != nil {
+		log.Println("Error obteniendo sesión:", err)
+	}
+	return session
+}
+
+// iniciarSesion asocia el cliente a una sesión nueva. La sesión anterior se
+// destruye para que un ID fijado antes del login no sirva después (rotación).
+func (h *Handler) iniciarSesion(w http.ResponseWriter, r *http.Request, cliente models.Cliente) error {
+	session := h.getSession(r)
+	if session.ID != "" {
+		if err := h.Sesiones.Delete(session.ID); err != nil {
+			log.Println("Error eliminando sesión anterior:", err)
+		}
+	}
+	session.ID = ""
+	session.IsNew = true
+	session.Values = map[interface{}]interface{}{claveCliente: cliente.ID}
+	return session.Save(r, w)
+}
+
+// cerrarSesion invalida la sesión en el servidor y expira la cookie.
+func (h *Handler) cerrarSesion(w http.ResponseWriter, r *http.Request) error {
+	session := h.getSession(r)
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
+
+// GetSessionCliente resuelve el cliente autenticado a partir de la sesión.
+// El perfil siempre se lee de la base de datos, nunca de la cookie.
+func (h *Handler) GetSessionCliente(r *http.Request) (models.Cliente, bool) {
+	session := h.getSession(r)
+	id, ok := session.Values[claveCliente].(int)
+	if !ok || id == 0 {
+		return models.Cliente{}, false
+	}
+	cliente, err := h.Clientes.GetByID(id)
+	if err != nil {
+		log.Println("Sesión con cliente inexistente:", err)
+		return models.Cliente{}, false
+	}
+	return cliente, true
+}
+
+// GetSessionData devuelve (loggedIn, perfil, id) del cliente autenticado,
+// resolviendo la sesión en el servidor.
+func (h *Handler) GetSessionData(r *http.Request) (bool, string, string) {
+	cliente, ok := h.GetSessionCliente(r)
+	if !ok {
+		return false, "", ""
+	}
+	return true, cliente.Perfil, strconv.Itoa(cliente.ID)
+}
@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"Go-Sistemas-de-Gestion-empresarial/models"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// parseOpciones interpreta el texto de opciones del formulario de producto:
+// una línea por eje con el formato `Nombre: valor1, valor2`.
+func parseOpciones(texto string) ([]models.OpcionProducto, error) {
+	var opciones []models.OpcionProducto
+	for n, linea := range strings.Split(texto, "\n") {
+		linea = strings.TrimSpace(linea)
+		if linea == "" {
+			continue
+		}
+		nombre, valores, ok := strings.Cut(linea, ":")
+		if !ok {
+			return nil, fmt.Errorf("línea %d: usa el formato \"Nombre: valor1, valor2\"", n+1)
+		}
+		opcion := models.OpcionProducto{Nombre: strings.TrimSpace(nombre)}
+		for _, valor := range strings.Split(valores, ",") {
+			if valor = strings.TrimSpace(valor); valor != "" {
+				opcion.Valores = append(opcion.Valores, models.ValorOpcion{Valor: valor})
+			}
+		}
+		opciones = append(opciones, opcion)
+	}
+	return opciones, models.ValidarOpciones(opciones)
+}
+
+// textoOpciones es la inversa de parseOpciones, para rellenar el formulario.
+func textoOpciones(opciones []models.OpcionProducto) string {
+	lineas := make([]string, len(opciones))
+	for i, o := range opciones {
+		valores := make([]string, len(o.Valores))
+		for j, v := range o.Valores {
+			valores[j] = v.Valor
+		}
+		lineas[i] = o.Nombre + ": " + strings.Join(valores, ", ")
+	}
+	return strings.Join(lineas, "\n")
+}
+
+// productosConVariantes indica cuáles de los productos se venden por
+// variantes, para que la grilla lleve al detalle en lugar de agregar directo.
+func (h *Handler) productosConVariantes(productos []models.Producto) map[int]bool {
+	ids := make([]int, 0, len(productos))
+	for _, p := range productos {
+		ids = append(ids, p.ID)
+	}
+	conVariantes, err := h.Variantes.ConVariantes(ids)
+	if err != nil {
+		log.Println("Error obteniendo productos con variantes:", err)
+		return map[int]bool{}
+	}
+	return conVariantes
+}
+
+// productoDeRuta lee `{id}` de la ruta y carga el producto. Responde 404 si no existe.
+func (h *Handler) productoDeRuta(w http.ResponseWriter, r *http.Request) (models.Producto, bool) {
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+	producto, err := h.Productos.GetByID(id)
+	if err != nil {
+		http.Error(w, "Producto no encontrado", http.StatusNotFound)
+		return models.Producto{}, false
+	}
+	return producto, true
+}
+
+// varianteDeRuta lee `{id}` e `{idVariante}` de la ruta y comprueba que la
+// variante pertenezca al producto. Responde 404 si no es así.
+func (h *Handler) varianteDeRuta(w http.ResponseWriter, r *http.Request) (models.VarianteProducto, bool) {
+	vars := mux.Vars(r)
+	idProducto, _ := strconv.Atoi(vars["id"])
+	idVariante, _ := strconv.Atoi(vars["idVariante"])
+
+	variante, err := h.Variantes.GetByID(idVariante)
+	if err != nil || variante.IDProducto != idProducto {
+		http.Error(w, "Variante no encontrada", http.StatusNotFound)
+		return models.VarianteProducto{}, false
+	}
+	return variante, true
+}
+
+func (h *Handler) AdminProductOptions(w http.ResponseWriter, r *http.Request) {
+	// AdminProductOptions guarda los ejes de variantes del producto (Talle,
+	// Color...). Las variantes que quedan sin un valor por eje se eliminan.
+	producto, ok := h.productoDeRuta(w, r)
+	if !ok {
+		return
+	}
+	opciones, err := parseOpciones(r.FormValue("opciones"))
+	if err == nil {
+		err = h.Variantes.SetOpciones(producto.ID, opciones)
+	}
+	if err != nil {
+		log.Println("Error guardando opciones del producto:", err)
+		h.renderFormularioProducto(w, r, true, producto, []string{"Opciones: " + err.Error()})
+		return
+	}
+	redirigirEdicionProducto(w, r, producto.ID)
+}
+
+func (h *Handler) AdminProductVariantsGenerate(w http.ResponseWriter, r *http.Request) {
+	// AdminProductVariantsGenerate crea, sin stock, las combinaciones de
+	// opciones que todavía no tienen variante.
+	producto, ok := h.productoDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if _, err := h.Variantes.Generar(producto.ID); err != nil {
+		log.Println("Error generando variantes:", err)
+		h.renderFormularioProducto(w, r, true, producto, []string{"Variantes: " + err.Error()})
+		return
+	}
+	redirigirEdicionProducto(w, r, producto.ID)
+}
+
+func (h *Handler) AdminProductVariantUpdate(w http.ResponseWriter, r *http.Request) {
+	// AdminProductVariantUpdate guarda SKU, precio, stock y estado de una
+	// variante. Un precio vacío usa el precio del producto.
+	variante, ok := h.varianteDeRuta(w, r)
+	if !ok {
+		return
+	}
+	variante.SKU = strings.TrimSpace(r.FormValue("sku"))
+	variante.Activo = r.FormValue("activo") == "on"
+
+	var errores []string
+	stock, err := strconv.Atoi(strings.TrimSpace(r.FormValue("stock")))
+	if err != nil || stock < 0 {
+		errores = append(errores, "El stock debe ser un número entero no negativo")
+	}
+	variante.Stock = stock
+	variante.PrecioPropio = false
+	if precio := strings.TrimSpace(r.FormValue("precio")); precio != "" {
+		valor, err := dinero.Parse(precio)
+		if err != nil || valor < 0 {
+			errores = append(errores, "El precio debe ser un importe no negativo con hasta dos decimales o quedar vacío")
+		}
+		variante.Precio, variante.PrecioPropio = valor, true
+	}
+	if len(errores) == 0 {
+		if err := h.Variantes.Update(variante); err != nil {
+			log.Println("Error actualizando variante:", err)
+			errores = append(errores, "No se pudo actualizar la variante: "+err.Error())
+		}
+	}
+	if len(errores) > 0 {
+		producto, err := h.Productos.GetByID(variante.IDProducto)
+		if err != nil {
+			http.Error(w, "Producto no encontrado", http.StatusNotFound)
+			return
+		}
+		for i := range errores {
+			errores[i] = variante.Descripcion() + ": " + errores[i]
+		}
+		h.renderFormularioProducto(w, r, true, producto, errores)
+		return
+	}
+	redirigirEdicionProducto(w, r, variante.IDProducto)
+}
+
+func (h *Handler) AdminProductVariantDelete(w http.ResponseWriter, r *http.Request) {
+	// AdminProductVariantDelete elimina una variante. Los pedidos que la
+	// incluían conservan su descripción.
+	variante, ok := h.varianteDeRuta(w, r)
+	if !ok {
+		return
+	}
+	if err := h.Variantes.Delete(variante.ID); err != nil {
+		log.Println("Error eliminando variante:", err)
+		http.Error(w, "Error eliminando variante", http.StatusInternalServerError)
+		return
+	}
+	redirigirEdicionProducto(w, r, variante.IDProducto)
+}
@@ -0,0 +1,156 @@
+// Package imagenes valida las imágenes que suben los administradores y genera
+// las variantes redimensionadas que muestra la tienda.
+package imagenes
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+// MaxBytes es el tamaño máximo aceptado por archivo.
+const MaxBytes = 5 << 20
+
+// maxPixeles evita decodificar imágenes enormes (bombas de descompresión):
+// un PNG pequeño puede declarar dimensiones que ocupan gigabytes en memoria.
+const maxPixeles = 40_000_000
+
+// calidadJPEG es la calidad con que se codifican las variantes JPEG.
+const calidadJPEG = 85
+
+var (
+	// ErrFormatoNoSoportado se devuelve si el contenido no es JPEG, PNG, GIF ni WebP.
+	ErrFormatoNoSoportado = errors.New("formato de imagen no soportado (usa JPEG, PNG, GIF o WebP)")
+	// ErrDemasiadoGrande se devuelve si el archivo supera MaxBytes.
+	ErrDemasiadoGrande = fmt.Errorf("la imagen supera el máximo de %d MB", MaxBytes>>20)
+	// ErrDimensiones se devuelve si la imagen está vacía o tiene demasiados píxeles.
+	ErrDimensiones = errors.New("dimensiones de imagen inválidas")
+)
+
+// Variante es un tamaño de salida. La imagen se ajusta dentro de un cuadrado
+// de Lado píxeles sin agrandarse nunca.
+type Variante struct {
+	Nombre string
+	Lado   int
+}
+
+// Variantes son los tamaños que se generan para cada imagen subida.
+var Variantes = []Variante{
+	{Nombre: "miniatura", Lado: 200},
+	{Nombre: "mediana", Lado: 600},
+	{Nombre: "grande", Lado: 1200},
+}
+
+// Procesada contiene las variantes codificadas de una imagen.
+type Procesada struct {
+	// Extension sin punto (`jpg` o `png`), común a todas las variantes.
+	Extension     string
+	TipoContenido string
+	Variantes     map[string][]byte
+}
+
+// decodificadores por tipo MIME detectado con http.DetectContentType.
+var decodificadores = map[string]struct {
+	config func([]byte) (image.Config, error)
+	decode func([]byte) (image.Image, error)
+}{
+	"image/jpeg": {
+		config: func(b []byte) (image.Config, error) { return jpeg.DecodeConfig(bytes.NewReader(b)) },
+		decode: func(b []byte) (image.Image, error) { return jpeg.Decode(bytes.NewReader(b)) },
+	},
+	"image/png": {
+		config: func(b []byte) (image.Config, error) { return png.DecodeConfig(bytes.NewReader(b)) },
+		decode: func(b []byte) (image.Image, error) { return png.Decode(bytes.NewReader(b)) },
+	},
+	"image/gif": {
+		config: func(b []byte) (image.Config, error) { return gif.DecodeConfig(bytes.NewReader(b)) },
+		decode: func(b []byte) (image.Image, error) { return gif.Decode(bytes.NewReader(b)) },
+	},
+	"image/webp": {
+		config: func(b []byte) (image.Config, error) { return webp.DecodeConfig(bytes.NewReader(b)) },
+		decode: func(b []byte) (image.Image, error) { return webp.Decode(bytes.NewReader(b)) },
+	},
+}
+
+// Procesar valida el contenido real del archivo (no la extensión ni el
+// Content-Type que declara el navegador) y genera todas las Variantes. Los PNG
+// y GIF se guardan como PNG para conservar la transparencia; el resto como JPEG.
+func Procesar(datos []byte) (Procesada, error) {
+	if len(datos) > MaxBytes {
+		return Procesada{}, ErrDemasiadoGrande
+	}
+	tipo := http.DetectContentType(datos)
+	dec, ok := decodificadores[tipo]
+	if !ok {
+		return Procesada{}, ErrFormatoNoSoportado
+	}
+
+	cfg, err := dec.config(datos)
+	if err != nil {
+		return Procesada{}, ErrFormatoNoSoportado
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxPixeles {
+		return Procesada{}, ErrDimensiones
+	}
+	original, err := dec.decode(datos)
+	if err != nil {
+		return Procesada{}, fmt.Errorf("imagen dañada: %w", err)
+	}
+
+	salida := Procesada{Extension: "jpg", TipoContenido: "image/jpeg", Variantes: map[string][]byte{}}
+	if tipo == "image/png" || tipo == "image/gif" {
+		salida.Extension, salida.TipoContenido = "png", "image/png"
+	}
+
+	for _, v := range Variantes {
+		redimensionada := redimensionar(original, v.Lado)
+		var buf bytes.Buffer
+		if salida.Extension == "png" {
+			err = png.Encode(&buf, redimensionada)
+		} else {
+			err = jpeg.Encode(&buf, sobreBlanco(redimensionada), &jpeg.Options{Quality: calidadJPEG})
+		}
+		if err != nil {
+			return Procesada{}, err
+		}
+		salida.Variantes[v.Nombre] = buf.Bytes()
+	}
+	return salida, nil
+}
+
+// redimensionar ajusta la imagen dentro de un cuadrado de `lado` píxeles
+// conservando la proporción. Las imágenes más chicas se copian sin agrandar.
+func redimensionar(src image.Image, lado int) image.Image {
+	b := src.Bounds()
+	ancho, alto := b.Dx(), b.Dy()
+	if ancho > lado || alto > lado {
+		if ancho >= alto {
+			alto = max(1, alto*lado/ancho)
+			ancho = lado
+		} else {
+			ancho = max(1, ancho*lado/alto)
+			alto = lado
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, ancho, alto))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+// sobreBlanco aplana la transparencia sobre fondo blanco, ya que JPEG no
+// tiene canal alfa.
+func sobreBlanco(src image.Image) image.Image {
+	dst := image.NewRGBA(src.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), src, src.Bounds().Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/db/migraciones"
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+)
+
+// usoMigrate describe el subcomando `migrate`.
+const usoMigrate = `uso: ecommerce migrate <comando> [n]
+
+comandos:
+  up [n]     aplica las migraciones pendientes (todas, o las n siguientes)
+  down [n]   revierte las últimas n migraciones aplicadas (1 por defecto)
+  status     muestra qué migraciones están aplicadas`
+
+// runMigrate ejecuta el subcomando `migrate` sobre el pool ya conectado.
+func runMigrate(args []string, pool *sql.DB) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%s", usoMigrate)
+	}
+	n := 0
+	if len(args) > 1 {
+		var err error
+		n, err = strconv.Atoi(args[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf("cantidad de migraciones inválida: %q", args[1])
+		}
+	}
+
+	migrador, err := migraciones.New(pool)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		aplicadas, err := migrador.Up(n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migraciones aplicadas: %d\n", aplicadas)
+	case "down":
+		revertidas, err := migrador.Down(n)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Migraciones revertidas: %d\n", revertidas)
+	case "status":
+		estados, err := migrador.Status()
+		if err != nil {
+			return err
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSIÓN\tNOMBRE\tESTADO\tAPLICADA")
+		for _, e := range estados {
+			estado, fecha := "pendiente", "-"
+			if e.Aplicada {
+				estado = "aplicada"
+				fecha = e.FechaAplicacion.Format("2006-01-02 15:04:05")
+			}
+			if e.Modificada {
+				estado = "MODIFICADA"
+			}
+			fmt.Fprintf(tw, "%04d\t%s\t%s\t%s\n", e.Version, e.Nombre, estado, fecha)
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("comando desconocido %q\n%s", args[0], usoMigrate)
+	}
+	return nil
+}
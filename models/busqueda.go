@@ -0,0 +1,247 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"log"
+	"strings"
+	"unicode"
+)
+
+// Órdenes disponibles para BuscarProductos.
+const (
+	OrdenRelevancia  = "relevancia"
+	OrdenPrecioAsc   = "precio_asc"
+	OrdenPrecioDesc  = "precio_desc"
+	OrdenRecientes   = "recientes"
+	OrdenMasVendidos = "mas_vendidos"
+)
+
+// PorPaginaDefecto es el tamaño de página si la búsqueda no indica otro.
+const PorPaginaDefecto = 12
+
+// porPaginaMax limita el tamaño de página que puede pedir un cliente.
+const porPaginaMax = 60
+
+// largoMinimoPalabra replica innodb_ft_min_token_size: las palabras más cortas
+// no están en el índice FULLTEXT.
+const largoMinimoPalabra = 3
+
+// BusquedaProductos describe una consulta al catálogo. Los campos vacíos o en
+// cero no filtran. PrecioMin y PrecioMax, como el orden por precio, usan el
+// precio "desde" del producto (ver precioDesde).
+type BusquedaProductos struct {
+	Texto        string
+	PrecioMin    dinero.Monto
+	PrecioMax    dinero.Monto
+	Categorias   []int // se devuelven productos de cualquiera de ellas
+	SoloActivos  bool
+	SoloConStock bool
+	Orden        string
+	Pagina       int // desde 1
+	PorPagina    int
+}
+
+// ResultadoBusqueda es una página de productos y el total de coincidencias.
+type ResultadoBusqueda struct {
+	Productos []Producto
+	Total     int
+	Pagina    int
+	PorPagina int
+}
+
+// TotalPaginas devuelve la cantidad de páginas del resultado (al menos 1).
+func (r ResultadoBusqueda) TotalPaginas() int {
+	if r.PorPagina <= 0 || r.Total == 0 {
+		return 1
+	}
+	return (r.Total + r.PorPagina - 1) / r.PorPagina
+}
+
+// HayAnterior indica si existe una página previa.
+func (r ResultadoBusqueda) HayAnterior() bool { return r.Pagina > 1 }
+
+// HaySiguiente indica si existe una página posterior.
+func (r ResultadoBusqueda) HaySiguiente() bool { return r.Pagina < r.TotalPaginas() }
+
+// normalizar completa los valores por defecto y corrige los inválidos.
+func (b BusquedaProductos) normalizar() BusquedaProductos {
+	b.Texto = strings.TrimSpace(b.Texto)
+	if b.Pagina < 1 {
+		b.Pagina = 1
+	}
+	if b.PorPagina <= 0 {
+		b.PorPagina = PorPaginaDefecto
+	}
+	if b.PorPagina > porPaginaMax {
+		b.PorPagina = porPaginaMax
+	}
+	if b.PrecioMin < 0 {
+		b.PrecioMin = 0
+	}
+	if b.PrecioMax < 0 {
+		b.PrecioMax = 0
+	}
+	switch b.Orden {
+	case OrdenPrecioAsc, OrdenPrecioDesc, OrdenRecientes, OrdenMasVendidos:
+	case OrdenRelevancia:
+		if b.Texto == "" {
+			b.Orden = OrdenRecientes
+		}
+	default:
+		if b.Texto != "" {
+			b.Orden = OrdenRelevancia
+		} else {
+			b.Orden = OrdenRecientes
+		}
+	}
+	return b
+}
+
+// sqlPrecioDesde es precioDesde en SQL, para filtrar y ordenar por precio.
+const sqlPrecioDesde = "COALESCE((SELECT MIN(COALESCE(v.precio, p.precio)) FROM variantes_producto v WHERE v.id_producto = p.id_producto AND v.activo = 1), p.precio)"
+
+// precioDesde es el menor precio al que se vende el producto: el de su
+// variante activa más barata (las que no tienen precio propio cuentan al
+// precio del producto) o, si no tiene variantes activas, el del producto.
+func precioDesde(p Producto, variantes []VarianteProducto) dinero.Monto {
+	precio, hay := p.Precio, false
+	for _, v := range variantes {
+		if !v.Activo || v.IDProducto != p.ID {
+			continue
+		}
+		if pv := v.PrecioPara(p); !hay || pv < precio {
+			precio, hay = pv, true
+		}
+	}
+	return precio
+}
+
+// palabrasBusqueda separa el texto en palabras, descartando los operadores
+// del modo booleano de MySQL para que el cliente no pueda alterar la consulta.
+func palabrasBusqueda(texto string) []string {
+	return strings.FieldsFunc(strings.ToLower(texto), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// expresionFullText arma la expresión booleana `+palabra*` para MATCH ...
+// AGAINST. Devuelve "" si ninguna palabra llega al largo mínimo del índice.
+func expresionFullText(texto string) string {
+	var terminos []string
+	for _, p := range palabrasBusqueda(texto) {
+		if len([]rune(p)) >= largoMinimoPalabra {
+			terminos = append(terminos, "+"+p+"*")
+		}
+	}
+	return strings.Join(terminos, " ")
+}
+
+// BuscarProductos ejecuta la búsqueda en MySQL: texto completo sobre nombre,
+// descripción y SKU (índice FULLTEXT `ft_productos`), filtros, orden y
+// paginación por OFFSET, todo resuelto en SQL.
+func BuscarProductos(b BusquedaProductos) (ResultadoBusqueda, error) {
+	b = b.normalizar()
+	resultado := ResultadoBusqueda{Pagina: b.Pagina, PorPagina: b.PorPagina}
+
+	var condiciones []string
+	var args []interface{}
+	expresion := expresionFullText(b.Texto)
+	if expresion != "" {
+		condiciones = append(condiciones, "(MATCH(p.nombre, p.descripcion, p.sku) AGAINST (? IN BOOLEAN MODE) OR p.sku = ?)")
+		args = append(args, expresion, b.Texto)
+	} else if b.Texto != "" {
+		// Palabras demasiado cortas para el índice: se busca por prefijo.
+		patron := escaparLike(b.Texto) + "%"
+		condiciones = append(condiciones, "(p.nombre LIKE ? OR p.sku LIKE ?)")
+		args = append(args, patron, patron)
+	}
+	if b.PrecioMin > 0 {
+		condiciones = append(condiciones, sqlPrecioDesde+" >= ?")
+		args = append(args, b.PrecioMin)
+	}
+	if b.PrecioMax > 0 {
+		condiciones = append(condiciones, sqlPrecioDesde+" <= ?")
+		args = append(args, b.PrecioMax)
+	}
+	if len(b.Categorias) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(b.Categorias)), ",")
+		condiciones = append(condiciones, "p.id_producto IN (SELECT id_producto FROM producto_categorias WHERE id_categoria IN ("+placeholders+"))")
+		for _, id := range b.Categorias {
+			args = append(args, id)
+		}
+	}
+	if b.SoloActivos {
+		condiciones = append(condiciones, "p.activo = 1")
+	}
+	if b.SoloConStock {
+		condiciones = append(condiciones, "p.stock > 0")
+	}
+
+	where := ""
+	if len(condiciones) > 0 {
+		where = " WHERE " + strings.Join(condiciones, " AND ")
+	}
+
+	if err := pool.QueryRow("SELECT COUNT(*) FROM productos p"+where, args...).Scan(&resultado.Total); err != nil {
+		log.Println("Error al contar los productos", err)
+		return resultado, err
+	}
+	if resultado.Total == 0 {
+		return resultado, nil
+	}
+
+	join := ""
+	orden := " ORDER BY p.fecha_creacion DESC, p.id_producto DESC"
+	var argsOrden []interface{}
+	switch b.Orden {
+	case OrdenPrecioAsc:
+		orden = " ORDER BY " + sqlPrecioDesde + " ASC, p.id_producto ASC"
+	case OrdenPrecioDesc:
+		orden = " ORDER BY " + sqlPrecioDesde + " DESC, p.id_producto ASC"
+	case OrdenMasVendidos:
+		join = " LEFT JOIN (SELECT d.id_producto, SUM(d.cantidad) AS vendidos FROM detalles_pedido d JOIN pedidos pe ON pe.id_pedido = d.id_pedido WHERE pe.estado <> 'CANCELADO' GROUP BY d.id_producto) v ON v.id_producto = p.id_producto"
+		orden = " ORDER BY COALESCE(v.vendidos, 0) DESC, p.id_producto DESC"
+	case OrdenRelevancia:
+		if expresion != "" {
+			orden = " ORDER BY (p.sku = ?) DESC, MATCH(p.nombre, p.descripcion, p.sku) AGAINST (? IN BOOLEAN MODE) DESC, p.id_producto DESC"
+			argsOrden = append(argsOrden, b.Texto, expresion)
+		}
+	}
+
+	query := "SELECT p.id_producto, p.nombre, p.descripcion, p.precio, p.stock, p.peso, p.id_clase_impuesto, p.sku, p.activo, p.fecha_creacion FROM productos p" + join + where + orden + " LIMIT ? OFFSET ?"
+	args = append(args, argsOrden...)
+	args = append(args, b.PorPagina, (b.Pagina-1)*b.PorPagina)
+
+	rows, err := pool.Query(query, args...)
+	if err != nil {
+		log.Println("Error al ejecutar la búsqueda", err)
+		return resultado, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var producto Producto
+		var descripcion, sku sql.NullString
+		var idClase sql.NullInt64
+		err = rows.Scan(&producto.ID, &producto.Nombre, &descripcion, &producto.Precio, &producto.Stock, &producto.Peso, &idClase, &sku, &producto.Activo, &producto.FechaCreacion)
+		if err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return resultado, err
+		}
+		producto.Descripcion = descripcion.String
+		producto.SKU = sku.String
+		producto.IDClaseImpuesto = int(idClase.Int64)
+		resultado.Productos = append(resultado.Productos, producto)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("Error al obtener los productos", err)
+		return resultado, err
+	}
+	return resultado, nil
+}
+
+// escaparLike escapa los comodines de LIKE en un texto ingresado por el usuario.
+func escaparLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
+}
@@ -0,0 +1,100 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"reflect"
+	"testing"
+)
+
+func TestPrecioDesde(t *testing.T) {
+	p := Producto{ID: 1, Precio: 1000}
+	casos := []struct {
+		nombre    string
+		variantes []VarianteProducto
+		esperado  dinero.Monto
+	}{
+		{"sin variantes", nil, 1000},
+		{"variante más barata", []VarianteProducto{{IDProducto: 1, Precio: 800, PrecioPropio: true, Activo: true}, {IDProducto: 1, Precio: 1200, PrecioPropio: true, Activo: true}}, 800},
+		{"solo variantes más caras", []VarianteProducto{{IDProducto: 1, Precio: 1500, PrecioPropio: true, Activo: true}}, 1500},
+		{"variante sin precio propio", []VarianteProducto{{IDProducto: 1, Activo: true}, {IDProducto: 1, Precio: 1500, PrecioPropio: true, Activo: true}}, 1000},
+		{"precio propio en 0", []VarianteProducto{{IDProducto: 1, Precio: 0, PrecioPropio: true, Activo: true}}, 0},
+		{"no cuentan las inactivas", []VarianteProducto{{IDProducto: 1, Precio: 500, PrecioPropio: true}, {IDProducto: 1, Precio: 1200, PrecioPropio: true, Activo: true}}, 1200},
+		{"solo variantes inactivas", []VarianteProducto{{IDProducto: 1, Precio: 500, PrecioPropio: true}}, 1000},
+		{"variante de otro producto", []VarianteProducto{{IDProducto: 2, Precio: 100, PrecioPropio: true, Activo: true}}, 1000},
+	}
+	for _, c := range casos {
+		if got := precioDesde(p, c.variantes); got != c.esperado {
+			t.Errorf("%s: precioDesde = %v; se esperaba %v", c.nombre, got, c.esperado)
+		}
+	}
+}
+
+func TestBuscarMemoriaPorPrecioDesde(t *testing.T) {
+	repos := NewRepositoriosMemoria()
+	// conVariantes crea un producto con una variante por precio; las
+	// negativas quedan inactivas y las 0 sin precio propio.
+	conVariantes := func(nombre string, precio dinero.Monto, precios ...dinero.Monto) int {
+		t.Helper()
+		id, err := repos.Productos.Create(Producto{Nombre: nombre, Precio: precio, Activo: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(precios) == 0 {
+			return id
+		}
+		var valores []ValorOpcion
+		for i := range precios {
+			valores = append(valores, ValorOpcion{Valor: string(rune('A' + i))})
+		}
+		if err := repos.Variantes.SetOpciones(id, []OpcionProducto{{Nombre: "Talle", Valores: valores}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := repos.Variantes.Generar(id); err != nil {
+			t.Fatal(err)
+		}
+		variantes, err := repos.Variantes.GetByProductoID(id)
+		if err != nil || len(variantes) != len(precios) {
+			t.Fatalf("variantes = %v, %v", variantes, err)
+		}
+		for i, v := range variantes {
+			v.Activo = precios[i] >= 0
+			v.Precio, v.PrecioPropio = precios[i], precios[i] != 0
+			if precios[i] < 0 {
+				v.Precio = -precios[i]
+			}
+			if err := repos.Variantes.Update(v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return id
+	}
+	remera := conVariantes("Remera", 2000)
+	buzo := conVariantes("Buzo", 5000, 1500, 0)
+	campera := conVariantes("Campera", 1000, 3000, -500)
+
+	casos := []struct {
+		nombre   string
+		busqueda BusquedaProductos
+		esperado []int
+	}{
+		{"hasta un precio", BusquedaProductos{PrecioMax: 1800}, []int{buzo}},
+		{"desde un precio", BusquedaProductos{PrecioMin: 2500}, []int{campera}},
+		// Sin orden de precio, del más nuevo al más viejo.
+		{"entre dos precios", BusquedaProductos{PrecioMin: 1500, PrecioMax: 2000}, []int{buzo, remera}},
+		{"del más barato al más caro", BusquedaProductos{Orden: OrdenPrecioAsc}, []int{buzo, remera, campera}},
+		{"del más caro al más barato", BusquedaProductos{Orden: OrdenPrecioDesc}, []int{campera, remera, buzo}},
+	}
+	for _, c := range casos {
+		r, err := repos.Productos.Buscar(c.busqueda)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var ids []int
+		for _, p := range r.Productos {
+			ids = append(ids, p.ID)
+		}
+		if !reflect.DeepEqual(ids, c.esperado) {
+			t.Errorf("%s: productos = %v; se esperaba %v", c.nombre, ids, c.esperado)
+		}
+	}
+}
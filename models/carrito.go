@@ -1,45 +1,65 @@
 package models
 
 import (
-	"Go-Sistemas-de-Gestion-empresarial/db"
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"log"
 	"time"
 )
 
+// Carrito pertenece a un cliente o, si es de un visitante anónimo, se
+// identifica por Token (IDCliente es 0).
 type Carrito struct {
 	ID            int
 	IDCliente     int
+	Token         string
 	FechaCreacion time.Time
 }
 
+// NewTokenCarrito genera el token aleatorio (256 bits en hexadecimal) de un
+// carrito de invitado.
+func NewTokenCarrito() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generando token de carrito: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// scanCarrito lee las columnas id_carrito, id_cliente, token y fecha_creacion.
+func scanCarrito(scan func(dest ...interface{}) error) (Carrito, error) {
+	var carrito Carrito
+	var idCliente sql.NullInt64
+	var token sql.NullString
+	err := scan(&carrito.ID, &idCliente, &token, &carrito.FechaCreacion)
+	carrito.IDCliente = int(idCliente.Int64)
+	carrito.Token = token.String
+	return carrito, err
+}
+
 type ItemCarrito struct {
 	ID         int
 	IDCarrito  int
 	IDProducto int
+	// IDVariante es 0 si el producto no tiene variantes.
+	IDVariante int
 	Cantidad   int
 }
 
 // GetCarritoByID obtiene un carrito por su ID
 func GetCarritoByID(id int) (Carrito, error) {
 	var carrito Carrito
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return carrito, err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("SELECT id_carrito, id_cliente, fecha_creacion FROM carritos WHERE id_carrito = ?")
+	stmt, err := pool.Prepare("SELECT id_carrito, id_cliente, token, fecha_creacion FROM carritos WHERE id_carrito = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return carrito, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow(id)
-	err = row.Scan(&carrito.ID, &carrito.IDCliente, &carrito.FechaCreacion)
+	carrito, err = scanCarrito(stmt.QueryRow(id).Scan)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return carrito, fmt.Errorf("carrito no encontrado con ID: %d", id)
@@ -54,22 +74,14 @@ func GetCarritoByID(id int) (Carrito, error) {
 func GetCarritoByClienteID(id int) (Carrito, error) {
 	// GetCarritoByClienteID devuelve el carrito asociado a un cliente por su ID.
 	var carrito Carrito
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return carrito, err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("SELECT id_carrito, id_cliente, fecha_creacion FROM carritos WHERE id_cliente = ?")
+	stmt, err := pool.Prepare("SELECT id_carrito, id_cliente, token, fecha_creacion FROM carritos WHERE id_cliente = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return carrito, err
 	}
 	defer stmt.Close()
 
-	row := stmt.QueryRow(id)
-	err = row.Scan(&carrito.ID, &carrito.IDCliente, &carrito.FechaCreacion)
+	carrito, err = scanCarrito(stmt.QueryRow(id).Scan)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return carrito, fmt.Errorf("carrito no encontrado con ID: %d", id)
@@ -85,12 +97,6 @@ func CreateCarrito(idCliente int) error {
 	// CreateCarrito crea un carrito para el cliente si no existe; es idempotente.
 	log.Println("Cliente ID", idCliente)
 
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
 	carrito, err := GetCarritoByClienteID(idCliente)
 	if err != nil {
 		log.Println("Error al obtener el carrito", err)
@@ -100,7 +106,7 @@ func CreateCarrito(idCliente int) error {
 		log.Println("Carrito ya existe")
 		return nil
 	}
-	stmt, err := DB.Prepare("INSERT INTO carritos (id_cliente) VALUES (?)")
+	stmt, err := pool.Prepare("INSERT INTO carritos (id_cliente) VALUES (?)")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
@@ -115,16 +121,159 @@ func CreateCarrito(idCliente int) error {
 	return nil
 }
 
-func DeleteCarrito(id int) error {
-	// DeleteCarrito elimina un carrito por su ID.
-	DB, err := db.Connect()
+// GetCarritoByToken devuelve el carrito de invitado con el token indicado.
+func GetCarritoByToken(token string) (Carrito, error) {
+	row := pool.QueryRow("SELECT id_carrito, id_cliente, token, fecha_creacion FROM carritos WHERE token = ?", token)
+	carrito, err := scanCarrito(row.Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return carrito, fmt.Errorf("carrito de invitado no encontrado")
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return carrito, err
+	}
+	return carrito, nil
+}
+
+// CreateCarritoInvitado crea el carrito de un visitante anónimo identificado
+// por `token` (ver NewTokenCarrito).
+func CreateCarritoInvitado(token string) error {
+	_, err := pool.Exec("INSERT INTO carritos (token) VALUES (?)", token)
+	if err != nil {
+		log.Println("Error al crear el carrito de invitado", err)
+		return err
+	}
+	return nil
+}
+
+// FusionarCarritoInvitado pasa los items del carrito de invitado `token` al
+// carrito del cliente (creándolo si hace falta) y elimina el de invitado, en
+// una sola transacción. Las líneas repetidas suman sus cantidades hasta el
+// stock disponible; nunca se reduce lo que el cliente ya tenía. Los productos
+// o variantes que ya no están a la venta se descartan. Si el token no tiene
+// carrito no hace nada.
+func FusionarCarritoInvitado(token string, idCliente int) error {
+	tx, err := pool.Begin()
 	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
+		log.Println("Error al iniciar la transacción", err)
 		return err
 	}
-	defer DB.Close()
+	defer tx.Rollback()
 
-	stmt, err := DB.Prepare("DELETE FROM carritos WHERE id_carrito = ?")
+	var idInvitado int
+	err = tx.QueryRow("SELECT id_carrito FROM carritos WHERE token = ? FOR UPDATE", token).Scan(&idInvitado)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		log.Println("Error al obtener el carrito de invitado", err)
+		return err
+	}
+
+	var idCarrito int
+	err = tx.QueryRow("SELECT id_carrito FROM carritos WHERE id_cliente = ? FOR UPDATE", idCliente).Scan(&idCarrito)
+	if err == sql.ErrNoRows {
+		result, errInsert := tx.Exec("INSERT INTO carritos (id_cliente) VALUES (?)", idCliente)
+		if errInsert != nil {
+			log.Println("Error al crear el carrito del cliente", errInsert)
+			return errInsert
+		}
+		id, _ := result.LastInsertId()
+		idCarrito, err = int(id), nil
+	}
+	if err != nil {
+		log.Println("Error al obtener el carrito del cliente", err)
+		return err
+	}
+
+	// Cada línea del invitado con el stock vigente y lo que el cliente ya
+	// tenía de ese mismo producto y variante.
+	rows, err := tx.Query(`SELECT i.id_producto, i.id_variante, i.cantidad,
+			p.activo AND COALESCE(v.activo, 1), COALESCE(v.stock, p.stock), COALESCE(c.id_item, 0), COALESCE(c.cantidad, 0)
+		FROM items_carrito i
+		JOIN productos p ON p.id_producto = i.id_producto
+		LEFT JOIN variantes_producto v ON v.id_variante = i.id_variante
+		LEFT JOIN items_carrito c ON c.id_carrito = ? AND c.id_producto = i.id_producto AND c.id_variante_clave = i.id_variante_clave
+		WHERE i.id_carrito = ?
+		ORDER BY i.id_item`, idCarrito, idInvitado)
+	if err != nil {
+		log.Println("Error al leer el carrito de invitado", err)
+		return err
+	}
+	type lineaFusion struct {
+		idProducto, idVariante, cantidad, stock, idItem, existente int
+		activo                                                     bool
+	}
+	var lineas []lineaFusion
+	for rows.Next() {
+		var l lineaFusion
+		var idVariante sql.NullInt64
+		if err := rows.Scan(&l.idProducto, &idVariante, &l.cantidad, &l.activo, &l.stock, &l.idItem, &l.existente); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return err
+		}
+		l.idVariante = int(idVariante.Int64)
+		lineas = append(lineas, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Println("Error al leer el carrito de invitado", err)
+		return err
+	}
+
+	for _, l := range lineas {
+		cantidad := cantidadFusionada(l.existente, l.cantidad, l.stock)
+		if !l.activo || cantidad == l.existente {
+			continue
+		}
+		if l.idItem != 0 {
+			_, err = tx.Exec("UPDATE items_carrito SET cantidad = ? WHERE id_item = ?", cantidad, l.idItem)
+		} else {
+			_, err = tx.Exec("INSERT INTO items_carrito (id_carrito, id_producto, id_variante, cantidad) VALUES (?, ?, ?, ?)",
+				idCarrito, l.idProducto, nullID(l.idVariante), cantidad)
+		}
+		if err != nil {
+			log.Println("Error al fusionar item del carrito", err)
+			return err
+		}
+	}
+
+	// Los items del invitado se eliminan en cascada.
+	if _, err := tx.Exec("DELETE FROM carritos WHERE id_carrito = ?", idInvitado); err != nil {
+		log.Println("Error al eliminar el carrito de invitado", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// cantidadFusionada suma la cantidad del invitado a la del cliente sin pasar
+// del stock disponible, pero sin quitarle al cliente lo que ya tenía.
+func cantidadFusionada(existente, agregada, stock int) int {
+	cantidad := existente + agregada
+	if cantidad > stock {
+		cantidad = stock
+	}
+	if cantidad < existente {
+		cantidad = existente
+	}
+	return cantidad
+}
+
+// DeleteCarritosInvitadosAntiguos elimina los carritos de invitado creados
+// hace más de `antiguedad` (su cookie ya venció) y devuelve cuántos borró.
+func DeleteCarritosInvitadosAntiguos(antiguedad time.Duration) (int64, error) {
+	result, err := pool.Exec("DELETE FROM carritos WHERE id_cliente IS NULL AND fecha_creacion < DATE_SUB(NOW(), INTERVAL ? SECOND)", int64(antiguedad/time.Second))
+	if err != nil {
+		log.Println("Error al eliminar carritos de invitado antiguos", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func DeleteCarrito(id int) error {
+	// DeleteCarrito elimina un carrito por su ID.
+	stmt, err := pool.Prepare("DELETE FROM carritos WHERE id_carrito = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
@@ -140,23 +289,21 @@ func DeleteCarrito(id int) error {
 	return nil
 }
 
-func AgregarItemCarrito(idCarrito, idProducto, cantidad int) error {
-	// AgregarItemCarrito inserta un nuevo item en el carrito especificado.
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-	log.Println("Intentando agregar item: CarritoID:", idCarrito, "ProductoID:", idProducto, "Cantidad:", cantidad)
-	stmt, err := DB.Prepare("INSERT INTO items_carrito (id_carrito, id_producto, cantidad) VALUES (?, ?, ?)")
+func AgregarItemCarrito(idCarrito, idProducto, idVariante, cantidad int) error {
+	// AgregarItemCarrito agrega un item al carrito especificado. Si el carrito
+	// ya tiene una línea del mismo producto y variante, suma la cantidad a esa
+	// línea (clave única `carrito_producto_variante`).
+	// `idVariante` es 0 para productos sin variantes.
+	log.Println("Intentando agregar item: CarritoID:", idCarrito, "ProductoID:", idProducto, "VarianteID:", idVariante, "Cantidad:", cantidad)
+	stmt, err := pool.Prepare(`INSERT INTO items_carrito (id_carrito, id_producto, id_variante, cantidad) VALUES (?, ?, ?, ?) AS nuevo
+		ON DUPLICATE KEY UPDATE cantidad = items_carrito.cantidad + nuevo.cantidad`)
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(idCarrito, idProducto, cantidad)
+	_, err = stmt.Exec(idCarrito, idProducto, nullID(idVariante), cantidad)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return err
@@ -168,14 +315,7 @@ func AgregarItemCarrito(idCarrito, idProducto, cantidad int) error {
 func GetItemsByCarritoID(idCarrito int) ([]ItemCarrito, error) {
 	// GetItemsByCarritoID devuelve los items pertenecientes a un carrito.
 	var items []ItemCarrito
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return items, err
-	}
-	defer DB.Close()
-
-	rows, err := DB.Query("SELECT id_item, id_carrito, id_producto, cantidad FROM items_carrito WHERE id_carrito = ?", idCarrito)
+	rows, err := pool.Query("SELECT id_item, id_carrito, id_producto, id_variante, cantidad FROM items_carrito WHERE id_carrito = ?", idCarrito)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return items, err
@@ -184,11 +324,13 @@ func GetItemsByCarritoID(idCarrito int) ([]ItemCarrito, error) {
 
 	for rows.Next() {
 		var item ItemCarrito
-		err = rows.Scan(&item.ID, &item.IDCarrito, &item.IDProducto, &item.Cantidad)
+		var idVariante sql.NullInt64
+		err = rows.Scan(&item.ID, &item.IDCarrito, &item.IDProducto, &idVariante, &item.Cantidad)
 		if err != nil {
 			log.Println("Error al escanear la consulta sql", err)
 			return items, err
 		}
+		item.IDVariante = int(idVariante.Int64)
 		items = append(items, item)
 	}
 	if err = rows.Err(); err != nil {
@@ -199,48 +341,81 @@ func GetItemsByCarritoID(idCarrito int) ([]ItemCarrito, error) {
 	return items, nil
 }
 
-func UpdateItemCarrito(idItem, cantidad int) error {
-	// UpdateItemCarrito actualiza la cantidad de un item del carrito.
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
+// PropietarioCarrito identifica a quien puede modificar un carrito: un
+// cliente autenticado o, si IDCliente es 0, el invitado dueño del Token.
+type PropietarioCarrito struct {
+	IDCliente int
+	Token     string
+}
+
+// condicion devuelve el filtro SQL sobre `carritos c` que limita una
+// consulta a los carritos del propietario.
+func (p PropietarioCarrito) condicion() (string, interface{}) {
+	if p.IDCliente != 0 {
+		return "c.id_cliente = ?", p.IDCliente
 	}
-	defer DB.Close()
+	return "c.token = ?", p.Token
+}
+
+// valido indica si el propietario identifica a alguien.
+func (p PropietarioCarrito) valido() bool {
+	return p.IDCliente != 0 || p.Token != ""
+}
 
-	stmt, err := DB.Prepare("UPDATE items_carrito SET cantidad = ? WHERE id_item = ?")
+// ErrItemCarritoNoEncontrado se devuelve al modificar un item que no existe
+// o que pertenece al carrito de otra persona.
+var ErrItemCarritoNoEncontrado = errors.New("item de carrito no encontrado")
+
+func UpdateItemCarrito(propietario PropietarioCarrito, idItem, cantidad int) error {
+	// UpdateItemCarrito actualiza la cantidad de un item del carrito, solo si
+	// el carrito pertenece a `propietario`.
+	if !propietario.valido() {
+		return ErrItemCarritoNoEncontrado
+	}
+	condicion, arg := propietario.condicion()
+	stmt, err := pool.Prepare("UPDATE items_carrito i JOIN carritos c ON c.id_carrito = i.id_carrito SET i.cantidad = ? WHERE i.id_item = ? AND " + condicion)
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(cantidad, idItem)
+	result, err := stmt.Exec(cantidad, idItem, arg)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return err
 	}
+	// MySQL no cuenta las filas que ya tenían esa cantidad; en ese caso se
+	// comprueba que el item exista y sea del propietario.
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		var id int
+		err = pool.QueryRow("SELECT i.id_item FROM items_carrito i JOIN carritos c ON c.id_carrito = i.id_carrito WHERE i.id_item = ? AND "+condicion, idItem, arg).Scan(&id)
+		if err == sql.ErrNoRows {
+			return ErrItemCarritoNoEncontrado
+		}
+		if err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return err
+		}
+	}
 	log.Println("Item actualizado exitosamente")
 	return nil
 }
 
-func EmptyCarrito(idCarrito int) error {
-	// EmptyCarrito elimina todos los items del carrito indicado.
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
+func EmptyCarrito(propietario PropietarioCarrito) error {
+	// EmptyCarrito elimina todos los items del carrito de `propietario`.
+	if !propietario.valido() {
+		return nil
 	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("DELETE FROM items_carrito WHERE id_carrito = ?")
+	condicion, arg := propietario.condicion()
+	stmt, err := pool.Prepare("DELETE i FROM items_carrito i JOIN carritos c ON c.id_carrito = i.id_carrito WHERE " + condicion)
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(idCarrito)
+	_, err = stmt.Exec(arg)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return err
@@ -249,27 +424,29 @@ func EmptyCarrito(idCarrito int) error {
 	return nil
 }
 
-func RemoveItemFromCarrito(idItem int) error {
-	// RemoveItemFromCarrito elimina un item específico del carrito por su ID.
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
+func RemoveItemFromCarrito(propietario PropietarioCarrito, idItem int) error {
+	// RemoveItemFromCarrito elimina un item del carrito por su ID, solo si el
+	// carrito pertenece a `propietario`. Devuelve ErrItemCarritoNoEncontrado
+	// si no existe o es de otra persona.
+	if !propietario.valido() {
+		return ErrItemCarritoNoEncontrado
 	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("DELETE FROM items_carrito WHERE id_item = ?")
+	condicion, arg := propietario.condicion()
+	stmt, err := pool.Prepare("DELETE i FROM items_carrito i JOIN carritos c ON c.id_carrito = i.id_carrito WHERE i.id_item = ? AND " + condicion)
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(idItem)
+	result, err := stmt.Exec(idItem, arg)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return err
 	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrItemCarritoNoEncontrado
+	}
 	log.Println("Item eliminado del carrito exitosamente")
 	return nil
 }
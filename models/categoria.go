@@ -0,0 +1,312 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// ErrCategoriaConSubcategorias se devuelve al eliminar una categoría que
+// todavía tiene categorías hijas.
+var ErrCategoriaConSubcategorias = errors.New("la categoría tiene subcategorías")
+
+// ErrCategoriaCiclica se devuelve cuando el padre elegido es la propia
+// categoría o una de sus descendientes.
+var ErrCategoriaCiclica = errors.New("una categoría no puede colgar de sí misma ni de sus subcategorías")
+
+// Categoria agrupa productos. Las categorías pueden anidarse mediante IDPadre.
+type Categoria struct {
+	ID          int
+	Nombre      string
+	Descripcion string
+	IDPadre     int // 0 si es una categoría raíz
+}
+
+// NodoCategoria es una categoría dentro del árbol, con su profundidad.
+type NodoCategoria struct {
+	Categoria
+	Nivel int
+}
+
+// Sangria devuelve un prefijo para mostrar la profundidad en listas planas.
+func (n NodoCategoria) Sangria() string {
+	return strings.Repeat("— ", n.Nivel)
+}
+
+// ArbolCategorias ordena las categorías en recorrido en profundidad (cada padre
+// seguido de sus hijas, alfabéticamente) y calcula el nivel de cada una.
+func ArbolCategorias(categorias []Categoria) []NodoCategoria {
+	hijas := map[int][]Categoria{}
+	existe := map[int]bool{}
+	for _, c := range categorias {
+		existe[c.ID] = true
+	}
+	for _, c := range categorias {
+		padre := c.IDPadre
+		if !existe[padre] {
+			padre = 0
+		}
+		hijas[padre] = append(hijas[padre], c)
+	}
+	for _, lista := range hijas {
+		sort.Slice(lista, func(i, j int) bool { return lista[i].Nombre < lista[j].Nombre })
+	}
+
+	arbol := make([]NodoCategoria, 0, len(categorias))
+	var recorrer func(padre, nivel int)
+	recorrer = func(padre, nivel int) {
+		for _, c := range hijas[padre] {
+			arbol = append(arbol, NodoCategoria{Categoria: c, Nivel: nivel})
+			recorrer(c.ID, nivel+1)
+		}
+	}
+	recorrer(0, 0)
+	return arbol
+}
+
+// Subcategorias devuelve las hijas directas de una categoría (0 para las raíces).
+func Subcategorias(categorias []Categoria, idPadre int) []Categoria {
+	var hijas []Categoria
+	for _, c := range categorias {
+		if c.IDPadre == idPadre {
+			hijas = append(hijas, c)
+		}
+	}
+	sort.Slice(hijas, func(i, j int) bool { return hijas[i].Nombre < hijas[j].Nombre })
+	return hijas
+}
+
+// Descendientes devuelve el ID indicado junto con los de todas sus
+// subcategorías, a cualquier profundidad.
+func Descendientes(categorias []Categoria, id int) []int {
+	ids := []int{id}
+	visitados := map[int]bool{id: true}
+	for i := 0; i < len(ids); i++ {
+		for _, c := range categorias {
+			if c.IDPadre == ids[i] && !visitados[c.ID] {
+				visitados[c.ID] = true
+				ids = append(ids, c.ID)
+			}
+		}
+	}
+	return ids
+}
+
+// RutaCategoria devuelve los ancestros de una categoría desde la raíz hasta
+// ella misma, para mostrar migas de pan.
+func RutaCategoria(categorias []Categoria, id int) []Categoria {
+	porID := make(map[int]Categoria, len(categorias))
+	for _, c := range categorias {
+		porID[c.ID] = c
+	}
+	var ruta []Categoria
+	for c, ok := porID[id]; ok && len(ruta) <= len(categorias); c, ok = porID[c.IDPadre] {
+		ruta = append([]Categoria{c}, ruta...)
+	}
+	return ruta
+}
+
+// validarPadre comprueba que idPadre exista y no sea la categoría id ni una de
+// sus descendientes. Para categorías nuevas id es 0.
+func validarPadre(categorias []Categoria, id, idPadre int) error {
+	if idPadre == 0 {
+		return nil
+	}
+	encontrado := false
+	for _, c := range categorias {
+		if c.ID == idPadre {
+			encontrado = true
+			break
+		}
+	}
+	if !encontrado {
+		return fmt.Errorf("categoría padre no encontrada con ID: %d", idPadre)
+	}
+	if id == 0 {
+		return nil
+	}
+	for _, d := range Descendientes(categorias, id) {
+		if d == idPadre {
+			return ErrCategoriaCiclica
+		}
+	}
+	return nil
+}
+
+// nullID convierte un ID opcional (0 = sin valor) en un valor SQL.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// GetCategoriaByID devuelve una categoría por su identificador.
+func GetCategoriaByID(id int) (Categoria, error) {
+	var categoria Categoria
+	stmt, err := pool.Prepare("SELECT id_categoria, nombre, descripcion, id_padre FROM categorias WHERE id_categoria = ?")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return categoria, err
+	}
+	defer stmt.Close()
+
+	var descripcion sql.NullString
+	var idPadre sql.NullInt64
+	err = stmt.QueryRow(id).Scan(&categoria.ID, &categoria.Nombre, &descripcion, &idPadre)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return categoria, fmt.Errorf("categoría no encontrada con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return categoria, err
+	}
+	categoria.Descripcion = descripcion.String
+	categoria.IDPadre = int(idPadre.Int64)
+	return categoria, nil
+}
+
+// GetAllCategorias devuelve todas las categorías ordenadas por nombre.
+func GetAllCategorias() ([]Categoria, error) {
+	return queryCategorias("SELECT id_categoria, nombre, descripcion, id_padre FROM categorias ORDER BY nombre")
+}
+
+// GetCategoriasByProductoID devuelve las categorías asignadas a un producto.
+func GetCategoriasByProductoID(idProducto int) ([]Categoria, error) {
+	return queryCategorias("SELECT c.id_categoria, c.nombre, c.descripcion, c.id_padre FROM categorias c JOIN producto_categorias pc ON pc.id_categoria = c.id_categoria WHERE pc.id_producto = ? ORDER BY c.nombre", idProducto)
+}
+
+func queryCategorias(query string, args ...interface{}) ([]Categoria, error) {
+	var categorias []Categoria
+	rows, err := pool.Query(query, args...)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return categorias, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Categoria
+		var descripcion sql.NullString
+		var idPadre sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.Nombre, &descripcion, &idPadre); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return categorias, err
+		}
+		c.Descripcion = descripcion.String
+		c.IDPadre = int(idPadre.Int64)
+		categorias = append(categorias, c)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("Error al obtener las categorías", err)
+		return categorias, err
+	}
+	return categorias, nil
+}
+
+// CreateCategoria inserta una nueva categoría. idPadre 0 la crea como raíz.
+func CreateCategoria(nombre, descripcion string, idPadre int) error {
+	categorias, err := GetAllCategorias()
+	if err != nil {
+		return err
+	}
+	if err := validarPadre(categorias, 0, idPadre); err != nil {
+		return err
+	}
+
+	stmt, err := pool.Prepare("INSERT INTO categorias (nombre, descripcion, id_padre) VALUES (?, ?, ?)")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nombre, descripcion, nullID(idPadre))
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	log.Println("Categoría creada exitosamente")
+	return nil
+}
+
+// UpdateCategoria actualiza una categoría. Rechaza padres que formarían un ciclo.
+func UpdateCategoria(id int, nombre, descripcion string, idPadre int) error {
+	categorias, err := GetAllCategorias()
+	if err != nil {
+		return err
+	}
+	if err := validarPadre(categorias, id, idPadre); err != nil {
+		return err
+	}
+
+	stmt, err := pool.Prepare("UPDATE categorias SET nombre = ?, descripcion = ?, id_padre = ? WHERE id_categoria = ?")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(nombre, descripcion, nullID(idPadre), id)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	log.Println("Categoría actualizada exitosamente")
+	return nil
+}
+
+// DeleteCategoria elimina una categoría sin subcategorías. Las asignaciones a
+// productos se borran en cascada.
+func DeleteCategoria(id int) error {
+	var hijas int
+	if err := pool.QueryRow("SELECT COUNT(*) FROM categorias WHERE id_padre = ?", id).Scan(&hijas); err != nil {
+		log.Println("Error al contar subcategorías", err)
+		return err
+	}
+	if hijas > 0 {
+		return ErrCategoriaConSubcategorias
+	}
+
+	stmt, err := pool.Prepare("DELETE FROM categorias WHERE id_categoria = ?")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(id)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	log.Println("Categoría eliminada exitosamente")
+	return nil
+}
+
+// SetCategoriasProducto reemplaza las categorías de un producto por las
+// indicadas, en una transacción.
+func SetCategoriasProducto(idProducto int, idsCategoria []int) error {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM producto_categorias WHERE id_producto = ?", idProducto); err != nil {
+		log.Println("Error al limpiar las categorías del producto", err)
+		return err
+	}
+	for _, idCategoria := range idsCategoria {
+		if _, err := tx.Exec("INSERT IGNORE INTO producto_categorias (id_producto, id_categoria) VALUES (?, ?)", idProducto, idCategoria); err != nil {
+			log.Println("Error al asignar la categoría", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,723 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ErrCarritoVacio se devuelve al intentar un checkout sin items en el carrito.
+var ErrCarritoVacio = errors.New("el carrito está vacío")
+
+// ItemSinStock describe una línea del carrito que no puede atenderse.
+type ItemSinStock struct {
+	IDProducto  int
+	IDVariante  int
+	Nombre      string
+	Solicitado  int
+	Disponible  int
+	Inactivo    bool
+	SinVariante bool
+}
+
+// Mensaje devuelve una explicación legible para mostrar al cliente.
+func (i ItemSinStock) Mensaje() string {
+	if i.SinVariante {
+		return fmt.Sprintf("%s ahora se vende por variantes: quítalo del carrito y elige una opción", i.Nombre)
+	}
+	if i.Inactivo {
+		return fmt.Sprintf("%s ya no está disponible para la venta", i.Nombre)
+	}
+	if i.Disponible == 0 {
+		return fmt.Sprintf("%s está agotado", i.Nombre)
+	}
+	return fmt.Sprintf("%s: pediste %d unidades pero solo quedan %d", i.Nombre, i.Solicitado, i.Disponible)
+}
+
+// StockInsuficienteError se devuelve cuando uno o más items del carrito
+// superan el stock disponible. El pedido no se crea.
+type StockInsuficienteError struct {
+	Items []ItemSinStock
+}
+
+func (e *StockInsuficienteError) Error() string {
+	mensajes := make([]string, len(e.Items))
+	for i, item := range e.Items {
+		mensajes[i] = item.Mensaje()
+	}
+	return "stock insuficiente: " + strings.Join(mensajes, "; ")
+}
+
+// lineaCheckout es una línea del carrito junto con el producto (o la
+// variante) bloqueado. `Variante` es la descripción que se guarda en el pedido.
+type lineaCheckout struct {
+	IDProducto  int
+	IDVariante  int
+	Variante    string
+	Cantidad    int
+	Nombre      string
+	Precio      dinero.Monto
+	Peso        float64
+	Stock       int
+	Activo      bool
+	SinVariante bool
+	Categorias  []int
+	// DescuentoPromocion es el ahorro de las promociones automáticas y
+	// Descuento el del cupón, que se calcula sobre lo que queda.
+	DescuentoPromocion dinero.Monto
+	Descuento          dinero.Monto
+	// IDClaseImpuesto es la clase del producto; Clase la que se aplicó (la
+	// predeterminada si no tiene) e Impuesto lo que paga la línea.
+	IDClaseImpuesto int
+	Clase           ClaseImpuesto
+	Impuesto        dinero.Monto
+}
+
+// SolicitudCheckout reúne los datos con los que el cliente confirma la compra.
+type SolicitudCheckout struct {
+	IDCliente  int
+	MetodoPago string
+	// CodigoCupon es opcional; si no es válido el pedido no se crea y el
+	// error envuelve ErrCuponInvalido.
+	CodigoCupon string
+	// IDMetodoEnvio es el método de envío elegido y Direccion la dirección
+	// de entrega, que el pedido guarda como copia. Si el método no sirve el
+	// pedido no se crea y el error envuelve ErrEnvioInvalido.
+	IDMetodoEnvio int
+	Direccion     DireccionEnvio
+}
+
+// nombreLinea devuelve el nombre del producto con la variante, si la hay.
+func (l lineaCheckout) nombreLinea() string {
+	if l.Variante == "" {
+		return l.Nombre
+	}
+	return l.Nombre + " (" + l.Variante + ")"
+}
+
+// ProcesarCheckout convierte el carrito del cliente en un pedido dentro de una
+// única transacción: bloquea las filas de los productos con SELECT ... FOR
+// UPDATE, valida el stock, aplica las promociones vigentes y el cupón (si lo
+// hay) y cuenta su uso, calcula los impuestos de cada línea, suma el envío
+// (y los impuestos, si los precios no los incluyen), crea el pedido y sus
+// detalles, descuenta el stock de forma relativa y vacía el carrito. Si algo
+// falla no queda nada a medias. Devuelve el ID del pedido creado.
+//
+// El crédito a favor del cliente se aplica al total y se descuenta de su
+// saldo. El pedido queda PENDIENTE (PAGADO si el crédito lo cubre todo): el
+// cobro del resto se hace después de confirmar la transacción, para no
+// retener los bloqueos mientras responde la pasarela (ver RegistrarCobro y
+// AnularCheckout).
+func ProcesarCheckout(s SolicitudCheckout) (int, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var idCarrito int
+	err = tx.QueryRow("SELECT id_carrito FROM carritos WHERE id_cliente = ? FOR UPDATE", s.IDCliente).Scan(&idCarrito)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, ErrCarritoVacio
+		}
+		log.Println("Error al obtener el carrito", err)
+		return 0, err
+	}
+
+	lineas, err := lockLineasCarrito(tx, idCarrito)
+	if err != nil {
+		return 0, err
+	}
+
+	subtotal, err := validarLineas(lineas)
+	if err != nil {
+		return 0, err
+	}
+
+	categorias, err := categoriasLineas(tx, lineas)
+	if err != nil {
+		return 0, err
+	}
+	promociones, err := GetPromocionesActivas()
+	if err != nil {
+		return 0, err
+	}
+	ahora := time.Now()
+	promocion := aplicarPromocionesLineas(promociones, lineas, categorias, ahora)
+
+	var cupon Cupon
+	var descuento dinero.Monto
+	if codigo := NormalizarCodigo(s.CodigoCupon); codigo != "" {
+		cupon, descuento, err = cuponCheckout(tx, codigo, s.IDCliente, lineas, categorias, ahora)
+		if err != nil {
+			return 0, err
+		}
+	}
+	importe := subtotal - promocion.Total - descuento
+
+	// Las clases de impuesto, los métodos y las zonas se leen fuera de la
+	// transacción, como las promociones.
+	clases, err := GetAllClasesImpuesto()
+	if err != nil {
+		return 0, err
+	}
+	impuestos := aplicarImpuestosLineas(clases, lineas)
+	metodos, err := GetMetodosEnvioActivos()
+	if err != nil {
+		return 0, err
+	}
+	zonas, err := GetAllZonasEnvio()
+	if err != nil {
+		return 0, err
+	}
+	metodo, costoEnvio, entrega, err := elegirEnvio(s, metodos, zonas, pesoLineas(lineas), importe)
+	if err != nil {
+		return 0, err
+	}
+	// Los umbrales de envío usan el importe sin los impuestos, y el envío
+	// no paga impuestos.
+	total := importe + impuestos.Adicional() + costoEnvio
+
+	// El crédito solo se gasta en un checkout, y los checkouts del cliente
+	// se serializan con el bloqueo del carrito: el saldo no puede quedar
+	// negativo.
+	var saldo dinero.Monto
+	if err := tx.QueryRow("SELECT COALESCE(SUM(monto), 0) FROM creditos_clientes WHERE id_cliente = ?", s.IDCliente).Scan(&saldo); err != nil {
+		log.Println("Error al obtener el crédito del cliente", err)
+		return 0, err
+	}
+	credito := CreditoAplicable(saldo, total)
+	estado := estadoInicial(total - credito)
+
+	result, err := tx.Exec("INSERT INTO pedidos (id_cliente, subtotal, descuento_promociones, descuento, total, credito, metodo_pago, id_cupon, codigo_cupon, id_metodo_envio, metodo_envio, costo_envio, impuestos, impuestos_incluidos, envio_destinatario, envio_direccion, envio_provincia, envio_telefono, estado) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		s.IDCliente, subtotal, promocion.Total, descuento, total, credito, s.MetodoPago, nullID(cupon.ID), sql.NullString{String: cupon.Codigo, Valid: cupon.ID != 0},
+		nullID(metodo.ID), nullString(metodo.Nombre), costoEnvio, impuestos.Total, impuestos.Incluidos, nullString(entrega.Destinatario), nullString(entrega.Direccion), nullString(entrega.Provincia), nullString(entrega.Telefono), estado)
+	if err != nil {
+		log.Println("Error al crear el pedido", err)
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error al obtener el ID del pedido insertado", err)
+		return 0, err
+	}
+	idPedido := int(id)
+
+	var responsable string
+	if err := tx.QueryRow("SELECT nombre FROM clientes WHERE id_cliente = ?", s.IDCliente).Scan(&responsable); err != nil {
+		log.Println("Error al leer el nombre del cliente", err)
+		return 0, err
+	}
+	if err := insertarCambioEstado(tx, CambioEstado{IDPedido: idPedido, EstadoNuevo: estado, IDCliente: s.IDCliente, Responsable: responsable, Motivo: motivoCreacion(estado)}); err != nil {
+		return 0, err
+	}
+
+	if credito > 0 {
+		if err := insertarMovimientoCredito(tx, s.IDCliente, -credito, fmt.Sprintf("Pago del pedido #%d", idPedido), idPedido); err != nil {
+			return 0, err
+		}
+	}
+
+	for _, a := range promocion.Aplicadas {
+		if _, err := tx.Exec("INSERT INTO pedido_promociones (id_pedido, id_promocion, nombre, descuento) VALUES (?, ?, ?, ?)", idPedido, a.IDPromocion, a.Nombre, a.Descuento); err != nil {
+			log.Println("Error al registrar la promoción del pedido", err)
+			return 0, err
+		}
+	}
+
+	// El cupón quedó bloqueado en cuponCheckout, así que el contador no puede
+	// pasarse del límite por checkouts simultáneos.
+	if cupon.ID != 0 {
+		if _, err := tx.Exec("UPDATE cupones SET usos = usos + 1 WHERE id_cupon = ?", cupon.ID); err != nil {
+			log.Println("Error al contar el uso del cupón", err)
+			return 0, err
+		}
+		if _, err := tx.Exec("INSERT INTO cupon_usos (id_cupon, id_cliente, id_pedido) VALUES (?, ?, ?)", cupon.ID, s.IDCliente, idPedido); err != nil {
+			log.Println("Error al registrar el uso del cupón", err)
+			return 0, err
+		}
+	}
+
+	for _, l := range lineas {
+		_, err = tx.Exec("INSERT INTO detalles_pedido (id_pedido, id_producto, id_variante, variante, cantidad, precio_unitario, descuento_promocion, descuento, impuesto_nombre, impuesto_tasa, impuesto_exento, impuesto) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			idPedido, l.IDProducto, nullID(l.IDVariante), sql.NullString{String: l.Variante, Valid: l.Variante != ""}, l.Cantidad, l.Precio, l.DescuentoPromocion, l.Descuento,
+			nullString(l.Clase.Nombre), l.Clase.Tasa, l.Clase.Exenta, l.Impuesto)
+		if err != nil {
+			log.Println("Error al crear el detalle del pedido", err)
+			return 0, err
+		}
+
+		// Con variante se descuenta su stock y también el total del producto,
+		// que guarda la suma de sus variantes.
+		guardia := "UPDATE productos SET stock = stock - ? WHERE id_producto = ? AND stock >= ?"
+		idGuardia := l.IDProducto
+		if l.IDVariante != 0 {
+			guardia = "UPDATE variantes_producto SET stock = stock - ? WHERE id_variante = ? AND stock >= ?"
+			idGuardia = l.IDVariante
+		}
+		result, err := tx.Exec(guardia, l.Cantidad, idGuardia, l.Cantidad)
+		if err != nil {
+			log.Println("Error al descontar stock", err)
+			return 0, err
+		}
+		if n, _ := result.RowsAffected(); n != 1 {
+			return 0, &StockInsuficienteError{Items: []ItemSinStock{{IDProducto: l.IDProducto, IDVariante: l.IDVariante, Nombre: l.nombreLinea(), Solicitado: l.Cantidad, Disponible: l.Stock}}}
+		}
+		if l.IDVariante != 0 {
+			if _, err := tx.Exec("UPDATE productos SET stock = stock - ? WHERE id_producto = ?", l.Cantidad, l.IDProducto); err != nil {
+				log.Println("Error al descontar stock", err)
+				return 0, err
+			}
+		}
+	}
+
+	if _, err = tx.Exec("DELETE FROM items_carrito WHERE id_carrito = ?", idCarrito); err != nil {
+		log.Println("Error al vaciar el carrito", err)
+		return 0, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return 0, err
+	}
+	log.Println("Checkout completado, pedido:", idPedido)
+	return idPedido, nil
+}
+
+// AnularCheckout cancela un pedido recién creado cuyo cobro no se pudo hacer:
+// repone el stock y el crédito usado, libera el uso del cupón y devuelve los
+// productos al carrito del cliente para que pueda reintentar con otro medio
+// de pago. El
+// pedido queda CANCELADO con el motivo en el historial. Solo se aplica a
+// pedidos PENDIENTES; si no, devuelve un error que envuelve
+// ErrTransicionInvalida.
+func AnularCheckout(idPedido int, responsable, motivo string) (CambioEstado, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return CambioEstado{}, err
+	}
+	defer tx.Rollback()
+
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE id_pedido = ? FOR UPDATE", idPedido).Scan)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error al bloquear el pedido", err)
+		}
+		return CambioEstado{}, err
+	}
+	if pedido.Estado != EstadoPendiente {
+		return CambioEstado{}, fmt.Errorf("%w: el pedido ya está %s", ErrTransicionInvalida, pedido.Estado)
+	}
+
+	// El carrito se bloquea antes que los productos, en el mismo orden que
+	// ProcesarCheckout.
+	var idCarrito int
+	err = tx.QueryRow("SELECT id_carrito FROM carritos WHERE id_cliente = ? FOR UPDATE", pedido.IDCliente).Scan(&idCarrito)
+	if err == sql.ErrNoRows {
+		result, errInsert := tx.Exec("INSERT INTO carritos (id_cliente) VALUES (?)", pedido.IDCliente)
+		if errInsert != nil {
+			log.Println("Error al crear el carrito", errInsert)
+			return CambioEstado{}, errInsert
+		}
+		id, _ := result.LastInsertId()
+		idCarrito, err = int(id), nil
+	}
+	if err != nil {
+		log.Println("Error al bloquear el carrito", err)
+		return CambioEstado{}, err
+	}
+
+	cambio, err := cambiarEstadoTx(tx, SolicitudCambioEstado{IDPedido: idPedido, Estado: EstadoCancelado, Responsable: responsable, Motivo: motivo}, pedido)
+	if err != nil {
+		return CambioEstado{}, err
+	}
+
+	if pedido.IDCupon != 0 {
+		if _, err := tx.Exec("UPDATE cupones SET usos = usos - 1 WHERE id_cupon = ? AND usos > 0", pedido.IDCupon); err != nil {
+			log.Println("Error al descontar el uso del cupón", err)
+			return CambioEstado{}, err
+		}
+		if _, err := tx.Exec("DELETE FROM cupon_usos WHERE id_pedido = ?", idPedido); err != nil {
+			log.Println("Error al liberar el uso del cupón", err)
+			return CambioEstado{}, err
+		}
+	}
+
+	detalles, err := lineasStockPedido(tx, idPedido)
+	if err != nil {
+		return CambioEstado{}, err
+	}
+	for _, d := range detalles {
+		// Como al reponer stock, las variantes borradas no vuelven.
+		if d.Variante != "" && d.IDVariante == 0 {
+			continue
+		}
+		_, err := tx.Exec(`INSERT INTO items_carrito (id_carrito, id_producto, id_variante, cantidad) VALUES (?, ?, ?, ?) AS nuevo
+			ON DUPLICATE KEY UPDATE cantidad = items_carrito.cantidad + nuevo.cantidad`, idCarrito, d.IDProducto, nullID(d.IDVariante), d.Cantidad)
+		if err != nil {
+			log.Println("Error al devolver el item al carrito", err)
+			return CambioEstado{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return CambioEstado{}, err
+	}
+	log.Println("Checkout anulado, pedido:", idPedido)
+	return cambio, nil
+}
+
+// pesoLineas devuelve el peso total en kg de las líneas.
+func pesoLineas(lineas []lineaCheckout) float64 {
+	var peso float64
+	for _, l := range lineas {
+		peso += l.Peso * float64(l.Cantidad)
+	}
+	return peso
+}
+
+// nullString convierte el texto vacío en NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// nullMonto convierte el importe 0 en NULL.
+func nullMonto(m dinero.Monto) interface{} {
+	if m == 0 {
+		return nil
+	}
+	return m
+}
+
+// CreditoAplicable es la parte del total que se paga con el saldo de
+// crédito del cliente: todo el saldo, hasta cubrir el total.
+func CreditoAplicable(saldo, total dinero.Monto) dinero.Monto {
+	if saldo <= 0 {
+		return 0
+	}
+	return dinero.Min(saldo, total)
+}
+
+// insertarMovimientoCredito registra un movimiento del crédito del cliente
+// ligado a un pedido: negativo al usarlo, positivo al devolverlo.
+func insertarMovimientoCredito(tx *sql.Tx, idCliente int, monto dinero.Monto, concepto string, idPedido int) error {
+	if _, err := tx.Exec("INSERT INTO creditos_clientes (id_cliente, monto, concepto, id_pedido) VALUES (?, ?, ?, ?)", idCliente, monto, concepto, idPedido); err != nil {
+		log.Println("Error al registrar el movimiento de crédito", err)
+		return err
+	}
+	return nil
+}
+
+// estadoInicial es el estado con que se crea un pedido: PENDIENTE hasta que
+// se cobre, o PAGADO si no hay nada que cobrar por la pasarela.
+func estadoInicial(aCobrar dinero.Monto) string {
+	if aCobrar == 0 {
+		return EstadoPagado
+	}
+	return EstadoPendiente
+}
+
+// motivoCreacion es el motivo de la primera entrada del historial.
+func motivoCreacion(estado string) string {
+	if estado == EstadoPagado {
+		return "Pedido creado y pagado"
+	}
+	return "Pedido creado"
+}
+
+// cuponCheckout bloquea el cupón con ese código hasta el fin de la
+// transacción, lo verifica para el cliente y reparte el descuento en las
+// líneas. Devuelve el cupón y el descuento total.
+func cuponCheckout(tx *sql.Tx, codigo string, idCliente int, lineas []lineaCheckout, categorias []Categoria, ahora time.Time) (Cupon, dinero.Monto, error) {
+	cupon, err := scanCupon(tx.QueryRow("SELECT "+columnasCupon+" FROM cupones WHERE codigo = ? FOR UPDATE", codigo).Scan)
+	if err == sql.ErrNoRows {
+		return Cupon{}, 0, fmt.Errorf("%w: el cupón %s no existe", ErrCuponInvalido, codigo)
+	}
+	if err != nil {
+		log.Println("Error al bloquear el cupón", err)
+		return Cupon{}, 0, err
+	}
+	if err := restriccionesCupon(tx, &cupon); err != nil {
+		return Cupon{}, 0, err
+	}
+	var usosCliente int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM cupon_usos WHERE id_cupon = ? AND id_cliente = ?", cupon.ID, idCliente).Scan(&usosCliente); err != nil {
+		log.Println("Error al contar los usos del cupón", err)
+		return Cupon{}, 0, err
+	}
+
+	descuento, err := aplicarCuponLineas(cupon, lineas, categorias, usosCliente, ahora)
+	return cupon, descuento, err
+}
+
+// categoriasLineas completa las categorías de cada línea y devuelve el árbol
+// completo de categorías, que las promociones y los cupones necesitan para
+// incluir las subcategorías.
+func categoriasLineas(tx *sql.Tx, lineas []lineaCheckout) ([]Categoria, error) {
+	ids := make([]interface{}, len(lineas))
+	for i, l := range lineas {
+		ids[i] = l.IDProducto
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err := tx.Query("SELECT id_producto, id_categoria FROM producto_categorias WHERE id_producto IN ("+placeholders+")", ids...)
+	if err != nil {
+		log.Println("Error al leer las categorías de los productos", err)
+		return nil, err
+	}
+	porProducto := map[int][]int{}
+	for rows.Next() {
+		var idProducto, idCategoria int
+		if err := rows.Scan(&idProducto, &idCategoria); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		porProducto[idProducto] = append(porProducto[idProducto], idCategoria)
+	}
+	rows.Close()
+	for i := range lineas {
+		lineas[i].Categorias = porProducto[lineas[i].IDProducto]
+	}
+
+	// El árbol no necesita bloqueo: se lee fuera de la transacción.
+	return GetAllCategorias()
+}
+
+// aplicarPromocionesLineas evalúa las promociones sobre las líneas y deja en
+// cada una su ahorro.
+func aplicarPromocionesLineas(promociones []Promocion, lineas []lineaCheckout, categorias []Categoria, ahora time.Time) ResultadoPromociones {
+	promocion := make([]LineaPromocion, len(lineas))
+	for i, l := range lineas {
+		promocion[i] = LineaPromocion{IDProducto: l.IDProducto, Categorias: l.Categorias, Precio: l.Precio, Cantidad: l.Cantidad}
+	}
+	resultado := EvaluarPromociones(promociones, promocion, categorias, ahora)
+	for i := range lineas {
+		lineas[i].DescuentoPromocion = resultado.PorLinea[i]
+	}
+	return resultado
+}
+
+// aplicarCuponLineas verifica el cupón para el pedido y deja en cada línea su
+// parte del descuento. El cupón se calcula sobre lo que queda después de las
+// promociones. Devuelve el descuento total.
+func aplicarCuponLineas(cupon Cupon, lineas []lineaCheckout, categorias []Categoria, usosCliente int, ahora time.Time) (dinero.Monto, error) {
+	var subtotal dinero.Monto
+	descuento := make([]LineaDescuento, len(lineas))
+	for i, l := range lineas {
+		descuento[i] = LineaDescuento{IDProducto: l.IDProducto, Categorias: l.Categorias, Subtotal: l.Precio.Por(l.Cantidad) - l.DescuentoPromocion}
+		subtotal += descuento[i].Subtotal
+	}
+	if err := cupon.Verificar(ahora, subtotal, usosCliente); err != nil {
+		return 0, err
+	}
+	porLinea, total, err := cupon.Aplicar(descuento, categorias)
+	if err != nil {
+		return 0, err
+	}
+	for i := range lineas {
+		lineas[i].Descuento = porLinea[i]
+	}
+	return total, nil
+}
+
+// aplicarImpuestosLineas deja en cada línea su clase de impuesto y el
+// impuesto sobre lo que paga, ya con las promociones y el cupón, y devuelve
+// el desglose.
+func aplicarImpuestosLineas(clases []ClaseImpuesto, lineas []lineaCheckout) *DesgloseImpuestos {
+	impuestos := NuevoDesgloseImpuestos()
+	for i, l := range lineas {
+		lineas[i].Clase = ClaseDeProducto(clases, l.IDClaseImpuesto)
+		lineas[i].Impuesto = impuestos.Agregar(lineas[i].Clase, l.Precio.Por(l.Cantidad)-l.DescuentoPromocion-l.Descuento)
+	}
+	return impuestos
+}
+
+// validarLineas comprueba que cada línea tenga stock suficiente y producto
+// activo, y devuelve el total del pedido. Reúne todos los problemas en un
+// único StockInsuficienteError para poder informarlos de una vez.
+func validarLineas(lineas []lineaCheckout) (dinero.Monto, error) {
+	if len(lineas) == 0 {
+		return 0, ErrCarritoVacio
+	}
+	var sinStock []ItemSinStock
+	var total dinero.Monto
+	for _, l := range lineas {
+		if !l.Activo || l.SinVariante || l.Cantidad > l.Stock {
+			sinStock = append(sinStock, ItemSinStock{
+				IDProducto:  l.IDProducto,
+				IDVariante:  l.IDVariante,
+				Nombre:      l.nombreLinea(),
+				Solicitado:  l.Cantidad,
+				Disponible:  l.Stock,
+				Inactivo:    !l.Activo,
+				SinVariante: l.SinVariante,
+			})
+			continue
+		}
+		total += l.Precio.Por(l.Cantidad)
+	}
+	if len(sinStock) > 0 {
+		return 0, &StockInsuficienteError{Items: sinStock}
+	}
+	return total, nil
+}
+
+// lockLineasCarrito lee las líneas del carrito agrupadas por producto y
+// variante, y bloquea las filas de `productos` y `variantes_producto` hasta el
+// fin de la transacción. Se ordena por ID (primero productos, luego variantes)
+// para que dos checkouts concurrentes tomen los bloqueos en el mismo orden.
+func lockLineasCarrito(tx *sql.Tx, idCarrito int) ([]lineaCheckout, error) {
+	rows, err := tx.Query("SELECT id_producto, COALESCE(id_variante, 0), SUM(cantidad) FROM items_carrito WHERE id_carrito = ? GROUP BY id_producto, id_variante ORDER BY id_producto, id_variante", idCarrito)
+	if err != nil {
+		log.Println("Error al leer el carrito", err)
+		return nil, err
+	}
+	var lineas []lineaCheckout
+	var ids, idsVariante []interface{}
+	vistos := map[int]bool{}
+	for rows.Next() {
+		var l lineaCheckout
+		if err := rows.Scan(&l.IDProducto, &l.IDVariante, &l.Cantidad); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		lineas = append(lineas, l)
+		if !vistos[l.IDProducto] {
+			vistos[l.IDProducto] = true
+			ids = append(ids, l.IDProducto)
+		}
+		if l.IDVariante != 0 {
+			idsVariante = append(idsVariante, l.IDVariante)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(lineas) == 0 {
+		return lineas, nil
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(ids)), ",")
+	rows, err = tx.Query("SELECT id_producto, nombre, precio, peso, COALESCE(id_clase_impuesto, 0), stock, activo FROM productos WHERE id_producto IN ("+placeholders+") ORDER BY id_producto FOR UPDATE", ids...)
+	if err != nil {
+		log.Println("Error al bloquear productos", err)
+		return nil, err
+	}
+	bloqueados := make(map[int]lineaCheckout, len(lineas))
+	for rows.Next() {
+		var l lineaCheckout
+		if err := rows.Scan(&l.IDProducto, &l.Nombre, &l.Precio, &l.Peso, &l.IDClaseImpuesto, &l.Stock, &l.Activo); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		bloqueados[l.IDProducto] = l
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	variantes, conVariantes, err := lockVariantes(tx, ids, idsVariante)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, l := range lineas {
+		p := bloqueados[l.IDProducto]
+		lineas[i].Nombre = p.Nombre
+		lineas[i].Precio = p.Precio
+		lineas[i].Peso = p.Peso
+		lineas[i].IDClaseImpuesto = p.IDClaseImpuesto
+		lineas[i].Stock = p.Stock
+		lineas[i].Activo = p.Activo
+		if l.IDVariante == 0 {
+			// El producto pasó a tener variantes después de agregarse al carrito.
+			lineas[i].SinVariante = conVariantes[l.IDProducto]
+			continue
+		}
+		v := variantes[l.IDVariante]
+		lineas[i].Variante = v.Descripcion()
+		lineas[i].Precio = v.PrecioPara(Producto{Precio: p.Precio})
+		lineas[i].Stock = v.Stock
+		lineas[i].Activo = p.Activo && v.Activo
+	}
+	return lineas, nil
+}
+
+// lockVariantes bloquea las variantes del carrito y carga sus valores para
+// describirlas. También indica qué productos del carrito tienen variantes.
+func lockVariantes(tx *sql.Tx, idsProducto, idsVariante []interface{}) (map[int]VarianteProducto, map[int]bool, error) {
+	variantes := map[int]VarianteProducto{}
+	conVariantes := map[int]bool{}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(idsProducto)), ",")
+	rows, err := tx.Query("SELECT DISTINCT id_producto FROM variantes_producto WHERE id_producto IN ("+placeholders+")", idsProducto...)
+	if err != nil {
+		log.Println("Error al leer las variantes", err)
+		return nil, nil, err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, nil, err
+		}
+		conVariantes[id] = true
+	}
+	rows.Close()
+	if len(idsVariante) == 0 {
+		return variantes, conVariantes, nil
+	}
+
+	placeholders = strings.TrimSuffix(strings.Repeat("?,", len(idsVariante)), ",")
+	rows, err = tx.Query("SELECT "+columnasVariante+" FROM variantes_producto WHERE id_variante IN ("+placeholders+") ORDER BY id_variante FOR UPDATE", idsVariante...)
+	if err != nil {
+		log.Println("Error al bloquear variantes", err)
+		return nil, nil, err
+	}
+	for rows.Next() {
+		v, err := scanVariante(rows.Scan)
+		if err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, nil, err
+		}
+		variantes[v.ID] = v
+	}
+	rows.Close()
+
+	rows, err = tx.Query(`SELECT vv.id_variante, o.nombre, v.valor
+		FROM variante_valores vv
+		JOIN valores_opcion v ON v.id_valor = vv.id_valor
+		JOIN opciones_producto o ON o.id_opcion = v.id_opcion
+		WHERE vv.id_variante IN (`+placeholders+`) ORDER BY o.orden, o.id_opcion`, idsVariante...)
+	if err != nil {
+		log.Println("Error al leer los valores de las variantes", err)
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var valor ValorOpcion
+		if err := rows.Scan(&id, &valor.Opcion, &valor.Valor); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, nil, err
+		}
+		v := variantes[id]
+		v.Valores = append(v.Valores, valor)
+		variantes[id] = v
+	}
+	return variantes, conVariantes, rows.Err()
+}
@@ -1,13 +1,19 @@
 package models
 
 import (
-	"Go-Sistemas-de-Gestion-empresarial/db"
 	"database/sql"
 	"fmt"
 	"log"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
+// bcryptCost es el costo usado al generar nuevos hashes de contraseña.
+// Se puede ajustar con SetBcryptCost (p. ej. desde la variable `BCRYPT_COST`).
+var bcryptCost = bcrypt.DefaultCost
+
 // Cliente representa a un usuario registrado en el sistema.
 type Cliente struct {
 	ID                 int       // Identificador único del cliente
@@ -21,24 +27,55 @@ type Cliente struct {
 	FechaActualizacion time.Time // Fecha de la última actualización de datos
 }
 
+// SetBcryptCost cambia el costo de bcrypt usado para los nuevos hashes.
+// Devuelve error si el costo está fuera del rango admitido por bcrypt.
+func SetBcryptCost(cost int) error {
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		return fmt.Errorf("costo de bcrypt inválido: %d (rango %d-%d)", cost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	bcryptCost = cost
+	return nil
+}
+
+// HashPassword genera el hash bcrypt de una contraseña en texto plano.
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("error generando hash: %w", err)
+	}
+	return string(hash), nil
+}
+
+// isBcryptHash indica si el valor almacenado tiene formato de hash bcrypt.
+// Los registros antiguos guardaban la contraseña en texto plano.
+func isBcryptHash(hash string) bool {
+	return strings.HasPrefix(hash, "$2a$") || strings.HasPrefix(hash, "$2b$") || strings.HasPrefix(hash, "$2y$")
+}
+
 // VerifyPassword verifica si la contraseña proporcionada coincide con el hash almacenado.
-// Esto encapsula la lógica de verificación de contraseñas.
+// Esto encapsula la lógica de verificación de contraseñas. Los hashes heredados en
+// texto plano se comparan directamente para poder migrarlos en el siguiente login.
 func (c *Cliente) VerifyPassword(password string) bool {
-	// En un escenario real, aquí usaríamos bcrypt.CompareHashAndPassword
-	return c.PasswordHash == password
+	if !isBcryptHash(c.PasswordHash) {
+		return c.PasswordHash != "" && c.PasswordHash == password
+	}
+	return bcrypt.CompareHashAndPassword([]byte(c.PasswordHash), []byte(password)) == nil
+}
+
+// NeedsRehash indica si el hash almacenado debe regenerarse: porque es texto
+// plano heredado o porque fue generado con un costo distinto al configurado.
+func (c *Cliente) NeedsRehash() bool {
+	if !isBcryptHash(c.PasswordHash) {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(c.PasswordHash))
+	return err != nil || cost != bcryptCost
 }
 
 // GetClienteByID obtiene un cliente por su ID desde la base de datos.
 func GetClienteByID(id int) (Cliente, error) {
 	var cliente Cliente
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return cliente, fmt.Errorf("error de conexión: %w", err)
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("SELECT id_cliente, nombre, email, password_hash, direccion, telefono, perfil, fecha_registro, fecha_actualizacion FROM clientes WHERE id_cliente = ?")
+	stmt, err := pool.Prepare("SELECT id_cliente, nombre, email, password_hash, direccion, telefono, perfil, fecha_registro, fecha_actualizacion FROM clientes WHERE id_cliente = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return cliente, fmt.Errorf("error preparando consulta: %w", err)
@@ -67,14 +104,7 @@ func GetClienteByID(id int) (Cliente, error) {
 // GetClienteByEmail recupera un cliente usando su dirección de correo electrónico.
 func GetClienteByEmail(email string) (Cliente, error) {
 	var cliente Cliente
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return cliente, fmt.Errorf("error de conexión: %w", err)
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("SELECT id_cliente, nombre, email, password_hash, direccion, telefono, perfil, fecha_registro, fecha_actualizacion FROM clientes WHERE email = ?")
+	stmt, err := pool.Prepare("SELECT id_cliente, nombre, email, password_hash, direccion, telefono, perfil, fecha_registro, fecha_actualizacion FROM clientes WHERE email = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return cliente, fmt.Errorf("error preparando consulta: %w", err)
@@ -102,14 +132,7 @@ func GetClienteByEmail(email string) (Cliente, error) {
 // GetAllClientes devuelve una lista de todos los clientes registrados.
 func GetAllClientes() ([]Cliente, error) {
 	var clientes []Cliente
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return clientes, fmt.Errorf("error de conexión: %w", err)
-	}
-	defer DB.Close()
-
-	rows, err := DB.Query("SELECT id_cliente, nombre, email, password_hash, direccion, telefono, perfil, fecha_registro, fecha_actualizacion FROM clientes")
+	rows, err := pool.Query("SELECT id_cliente, nombre, email, password_hash, direccion, telefono, perfil, fecha_registro, fecha_actualizacion FROM clientes")
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return clientes, fmt.Errorf("error ejecutando consulta: %w", err)
@@ -140,15 +163,9 @@ func GetAllClientes() ([]Cliente, error) {
 }
 
 // CreateCliente registra un nuevo cliente en la base de datos.
+// `passwordHash` debe ser el resultado de HashPassword, nunca la contraseña en claro.
 func CreateCliente(nombre, email, passwordHash, direccion, telefono string) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return fmt.Errorf("error de conexión: %w", err)
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("INSERT INTO clientes (nombre, email, password_hash, direccion, telefono, perfil) VALUES (?, ?, ?, ?, ?, 'cliente')")
+	stmt, err := pool.Prepare("INSERT INTO clientes (nombre, email, password_hash, direccion, telefono, perfil) VALUES (?, ?, ?, ?, ?, 'cliente')")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return fmt.Errorf("error preparando consulta: %w", err)
@@ -166,14 +183,7 @@ func CreateCliente(nombre, email, passwordHash, direccion, telefono string) erro
 
 // UpdateCliente actualiza los datos de un cliente existente.
 func UpdateCliente(id int, nombre, email, direccion, telefono string) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return fmt.Errorf("error de conexión: %w", err)
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("UPDATE clientes SET nombre = ?, email = ?, direccion = ?, telefono = ? WHERE id_cliente = ?")
+	stmt, err := pool.Prepare("UPDATE clientes SET nombre = ?, email = ?, direccion = ?, telefono = ? WHERE id_cliente = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return fmt.Errorf("error preparando consulta: %w", err)
@@ -189,16 +199,27 @@ func UpdateCliente(id int, nombre, email, direccion, telefono string) error {
 	return nil
 }
 
-// DeleteCliente elimina un cliente de la base de datos por su ID.
-func DeleteCliente(id int) error {
-	DB, err := db.Connect()
+// UpdatePasswordHash reemplaza el hash de contraseña almacenado de un cliente.
+func UpdatePasswordHash(id int, passwordHash string) error {
+	stmt, err := pool.Prepare("UPDATE clientes SET password_hash = ? WHERE id_cliente = ?")
 	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return fmt.Errorf("error de conexión: %w", err)
+		log.Println("Error al preparar la consulta sql", err)
+		return fmt.Errorf("error preparando consulta: %w", err)
 	}
-	defer DB.Close()
+	defer stmt.Close()
 
-	stmt, err := DB.Prepare("DELETE FROM clientes WHERE id_cliente = ?")
+	_, err = stmt.Exec(passwordHash, id)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return fmt.Errorf("error ejecutando actualización: %w", err)
+	}
+	log.Println("Hash de contraseña actualizado para cliente", id)
+	return nil
+}
+
+// DeleteCliente elimina un cliente de la base de datos por su ID.
+func DeleteCliente(id int) error {
+	stmt, err := pool.Prepare("DELETE FROM clientes WHERE id_cliente = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return fmt.Errorf("error preparando consulta: %w", err)
@@ -214,9 +235,10 @@ func DeleteCliente(id int) error {
 	return nil
 }
 
-// Login autentica a un usuario verificando su email y contraseña.
-func Login(email, password string) (Cliente, error) {
-	cliente, err := GetClienteByEmail(email)
+// Login autentica a un usuario verificando su email y contraseña contra el
+// repositorio indicado.
+func Login(repo ClienteRepository, email, password string) (Cliente, error) {
+	cliente, err := repo.GetByEmail(email)
 	if err != nil {
 		return Cliente{}, err
 	}
@@ -226,5 +248,20 @@ func Login(email, password string) (Cliente, error) {
 		return Cliente{}, fmt.Errorf("contraseña incorrecta")
 	}
 
+	// Migración transparente: los hashes en texto plano o con otro costo se
+	// regeneran ahora que conocemos la contraseña correcta.
+	if cliente.NeedsRehash() {
+		hash, err := HashPassword(password)
+		if err != nil {
+			log.Println("Error regenerando hash de contraseña:", err)
+			return cliente, nil
+		}
+		if err := repo.UpdatePasswordHash(cliente.ID, hash); err != nil {
+			log.Println("Error guardando hash regenerado:", err)
+			return cliente, nil
+		}
+		cliente.PasswordHash = hash
+	}
+
 	return cliente, nil
 }
@@ -0,0 +1,396 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Tipos de cupón.
+const (
+	CuponPorcentaje = "PORCENTAJE"
+	CuponMonto      = "MONTO"
+)
+
+// ErrCuponInvalido envuelve los motivos por los que un cupón no se puede
+// aplicar a un pedido. El mensaje está pensado para mostrarse al cliente.
+var ErrCuponInvalido = errors.New("cupón no válido")
+
+// Cupon es un código de descuento. Sin Productos ni Categorias se aplica a
+// todo el carrito; si no, solo a las líneas de esos productos o de esas
+// categorías (incluidas sus subcategorías). Los límites en 0 y las fechas
+// vacías significan "sin límite".
+type Cupon struct {
+	ID          int
+	Codigo      string
+	Descripcion string
+	Tipo        string
+	// Porcentaje es el descuento de los cupones PORCENTAJE y Monto el de
+	// los MONTO; el otro queda en 0.
+	Porcentaje     float64
+	Monto          dinero.Monto
+	MinimoCompra   dinero.Monto
+	ValidoDesde    time.Time
+	ValidoHasta    time.Time
+	UsosMaximos    int
+	UsosPorCliente int
+	// Usos cuenta los pedidos que ya usaron el cupón.
+	Usos       int
+	Activo     bool
+	Productos  []int
+	Categorias []int
+}
+
+// NormalizarCodigo pasa un código a la forma en que se guarda: sin espacios
+// alrededor y en mayúsculas.
+func NormalizarCodigo(codigo string) string {
+	return strings.ToUpper(strings.TrimSpace(codigo))
+}
+
+// Restringido indica si el cupón se limita a ciertos productos o categorías.
+func (c Cupon) Restringido() bool {
+	return len(c.Productos) > 0 || len(c.Categorias) > 0
+}
+
+// ValidarCupon comprueba los datos de un cupón antes de guardarlo.
+func ValidarCupon(c Cupon) error {
+	switch {
+	case c.Codigo == "" || utf8.RuneCountInString(c.Codigo) > 40 || strings.ContainsAny(c.Codigo, " \t"):
+		return fmt.Errorf("el código es obligatorio, de hasta 40 caracteres y sin espacios")
+	case c.Tipo != CuponPorcentaje && c.Tipo != CuponMonto:
+		return fmt.Errorf("tipo de cupón desconocido: %q", c.Tipo)
+	case c.Tipo == CuponPorcentaje && (c.Porcentaje <= 0 || c.Monto != 0):
+		return fmt.Errorf("el porcentaje de descuento debe ser mayor que 0")
+	case c.Tipo == CuponPorcentaje && c.Porcentaje > 100:
+		return fmt.Errorf("un porcentaje no puede superar el 100%%")
+	case c.Tipo == CuponMonto && (c.Monto <= 0 || c.Porcentaje != 0):
+		return fmt.Errorf("el monto del descuento debe ser mayor que 0")
+	case c.MinimoCompra < 0:
+		return fmt.Errorf("el pedido mínimo no puede ser negativo")
+	case c.UsosMaximos < 0 || c.UsosPorCliente < 0:
+		return fmt.Errorf("los límites de uso no pueden ser negativos")
+	case !c.ValidoDesde.IsZero() && !c.ValidoHasta.IsZero() && !c.ValidoHasta.After(c.ValidoDesde):
+		return fmt.Errorf("la fecha de fin debe ser posterior a la de inicio")
+	}
+	return nil
+}
+
+// LineaDescuento es una línea del carrito vista por el motor de descuentos:
+// el producto, sus categorías y el importe de la línea.
+type LineaDescuento struct {
+	IDProducto int
+	Categorias []int
+	Subtotal   dinero.Monto
+}
+
+// Verificar comprueba que el cupón pueda usarse ahora, por un cliente que ya
+// lo usó `usosCliente` veces, en un pedido de `subtotal`.
+func (c Cupon) Verificar(ahora time.Time, subtotal dinero.Monto, usosCliente int) error {
+	switch {
+	case !c.Activo:
+		return fmt.Errorf("%w: el cupón %s no está activo", ErrCuponInvalido, c.Codigo)
+	case !c.ValidoDesde.IsZero() && ahora.Before(c.ValidoDesde):
+		return fmt.Errorf("%w: el cupón %s todavía no está vigente", ErrCuponInvalido, c.Codigo)
+	case !c.ValidoHasta.IsZero() && !ahora.Before(c.ValidoHasta):
+		return fmt.Errorf("%w: el cupón %s venció", ErrCuponInvalido, c.Codigo)
+	case c.UsosMaximos > 0 && c.Usos >= c.UsosMaximos:
+		return fmt.Errorf("%w: el cupón %s ya se agotó", ErrCuponInvalido, c.Codigo)
+	case c.UsosPorCliente > 0 && usosCliente >= c.UsosPorCliente:
+		return fmt.Errorf("%w: ya usaste el cupón %s el máximo de veces permitido", ErrCuponInvalido, c.Codigo)
+	case subtotal < c.MinimoCompra:
+		return fmt.Errorf("%w: el cupón %s requiere una compra mínima de %s", ErrCuponInvalido, c.Codigo, c.MinimoCompra.Formato())
+	}
+	return nil
+}
+
+// Aplicar calcula el descuento del cupón sobre las líneas y lo reparte entre
+// las elegibles en proporción a su importe (ver repartir). `categorias` es el
+// árbol completo, para incluir las subcategorías de las categorías del cupón.
+// Devuelve el descuento por línea, en el mismo orden, y el total.
+func (c Cupon) Aplicar(lineas []LineaDescuento, categorias []Categoria) ([]dinero.Monto, dinero.Monto, error) {
+	productos := map[int]bool{}
+	for _, id := range c.Productos {
+		productos[id] = true
+	}
+	enCategoria := map[int]bool{}
+	for _, id := range c.Categorias {
+		for _, d := range Descendientes(categorias, id) {
+			enCategoria[d] = true
+		}
+	}
+
+	importes := make([]dinero.Monto, len(lineas))
+	var base dinero.Monto
+	for i, l := range lineas {
+		elegible := !c.Restringido() || productos[l.IDProducto]
+		for _, idCategoria := range l.Categorias {
+			elegible = elegible || enCategoria[idCategoria]
+		}
+		if elegible && l.Subtotal > 0 {
+			importes[i] = l.Subtotal
+			base += l.Subtotal
+		}
+	}
+	if base == 0 {
+		return nil, 0, fmt.Errorf("%w: el cupón %s no aplica a ningún producto del carrito", ErrCuponInvalido, c.Codigo)
+	}
+
+	total := c.Monto
+	if c.Tipo == CuponPorcentaje {
+		total = base.Porcentaje(c.Porcentaje)
+	}
+	total = dinero.Min(total, base)
+
+	return repartir(total, importes), total, nil
+}
+
+// repartir divide `total` entre las líneas en proporción a sus importes,
+// redondeado a centavos; la diferencia del redondeo va a la última línea con
+// importe. Las líneas con importe 0 no reciben nada.
+func repartir(total dinero.Monto, importes []dinero.Monto) []dinero.Monto {
+	var base dinero.Monto
+	ultima := -1
+	for i, importe := range importes {
+		if importe > 0 {
+			base += importe
+			ultima = i
+		}
+	}
+	partes := make([]dinero.Monto, len(importes))
+	var repartido dinero.Monto
+	for i, importe := range importes {
+		if importe <= 0 {
+			continue
+		}
+		if i == ultima {
+			partes[i] = total - repartido
+			break
+		}
+		partes[i] = total.Proporcion(importe.Centavos(), base.Centavos())
+		repartido += partes[i]
+	}
+	return partes
+}
+
+// columnasCupon son las columnas que lee scanCupon, en orden.
+const columnasCupon = "id_cupon, codigo, descripcion, tipo, porcentaje, monto, minimo_compra, valido_desde, valido_hasta, usos_maximos, usos_por_cliente, usos, activo"
+
+// scanCupon lee una fila con columnasCupon.
+func scanCupon(scan func(dest ...interface{}) error) (Cupon, error) {
+	var c Cupon
+	var descripcion sql.NullString
+	var porcentaje sql.NullFloat64
+	var desde, hasta sql.NullTime
+	var usosMaximos, usosPorCliente sql.NullInt64
+	err := scan(&c.ID, &c.Codigo, &descripcion, &c.Tipo, &porcentaje, &c.Monto, &c.MinimoCompra, &desde, &hasta, &usosMaximos, &usosPorCliente, &c.Usos, &c.Activo)
+	c.Descripcion = descripcion.String
+	c.Porcentaje = porcentaje.Float64
+	c.ValidoDesde = desde.Time
+	c.ValidoHasta = hasta.Time
+	c.UsosMaximos = int(usosMaximos.Int64)
+	c.UsosPorCliente = int(usosPorCliente.Int64)
+	return c, err
+}
+
+// argsCupon devuelve los valores de las columnas editables del cupón, en el
+// orden de INSERT y UPDATE.
+func argsCupon(c Cupon) []interface{} {
+	return []interface{}{
+		NormalizarCodigo(c.Codigo),
+		sql.NullString{String: c.Descripcion, Valid: c.Descripcion != ""},
+		c.Tipo, sql.NullFloat64{Float64: c.Porcentaje, Valid: c.Tipo == CuponPorcentaje}, nullMonto(c.Monto), c.MinimoCompra,
+		sql.NullTime{Time: c.ValidoDesde, Valid: !c.ValidoDesde.IsZero()},
+		sql.NullTime{Time: c.ValidoHasta, Valid: !c.ValidoHasta.IsZero()},
+		nullID(c.UsosMaximos), nullID(c.UsosPorCliente),
+		c.Activo,
+	}
+}
+
+// restriccionesCupon carga los productos y categorías a los que se limita el cupón.
+func restriccionesCupon(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, c *Cupon) error {
+	consultas := []struct {
+		sql  string
+		dest *[]int
+	}{
+		{"SELECT id_producto FROM cupon_productos WHERE id_cupon = ? ORDER BY id_producto", &c.Productos},
+		{"SELECT id_categoria FROM cupon_categorias WHERE id_cupon = ? ORDER BY id_categoria", &c.Categorias},
+	}
+	for _, consulta := range consultas {
+		rows, err := q.Query(consulta.sql, c.ID)
+		if err != nil {
+			log.Println("Error al leer las restricciones del cupón", err)
+			return err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				log.Println("Error al escanear la consulta sql", err)
+				return err
+			}
+			*consulta.dest = append(*consulta.dest, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetAllCupones devuelve todos los cupones, los más nuevos primero.
+func GetAllCupones() ([]Cupon, error) {
+	var cupones []Cupon
+	rows, err := pool.Query("SELECT " + columnasCupon + " FROM cupones ORDER BY id_cupon DESC")
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return cupones, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		c, err := scanCupon(rows.Scan)
+		if err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return cupones, err
+		}
+		cupones = append(cupones, c)
+	}
+	if err := rows.Err(); err != nil {
+		return cupones, err
+	}
+	for i := range cupones {
+		if err := restriccionesCupon(pool, &cupones[i]); err != nil {
+			return cupones, err
+		}
+	}
+	return cupones, nil
+}
+
+// GetCuponByID devuelve un cupón con sus restricciones.
+func GetCuponByID(id int) (Cupon, error) {
+	c, err := scanCupon(pool.QueryRow("SELECT "+columnasCupon+" FROM cupones WHERE id_cupon = ?", id).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c, fmt.Errorf("cupón no encontrado con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return c, err
+	}
+	return c, restriccionesCupon(pool, &c)
+}
+
+// GetCuponByCodigo devuelve el cupón con ese código (sin distinguir
+// mayúsculas). Si no existe devuelve un error que envuelve ErrCuponInvalido.
+func GetCuponByCodigo(codigo string) (Cupon, error) {
+	c, err := scanCupon(pool.QueryRow("SELECT "+columnasCupon+" FROM cupones WHERE codigo = ?", NormalizarCodigo(codigo)).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return c, fmt.Errorf("%w: el cupón %s no existe", ErrCuponInvalido, NormalizarCodigo(codigo))
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return c, err
+	}
+	return c, restriccionesCupon(pool, &c)
+}
+
+// guardarRestriccionesCupon reemplaza los productos y categorías del cupón.
+func guardarRestriccionesCupon(tx *sql.Tx, c Cupon) error {
+	if _, err := tx.Exec("DELETE FROM cupon_productos WHERE id_cupon = ?", c.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM cupon_categorias WHERE id_cupon = ?", c.ID); err != nil {
+		return err
+	}
+	for _, id := range c.Productos {
+		if _, err := tx.Exec("INSERT INTO cupon_productos (id_cupon, id_producto) VALUES (?, ?)", c.ID, id); err != nil {
+			return err
+		}
+	}
+	for _, id := range c.Categorias {
+		if _, err := tx.Exec("INSERT INTO cupon_categorias (id_cupon, id_categoria) VALUES (?, ?)", c.ID, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateCupon inserta un cupón con sus restricciones.
+func CreateCupon(c Cupon) error {
+	if err := ValidarCupon(c); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO cupones (codigo, descripcion, tipo, porcentaje, monto, minimo_compra, valido_desde, valido_hasta, usos_maximos, usos_por_cliente, activo) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", argsCupon(c)...)
+	if err != nil {
+		log.Println("Error al crear el cupón", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = int(id)
+	if err := guardarRestriccionesCupon(tx, c); err != nil {
+		log.Println("Error al guardar las restricciones del cupón", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateCupon modifica un cupón y reemplaza sus restricciones. No toca el
+// contador de usos.
+func UpdateCupon(c Cupon) error {
+	if err := ValidarCupon(c); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	args := append(argsCupon(c), c.ID)
+	if _, err := tx.Exec("UPDATE cupones SET codigo = ?, descripcion = ?, tipo = ?, porcentaje = ?, monto = ?, minimo_compra = ?, valido_desde = ?, valido_hasta = ?, usos_maximos = ?, usos_por_cliente = ?, activo = ? WHERE id_cupon = ?", args...); err != nil {
+		log.Println("Error al actualizar el cupón", err)
+		return err
+	}
+	if err := guardarRestriccionesCupon(tx, c); err != nil {
+		log.Println("Error al guardar las restricciones del cupón", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteCupon elimina un cupón. Los pedidos que lo usaron conservan el código.
+func DeleteCupon(id int) error {
+	if _, err := pool.Exec("DELETE FROM cupones WHERE id_cupon = ?", id); err != nil {
+		log.Println("Error al eliminar el cupón", err)
+		return err
+	}
+	return nil
+}
+
+// GetUsosCuponCliente cuenta los pedidos de un cliente que usaron el cupón.
+func GetUsosCuponCliente(idCupon, idCliente int) (int, error) {
+	var n int
+	err := pool.QueryRow("SELECT COUNT(*) FROM cupon_usos WHERE id_cupon = ? AND id_cliente = ?", idCupon, idCliente).Scan(&n)
+	if err != nil {
+		log.Println("Error al contar los usos del cupón", err)
+	}
+	return n, err
+}
@@ -0,0 +1,132 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRepartir(t *testing.T) {
+	casos := []struct {
+		total    dinero.Monto
+		importes []dinero.Monto
+		esperado []dinero.Monto
+	}{
+		{300, []dinero.Monto{1000, 2000}, []dinero.Monto{100, 200}},
+		{100, []dinero.Monto{1, 1, 1}, []dinero.Monto{33, 33, 34}},
+		{200, []dinero.Monto{1, 1, 1}, []dinero.Monto{67, 67, 66}},
+		{100, []dinero.Monto{0, 500, 0, 500, 0}, []dinero.Monto{0, 50, 0, 50, 0}},
+		{100, []dinero.Monto{0, 0}, []dinero.Monto{0, 0}},
+		{0, []dinero.Monto{700, 300}, []dinero.Monto{0, 0}},
+	}
+	for _, c := range casos {
+		if got := repartir(c.total, c.importes); !reflect.DeepEqual(got, c.esperado) {
+			t.Errorf("repartir(%v, %v) = %v; se esperaba %v", c.total, c.importes, got, c.esperado)
+		}
+	}
+
+	// Con cualquier reparto las partes suman exactamente el total.
+	importes := []dinero.Monto{999, 1, 333, 0, 12345, 7}
+	for total := dinero.Monto(0); total <= 5000; total += 37 {
+		var suma dinero.Monto
+		for i, parte := range repartir(total, importes) {
+			if importes[i] == 0 && parte != 0 {
+				t.Errorf("repartir(%v): la línea %d sin importe recibió %v", total, i, parte)
+			}
+			suma += parte
+		}
+		if suma != total {
+			t.Errorf("repartir(%v) suma %v", total, suma)
+		}
+	}
+}
+
+func TestCuponAplicar(t *testing.T) {
+	lineas := []LineaDescuento{
+		{IDProducto: 1, Categorias: []int{2}, Subtotal: 1000},
+		{IDProducto: 2, Categorias: []int{3}, Subtotal: 2000},
+		{IDProducto: 3, Categorias: []int{3}, Subtotal: 0},
+	}
+	casos := []struct {
+		nombre   string
+		cupon    Cupon
+		porLinea []dinero.Monto
+		total    dinero.Monto
+	}{
+		{"porcentaje sobre todo el carrito", Cupon{Tipo: CuponPorcentaje, Porcentaje: 15}, []dinero.Monto{150, 300, 0}, 450},
+		{"porcentaje con redondeo", Cupon{Tipo: CuponPorcentaje, Porcentaje: 10.5}, []dinero.Monto{105, 210, 0}, 315},
+		{"monto repartido en proporción", Cupon{Tipo: CuponMonto, Monto: 1000}, []dinero.Monto{333, 667, 0}, 1000},
+		{"monto limitado al subtotal del carrito", Cupon{Tipo: CuponMonto, Monto: 9999}, []dinero.Monto{1000, 2000, 0}, 3000},
+		{"monto limitado a la categoría, con sus subcategorías", Cupon{Tipo: CuponMonto, Monto: 5000, Categorias: []int{1}}, []dinero.Monto{1000, 0, 0}, 1000},
+		{"porcentaje limitado a un producto", Cupon{Tipo: CuponPorcentaje, Porcentaje: 50, Productos: []int{2}}, []dinero.Monto{0, 1000, 0}, 1000},
+		{"producto o categoría", Cupon{Tipo: CuponPorcentaje, Porcentaje: 10, Productos: []int{1}, Categorias: []int{3}}, []dinero.Monto{100, 200, 0}, 300},
+	}
+	for _, c := range casos {
+		c.cupon.Codigo = "PRUEBA"
+		porLinea, total, err := c.cupon.Aplicar(lineas, categoriasTest)
+		if err != nil {
+			t.Errorf("%s: %v", c.nombre, err)
+			continue
+		}
+		if !reflect.DeepEqual(porLinea, c.porLinea) || total != c.total {
+			t.Errorf("%s: = %v, %v; se esperaba %v, %v", c.nombre, porLinea, total, c.porLinea, c.total)
+		}
+		var suma dinero.Monto
+		for _, d := range porLinea {
+			suma += d
+		}
+		if suma != total {
+			t.Errorf("%s: las líneas suman %v y el total es %v", c.nombre, suma, total)
+		}
+	}
+
+	// Un cupón que no alcanza a ninguna línea con importe no se aplica.
+	for _, c := range []Cupon{
+		{Codigo: "OTRO", Tipo: CuponMonto, Monto: 100, Productos: []int{99}},
+		{Codigo: "GRATIS", Tipo: CuponMonto, Monto: 100, Productos: []int{3}},
+	} {
+		if _, _, err := c.Aplicar(lineas, categoriasTest); !errors.Is(err, ErrCuponInvalido) {
+			t.Errorf("%s: err = %v; se esperaba ErrCuponInvalido", c.Codigo, err)
+		}
+	}
+}
+
+func TestCuponVerificar(t *testing.T) {
+	base := Cupon{Codigo: "PRUEBA", Tipo: CuponPorcentaje, Porcentaje: 10, Activo: true}
+	con := func(cambiar func(c *Cupon)) Cupon {
+		c := base
+		cambiar(&c)
+		return c
+	}
+	casos := []struct {
+		nombre      string
+		cupon       Cupon
+		subtotal    dinero.Monto
+		usosCliente int
+		valido      bool
+	}{
+		{"sin límites", base, 100, 5, true},
+		{"inactivo", con(func(c *Cupon) { c.Activo = false }), 100, 0, false},
+		{"todavía no vigente", con(func(c *Cupon) { c.ValidoDesde = ahoraTest.Add(time.Minute) }), 100, 0, false},
+		{"vigente desde ahora", con(func(c *Cupon) { c.ValidoDesde = ahoraTest }), 100, 0, true},
+		{"vence ahora", con(func(c *Cupon) { c.ValidoHasta = ahoraTest }), 100, 0, false},
+		{"vence después", con(func(c *Cupon) { c.ValidoHasta = ahoraTest.Add(time.Minute) }), 100, 0, true},
+		{"usos agotados", con(func(c *Cupon) { c.UsosMaximos, c.Usos = 5, 5 }), 100, 0, false},
+		{"queda un uso", con(func(c *Cupon) { c.UsosMaximos, c.Usos = 5, 4 }), 100, 0, true},
+		{"el cliente ya lo usó el máximo", con(func(c *Cupon) { c.UsosPorCliente = 2 }), 100, 2, false},
+		{"el cliente puede usarlo otra vez", con(func(c *Cupon) { c.UsosPorCliente = 2 }), 100, 1, true},
+		{"debajo del mínimo", con(func(c *Cupon) { c.MinimoCompra = 1000 }), 999, 0, false},
+		{"justo el mínimo", con(func(c *Cupon) { c.MinimoCompra = 1000 }), 1000, 0, true},
+	}
+	for _, c := range casos {
+		err := c.cupon.Verificar(ahoraTest, c.subtotal, c.usosCliente)
+		switch {
+		case c.valido && err != nil:
+			t.Errorf("%s: %v", c.nombre, err)
+		case !c.valido && !errors.Is(err, ErrCuponInvalido):
+			t.Errorf("%s: err = %v; se esperaba ErrCuponInvalido", c.nombre, err)
+		}
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+import "database/sql"
+
+// pool es el pool de conexiones compartido por todas las funciones del
+// paquete. Se inyecta una sola vez al arrancar mediante SetDB.
+var pool *sql.DB
+
+// SetDB inyecta el pool de conexiones que usarán los modelos.
+func SetDB(database *sql.DB) {
+	pool = database
+}
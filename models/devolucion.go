@@ -0,0 +1,452 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+	"unicode/utf8"
+)
+
+// Estados de una devolución.
+const (
+	DevolucionSolicitada  = "SOLICITADA"
+	DevolucionAprobada    = "APROBADA"
+	DevolucionRechazada   = "RECHAZADA"
+	DevolucionRecibida    = "RECIBIDA"
+	DevolucionReembolsada = "REEMBOLSADA"
+	DevolucionAcreditada  = "ACREDITADA"
+)
+
+// ErrDevolucionInvalida envuelve los motivos por los que no se puede pedir
+// o resolver una devolución. El mensaje está pensado para mostrarse.
+var ErrDevolucionInvalida = errors.New("devolución no válida")
+
+// transicionesDevolucion son los cambios de estado admitidos. La devolución
+// aprobada se recibe y después se resuelve con un reembolso o con crédito
+// para el cliente; RECHAZADA, REEMBOLSADA y ACREDITADA son finales.
+var transicionesDevolucion = map[string][]string{
+	DevolucionSolicitada:  {DevolucionAprobada, DevolucionRechazada},
+	DevolucionAprobada:    {DevolucionRecibida},
+	DevolucionRecibida:    {DevolucionReembolsada, DevolucionAcreditada},
+	DevolucionRechazada:   nil,
+	DevolucionReembolsada: nil,
+	DevolucionAcreditada:  nil,
+}
+
+// Devolucion es el pedido de un cliente de devolver parte de un pedido
+// entregado. Monto es lo que se le devuelve: lo que pagó por esas unidades,
+// con los descuentos de promociones y cupón ya restados. Nota es el
+// comentario del administrador (p. ej. por qué se rechazó).
+type Devolucion struct {
+	ID                 int
+	IDPedido           int
+	IDCliente          int
+	Estado             string
+	Motivo             string
+	Nota               string
+	Monto              dinero.Monto
+	FechaSolicitud     time.Time
+	FechaActualizacion time.Time
+	Lineas             []LineaDevolucion
+}
+
+// LineaDevolucion son las unidades de una línea del pedido que se devuelven.
+// ReponerStock indica si, al recibirlas, volvieron al stock.
+type LineaDevolucion struct {
+	ID           int
+	IDDevolucion int
+	IDDetalle    int
+	IDProducto   int
+	Variante     string
+	Cantidad     int
+	Monto        dinero.Monto
+	ReponerStock bool
+}
+
+// Transiciones devuelve los estados a los que puede pasar la devolución.
+func (d Devolucion) Transiciones() []string {
+	return transicionesDevolucion[d.Estado]
+}
+
+// Abierta indica si la devolución todavía no se resolvió.
+func (d Devolucion) Abierta() bool {
+	return len(d.Transiciones()) > 0
+}
+
+// validarTransicionDevolucion comprueba que la devolución pueda pasar de
+// `desde` a `hasta`.
+func validarTransicionDevolucion(desde, hasta string) error {
+	if _, ok := transicionesDevolucion[hasta]; !ok {
+		return fmt.Errorf("%w: el estado %q no existe", ErrTransicionInvalida, hasta)
+	}
+	for _, e := range transicionesDevolucion[desde] {
+		if e == hasta {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: una devolución %s no puede pasar a %s", ErrTransicionInvalida, desde, hasta)
+}
+
+// SolicitudDevolucion pide devolver unidades de un pedido. Cantidades va del
+// ID de la línea del pedido (`id_detalle`) a las unidades a devolver.
+type SolicitudDevolucion struct {
+	IDCliente  int
+	IDPedido   int
+	Motivo     string
+	Cantidades map[int]int
+}
+
+// SolicitudEstadoDevolucion pide pasar una devolución a otro estado. Al
+// recibirla, Reponer lista las líneas de la devolución cuyas unidades vuelven
+// al stock.
+type SolicitudEstadoDevolucion struct {
+	ID      int
+	Estado  string
+	Nota    string
+	Reponer []int
+}
+
+// Devolvibles devuelve, por línea del pedido, cuántas unidades quedan por
+// devolver: las compradas menos las de devoluciones no rechazadas.
+func Devolvibles(detalles []DetallePedido, devoluciones []Devolucion) map[int]int {
+	disponibles := map[int]int{}
+	for _, d := range detalles {
+		disponibles[d.ID] = d.Cantidad
+	}
+	for _, dev := range devoluciones {
+		if dev.Estado == DevolucionRechazada {
+			continue
+		}
+		for _, l := range dev.Lineas {
+			disponibles[l.IDDetalle] -= l.Cantidad
+		}
+	}
+	return disponibles
+}
+
+// armarDevolucion valida la solicitud contra el pedido, sus líneas y sus
+// devoluciones anteriores, y calcula el monto de cada línea. Devolver todo
+// lo que queda de una línea devuelve exactamente lo que falta de su importe,
+// para que el redondeo no deje centavos sueltos.
+func armarDevolucion(s SolicitudDevolucion, pedido Pedido, detalles []DetallePedido, anteriores []Devolucion) (Devolucion, error) {
+	switch {
+	case pedido.IDCliente != s.IDCliente:
+		return Devolucion{}, fmt.Errorf("%w: el pedido no existe", ErrDevolucionInvalida)
+	case pedido.Estado != EstadoEntregado:
+		return Devolucion{}, fmt.Errorf("%w: solo se pueden devolver pedidos entregados", ErrDevolucionInvalida)
+	case s.Motivo == "" || utf8.RuneCountInString(s.Motivo) > 255:
+		return Devolucion{}, fmt.Errorf("%w: indica el motivo, de hasta 255 caracteres", ErrDevolucionInvalida)
+	}
+
+	disponibles := Devolvibles(detalles, anteriores)
+	devuelto := map[int]dinero.Monto{}
+	for _, dev := range anteriores {
+		if dev.Estado == DevolucionRechazada {
+			continue
+		}
+		for _, l := range dev.Lineas {
+			devuelto[l.IDDetalle] += l.Monto
+		}
+	}
+
+	dev := Devolucion{IDPedido: pedido.ID, IDCliente: pedido.IDCliente, Estado: DevolucionSolicitada, Motivo: s.Motivo}
+	for _, d := range detalles {
+		cantidad := s.Cantidades[d.ID]
+		if cantidad == 0 {
+			continue
+		}
+		if cantidad < 0 || cantidad > disponibles[d.ID] {
+			return Devolucion{}, fmt.Errorf("%w: del producto %d puedes devolver hasta %d unidades", ErrDevolucionInvalida, d.IDProducto, disponibles[d.ID])
+		}
+		pagado := d.Pagado(pedido.ImpuestosIncluidos)
+		monto := pagado.Proporcion(int64(cantidad), int64(d.Cantidad))
+		if cantidad == disponibles[d.ID] {
+			monto = pagado - devuelto[d.ID]
+		}
+		dev.Lineas = append(dev.Lineas, LineaDevolucion{IDDetalle: d.ID, IDProducto: d.IDProducto, Variante: d.Variante, Cantidad: cantidad, Monto: monto})
+		dev.Monto += monto
+	}
+	if len(dev.Lineas) == 0 {
+		return Devolucion{}, fmt.Errorf("%w: elige al menos un producto y cuántas unidades devuelves", ErrDevolucionInvalida)
+	}
+	for id := range s.Cantidades {
+		if _, ok := disponibles[id]; !ok {
+			return Devolucion{}, fmt.Errorf("%w: el producto no es de este pedido", ErrDevolucionInvalida)
+		}
+	}
+	return dev, nil
+}
+
+// validarResolucion comprueba que la devolución pueda reembolsarse sobre lo
+// que queda cobrado del pedido.
+func validarResolucion(s SolicitudEstadoDevolucion, dev Devolucion, pedido Pedido) error {
+	if s.Estado != DevolucionReembolsada {
+		return nil
+	}
+	if pedido.TransaccionID == "" {
+		return fmt.Errorf("%w: el pedido no tiene un cobro que reembolsar; usa crédito", ErrDevolucionInvalida)
+	}
+	if dev.Monto > pedido.PorReembolsar() {
+		return fmt.Errorf("%w: del pedido solo quedan %s por reembolsar", ErrDevolucionInvalida, pedido.PorReembolsar().Formato())
+	}
+	return nil
+}
+
+// columnasDevolucion son las columnas que lee scanDevolucion, en orden.
+const columnasDevolucion = "d.id_devolucion, d.id_pedido, p.id_cliente, d.estado, d.motivo, d.nota, d.monto, d.fecha_solicitud, d.fecha_actualizacion"
+
+// scanDevolucion lee una fila con columnasDevolucion.
+func scanDevolucion(scan func(dest ...interface{}) error) (Devolucion, error) {
+	var d Devolucion
+	var nota sql.NullString
+	err := scan(&d.ID, &d.IDPedido, &d.IDCliente, &d.Estado, &d.Motivo, &nota, &d.Monto, &d.FechaSolicitud, &d.FechaActualizacion)
+	d.Nota = nota.String
+	return d, err
+}
+
+// consultarDevoluciones lee las devoluciones que cumplen `where`, de la más
+// reciente a la más antigua. Con `lineas` carga también sus líneas.
+func consultarDevoluciones(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, lineas bool, where string, args ...interface{}) ([]Devolucion, error) {
+	var devoluciones []Devolucion
+	rows, err := q.Query("SELECT "+columnasDevolucion+" FROM devoluciones d JOIN pedidos p ON p.id_pedido = d.id_pedido "+where+" ORDER BY d.id_devolucion DESC", args...)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return devoluciones, err
+	}
+	for rows.Next() {
+		d, err := scanDevolucion(rows.Scan)
+		if err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return devoluciones, err
+		}
+		devoluciones = append(devoluciones, d)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Println("Error al obtener las devoluciones", err)
+		return devoluciones, err
+	}
+	if !lineas {
+		return devoluciones, nil
+	}
+
+	for i := range devoluciones {
+		rows, err := q.Query("SELECT dd.id_detalle_devolucion, dd.id_devolucion, dd.id_detalle, dp.id_producto, dp.variante, dd.cantidad, dd.monto, dd.reponer_stock FROM detalles_devolucion dd JOIN detalles_pedido dp ON dp.id_detalle = dd.id_detalle WHERE dd.id_devolucion = ? ORDER BY dd.id_detalle", devoluciones[i].ID)
+		if err != nil {
+			log.Println("Error al ejecutar la consulta sql", err)
+			return devoluciones, err
+		}
+		for rows.Next() {
+			var l LineaDevolucion
+			var variante sql.NullString
+			if err := rows.Scan(&l.ID, &l.IDDevolucion, &l.IDDetalle, &l.IDProducto, &variante, &l.Cantidad, &l.Monto, &l.ReponerStock); err != nil {
+				rows.Close()
+				log.Println("Error al escanear la consulta sql", err)
+				return devoluciones, err
+			}
+			l.Variante = variante.String
+			devoluciones[i].Lineas = append(devoluciones[i].Lineas, l)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			log.Println("Error al obtener las líneas de la devolución", err)
+			return devoluciones, err
+		}
+	}
+	return devoluciones, nil
+}
+
+func GetDevolucionByID(id int) (Devolucion, error) {
+	devoluciones, err := consultarDevoluciones(pool, true, "WHERE d.id_devolucion = ?", id)
+	if err != nil {
+		return Devolucion{}, err
+	}
+	if len(devoluciones) == 0 {
+		return Devolucion{}, fmt.Errorf("devolución no encontrada con ID: %d", id)
+	}
+	return devoluciones[0], nil
+}
+
+// GetAllDevoluciones devuelve todas las devoluciones, sin sus líneas.
+func GetAllDevoluciones() ([]Devolucion, error) {
+	return consultarDevoluciones(pool, false, "")
+}
+
+func GetDevolucionesByPedidoID(idPedido int) ([]Devolucion, error) {
+	return consultarDevoluciones(pool, true, "WHERE d.id_pedido = ?", idPedido)
+}
+
+// GetDevolucionesByClienteID devuelve las devoluciones del cliente, sin sus
+// líneas.
+func GetDevolucionesByClienteID(idCliente int) ([]Devolucion, error) {
+	return consultarDevoluciones(pool, false, "WHERE p.id_cliente = ?", idCliente)
+}
+
+// SolicitarDevolucion registra la devolución en una transacción. Bloquea el
+// pedido para que dos solicitudes simultáneas no devuelvan las mismas
+// unidades.
+func SolicitarDevolucion(s SolicitudDevolucion) (int, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE id_pedido = ? FOR UPDATE", s.IDPedido).Scan)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("%w: el pedido no existe", ErrDevolucionInvalida)
+	}
+	if err != nil {
+		log.Println("Error al bloquear el pedido", err)
+		return 0, err
+	}
+	detalles, err := getDetallesPedido(tx, s.IDPedido)
+	if err != nil {
+		return 0, err
+	}
+	anteriores, err := consultarDevoluciones(tx, true, "WHERE d.id_pedido = ?", s.IDPedido)
+	if err != nil {
+		return 0, err
+	}
+	dev, err := armarDevolucion(s, pedido, detalles, anteriores)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO devoluciones (id_pedido, estado, motivo, monto) VALUES (?, ?, ?, ?)", dev.IDPedido, dev.Estado, dev.Motivo, dev.Monto)
+	if err != nil {
+		log.Println("Error al crear la devolución", err)
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error al obtener el ID de la devolución insertada", err)
+		return 0, err
+	}
+	for _, l := range dev.Lineas {
+		if _, err := tx.Exec("INSERT INTO detalles_devolucion (id_devolucion, id_detalle, cantidad, monto) VALUES (?, ?, ?, ?)", id, l.IDDetalle, l.Cantidad, l.Monto); err != nil {
+			log.Println("Error al crear la línea de la devolución", err)
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return 0, err
+	}
+	log.Println("Devolución creada exitosamente con ID:", id)
+	return int(id), nil
+}
+
+// CambiarEstadoDevolucion aplica un cambio de estado en una transacción, con
+// sus efectos: al recibir repone el stock de las líneas indicadas, al
+// reembolsar registra el reembolso pendiente (ver Reembolso; la pasarela se
+// llama después, una sola vez por devolución) y al acreditar suma el monto
+// al crédito del cliente.
+func CambiarEstadoDevolucion(s SolicitudEstadoDevolucion) (Devolucion, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return Devolucion{}, err
+	}
+	defer tx.Rollback()
+
+	// El pedido se bloquea antes que la devolución, en el mismo orden que
+	// SolicitarDevolucion.
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE id_pedido = (SELECT id_pedido FROM devoluciones WHERE id_devolucion = ?) FOR UPDATE", s.ID).Scan)
+	if err == sql.ErrNoRows {
+		return Devolucion{}, fmt.Errorf("devolución no encontrada con ID: %d", s.ID)
+	}
+	if err != nil {
+		log.Println("Error al bloquear el pedido de la devolución", err)
+		return Devolucion{}, err
+	}
+	var idDevolucion int
+	if err := tx.QueryRow("SELECT id_devolucion FROM devoluciones WHERE id_devolucion = ? FOR UPDATE", s.ID).Scan(&idDevolucion); err != nil {
+		log.Println("Error al bloquear la devolución", err)
+		return Devolucion{}, err
+	}
+	devoluciones, err := consultarDevoluciones(tx, true, "WHERE d.id_devolucion = ?", s.ID)
+	if err != nil {
+		return Devolucion{}, err
+	}
+	dev := devoluciones[0]
+	if err := validarTransicionDevolucion(dev.Estado, s.Estado); err != nil {
+		return Devolucion{}, err
+	}
+	if err := validarResolucion(s, dev, pedido); err != nil {
+		return Devolucion{}, err
+	}
+
+	if _, err := tx.Exec("UPDATE devoluciones SET estado = ?, nota = COALESCE(?, nota) WHERE id_devolucion = ?", s.Estado, sql.NullString{String: s.Nota, Valid: s.Nota != ""}, s.ID); err != nil {
+		log.Println("Error al actualizar la devolución", err)
+		return Devolucion{}, err
+	}
+
+	switch s.Estado {
+	case DevolucionRecibida:
+		detalles, err := getDetallesPedido(tx, dev.IDPedido)
+		if err != nil {
+			return Devolucion{}, err
+		}
+		for _, l := range dev.Lineas {
+			if !contiene(s.Reponer, l.ID) {
+				continue
+			}
+			for _, d := range detalles {
+				if d.ID == l.IDDetalle {
+					if err := reponerStockLinea(tx, d, l.Cantidad); err != nil {
+						return Devolucion{}, err
+					}
+				}
+			}
+			if _, err := tx.Exec("UPDATE detalles_devolucion SET reponer_stock = 1 WHERE id_detalle_devolucion = ?", l.ID); err != nil {
+				log.Println("Error al actualizar la línea de la devolución", err)
+				return Devolucion{}, err
+			}
+		}
+	case DevolucionAcreditada:
+		if _, err := tx.Exec("INSERT INTO creditos_clientes (id_cliente, monto, concepto, id_devolucion) VALUES (?, ?, ?, ?)",
+			dev.IDCliente, dev.Monto, fmt.Sprintf("Devolución #%d del pedido #%d", dev.ID, dev.IDPedido), dev.ID); err != nil {
+			log.Println("Error al acreditar la devolución", err)
+			return Devolucion{}, err
+		}
+	case DevolucionReembolsada:
+		if err := insertarReembolso(tx, reembolsoPorDevolucion(dev, pedido)); err != nil {
+			return Devolucion{}, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return Devolucion{}, err
+	}
+	return GetDevolucionByID(s.ID)
+}
+
+// GetSaldoCredito devuelve el crédito a favor del cliente.
+func GetSaldoCredito(idCliente int) (dinero.Monto, error) {
+	var saldo dinero.Monto
+	err := pool.QueryRow("SELECT COALESCE(SUM(monto), 0) FROM creditos_clientes WHERE id_cliente = ?", idCliente).Scan(&saldo)
+	if err != nil {
+		log.Println("Error al obtener el crédito del cliente", err)
+	}
+	return saldo, err
+}
+
+// contiene indica si `id` está en `ids`.
+func contiene(ids []int, id int) bool {
+	for _, x := range ids {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,421 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ErrEnvioPedidoInvalido envuelve los motivos por los que no se puede
+// registrar o modificar un envío de un pedido. El mensaje está pensado para
+// mostrarse.
+var ErrEnvioPedidoInvalido = errors.New("envío del pedido no válido")
+
+// Envio es un paquete despachado con parte o todas las unidades de un
+// pedido. EntregaEstimada y FechaEntrega están en cero mientras no se
+// conocen.
+type Envio struct {
+	ID                int
+	IDPedido          int
+	Transportista     string
+	NumeroSeguimiento string
+	FechaEnvio        time.Time
+	EntregaEstimada   time.Time
+	FechaEntrega      time.Time
+	Lineas            []LineaEnvio
+}
+
+// LineaEnvio son las unidades de una línea del pedido que van en el envío.
+type LineaEnvio struct {
+	IDDetalle  int
+	IDProducto int
+	Variante   string
+	Cantidad   int
+}
+
+// Entregado indica si el paquete ya llegó.
+func (e Envio) Entregado() bool {
+	return !e.FechaEntrega.IsZero()
+}
+
+// SolicitudEnvio registra un envío nuevo (ID 0) o modifica los datos de uno
+// existente. Cantidades va del ID de la línea del pedido (`id_detalle`) a las
+// unidades que se despachan y solo se usa al registrarlo. IDCliente y
+// Responsable son quien lo carga, para el historial de estados del pedido.
+type SolicitudEnvio struct {
+	ID                int
+	IDPedido          int
+	Transportista     string
+	NumeroSeguimiento string
+	FechaEnvio        time.Time
+	EntregaEstimada   time.Time
+	FechaEntrega      time.Time
+	Cantidades        map[int]int
+	IDCliente         int
+	Responsable       string
+}
+
+// PorEnviar devuelve, por línea del pedido, cuántas unidades quedan por
+// despachar.
+func PorEnviar(detalles []DetallePedido, envios []Envio) map[int]int {
+	pendientes := map[int]int{}
+	for _, d := range detalles {
+		pendientes[d.ID] = d.Cantidad
+	}
+	for _, e := range envios {
+		for _, l := range e.Lineas {
+			pendientes[l.IDDetalle] -= l.Cantidad
+		}
+	}
+	return pendientes
+}
+
+// EstadoSegunEnvios devuelve el estado que corresponde al pedido por sus
+// envíos: ENTREGADO si se despacharon todas las unidades y llegaron todos los
+// paquetes, ENVIADO si se despacharon todas, ENVIADO_PARCIAL si solo una
+// parte y "" si todavía no se despachó nada.
+func EstadoSegunEnvios(detalles []DetallePedido, envios []Envio) string {
+	if len(envios) == 0 {
+		return ""
+	}
+	for _, pendientes := range PorEnviar(detalles, envios) {
+		if pendientes > 0 {
+			return EstadoEnviadoParcial
+		}
+	}
+	for _, e := range envios {
+		if !e.Entregado() {
+			return EstadoEnviado
+		}
+	}
+	return EstadoEntregado
+}
+
+// caminoEstado devuelve los estados por los que pasa el pedido para llegar
+// de `actual` a `destino`: a ENTREGADO se llega siempre desde ENVIADO, para
+// que el historial muestre el despacho.
+func caminoEstado(actual, destino string) []string {
+	switch {
+	case destino == "" || destino == actual:
+		return nil
+	case destino == EstadoEntregado && actual != EstadoEnviado:
+		return []string{EstadoEnviado, EstadoEntregado}
+	}
+	return []string{destino}
+}
+
+// motivoEnvio es el motivo que queda en el historial por los cambios de
+// estado que provoca el envío.
+func motivoEnvio(e Envio) string {
+	motivo := fmt.Sprintf("Envío #%d con %s", e.ID, e.Transportista)
+	if e.NumeroSeguimiento != "" {
+		motivo += ", seguimiento " + e.NumeroSeguimiento
+	}
+	return motivo
+}
+
+// validarDatosEnvio normaliza y comprueba el transportista, el seguimiento y
+// las fechas de la solicitud. Sin fecha de envío se usa la actual, o la de
+// entrega si el paquete se registra ya entregado.
+func validarDatosEnvio(s *SolicitudEnvio) error {
+	s.Transportista = strings.TrimSpace(s.Transportista)
+	s.NumeroSeguimiento = strings.TrimSpace(s.NumeroSeguimiento)
+	if s.FechaEnvio.IsZero() {
+		s.FechaEnvio = time.Now()
+		if !s.FechaEntrega.IsZero() && s.FechaEntrega.Before(s.FechaEnvio) {
+			s.FechaEnvio = s.FechaEntrega
+		}
+	}
+	switch {
+	case s.Transportista == "" || utf8.RuneCountInString(s.Transportista) > 100:
+		return fmt.Errorf("%w: indica el transportista, de hasta 100 caracteres", ErrEnvioPedidoInvalido)
+	case utf8.RuneCountInString(s.NumeroSeguimiento) > 100:
+		return fmt.Errorf("%w: el número de seguimiento admite hasta 100 caracteres", ErrEnvioPedidoInvalido)
+	case !s.EntregaEstimada.IsZero() && s.EntregaEstimada.Before(dia(s.FechaEnvio)):
+		return fmt.Errorf("%w: la entrega estimada no puede ser anterior al envío", ErrEnvioPedidoInvalido)
+	case !s.FechaEntrega.IsZero() && s.FechaEntrega.Before(s.FechaEnvio):
+		return fmt.Errorf("%w: la fecha de entrega no puede ser anterior al envío", ErrEnvioPedidoInvalido)
+	}
+	return nil
+}
+
+// dia devuelve el comienzo del día de `t`.
+func dia(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// armarEnvio valida la solicitud de un envío nuevo contra el pedido, sus
+// líneas y sus envíos anteriores.
+func armarEnvio(s SolicitudEnvio, pedido Pedido, detalles []DetallePedido, anteriores []Envio) (Envio, error) {
+	if pedido.Estado != EstadoPagado && pedido.Estado != EstadoEnviadoParcial {
+		return Envio{}, fmt.Errorf("%w: un pedido %s no admite envíos nuevos", ErrEnvioPedidoInvalido, pedido.Estado)
+	}
+	if err := validarDatosEnvio(&s); err != nil {
+		return Envio{}, err
+	}
+
+	pendientes := PorEnviar(detalles, anteriores)
+	envio := Envio{
+		IDPedido:          pedido.ID,
+		Transportista:     s.Transportista,
+		NumeroSeguimiento: s.NumeroSeguimiento,
+		FechaEnvio:        s.FechaEnvio,
+		EntregaEstimada:   s.EntregaEstimada,
+		FechaEntrega:      s.FechaEntrega,
+	}
+	for id := range s.Cantidades {
+		if _, ok := pendientes[id]; !ok {
+			return Envio{}, fmt.Errorf("%w: el producto no es de este pedido", ErrEnvioPedidoInvalido)
+		}
+	}
+	for _, d := range detalles {
+		cantidad := s.Cantidades[d.ID]
+		if cantidad == 0 {
+			continue
+		}
+		if cantidad < 0 || cantidad > pendientes[d.ID] {
+			return Envio{}, fmt.Errorf("%w: del producto %d quedan %d unidades por enviar", ErrEnvioPedidoInvalido, d.IDProducto, pendientes[d.ID])
+		}
+		envio.Lineas = append(envio.Lineas, LineaEnvio{IDDetalle: d.ID, IDProducto: d.IDProducto, Variante: d.Variante, Cantidad: cantidad})
+	}
+	if len(envio.Lineas) == 0 {
+		return Envio{}, fmt.Errorf("%w: elige al menos un producto y cuántas unidades van en el envío", ErrEnvioPedidoInvalido)
+	}
+	return envio, nil
+}
+
+// modificarEnvio aplica los datos de la solicitud al envío. La entrega
+// registrada no se puede quitar, porque el estado del pedido no retrocede.
+func modificarEnvio(s SolicitudEnvio, envio Envio) (Envio, error) {
+	if s.FechaEnvio.IsZero() {
+		s.FechaEnvio = envio.FechaEnvio
+	}
+	if err := validarDatosEnvio(&s); err != nil {
+		return Envio{}, err
+	}
+	if envio.Entregado() && s.FechaEntrega.IsZero() {
+		return Envio{}, fmt.Errorf("%w: el envío ya figura como entregado", ErrEnvioPedidoInvalido)
+	}
+	envio.Transportista = s.Transportista
+	envio.NumeroSeguimiento = s.NumeroSeguimiento
+	envio.FechaEnvio = s.FechaEnvio
+	envio.EntregaEstimada = s.EntregaEstimada
+	envio.FechaEntrega = s.FechaEntrega
+	return envio, nil
+}
+
+// nullTime convierte la fecha en cero en NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+// consultarEnvios lee los envíos del pedido con sus líneas, del más antiguo
+// al más reciente. `q` puede ser el pool o una transacción.
+func consultarEnvios(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, idPedido int) ([]Envio, error) {
+	var envios []Envio
+	rows, err := q.Query("SELECT id_envio, id_pedido, transportista, numero_seguimiento, fecha_envio, entrega_estimada, fecha_entrega FROM envios WHERE id_pedido = ? ORDER BY fecha_envio, id_envio", idPedido)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return envios, err
+	}
+	for rows.Next() {
+		var e Envio
+		var seguimiento sql.NullString
+		var estimada, entrega sql.NullTime
+		if err := rows.Scan(&e.ID, &e.IDPedido, &e.Transportista, &seguimiento, &e.FechaEnvio, &estimada, &entrega); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return envios, err
+		}
+		e.NumeroSeguimiento = seguimiento.String
+		e.EntregaEstimada = estimada.Time
+		e.FechaEntrega = entrega.Time
+		envios = append(envios, e)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		log.Println("Error al obtener los envíos", err)
+		return envios, err
+	}
+
+	for i := range envios {
+		rows, err := q.Query("SELECT de.id_detalle, dp.id_producto, dp.variante, de.cantidad FROM detalles_envio de JOIN detalles_pedido dp ON dp.id_detalle = de.id_detalle WHERE de.id_envio = ? ORDER BY de.id_detalle", envios[i].ID)
+		if err != nil {
+			log.Println("Error al ejecutar la consulta sql", err)
+			return envios, err
+		}
+		for rows.Next() {
+			var l LineaEnvio
+			var variante sql.NullString
+			if err := rows.Scan(&l.IDDetalle, &l.IDProducto, &variante, &l.Cantidad); err != nil {
+				rows.Close()
+				log.Println("Error al escanear la consulta sql", err)
+				return envios, err
+			}
+			l.Variante = variante.String
+			envios[i].Lineas = append(envios[i].Lineas, l)
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			log.Println("Error al obtener las líneas del envío", err)
+			return envios, err
+		}
+	}
+	return envios, nil
+}
+
+// GetEnviosByPedidoID devuelve los envíos del pedido con sus líneas.
+func GetEnviosByPedidoID(idPedido int) ([]Envio, error) {
+	return consultarEnvios(pool, idPedido)
+}
+
+// aplicarEstadoEnvios lleva el pedido bloqueado al estado que corresponde a
+// sus envíos y devuelve los cambios registrados.
+func aplicarEstadoEnvios(tx *sql.Tx, s SolicitudEnvio, pedido Pedido, detalles []DetallePedido, envios []Envio, envio Envio) ([]CambioEstado, error) {
+	var cambios []CambioEstado
+	for _, estado := range caminoEstado(pedido.Estado, EstadoSegunEnvios(detalles, envios)) {
+		cambio, err := cambiarEstadoTx(tx, SolicitudCambioEstado{
+			IDPedido:    pedido.ID,
+			Estado:      estado,
+			IDCliente:   s.IDCliente,
+			Responsable: s.Responsable,
+			Motivo:      motivoEnvio(envio),
+		}, pedido)
+		if err != nil {
+			return nil, err
+		}
+		pedido.Estado = estado
+		cambios = append(cambios, cambio)
+	}
+	return cambios, nil
+}
+
+// bloquearPedidoEnvio bloquea el pedido y lee sus líneas y envíos.
+func bloquearPedidoEnvio(tx *sql.Tx, idPedido int) (Pedido, []DetallePedido, []Envio, error) {
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE id_pedido = ? FOR UPDATE", idPedido).Scan)
+	if err == sql.ErrNoRows {
+		return Pedido{}, nil, nil, fmt.Errorf("pedido no encontrado con ID: %d", idPedido)
+	}
+	if err != nil {
+		log.Println("Error al bloquear el pedido", err)
+		return Pedido{}, nil, nil, err
+	}
+	detalles, err := getDetallesPedido(tx, idPedido)
+	if err != nil {
+		return Pedido{}, nil, nil, err
+	}
+	envios, err := consultarEnvios(tx, idPedido)
+	if err != nil {
+		return Pedido{}, nil, nil, err
+	}
+	return pedido, detalles, envios, nil
+}
+
+// RegistrarEnvio crea el envío en una transacción y pasa el pedido al estado
+// que corresponde a sus envíos. Bloquea el pedido para que dos envíos
+// simultáneos no despachen las mismas unidades.
+func RegistrarEnvio(s SolicitudEnvio) (Envio, []CambioEstado, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return Envio{}, nil, err
+	}
+	defer tx.Rollback()
+
+	pedido, detalles, anteriores, err := bloquearPedidoEnvio(tx, s.IDPedido)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	envio, err := armarEnvio(s, pedido, detalles, anteriores)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+
+	result, err := tx.Exec("INSERT INTO envios (id_pedido, transportista, numero_seguimiento, fecha_envio, entrega_estimada, fecha_entrega) VALUES (?, ?, ?, ?, ?, ?)",
+		envio.IDPedido, envio.Transportista, nullString(envio.NumeroSeguimiento), envio.FechaEnvio, nullTime(envio.EntregaEstimada), nullTime(envio.FechaEntrega))
+	if err != nil {
+		log.Println("Error al crear el envío", err)
+		return Envio{}, nil, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error al obtener el ID del envío insertado", err)
+		return Envio{}, nil, err
+	}
+	envio.ID = int(id)
+	for _, l := range envio.Lineas {
+		if _, err := tx.Exec("INSERT INTO detalles_envio (id_envio, id_detalle, cantidad) VALUES (?, ?, ?)", envio.ID, l.IDDetalle, l.Cantidad); err != nil {
+			log.Println("Error al crear la línea del envío", err)
+			return Envio{}, nil, err
+		}
+	}
+	cambios, err := aplicarEstadoEnvios(tx, s, pedido, detalles, append(anteriores, envio), envio)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return Envio{}, nil, err
+	}
+	log.Println("Envío creado exitosamente con ID:", envio.ID)
+	return envio, cambios, nil
+}
+
+// ActualizarEnvio modifica el transportista, el seguimiento y las fechas del
+// envío en una transacción y, si se registró la entrega, pasa el pedido al
+// estado que corresponde.
+func ActualizarEnvio(s SolicitudEnvio) (Envio, []CambioEstado, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return Envio{}, nil, err
+	}
+	defer tx.Rollback()
+
+	pedido, detalles, envios, err := bloquearPedidoEnvio(tx, s.IDPedido)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	i := indiceEnvio(envios, s.ID)
+	if i < 0 {
+		return Envio{}, nil, fmt.Errorf("envío no encontrado con ID: %d", s.ID)
+	}
+	envio, err := modificarEnvio(s, envios[i])
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	envios[i] = envio
+
+	if _, err := tx.Exec("UPDATE envios SET transportista = ?, numero_seguimiento = ?, fecha_envio = ?, entrega_estimada = ?, fecha_entrega = ? WHERE id_envio = ?",
+		envio.Transportista, nullString(envio.NumeroSeguimiento), envio.FechaEnvio, nullTime(envio.EntregaEstimada), nullTime(envio.FechaEntrega), envio.ID); err != nil {
+		log.Println("Error al actualizar el envío", err)
+		return Envio{}, nil, err
+	}
+	cambios, err := aplicarEstadoEnvios(tx, s, pedido, detalles, envios, envio)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return Envio{}, nil, err
+	}
+	return envio, cambios, nil
+}
+
+// indiceEnvio devuelve la posición del envío `id` en `envios`, o -1.
+func indiceEnvio(envios []Envio, id int) int {
+	for i, e := range envios {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
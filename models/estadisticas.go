@@ -0,0 +1,41 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"log"
+)
+
+// Estadisticas agrupa los totales que muestra el dashboard de administración.
+type Estadisticas struct {
+	TotalClientes  int
+	TotalProductos int
+	TotalPedidos   int
+	TotalVentas    dinero.Monto
+}
+
+// GetEstadisticas obtiene estadísticas agregadas de la base de datos para el admin.
+func GetEstadisticas() (Estadisticas, error) {
+	var stats Estadisticas
+
+	if err := pool.QueryRow("SELECT COUNT(*) FROM clientes").Scan(&stats.TotalClientes); err != nil {
+		log.Println("Error al contar clientes", err)
+		return stats, err
+	}
+
+	if err := pool.QueryRow("SELECT COUNT(*) FROM productos").Scan(&stats.TotalProductos); err != nil {
+		log.Println("Error al contar productos", err)
+		return stats, err
+	}
+
+	if err := pool.QueryRow("SELECT COUNT(*) FROM pedidos").Scan(&stats.TotalPedidos); err != nil {
+		log.Println("Error al contar pedidos", err)
+		return stats, err
+	}
+
+	if err := pool.QueryRow("SELECT SUM(total) FROM pedidos").Scan(&stats.TotalVentas); err != nil {
+		log.Println("Error al sumar ventas", err)
+		return stats, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,301 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// ErrTransicionInvalida se devuelve al pedir un cambio de estado que la
+// máquina de estados del pedido no admite.
+var ErrTransicionInvalida = errors.New("cambio de estado no permitido")
+
+// transicionesPedido son los cambios de estado admitidos. Un pedido solo se
+// cancela antes de enviarse; ENTREGADO y CANCELADO son finales.
+var transicionesPedido = map[string][]string{
+	EstadoPendiente:      {EstadoPagado, EstadoCancelado},
+	EstadoPagado:         {EstadoEnviadoParcial, EstadoEnviado, EstadoCancelado},
+	EstadoEnviadoParcial: {EstadoEnviado},
+	EstadoEnviado:        {EstadoEntregado},
+	EstadoEntregado:      nil,
+	EstadoCancelado:      nil,
+}
+
+// EsEstadoDeEnvio indica si el estado se deriva de los envíos del pedido
+// (ver EstadoSegunEnvios) en lugar de elegirse a mano.
+func EsEstadoDeEnvio(estado string) bool {
+	return estado == EstadoEnviadoParcial || estado == EstadoEnviado || estado == EstadoEntregado
+}
+
+// Transiciones devuelve los estados a los que puede pasar el pedido.
+func (p Pedido) Transiciones() []string {
+	return transicionesPedido[p.Estado]
+}
+
+// TransicionesManuales devuelve los estados a los que un administrador puede
+// pasar el pedido a mano; los de envío se registran con los envíos.
+func (p Pedido) TransicionesManuales() []string {
+	var estados []string
+	for _, e := range p.Transiciones() {
+		if !EsEstadoDeEnvio(e) {
+			estados = append(estados, e)
+		}
+	}
+	return estados
+}
+
+// Cancelable indica si el pedido todavía puede cancelarse.
+func (p Pedido) Cancelable() bool {
+	return validarTransicion(p.Estado, EstadoCancelado) == nil
+}
+
+// ACobrar es lo que se cobra por la pasarela: el total menos el crédito
+// aplicado.
+func (p Pedido) ACobrar() dinero.Monto {
+	return p.Total - p.Credito
+}
+
+// PorReembolsar es lo cobrado por la pasarela que todavía no se devolvió.
+// Solo los pedidos pagados tienen algo que devolver; el crédito aplicado
+// vuelve como crédito al cancelar.
+func (p Pedido) PorReembolsar() dinero.Monto {
+	if p.Estado == EstadoPendiente || p.TransaccionID == "" {
+		return 0
+	}
+	return p.ACobrar() - p.Reembolsado
+}
+
+// validarEstadoManual rechaza los estados de envío en los cambios pedidos a
+// mano.
+func validarEstadoManual(estado string) error {
+	if EsEstadoDeEnvio(estado) {
+		return fmt.Errorf("%w: el estado %s se calcula con los envíos del pedido", ErrTransicionInvalida, estado)
+	}
+	return nil
+}
+
+// validarTransicion comprueba que el pedido pueda pasar de `desde` a `hasta`.
+func validarTransicion(desde, hasta string) error {
+	if _, ok := transicionesPedido[hasta]; !ok {
+		return fmt.Errorf("%w: el estado %q no existe", ErrTransicionInvalida, hasta)
+	}
+	for _, e := range transicionesPedido[desde] {
+		if e == hasta {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: un pedido %s no puede pasar a %s", ErrTransicionInvalida, desde, hasta)
+}
+
+// CambioEstado es una entrada del historial de estados de un pedido.
+// EstadoAnterior está vacío en la entrada que crea el pedido. IDCliente es
+// quien hizo el cambio (0 si fue el sistema, p. ej. la pasarela) y
+// Responsable su nombre en ese momento.
+type CambioEstado struct {
+	ID             int
+	IDPedido       int
+	EstadoAnterior string
+	EstadoNuevo    string
+	IDCliente      int
+	Responsable    string
+	Motivo         string
+	Fecha          time.Time
+}
+
+// SolicitudCambioEstado pide pasar un pedido a otro estado.
+type SolicitudCambioEstado struct {
+	IDPedido    int
+	Estado      string
+	IDCliente   int
+	Responsable string
+	Motivo      string
+	// DevolverPago, al cancelar, registra el reembolso de lo cobrado o la
+	// anulación del cobro pendiente (ver Reembolso). El cambio no llama a la
+	// pasarela: el reembolso se pide después de confirmarlo.
+	DevolverPago bool
+}
+
+// insertarCambioEstado agrega una entrada al historial dentro de la
+// transacción.
+func insertarCambioEstado(tx *sql.Tx, c CambioEstado) error {
+	_, err := tx.Exec("INSERT INTO pedido_estados (id_pedido, estado_anterior, estado_nuevo, id_cliente, responsable, motivo) VALUES (?, ?, ?, ?, ?, ?)",
+		c.IDPedido, sql.NullString{String: c.EstadoAnterior, Valid: c.EstadoAnterior != ""}, c.EstadoNuevo,
+		nullID(c.IDCliente), c.Responsable, sql.NullString{String: c.Motivo, Valid: c.Motivo != ""})
+	if err != nil {
+		log.Println("Error al registrar el cambio de estado", err)
+	}
+	return err
+}
+
+// CambiarEstadoPedido aplica un cambio de estado en una transacción: bloquea
+// el pedido, valida la transición, repone el stock si se cancela (y, con
+// DevolverPago, registra el reembolso pendiente) y registra el cambio en el
+// historial. Los estados de envío no se aceptan: los aplica
+// RegistrarEnvio o ActualizarEnvio.
+func CambiarEstadoPedido(s SolicitudCambioEstado) (CambioEstado, error) {
+	if err := validarEstadoManual(s.Estado); err != nil {
+		return CambioEstado{}, err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return CambioEstado{}, err
+	}
+	defer tx.Rollback()
+
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE id_pedido = ? FOR UPDATE", s.IDPedido).Scan)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error al bloquear el pedido", err)
+		}
+		return CambioEstado{}, err
+	}
+	cambio, err := cambiarEstadoTx(tx, s, pedido)
+	if err != nil {
+		return CambioEstado{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return CambioEstado{}, err
+	}
+	return cambio, nil
+}
+
+// cambiarEstadoTx valida y aplica el cambio sobre un pedido ya bloqueado.
+func cambiarEstadoTx(tx *sql.Tx, s SolicitudCambioEstado, pedido Pedido) (CambioEstado, error) {
+	if err := validarTransicion(pedido.Estado, s.Estado); err != nil {
+		return CambioEstado{}, err
+	}
+	if _, err := tx.Exec("UPDATE pedidos SET estado = ? WHERE id_pedido = ?", s.Estado, s.IDPedido); err != nil {
+		log.Println("Error al actualizar el estado del pedido", err)
+		return CambioEstado{}, err
+	}
+	if s.Estado == EstadoCancelado {
+		if err := reponerStockPedido(tx, s.IDPedido); err != nil {
+			return CambioEstado{}, err
+		}
+		if pedido.Credito > 0 {
+			if err := insertarMovimientoCredito(tx, pedido.IDCliente, pedido.Credito, conceptoDevolucionCredito(pedido.ID), pedido.ID); err != nil {
+				return CambioEstado{}, err
+			}
+		}
+		if r, ok := reembolsoPorCancelacion(pedido); ok && s.DevolverPago {
+			if err := insertarReembolso(tx, r); err != nil {
+				return CambioEstado{}, err
+			}
+		}
+	}
+	cambio := CambioEstado{
+		IDPedido:       s.IDPedido,
+		EstadoAnterior: pedido.Estado,
+		EstadoNuevo:    s.Estado,
+		IDCliente:      s.IDCliente,
+		Responsable:    s.Responsable,
+		Motivo:         s.Motivo,
+		Fecha:          time.Now(),
+	}
+	if err := insertarCambioEstado(tx, cambio); err != nil {
+		return CambioEstado{}, err
+	}
+	return cambio, nil
+}
+
+// conceptoDevolucionCredito es el concepto del movimiento que devuelve el
+// crédito usado en un pedido cancelado.
+func conceptoDevolucionCredito(idPedido int) string {
+	return fmt.Sprintf("Devolución del crédito del pedido #%d", idPedido)
+}
+
+// reponerStockPedido devuelve al stock las unidades de un pedido. Las líneas
+// de variantes que ya no existen no se reponen: el stock del producto es la
+// suma de sus variantes y no hay dónde sumarlas.
+func reponerStockPedido(tx *sql.Tx, idPedido int) error {
+	detalles, err := lineasStockPedido(tx, idPedido)
+	if err != nil {
+		return err
+	}
+	for _, d := range detalles {
+		if err := reponerStockLinea(tx, d, d.Cantidad); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lineasStockPedido lee de cada línea del pedido el producto, la variante y
+// la cantidad.
+func lineasStockPedido(tx *sql.Tx, idPedido int) ([]DetallePedido, error) {
+	rows, err := tx.Query("SELECT id_producto, id_variante, variante, cantidad FROM detalles_pedido WHERE id_pedido = ?", idPedido)
+	if err != nil {
+		log.Println("Error al leer los detalles del pedido", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var detalles []DetallePedido
+	for rows.Next() {
+		var d DetallePedido
+		var idVariante sql.NullInt64
+		var variante sql.NullString
+		if err := rows.Scan(&d.IDProducto, &idVariante, &variante, &d.Cantidad); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		d.IDVariante = int(idVariante.Int64)
+		d.Variante = variante.String
+		detalles = append(detalles, d)
+	}
+	return detalles, rows.Err()
+}
+
+// reponerStockLinea devuelve al stock `cantidad` unidades de una línea de
+// pedido, con el mismo criterio que reponerStockPedido.
+func reponerStockLinea(tx *sql.Tx, d DetallePedido, cantidad int) error {
+	if d.Variante != "" && d.IDVariante == 0 {
+		return nil
+	}
+	if d.IDVariante != 0 {
+		if _, err := tx.Exec("UPDATE variantes_producto SET stock = stock + ? WHERE id_variante = ?", cantidad, d.IDVariante); err != nil {
+			log.Println("Error al reponer el stock de la variante", err)
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE productos SET stock = stock + ? WHERE id_producto = ?", cantidad, d.IDProducto); err != nil {
+		log.Println("Error al reponer el stock", err)
+		return err
+	}
+	return nil
+}
+
+// GetHistorialPedido devuelve los cambios de estado del pedido, del más
+// antiguo al más reciente.
+func GetHistorialPedido(idPedido int) ([]CambioEstado, error) {
+	var historial []CambioEstado
+	rows, err := pool.Query("SELECT id_pedido_estado, id_pedido, estado_anterior, estado_nuevo, id_cliente, responsable, motivo, fecha FROM pedido_estados WHERE id_pedido = ? ORDER BY fecha, id_pedido_estado", idPedido)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return historial, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c CambioEstado
+		var anterior, motivo sql.NullString
+		var idCliente sql.NullInt64
+		if err := rows.Scan(&c.ID, &c.IDPedido, &anterior, &c.EstadoNuevo, &idCliente, &c.Responsable, &motivo, &c.Fecha); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return historial, err
+		}
+		c.EstadoAnterior = anterior.String
+		c.IDCliente = int(idCliente.Int64)
+		c.Motivo = motivo.String
+		historial = append(historial, c)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("Error al obtener el historial del pedido", err)
+	}
+	return historial, err
+}
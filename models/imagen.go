@@ -0,0 +1,220 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// ImagenProducto es una imagen subida para un producto. Los archivos viven en
+// el almacenamiento; aquí solo se guarda la clave base de sus variantes.
+type ImagenProducto struct {
+	ID            int
+	IDProducto    int
+	Clave         string
+	Extension     string
+	Orden         int
+	Principal     bool
+	FechaCreacion time.Time
+}
+
+// ClaveVariante devuelve la clave de almacenamiento de una variante
+// (p. ej. "miniatura") de la imagen.
+func (i ImagenProducto) ClaveVariante(variante string) string {
+	return i.Clave + "_" + variante + "." + i.Extension
+}
+
+const columnasImagen = "id_imagen, id_producto, clave, extension, orden, principal, fecha_creacion"
+
+func scanImagenes(rows *sql.Rows) ([]ImagenProducto, error) {
+	var imagenes []ImagenProducto
+	for rows.Next() {
+		var i ImagenProducto
+		if err := rows.Scan(&i.ID, &i.IDProducto, &i.Clave, &i.Extension, &i.Orden, &i.Principal, &i.FechaCreacion); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return imagenes, err
+		}
+		imagenes = append(imagenes, i)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error al obtener las imágenes", err)
+		return imagenes, err
+	}
+	return imagenes, nil
+}
+
+// GetImagenByID devuelve una imagen por su identificador.
+func GetImagenByID(id int) (ImagenProducto, error) {
+	var i ImagenProducto
+	err := pool.QueryRow("SELECT "+columnasImagen+" FROM imagenes_producto WHERE id_imagen = ?", id).
+		Scan(&i.ID, &i.IDProducto, &i.Clave, &i.Extension, &i.Orden, &i.Principal, &i.FechaCreacion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return i, fmt.Errorf("imagen no encontrada con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return i, err
+	}
+	return i, nil
+}
+
+// GetImagenesByProductoID devuelve las imágenes de un producto en su orden.
+func GetImagenesByProductoID(idProducto int) ([]ImagenProducto, error) {
+	rows, err := pool.Query("SELECT "+columnasImagen+" FROM imagenes_producto WHERE id_producto = ? ORDER BY orden, id_imagen", idProducto)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return nil, err
+	}
+	defer rows.Close()
+	return scanImagenes(rows)
+}
+
+// GetImagenesPrincipales devuelve la imagen principal de cada producto
+// indicado que tenga imágenes, indexada por ID de producto.
+func GetImagenesPrincipales(idsProducto []int) (map[int]ImagenProducto, error) {
+	principales := map[int]ImagenProducto{}
+	if len(idsProducto) == 0 {
+		return principales, nil
+	}
+	args := make([]interface{}, len(idsProducto))
+	for i, id := range idsProducto {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	rows, err := pool.Query("SELECT "+columnasImagen+" FROM imagenes_producto WHERE principal = 1 AND id_producto IN ("+placeholders+")", args...)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return principales, err
+	}
+	defer rows.Close()
+	imagenes, err := scanImagenes(rows)
+	if err != nil {
+		return principales, err
+	}
+	for _, i := range imagenes {
+		principales[i.IDProducto] = i
+	}
+	return principales, nil
+}
+
+// CreateImagen registra una imagen al final del orden del producto. La primera
+// imagen de un producto queda como principal. Devuelve el ID creado.
+func CreateImagen(idProducto int, clave, extension string) (int, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	// Bloquea el producto para que dos subidas simultáneas no repitan el orden.
+	var existe int
+	if err := tx.QueryRow("SELECT id_producto FROM productos WHERE id_producto = ? FOR UPDATE", idProducto).Scan(&existe); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("producto no encontrado con ID: %d", idProducto)
+		}
+		log.Println("Error al bloquear el producto", err)
+		return 0, err
+	}
+	var siguiente, principales int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(orden) + 1, 0), COALESCE(SUM(principal), 0) FROM imagenes_producto WHERE id_producto = ?", idProducto).Scan(&siguiente, &principales); err != nil {
+		log.Println("Error al calcular el orden de la imagen", err)
+		return 0, err
+	}
+
+	result, err := tx.Exec("INSERT INTO imagenes_producto (id_producto, clave, extension, orden, principal) VALUES (?, ?, ?, ?, ?)", idProducto, clave, extension, siguiente, principales == 0)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error al obtener el ID de la imagen insertada", err)
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return 0, err
+	}
+	return int(id), nil
+}
+
+// DeleteImagen elimina el registro de una imagen. Si era la principal, la
+// siguiente en orden pasa a serlo. Los archivos los borra quien llama.
+func DeleteImagen(id int) error {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var idProducto int
+	var principal bool
+	err = tx.QueryRow("SELECT id_producto, principal FROM imagenes_producto WHERE id_imagen = ? FOR UPDATE", id).Scan(&idProducto, &principal)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("imagen no encontrada con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM imagenes_producto WHERE id_imagen = ?", id); err != nil {
+		log.Println("Error al eliminar la imagen", err)
+		return err
+	}
+	if principal {
+		if _, err := tx.Exec("UPDATE imagenes_producto SET principal = 1 WHERE id_producto = ? ORDER BY orden, id_imagen LIMIT 1", idProducto); err != nil {
+			log.Println("Error al promover la imagen principal", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return err
+	}
+	return nil
+}
+
+// SetImagenPrincipal marca una imagen como la principal de su producto y
+// desmarca las demás.
+func SetImagenPrincipal(idProducto, idImagen int) error {
+	imagen, err := GetImagenByID(idImagen)
+	if err != nil {
+		return err
+	}
+	if imagen.IDProducto != idProducto {
+		return fmt.Errorf("la imagen %d no pertenece al producto %d", idImagen, idProducto)
+	}
+	_, err = pool.Exec("UPDATE imagenes_producto SET principal = (id_imagen = ?) WHERE id_producto = ?", idImagen, idProducto)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	return nil
+}
+
+// ReordenarImagenes asigna el orden de las imágenes de un producto según la
+// posición de cada ID en `ids`. Los IDs de otros productos se ignoran.
+func ReordenarImagenes(idProducto int, ids []int) error {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	for orden, id := range ids {
+		if _, err := tx.Exec("UPDATE imagenes_producto SET orden = ? WHERE id_imagen = ? AND id_producto = ?", orden, id, idProducto); err != nil {
+			log.Println("Error al reordenar las imágenes", err)
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,268 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"fmt"
+	"log"
+	"unicode/utf8"
+)
+
+// preciosConImpuestos indica si los precios del catálogo ya incluyen los
+// impuestos. Se ajusta con SetPreciosConImpuestos (p. ej. desde la variable
+// `PRECIOS_CON_IMPUESTOS`).
+var preciosConImpuestos = true
+
+// SetPreciosConImpuestos elige si los precios del catálogo incluyen los
+// impuestos (el impuesto se informa pero no se suma) o no (se suma al total).
+func SetPreciosConImpuestos(incluidos bool) {
+	preciosConImpuestos = incluidos
+}
+
+// PreciosConImpuestos indica si los precios del catálogo incluyen los
+// impuestos.
+func PreciosConImpuestos() bool {
+	return preciosConImpuestos
+}
+
+// ClaseImpuesto es un tipo de impuesto asignable a los productos, p. ej. IVA
+// general, reducido o exento. Los productos sin clase usan la predeterminada.
+// Una clase exenta no paga impuestos, igual que una de tasa 0, pero se
+// informa como exenta.
+type ClaseImpuesto struct {
+	ID             int
+	Nombre         string
+	Tasa           float64 // porcentaje, p. ej. 21 para el 21%
+	Exenta         bool
+	Predeterminada bool
+}
+
+// Impuesto calcula el impuesto de una línea que cuesta `importe`, con el
+// precio que ya lo incluye o no, redondeado a centavos.
+func (c ClaseImpuesto) Impuesto(importe dinero.Monto, incluido bool) dinero.Monto {
+	if c.Exenta || c.Tasa == 0 {
+		return 0
+	}
+	if incluido {
+		return importe.ImpuestoIncluido(c.Tasa)
+	}
+	return importe.Porcentaje(c.Tasa)
+}
+
+// ValidarClaseImpuesto comprueba los datos de una clase antes de guardarla.
+func ValidarClaseImpuesto(c ClaseImpuesto) error {
+	if c.Nombre == "" || utf8.RuneCountInString(c.Nombre) > 100 {
+		return fmt.Errorf("el nombre es obligatorio y de hasta 100 caracteres")
+	}
+	if c.Tasa < 0 || c.Tasa > 100 {
+		return fmt.Errorf("la tasa debe estar entre 0 y 100")
+	}
+	if c.Exenta && c.Tasa != 0 {
+		return fmt.Errorf("una clase exenta no puede tener tasa")
+	}
+	return nil
+}
+
+// ClaseDeProducto devuelve la clase con ese ID o, si no la hay (el producto
+// no tiene clase o se borró), la predeterminada. Sin predeterminada devuelve
+// una clase vacía, que no paga impuestos.
+func ClaseDeProducto(clases []ClaseImpuesto, idClase int) ClaseImpuesto {
+	var predeterminada ClaseImpuesto
+	for _, c := range clases {
+		if idClase != 0 && c.ID == idClase {
+			return c
+		}
+		if c.Predeterminada {
+			predeterminada = c
+		}
+	}
+	return predeterminada
+}
+
+// TramoImpuesto es el total de una clase en el desglose: la base imponible
+// (el importe sin el impuesto) y el impuesto.
+type TramoImpuesto struct {
+	Nombre   string
+	Tasa     float64
+	Exenta   bool
+	Base     dinero.Monto
+	Impuesto dinero.Monto
+}
+
+// DesgloseImpuestos reúne los impuestos de un carrito o un pedido por clase.
+// El impuesto se redondea por línea y los totales son la suma de las líneas,
+// así el desglose, los detalles del pedido y el total coinciden al centavo.
+type DesgloseImpuestos struct {
+	Incluidos bool
+	Tramos    []TramoImpuesto
+	Total     dinero.Monto
+}
+
+// NuevoDesgloseImpuestos arma un desglose vacío con el modo de precios
+// actual.
+func NuevoDesgloseImpuestos() *DesgloseImpuestos {
+	return &DesgloseImpuestos{Incluidos: preciosConImpuestos}
+}
+
+// Agregar calcula el impuesto de una línea que cuesta `importe` (ya con sus
+// descuentos), lo suma al tramo de su clase y lo devuelve. Las líneas sin
+// clase no pagan impuestos ni aparecen en el desglose.
+func (d *DesgloseImpuestos) Agregar(clase ClaseImpuesto, importe dinero.Monto) dinero.Monto {
+	impuesto := clase.Impuesto(importe, d.Incluidos)
+	d.sumar(clase, importe, impuesto)
+	return impuesto
+}
+
+// sumar acumula una línea con su impuesto ya calculado.
+func (d *DesgloseImpuestos) sumar(clase ClaseImpuesto, importe, impuesto dinero.Monto) {
+	if clase.Nombre == "" {
+		return
+	}
+	base := importe
+	if d.Incluidos {
+		base = importe - impuesto
+	}
+	d.Total += impuesto
+	for i, t := range d.Tramos {
+		if t.Nombre == clase.Nombre && t.Tasa == clase.Tasa && t.Exenta == clase.Exenta {
+			d.Tramos[i].Base += base
+			d.Tramos[i].Impuesto += impuesto
+			return
+		}
+	}
+	d.Tramos = append(d.Tramos, TramoImpuesto{Nombre: clase.Nombre, Tasa: clase.Tasa, Exenta: clase.Exenta, Base: base, Impuesto: impuesto})
+}
+
+// Adicional es lo que los impuestos suman al total: nada si los precios ya
+// los incluían.
+func (d *DesgloseImpuestos) Adicional() dinero.Monto {
+	if d.Incluidos {
+		return 0
+	}
+	return d.Total
+}
+
+// DesgloseDePedido rearma el desglose de un pedido con la copia de la clase
+// que guarda cada detalle.
+func DesgloseDePedido(p Pedido, detalles []DetallePedido) DesgloseImpuestos {
+	d := DesgloseImpuestos{Incluidos: p.ImpuestosIncluidos}
+	for _, det := range detalles {
+		d.sumar(det.ClaseImpuesto(), det.Subtotal-det.DescuentoPromocion-det.Descuento, det.Impuesto)
+	}
+	return d
+}
+
+// columnasClaseImpuesto son las columnas que lee scanClaseImpuesto, en orden.
+const columnasClaseImpuesto = "id_clase, nombre, tasa, exenta, predeterminada"
+
+func scanClaseImpuesto(scan func(dest ...interface{}) error) (ClaseImpuesto, error) {
+	var c ClaseImpuesto
+	err := scan(&c.ID, &c.Nombre, &c.Tasa, &c.Exenta, &c.Predeterminada)
+	return c, err
+}
+
+// GetAllClasesImpuesto devuelve las clases de impuesto por nombre.
+func GetAllClasesImpuesto() ([]ClaseImpuesto, error) {
+	var clases []ClaseImpuesto
+	rows, err := pool.Query("SELECT " + columnasClaseImpuesto + " FROM clases_impuesto ORDER BY nombre")
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return clases, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c, err := scanClaseImpuesto(rows.Scan)
+		if err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return clases, err
+		}
+		clases = append(clases, c)
+	}
+	return clases, rows.Err()
+}
+
+// GetClaseImpuestoByID devuelve una clase de impuesto.
+func GetClaseImpuestoByID(id int) (ClaseImpuesto, error) {
+	c, err := scanClaseImpuesto(pool.QueryRow("SELECT "+columnasClaseImpuesto+" FROM clases_impuesto WHERE id_clase = ?", id).Scan)
+	if err == sql.ErrNoRows {
+		return c, fmt.Errorf("clase de impuesto no encontrada con ID: %d", id)
+	}
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+	}
+	return c, err
+}
+
+// quitarPredeterminada desmarca las demás clases cuando `c` pasa a ser la
+// predeterminada: solo puede haber una.
+func quitarPredeterminada(tx *sql.Tx, c ClaseImpuesto) error {
+	if !c.Predeterminada {
+		return nil
+	}
+	if _, err := tx.Exec("UPDATE clases_impuesto SET predeterminada = 0 WHERE id_clase <> ?", c.ID); err != nil {
+		log.Println("Error al desmarcar la clase predeterminada", err)
+		return err
+	}
+	return nil
+}
+
+// CreateClaseImpuesto inserta una clase de impuesto.
+func CreateClaseImpuesto(c ClaseImpuesto) error {
+	if err := ValidarClaseImpuesto(c); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO clases_impuesto (nombre, tasa, exenta, predeterminada) VALUES (?, ?, ?, ?)", c.Nombre, c.Tasa, c.Exenta, c.Predeterminada)
+	if err != nil {
+		log.Println("Error al crear la clase de impuesto", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = int(id)
+	if err := quitarPredeterminada(tx, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateClaseImpuesto modifica una clase de impuesto. Los pedidos ya hechos
+// no cambian: guardan una copia de la clase en cada detalle.
+func UpdateClaseImpuesto(c ClaseImpuesto) error {
+	if err := ValidarClaseImpuesto(c); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE clases_impuesto SET nombre = ?, tasa = ?, exenta = ?, predeterminada = ? WHERE id_clase = ?", c.Nombre, c.Tasa, c.Exenta, c.Predeterminada, c.ID); err != nil {
+		log.Println("Error al actualizar la clase de impuesto", err)
+		return err
+	}
+	if err := quitarPredeterminada(tx, c); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteClaseImpuesto elimina una clase de impuesto. Sus productos pasan a
+// usar la predeterminada (la FK los deja sin clase).
+func DeleteClaseImpuesto(id int) error {
+	if _, err := pool.Exec("DELETE FROM clases_impuesto WHERE id_clase = ?", id); err != nil {
+		log.Println("Error al eliminar la clase de impuesto", err)
+		return err
+	}
+	return nil
+}
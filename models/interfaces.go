@@ -1,5 +1,10 @@
 package models
 
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"time"
+)
+
 // ClienteRepository define la interfaz para el manejo de datos de clientes.
 // Esto permite desacoplar la lógica de negocio de la implementación de base de datos.
 type ClienteRepository interface {
@@ -7,7 +12,9 @@ type ClienteRepository interface {
 	GetByEmail(email string) (Cliente, error)
 	GetAll() ([]Cliente, error)
 	Create(cliente Cliente) error
+	// Update modifica los datos de contacto; no cambia la contraseña ni el perfil.
 	Update(cliente Cliente) error
+	UpdatePasswordHash(id int, passwordHash string) error
 	Delete(id int) error
 }
 
@@ -15,5 +22,252 @@ type ClienteRepository interface {
 type ProductoRepository interface {
 	GetByID(id int) (Producto, error)
 	GetAll() ([]Producto, error)
+	// Buscar devuelve una página de productos que cumplen la búsqueda.
+	Buscar(busqueda BusquedaProductos) (ResultadoBusqueda, error)
+	// Create inserta el producto y devuelve su ID.
+	Create(producto Producto) (int, error)
 	Update(producto Producto) error
+	Delete(id int) error
+}
+
+// CategoriaRepository define la interfaz para el manejo de categorías y su
+// asignación a productos.
+type CategoriaRepository interface {
+	GetByID(id int) (Categoria, error)
+	GetAll() ([]Categoria, error)
+	Create(categoria Categoria) error
+	Update(categoria Categoria) error
+	// Delete falla con ErrCategoriaConSubcategorias si la categoría tiene hijas.
+	Delete(id int) error
+	GetByProductoID(idProducto int) ([]Categoria, error)
+	// SetProducto reemplaza las categorías asignadas a un producto.
+	SetProducto(idProducto int, idsCategoria []int) error
+}
+
+// ImagenRepository define la interfaz de los registros de imágenes de
+// productos. No toca los archivos, que maneja el almacenamiento.
+type ImagenRepository interface {
+	GetByID(id int) (ImagenProducto, error)
+	GetByProductoID(idProducto int) ([]ImagenProducto, error)
+	// GetPrincipales devuelve la imagen principal de cada producto que tenga una.
+	GetPrincipales(idsProducto []int) (map[int]ImagenProducto, error)
+	// Create agrega la imagen al final; la primera de un producto es la principal.
+	Create(idProducto int, clave, extension string) (int, error)
+	Delete(id int) error
+	SetPrincipal(idProducto, idImagen int) error
+	Reordenar(idProducto int, ids []int) error
+}
+
+// VarianteRepository define la interfaz de los ejes de opciones y las
+// variantes de los productos.
+type VarianteRepository interface {
+	GetOpciones(idProducto int) ([]OpcionProducto, error)
+	// SetOpciones reemplaza los ejes del producto y elimina las variantes que
+	// queden sin un valor por eje.
+	SetOpciones(idProducto int, opciones []OpcionProducto) error
+	GetByID(id int) (VarianteProducto, error)
+	GetByProductoID(idProducto int) ([]VarianteProducto, error)
+	// ConVariantes indica cuáles de los productos tienen variantes.
+	ConVariantes(idsProducto []int) (map[int]bool, error)
+	// Generar crea las combinaciones que faltan y devuelve cuántas creó.
+	Generar(idProducto int) (int, error)
+	Update(variante VarianteProducto) error
+	Delete(id int) error
+}
+
+// PedidoRepository define la interfaz para el manejo de pedidos y sus detalles.
+type PedidoRepository interface {
+	GetByID(id int) (Pedido, error)
+	GetAll() ([]Pedido, error)
+	GetByClienteID(idCliente int) ([]Pedido, error)
+	GetDetalles(idPedido int) ([]DetallePedido, error)
+	// GetPromociones devuelve las promociones aplicadas al pedido.
+	GetPromociones(idPedido int) ([]PromocionAplicada, error)
+	// CambiarEstado aplica un cambio de estado validado por la máquina de
+	// estados (ver ErrTransicionInvalida), con sus efectos (reponer stock al
+	// cancelar) y su entrada en el historial. Los estados de envío no se
+	// aceptan: se derivan de los envíos (ver EnvioRepository.RegistrarEnvio).
+	CambiarEstado(solicitud SolicitudCambioEstado) (CambioEstado, error)
+	// GetHistorial devuelve los cambios de estado del pedido en orden.
+	GetHistorial(idPedido int) ([]CambioEstado, error)
+	// Checkout convierte el carrito del cliente en un pedido de forma atómica
+	// y devuelve el ID del pedido creado, PENDIENTE de cobro (PAGADO si el
+	// total es 0). Si la solicitud trae un código de cupón que no aplica,
+	// devuelve un error que envuelve ErrCuponInvalido; si el envío elegido no
+	// sirve, uno que envuelve ErrEnvioInvalido.
+	Checkout(solicitud SolicitudCheckout) (int, error)
+	// RegistrarCobro guarda la transacción de la pasarela en el pedido y, si
+	// el cobro está pagado, lo pasa a PAGADO. Devuelve el cambio de estado,
+	// si hubo uno.
+	RegistrarCobro(idPedido int, cobro Cobro) (*CambioEstado, error)
+	// AnularCheckout cancela un pedido PENDIENTE cuyo cobro falló: repone el
+	// stock, libera el cupón y devuelve los productos al carrito.
+	AnularCheckout(idPedido int, responsable, motivo string) (CambioEstado, error)
+	// RegistrarEventoPago aplica una notificación de la pasarela al pedido de
+	// esa transacción. Devuelve false si el evento ya se había registrado, y
+	// el cambio de estado que provocó, si hubo uno.
+	RegistrarEventoPago(evento EventoPago) (bool, *CambioEstado, error)
+	// GetReembolsos devuelve los reembolsos del pedido, del más antiguo al
+	// más reciente.
+	GetReembolsos(idPedido int) ([]Reembolso, error)
+	// GetReembolsosPendientes devuelve los reembolsos de todos los pedidos
+	// que todavía hay que pedir a la pasarela.
+	GetReembolsosPendientes() ([]Reembolso, error)
+	// RegistrarResultadoReembolso marca HECHO el reembolso si la pasarela
+	// respondió sin error o, si falló, guarda el motivo y lo deja pendiente.
+	RegistrarResultadoReembolso(id int, resultado error) error
+}
+
+// DevolucionRepository define la interfaz para el manejo de devoluciones de
+// pedidos entregados y del crédito que generan para los clientes.
+type DevolucionRepository interface {
+	// GetByID devuelve la devolución con sus líneas.
+	GetByID(id int) (Devolucion, error)
+	// GetAll devuelve todas las devoluciones, sin sus líneas.
+	GetAll() ([]Devolucion, error)
+	// GetByPedidoID devuelve las devoluciones del pedido con sus líneas.
+	GetByPedidoID(idPedido int) ([]Devolucion, error)
+	// GetByClienteID devuelve las devoluciones del cliente, sin sus líneas.
+	GetByClienteID(idCliente int) ([]Devolucion, error)
+	// Solicitar registra una devolución SOLICITADA y devuelve su ID. Si la
+	// solicitud no es válida devuelve un error que envuelve
+	// ErrDevolucionInvalida.
+	Solicitar(solicitud SolicitudDevolucion) (int, error)
+	// CambiarEstado aplica un cambio de estado validado (ver
+	// ErrTransicionInvalida) con sus efectos: reponer stock al recibir,
+	// reembolsar o acreditar al resolver.
+	CambiarEstado(solicitud SolicitudEstadoDevolucion) (Devolucion, error)
+	// SaldoCredito devuelve el crédito a favor del cliente.
+	SaldoCredito(idCliente int) (dinero.Monto, error)
+}
+
+// PromocionRepository define la interfaz para el manejo de promociones
+// automáticas.
+type PromocionRepository interface {
+	GetAll() ([]Promocion, error)
+	// GetActivas devuelve las marcadas como activas, sin filtrar por fechas.
+	GetActivas() ([]Promocion, error)
+	GetByID(id int) (Promocion, error)
+	Create(promocion Promocion) error
+	Update(promocion Promocion) error
+	Delete(id int) error
+}
+
+// EnvioRepository define la interfaz para el manejo de los métodos de envío,
+// sus tarifas y las zonas, y de los envíos despachados de cada pedido.
+type EnvioRepository interface {
+	GetMetodos() ([]MetodoEnvio, error)
+	// GetMetodosActivos devuelve los métodos que se ofrecen en el checkout.
+	GetMetodosActivos() ([]MetodoEnvio, error)
+	GetMetodoByID(id int) (MetodoEnvio, error)
+	CreateMetodo(metodo MetodoEnvio) error
+	// UpdateMetodo reemplaza también las tarifas del método.
+	UpdateMetodo(metodo MetodoEnvio) error
+	DeleteMetodo(id int) error
+	GetZonas() ([]ZonaEnvio, error)
+	GetZonaByID(id int) (ZonaEnvio, error)
+	// CreateZona y UpdateZona fallan si una provincia ya está en otra zona.
+	CreateZona(zona ZonaEnvio) error
+	UpdateZona(zona ZonaEnvio) error
+	// DeleteZona elimina también las tarifas que usan la zona.
+	DeleteZona(id int) error
+	// GetEnviosPedido devuelve los envíos del pedido con sus líneas, del más
+	// antiguo al más reciente.
+	GetEnviosPedido(idPedido int) ([]Envio, error)
+	// RegistrarEnvio crea un envío del pedido y lo pasa al estado que
+	// corresponde (ver EstadoSegunEnvios). Devuelve los cambios de estado
+	// registrados. Si la solicitud no es válida devuelve un error que envuelve
+	// ErrEnvioPedidoInvalido.
+	RegistrarEnvio(solicitud SolicitudEnvio) (Envio, []CambioEstado, error)
+	// ActualizarEnvio modifica el transportista, el seguimiento y las fechas
+	// de un envío, con el mismo efecto sobre el estado del pedido.
+	ActualizarEnvio(solicitud SolicitudEnvio) (Envio, []CambioEstado, error)
+}
+
+// ImpuestoRepository define la interfaz para el manejo de las clases de
+// impuesto.
+type ImpuestoRepository interface {
+	GetAll() ([]ClaseImpuesto, error)
+	GetByID(id int) (ClaseImpuesto, error)
+	// Create y Update desmarcan las demás clases si la nueva es la
+	// predeterminada.
+	Create(clase ClaseImpuesto) error
+	Update(clase ClaseImpuesto) error
+	// Delete deja sin clase a sus productos, que pasan a usar la
+	// predeterminada.
+	Delete(id int) error
+}
+
+// CuponRepository define la interfaz para el manejo de cupones de descuento.
+type CuponRepository interface {
+	GetAll() ([]Cupon, error)
+	GetByID(id int) (Cupon, error)
+	// GetByCodigo busca sin distinguir mayúsculas; si no existe devuelve un
+	// error que envuelve ErrCuponInvalido.
+	GetByCodigo(codigo string) (Cupon, error)
+	Create(cupon Cupon) error
+	Update(cupon Cupon) error
+	Delete(id int) error
+	// UsosCliente cuenta los pedidos del cliente que usaron el cupón.
+	UsosCliente(idCupon, idCliente int) (int, error)
+}
+
+// CarritoRepository define la interfaz para el manejo de carritos y sus items.
+type CarritoRepository interface {
+	GetByClienteID(idCliente int) (Carrito, error)
+	// Create crea el carrito del cliente si no existe; es idempotente.
+	Create(idCliente int) error
+	// GetByToken devuelve el carrito de invitado con ese token.
+	GetByToken(token string) (Carrito, error)
+	CreateInvitado(token string) error
+	// Fusionar pasa el carrito de invitado al del cliente, limitando las
+	// cantidades al stock, y elimina el de invitado.
+	Fusionar(token string, idCliente int) error
+	// DeleteInvitadosAntiguos elimina los carritos de invitado más antiguos
+	// que `antiguedad`.
+	DeleteInvitadosAntiguos(antiguedad time.Duration) (int64, error)
+	GetItems(idCarrito int) ([]ItemCarrito, error)
+	// AddItem agrega un item; `idVariante` es 0 si el producto no tiene variantes.
+	// Si ya hay una línea del mismo producto y variante, suma la cantidad.
+	AddItem(idCarrito, idProducto, idVariante, cantidad int) error
+	// UpdateItem fija la cantidad de una línea del propietario; no valida
+	// stock. Los items ajenos devuelven ErrItemCarritoNoEncontrado.
+	UpdateItem(propietario PropietarioCarrito, idItem, cantidad int) error
+	// RemoveItem quita una línea del propietario. Los items ajenos devuelven
+	// ErrItemCarritoNoEncontrado.
+	RemoveItem(propietario PropietarioCarrito, idItem int) error
+	// Empty vacía el carrito del propietario.
+	Empty(propietario PropietarioCarrito) error
+}
+
+// SesionRepository define la interfaz del almacén de sesiones del servidor.
+type SesionRepository interface {
+	GetByID(id string) (Sesion, error)
+	Save(sesion Sesion, duracion time.Duration) error
+	Delete(id string) error
+	DeleteExpired() (int64, error)
+}
+
+// EstadisticasRepository define la interfaz de las métricas del dashboard.
+type EstadisticasRepository interface {
+	Get() (Estadisticas, error)
+}
+
+// Repositorios agrupa las implementaciones de acceso a datos que usa la
+// aplicación, para inyectarlas juntas en los handlers.
+type Repositorios struct {
+	Clientes     ClienteRepository
+	Productos    ProductoRepository
+	Categorias   CategoriaRepository
+	Imagenes     ImagenRepository
+	Variantes    VarianteRepository
+	Pedidos      PedidoRepository
+	Devoluciones DevolucionRepository
+	Carritos     CarritoRepository
+	Cupones      CuponRepository
+	Promociones  PromocionRepository
+	Envios       EnvioRepository
+	Impuestos    ImpuestoRepository
+	Sesiones     SesionRepository
+	Estadisticas EstadisticasRepository
 }
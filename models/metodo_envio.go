@@ -0,0 +1,538 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"unicode/utf8"
+)
+
+// Tipos de método de envío.
+const (
+	// EnvioRetiro: el cliente retira el pedido en el local; no necesita
+	// dirección y, si no tiene tarifas, es gratis.
+	EnvioRetiro   = "RETIRO"
+	EnvioEstandar = "ESTANDAR"
+	EnvioExpress  = "EXPRESS"
+)
+
+// ErrEnvioInvalido se devuelve cuando el método o la dirección de envío
+// elegidos en el checkout no sirven para el pedido.
+var ErrEnvioInvalido = errors.New("envío no válido")
+
+// ZonaEnvio agrupa las provincias que comparten tarifas. Una provincia
+// pertenece como mucho a una zona.
+type ZonaEnvio struct {
+	ID         int
+	Nombre     string
+	Provincias []string
+}
+
+// TarifaEnvio es el costo de un método para una zona (IDZona 0: todas), hasta
+// un peso en kg (PesoHasta 0: sin límite) y desde un importe de compra.
+type TarifaEnvio struct {
+	IDZona       int
+	PesoHasta    float64
+	ImporteDesde dinero.Monto
+	Costo        dinero.Monto
+}
+
+// MetodoEnvio es una forma de entrega que el cliente elige en el checkout.
+// GratisDesde (0: nunca) hace gratis el envío a partir de ese importe, en las
+// zonas a las que el método llega.
+type MetodoEnvio struct {
+	ID          int
+	Nombre      string
+	Tipo        string
+	Descripcion string
+	GratisDesde dinero.Monto
+	Activo      bool
+	Tarifas     []TarifaEnvio
+}
+
+// DireccionEnvio es la dirección de entrega que se copia en el pedido.
+type DireccionEnvio struct {
+	Destinatario string
+	Direccion    string
+	Provincia    string
+	Telefono     string
+}
+
+// RequiereDireccion indica si el método entrega en una dirección.
+func (m MetodoEnvio) RequiereDireccion() bool {
+	return m.Tipo != EnvioRetiro
+}
+
+// aplica indica si la tarifa sirve para la zona, el peso y el importe.
+func (t TarifaEnvio) aplica(idZona int, peso float64, importe dinero.Monto) bool {
+	return (t.IDZona == 0 || t.IDZona == idZona) &&
+		(t.PesoHasta == 0 || peso <= t.PesoHasta) &&
+		importe >= t.ImporteDesde
+}
+
+// masEspecifica indica si la tarifa gana sobre `otra` cuando las dos
+// aplican: primero la de una zona concreta, después la del menor tope de
+// peso y por último la del mayor importe mínimo.
+func (t TarifaEnvio) masEspecifica(otra TarifaEnvio) bool {
+	if (t.IDZona != 0) != (otra.IDZona != 0) {
+		return t.IDZona != 0
+	}
+	if t.PesoHasta != otra.PesoHasta {
+		if t.PesoHasta == 0 || otra.PesoHasta == 0 {
+			return otra.PesoHasta == 0
+		}
+		return t.PesoHasta < otra.PesoHasta
+	}
+	return t.ImporteDesde > otra.ImporteDesde
+}
+
+// Cotizar devuelve el costo del envío a la zona (0 si la provincia no está en
+// ninguna) de un pedido con ese peso e importe, usando la tarifa más
+// específica que aplique. Devuelve false si el método no llega.
+func (m MetodoEnvio) Cotizar(idZona int, peso float64, importe dinero.Monto) (dinero.Monto, bool) {
+	var mejor *TarifaEnvio
+	for i, t := range m.Tarifas {
+		if t.aplica(idZona, peso, importe) && (mejor == nil || t.masEspecifica(*mejor)) {
+			mejor = &m.Tarifas[i]
+		}
+	}
+	if mejor == nil {
+		return 0, m.Tipo == EnvioRetiro && len(m.Tarifas) == 0
+	}
+	if m.GratisDesde > 0 && importe >= m.GratisDesde {
+		return 0, true
+	}
+	return mejor.Costo, true
+}
+
+// NormalizarProvincia quita los espacios sobrantes del nombre de una
+// provincia.
+func NormalizarProvincia(provincia string) string {
+	return strings.Join(strings.Fields(provincia), " ")
+}
+
+// ZonaDeProvincia devuelve el ID de la zona que contiene la provincia, sin
+// distinguir mayúsculas, o 0 si no está en ninguna.
+func ZonaDeProvincia(zonas []ZonaEnvio, provincia string) int {
+	provincia = NormalizarProvincia(provincia)
+	for _, z := range zonas {
+		for _, p := range z.Provincias {
+			if strings.EqualFold(p, provincia) {
+				return z.ID
+			}
+		}
+	}
+	return 0
+}
+
+// ValidarZonaEnvio comprueba los datos de una zona antes de guardarla. Que
+// las provincias no estén en otra zona lo comprueba el repositorio.
+func ValidarZonaEnvio(z ZonaEnvio) error {
+	if z.Nombre == "" || utf8.RuneCountInString(z.Nombre) > 100 {
+		return fmt.Errorf("el nombre es obligatorio y de hasta 100 caracteres")
+	}
+	if len(z.Provincias) == 0 {
+		return fmt.Errorf("agrega al menos una provincia")
+	}
+	vistas := map[string]bool{}
+	for _, p := range z.Provincias {
+		if p == "" || utf8.RuneCountInString(p) > 100 {
+			return fmt.Errorf("cada provincia debe tener entre 1 y 100 caracteres")
+		}
+		if vistas[strings.ToLower(p)] {
+			return fmt.Errorf("la provincia %s está repetida", p)
+		}
+		vistas[strings.ToLower(p)] = true
+	}
+	return nil
+}
+
+// ValidarMetodoEnvio comprueba los datos de un método antes de guardarlo.
+func ValidarMetodoEnvio(m MetodoEnvio) error {
+	if m.Nombre == "" || utf8.RuneCountInString(m.Nombre) > 100 {
+		return fmt.Errorf("el nombre es obligatorio y de hasta 100 caracteres")
+	}
+	if utf8.RuneCountInString(m.Descripcion) > 255 {
+		return fmt.Errorf("la descripción admite hasta 255 caracteres")
+	}
+	switch m.Tipo {
+	case EnvioRetiro, EnvioEstandar, EnvioExpress:
+	default:
+		return fmt.Errorf("tipo de envío desconocido: %q", m.Tipo)
+	}
+	if m.GratisDesde < 0 {
+		return fmt.Errorf("el importe para envío gratis no puede ser negativo")
+	}
+	if m.Tipo != EnvioRetiro && len(m.Tarifas) == 0 {
+		return fmt.Errorf("agrega al menos una tarifa")
+	}
+	for i, t := range m.Tarifas {
+		if t.Costo < 0 || t.PesoHasta < 0 || t.ImporteDesde < 0 {
+			return fmt.Errorf("tarifa %d: el costo, el peso y el importe no pueden ser negativos", i+1)
+		}
+	}
+	return nil
+}
+
+// elegirEnvio valida el método y la dirección de la solicitud de checkout
+// contra los métodos activos y calcula el costo para el peso y el importe del
+// pedido. Si no hay métodos activos la tienda no cobra envío y el método
+// puede quedar sin elegir. Devuelve el método, el costo y la dirección a
+// guardar en el pedido.
+func elegirEnvio(s SolicitudCheckout, metodos []MetodoEnvio, zonas []ZonaEnvio, peso float64, importe dinero.Monto) (MetodoEnvio, dinero.Monto, DireccionEnvio, error) {
+	d := DireccionEnvio{
+		Destinatario: strings.TrimSpace(s.Direccion.Destinatario),
+		Direccion:    strings.TrimSpace(s.Direccion.Direccion),
+		Provincia:    NormalizarProvincia(s.Direccion.Provincia),
+		Telefono:     strings.TrimSpace(s.Direccion.Telefono),
+	}
+	if utf8.RuneCountInString(d.Destinatario) > 100 || utf8.RuneCountInString(d.Direccion) > 255 || utf8.RuneCountInString(d.Provincia) > 100 || utf8.RuneCountInString(d.Telefono) > 20 {
+		return MetodoEnvio{}, 0, d, fmt.Errorf("%w: la dirección es demasiado larga", ErrEnvioInvalido)
+	}
+	if len(metodos) == 0 && s.IDMetodoEnvio == 0 {
+		return MetodoEnvio{}, 0, d, nil
+	}
+
+	var metodo MetodoEnvio
+	for _, m := range metodos {
+		if m.ID == s.IDMetodoEnvio {
+			metodo = m
+		}
+	}
+	if metodo.ID == 0 {
+		return MetodoEnvio{}, 0, d, fmt.Errorf("%w: elige un método de envío", ErrEnvioInvalido)
+	}
+	if !metodo.RequiereDireccion() {
+		d.Direccion, d.Provincia = "", ""
+	} else if d.Direccion == "" || d.Provincia == "" {
+		return MetodoEnvio{}, 0, d, fmt.Errorf("%w: indica la dirección y la provincia de entrega", ErrEnvioInvalido)
+	}
+	costo, ok := metodo.Cotizar(ZonaDeProvincia(zonas, d.Provincia), peso, importe)
+	if !ok {
+		if d.Provincia == "" {
+			return MetodoEnvio{}, 0, d, fmt.Errorf("%w: %s no está disponible para este pedido", ErrEnvioInvalido, metodo.Nombre)
+		}
+		return MetodoEnvio{}, 0, d, fmt.Errorf("%w: %s no está disponible para %s con este pedido", ErrEnvioInvalido, metodo.Nombre, d.Provincia)
+	}
+	return metodo, costo, d, nil
+}
+
+// columnasMetodoEnvio son las columnas que lee scanMetodoEnvio, en orden.
+const columnasMetodoEnvio = "id_metodo, nombre, tipo, descripcion, gratis_desde, activo"
+
+// scanMetodoEnvio lee una fila con columnasMetodoEnvio.
+func scanMetodoEnvio(scan func(dest ...interface{}) error) (MetodoEnvio, error) {
+	var m MetodoEnvio
+	var descripcion sql.NullString
+	err := scan(&m.ID, &m.Nombre, &m.Tipo, &descripcion, &m.GratisDesde, &m.Activo)
+	m.Descripcion = descripcion.String
+	return m, err
+}
+
+// argsMetodoEnvio devuelve los valores de las columnas editables del método,
+// en el orden de INSERT y UPDATE.
+func argsMetodoEnvio(m MetodoEnvio) []interface{} {
+	return []interface{}{
+		m.Nombre, m.Tipo,
+		sql.NullString{String: m.Descripcion, Valid: m.Descripcion != ""},
+		nullMonto(m.GratisDesde),
+		m.Activo,
+	}
+}
+
+// consultarMetodosEnvio devuelve los métodos de la consulta con sus tarifas.
+func consultarMetodosEnvio(where string, args ...interface{}) ([]MetodoEnvio, error) {
+	var metodos []MetodoEnvio
+	rows, err := pool.Query("SELECT "+columnasMetodoEnvio+" FROM metodos_envio"+where+" ORDER BY id_metodo", args...)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return metodos, err
+	}
+	for rows.Next() {
+		m, err := scanMetodoEnvio(rows.Scan)
+		if err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return metodos, err
+		}
+		metodos = append(metodos, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return metodos, err
+	}
+	for i := range metodos {
+		if metodos[i].Tarifas, err = tarifasMetodo(metodos[i].ID); err != nil {
+			return metodos, err
+		}
+	}
+	return metodos, nil
+}
+
+// tarifasMetodo lee las tarifas de un método en el orden en que se cargaron.
+func tarifasMetodo(idMetodo int) ([]TarifaEnvio, error) {
+	var tarifas []TarifaEnvio
+	rows, err := pool.Query("SELECT id_zona, peso_hasta, importe_desde, costo FROM tarifas_envio WHERE id_metodo = ? ORDER BY id_tarifa", idMetodo)
+	if err != nil {
+		log.Println("Error al leer las tarifas de envío", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TarifaEnvio
+		var idZona sql.NullInt64
+		var peso sql.NullFloat64
+		if err := rows.Scan(&idZona, &peso, &t.ImporteDesde, &t.Costo); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		t.IDZona = int(idZona.Int64)
+		t.PesoHasta = peso.Float64
+		tarifas = append(tarifas, t)
+	}
+	return tarifas, rows.Err()
+}
+
+// GetAllMetodosEnvio devuelve todos los métodos de envío con sus tarifas.
+func GetAllMetodosEnvio() ([]MetodoEnvio, error) {
+	return consultarMetodosEnvio("")
+}
+
+// GetMetodosEnvioActivos devuelve los métodos que se ofrecen en el checkout.
+func GetMetodosEnvioActivos() ([]MetodoEnvio, error) {
+	return consultarMetodosEnvio(" WHERE activo = 1")
+}
+
+// GetMetodoEnvioByID devuelve un método con sus tarifas.
+func GetMetodoEnvioByID(id int) (MetodoEnvio, error) {
+	metodos, err := consultarMetodosEnvio(" WHERE id_metodo = ?", id)
+	if err != nil {
+		return MetodoEnvio{}, err
+	}
+	if len(metodos) == 0 {
+		return MetodoEnvio{}, fmt.Errorf("método de envío no encontrado con ID: %d", id)
+	}
+	return metodos[0], nil
+}
+
+// guardarTarifasMetodo reemplaza las tarifas del método.
+func guardarTarifasMetodo(tx *sql.Tx, m MetodoEnvio) error {
+	if _, err := tx.Exec("DELETE FROM tarifas_envio WHERE id_metodo = ?", m.ID); err != nil {
+		return err
+	}
+	for _, t := range m.Tarifas {
+		peso := sql.NullFloat64{Float64: t.PesoHasta, Valid: t.PesoHasta > 0}
+		if _, err := tx.Exec("INSERT INTO tarifas_envio (id_metodo, id_zona, peso_hasta, importe_desde, costo) VALUES (?, ?, ?, ?, ?)", m.ID, nullID(t.IDZona), peso, t.ImporteDesde, t.Costo); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateMetodoEnvio inserta un método con sus tarifas.
+func CreateMetodoEnvio(m MetodoEnvio) error {
+	if err := ValidarMetodoEnvio(m); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO metodos_envio (nombre, tipo, descripcion, gratis_desde, activo) VALUES (?, ?, ?, ?, ?)", argsMetodoEnvio(m)...)
+	if err != nil {
+		log.Println("Error al crear el método de envío", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+	if err := guardarTarifasMetodo(tx, m); err != nil {
+		log.Println("Error al guardar las tarifas de envío", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateMetodoEnvio modifica un método y reemplaza sus tarifas. Los pedidos
+// ya hechos conservan el nombre y el costo que se cobró.
+func UpdateMetodoEnvio(m MetodoEnvio) error {
+	if err := ValidarMetodoEnvio(m); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	args := append(argsMetodoEnvio(m), m.ID)
+	if _, err := tx.Exec("UPDATE metodos_envio SET nombre = ?, tipo = ?, descripcion = ?, gratis_desde = ?, activo = ? WHERE id_metodo = ?", args...); err != nil {
+		log.Println("Error al actualizar el método de envío", err)
+		return err
+	}
+	if err := guardarTarifasMetodo(tx, m); err != nil {
+		log.Println("Error al guardar las tarifas de envío", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteMetodoEnvio elimina un método y sus tarifas. Los pedidos conservan su
+// nombre.
+func DeleteMetodoEnvio(id int) error {
+	if _, err := pool.Exec("DELETE FROM metodos_envio WHERE id_metodo = ?", id); err != nil {
+		log.Println("Error al eliminar el método de envío", err)
+		return err
+	}
+	return nil
+}
+
+// GetAllZonasEnvio devuelve las zonas con sus provincias, por nombre.
+func GetAllZonasEnvio() ([]ZonaEnvio, error) {
+	var zonas []ZonaEnvio
+	rows, err := pool.Query("SELECT id_zona, nombre FROM zonas_envio ORDER BY nombre")
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return zonas, err
+	}
+	porID := map[int]int{}
+	for rows.Next() {
+		var z ZonaEnvio
+		if err := rows.Scan(&z.ID, &z.Nombre); err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return zonas, err
+		}
+		porID[z.ID] = len(zonas)
+		zonas = append(zonas, z)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return zonas, err
+	}
+
+	rows, err = pool.Query("SELECT id_zona, provincia FROM zona_provincias ORDER BY provincia")
+	if err != nil {
+		log.Println("Error al leer las provincias de las zonas", err)
+		return zonas, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		var provincia string
+		if err := rows.Scan(&id, &provincia); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return zonas, err
+		}
+		if i, ok := porID[id]; ok {
+			zonas[i].Provincias = append(zonas[i].Provincias, provincia)
+		}
+	}
+	return zonas, rows.Err()
+}
+
+// GetZonaEnvioByID devuelve una zona con sus provincias.
+func GetZonaEnvioByID(id int) (ZonaEnvio, error) {
+	zonas, err := GetAllZonasEnvio()
+	if err != nil {
+		return ZonaEnvio{}, err
+	}
+	for _, z := range zonas {
+		if z.ID == id {
+			return z, nil
+		}
+	}
+	return ZonaEnvio{}, fmt.Errorf("zona de envío no encontrada con ID: %d", id)
+}
+
+// guardarProvinciasZona reemplaza las provincias de la zona. Falla si alguna
+// ya está en otra zona.
+func guardarProvinciasZona(tx *sql.Tx, z ZonaEnvio) error {
+	if _, err := tx.Exec("DELETE FROM zona_provincias WHERE id_zona = ?", z.ID); err != nil {
+		return err
+	}
+	for _, p := range z.Provincias {
+		var otra string
+		err := tx.QueryRow("SELECT z.nombre FROM zona_provincias p JOIN zonas_envio z ON z.id_zona = p.id_zona WHERE p.provincia = ? FOR UPDATE", p).Scan(&otra)
+		if err == nil {
+			return fmt.Errorf("la provincia %s ya está en la zona %s", p, otra)
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+		if _, err := tx.Exec("INSERT INTO zona_provincias (id_zona, provincia) VALUES (?, ?)", z.ID, p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateZonaEnvio inserta una zona con sus provincias.
+func CreateZonaEnvio(z ZonaEnvio) error {
+	if err := ValidarZonaEnvio(z); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO zonas_envio (nombre) VALUES (?)", z.Nombre)
+	if err != nil {
+		log.Println("Error al crear la zona de envío", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	z.ID = int(id)
+	if err := guardarProvinciasZona(tx, z); err != nil {
+		log.Println("Error al guardar las provincias de la zona", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateZonaEnvio modifica una zona y reemplaza sus provincias.
+func UpdateZonaEnvio(z ZonaEnvio) error {
+	if err := ValidarZonaEnvio(z); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE zonas_envio SET nombre = ? WHERE id_zona = ?", z.Nombre, z.ID); err != nil {
+		log.Println("Error al actualizar la zona de envío", err)
+		return err
+	}
+	if err := guardarProvinciasZona(tx, z); err != nil {
+		log.Println("Error al guardar las provincias de la zona", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteZonaEnvio elimina una zona, sus provincias y las tarifas que la usan.
+func DeleteZonaEnvio(id int) error {
+	if _, err := pool.Exec("DELETE FROM zonas_envio WHERE id_zona = ?", id); err != nil {
+		log.Println("Error al eliminar la zona de envío", err)
+		return err
+	}
+	return nil
+}
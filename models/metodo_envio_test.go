@@ -0,0 +1,134 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTarifaMasEspecifica(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		t, otra  TarifaEnvio
+		esperado bool
+	}{
+		{"zona sobre cualquier zona", TarifaEnvio{IDZona: 1}, TarifaEnvio{}, true},
+		{"cualquier zona no gana a una zona", TarifaEnvio{}, TarifaEnvio{IDZona: 1}, false},
+		{"la zona pesa más que el tope de peso", TarifaEnvio{IDZona: 1}, TarifaEnvio{PesoHasta: 5}, true},
+		{"menor tope de peso", TarifaEnvio{IDZona: 1, PesoHasta: 5}, TarifaEnvio{IDZona: 1, PesoHasta: 10}, true},
+		{"mayor tope de peso", TarifaEnvio{IDZona: 1, PesoHasta: 10}, TarifaEnvio{IDZona: 1, PesoHasta: 5}, false},
+		{"con tope sobre sin tope", TarifaEnvio{PesoHasta: 5}, TarifaEnvio{}, true},
+		{"sin tope no gana a con tope", TarifaEnvio{}, TarifaEnvio{PesoHasta: 5}, false},
+		{"el tope pesa más que el importe", TarifaEnvio{PesoHasta: 5}, TarifaEnvio{PesoHasta: 10, ImporteDesde: 5000}, true},
+		{"mayor importe mínimo", TarifaEnvio{ImporteDesde: 5000}, TarifaEnvio{}, true},
+		{"menor importe mínimo", TarifaEnvio{}, TarifaEnvio{ImporteDesde: 5000}, false},
+		{"iguales", TarifaEnvio{IDZona: 1, PesoHasta: 5, ImporteDesde: 5000}, TarifaEnvio{IDZona: 1, PesoHasta: 5, ImporteDesde: 5000}, false},
+	}
+	for _, c := range casos {
+		if got := c.t.masEspecifica(c.otra); got != c.esperado {
+			t.Errorf("%s: masEspecifica = %v; se esperaba %v", c.nombre, got, c.esperado)
+		}
+	}
+}
+
+func TestCotizar(t *testing.T) {
+	estandar := MetodoEnvio{Nombre: "Estándar", Tipo: EnvioEstandar, GratisDesde: 50000, Tarifas: []TarifaEnvio{
+		{Costo: 3000},
+		{IDZona: 1, Costo: 1500},
+		{IDZona: 1, PesoHasta: 5, Costo: 1000},
+		{IDZona: 1, PesoHasta: 5, ImporteDesde: 20000, Costo: 500},
+		{IDZona: 2, PesoHasta: 10, Costo: 2000},
+	}}
+	express := MetodoEnvio{Nombre: "Express", Tipo: EnvioExpress, GratisDesde: 1000, Tarifas: []TarifaEnvio{{IDZona: 1, PesoHasta: 5, Costo: 4000}}}
+
+	casos := []struct {
+		nombre  string
+		metodo  MetodoEnvio
+		idZona  int
+		peso    float64
+		importe dinero.Monto
+		costo   dinero.Monto
+		llega   bool
+	}{
+		{"provincia sin zona usa la tarifa general", estandar, 0, 3, 1000, 3000, true},
+		{"zona sin tarifa propia usa la general", estandar, 3, 3, 1000, 3000, true},
+		{"la tarifa de la zona gana a la general", estandar, 1, 8, 1000, 1500, true},
+		{"el menor tope de peso que alcanza", estandar, 1, 3, 1000, 1000, true},
+		{"el tope de peso es inclusivo", estandar, 1, 5, 1000, 1000, true},
+		{"el mayor importe mínimo alcanzado", estandar, 1, 3, 20000, 500, true},
+		{"debajo del importe mínimo", estandar, 1, 3, 19999, 1000, true},
+		{"pasado el tope de la zona vuelve a la general", estandar, 2, 12, 1000, 3000, true},
+		{"dentro del tope de la zona", estandar, 2, 10, 1000, 2000, true},
+		{"gratis desde el umbral", estandar, 1, 3, 50000, 0, true},
+		{"justo debajo del umbral", estandar, 1, 3, 49999, 500, true},
+		{"gratis también con la tarifa general", estandar, 0, 30, 50000, 0, true},
+		{"no llega a otra zona", express, 2, 1, 500, 0, false},
+		{"no llega aunque supere el umbral de gratis", express, 2, 1, 99999, 0, false},
+		{"no lleva tanto peso", express, 1, 6, 500, 0, false},
+		{"express en su zona", express, 1, 2, 500, 4000, true},
+		{"express gratis en su zona", express, 1, 2, 1000, 0, true},
+		{"retiro sin tarifas es gratis", MetodoEnvio{Tipo: EnvioRetiro}, 0, 100, 0, 0, true},
+		{"retiro con tarifa", MetodoEnvio{Tipo: EnvioRetiro, Tarifas: []TarifaEnvio{{Costo: 200}}}, 0, 1, 0, 200, true},
+		{"retiro con tarifas que no aplican", MetodoEnvio{Tipo: EnvioRetiro, Tarifas: []TarifaEnvio{{PesoHasta: 5, Costo: 200}}}, 0, 10, 0, 0, false},
+		{"envío sin tarifas", MetodoEnvio{Tipo: EnvioEstandar}, 1, 1, 1000, 0, false},
+	}
+	for _, c := range casos {
+		costo, llega := c.metodo.Cotizar(c.idZona, c.peso, c.importe)
+		if costo != c.costo || llega != c.llega {
+			t.Errorf("%s: Cotizar = %v, %v; se esperaba %v, %v", c.nombre, costo, llega, c.costo, c.llega)
+		}
+	}
+}
+
+func TestElegirEnvio(t *testing.T) {
+	zonas := []ZonaEnvio{
+		{ID: 1, Nombre: "Centro", Provincias: []string{"Buenos Aires", "Córdoba"}},
+		{ID: 2, Nombre: "Sur", Provincias: []string{"Chubut"}},
+	}
+	retiro := MetodoEnvio{ID: 1, Nombre: "Retiro en el local", Tipo: EnvioRetiro}
+	estandar := MetodoEnvio{ID: 2, Nombre: "Estándar", Tipo: EnvioEstandar, Tarifas: []TarifaEnvio{{IDZona: 1, Costo: 1500}, {IDZona: 2, Costo: 2500}}}
+	metodos := []MetodoEnvio{retiro, estandar}
+	direccion := DireccionEnvio{Destinatario: " Ana ", Direccion: " Calle 1 ", Provincia: "  buenos   aires ", Telefono: "1234"}
+
+	casos := []struct {
+		nombre    string
+		metodos   []MetodoEnvio
+		idMetodo  int
+		direccion DireccionEnvio
+		elegido   int
+		costo     dinero.Monto
+		entrega   DireccionEnvio
+		invalido  bool
+	}{
+		{nombre: "sin métodos activos no se cobra envío", direccion: direccion,
+			entrega: DireccionEnvio{Destinatario: "Ana", Direccion: "Calle 1", Provincia: "buenos aires", Telefono: "1234"}},
+		{nombre: "sin métodos activos no se puede elegir uno", idMetodo: 2, direccion: direccion, invalido: true},
+		{nombre: "hay que elegir un método", metodos: metodos, direccion: direccion, invalido: true},
+		{nombre: "método inactivo o inexistente", metodos: metodos, idMetodo: 9, direccion: direccion, invalido: true},
+		{nombre: "retiro sin tarifas no guarda la dirección", metodos: metodos, idMetodo: 1, direccion: direccion, elegido: 1,
+			entrega: DireccionEnvio{Destinatario: "Ana", Telefono: "1234"}},
+		{nombre: "envío a una provincia de la zona", metodos: metodos, idMetodo: 2, direccion: direccion, elegido: 2, costo: 1500,
+			entrega: DireccionEnvio{Destinatario: "Ana", Direccion: "Calle 1", Provincia: "buenos aires", Telefono: "1234"}},
+		{nombre: "envío sin provincia", metodos: metodos, idMetodo: 2, direccion: DireccionEnvio{Direccion: "Calle 1"}, invalido: true},
+		{nombre: "envío sin dirección", metodos: metodos, idMetodo: 2, direccion: DireccionEnvio{Provincia: "Chubut"}, invalido: true},
+		{nombre: "envío a una provincia adonde no llega", metodos: metodos, idMetodo: 2, direccion: DireccionEnvio{Direccion: "Calle 1", Provincia: "Jujuy"}, invalido: true},
+		{nombre: "destinatario demasiado largo", metodos: metodos, idMetodo: 1, direccion: DireccionEnvio{Destinatario: strings.Repeat("a", 101)}, invalido: true},
+	}
+	for _, c := range casos {
+		metodo, costo, entrega, err := elegirEnvio(SolicitudCheckout{IDMetodoEnvio: c.idMetodo, Direccion: c.direccion}, c.metodos, zonas, 3, 10000)
+		if c.invalido {
+			if !errors.Is(err, ErrEnvioInvalido) {
+				t.Errorf("%s: err = %v; se esperaba ErrEnvioInvalido", c.nombre, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.nombre, err)
+			continue
+		}
+		if metodo.ID != c.elegido || costo != c.costo || entrega != c.entrega {
+			t.Errorf("%s: = método %d, %v, %+v; se esperaba método %d, %v, %+v", c.nombre, metodo.ID, costo, entrega, c.elegido, c.costo, c.entrega)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/db/migraciones"
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// Las pruebas de este archivo corren las transacciones contra un servidor
+// MySQL real y se saltean si TEST_MYSQL_DSN no está definida, p. ej.:
+//
+//	TEST_MYSQL_DSN='root:clave@tcp(127.0.0.1:3306)/ecommerce_test' go test ./models/
+//
+// Al empezar revierten todas las migraciones y las vuelven a aplicar, así que
+// la base tiene que ser descartable: por eso su nombre debe terminar en _test.
+
+var (
+	baseOnce sync.Once
+	baseErr  error
+)
+
+// baseMySQL deja el paquete conectado a una base de pruebas con el esquema
+// recién migrado, o saltea la prueba si no hay base configurada.
+func baseMySQL(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("TEST_MYSQL_DSN no está definida")
+	}
+	baseOnce.Do(func() { baseErr = prepararBase(dsn) })
+	if baseErr != nil {
+		t.Fatal(baseErr)
+	}
+}
+
+// prepararBase abre la base, borra el esquema y lo vuelve a migrar.
+func prepararBase(dsn string) error {
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return fmt.Errorf("TEST_MYSQL_DSN inválida: %w", err)
+	}
+	if !strings.HasSuffix(cfg.DBName, "_test") {
+		return fmt.Errorf("la base %q no termina en _test: las pruebas borran su contenido", cfg.DBName)
+	}
+	cfg.ParseTime = true
+	pool, err := sql.Open("mysql", cfg.FormatDSN())
+	if err != nil {
+		return err
+	}
+	if err := pool.Ping(); err != nil {
+		return err
+	}
+	log.SetOutput(io.Discard)
+
+	todas, err := migraciones.Cargar()
+	if err != nil {
+		return err
+	}
+	m, err := migraciones.New(pool)
+	if err != nil {
+		return err
+	}
+	if _, err := m.Down(len(todas)); err != nil {
+		return err
+	}
+	if _, err := m.Up(0); err != nil {
+		return err
+	}
+	SetDB(pool)
+	return nil
+}
+
+// nuevoClienteBD registra un cliente con un email único y devuelve su ID.
+func nuevoClienteBD(t *testing.T) int {
+	t.Helper()
+	email := fmt.Sprintf("cliente%d@test.com", time.Now().UnixNano())
+	if err := CreateCliente("Ana", email, "hash", "Calle 1", "1234"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := GetClienteByEmail(email)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.ID
+}
+
+// nuevoProductoBD registra un producto activo con el precio y el stock dados.
+func nuevoProductoBD(t *testing.T, precio dinero.Monto, stock int) int {
+	t.Helper()
+	id, err := CreateProducto("Taza", "", precio, stock, 0.5, 0, "", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// stockBD devuelve el stock del producto.
+func stockBD(t *testing.T, idProducto int) int {
+	t.Helper()
+	p, err := GetProductoByID(idProducto)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.Stock
+}
+
+// pedidoBD devuelve el pedido.
+func pedidoBD(t *testing.T, id int) Pedido {
+	t.Helper()
+	p, err := GetPedidoByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// comprarBD pone `cantidad` unidades del producto en el carrito del
+// cliente y hace el checkout.
+func comprarBD(t *testing.T, idCliente, idProducto, cantidad int) (int, error) {
+	t.Helper()
+	if err := CreateCarrito(idCliente); err != nil {
+		t.Fatal(err)
+	}
+	carrito, err := GetCarritoByClienteID(idCliente)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AgregarItemCarrito(carrito.ID, idProducto, 0, cantidad); err != nil {
+		t.Fatal(err)
+	}
+	return ProcesarCheckout(SolicitudCheckout{IDCliente: idCliente, MetodoPago: "tarjeta"})
+}
+
+// pagadoBD compra y registra el cobro aprobado con la transacción `tx`.
+func pagadoBD(t *testing.T, idCliente, idProducto, cantidad int, tx string) int {
+	t.Helper()
+	id, err := comprarBD(t, idCliente, idProducto, cantidad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RegistrarCobro(id, Cobro{Proveedor: "simulado", TransaccionID: tx, Pagado: true}); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+func TestMySQLCheckoutDescuentaStockYVaciaElCarrito(t *testing.T) {
+	baseMySQL(t)
+	cliente := nuevoClienteBD(t)
+	producto := nuevoProductoBD(t, 1000, 5)
+
+	id, err := comprarBD(t, cliente, producto, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pedidoBD(t, id)
+	if p.Estado != EstadoPendiente || p.Subtotal != 2000 || p.Total != 2000 {
+		t.Errorf("pedido = %s, subtotal %v, total %v; se esperaba PENDIENTE por 2000", p.Estado, p.Subtotal, p.Total)
+	}
+	detalles, err := GetDetallesByPedidoID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(detalles) != 1 || detalles[0].Cantidad != 2 || detalles[0].PrecioUnitario != 1000 {
+		t.Errorf("detalles = %+v", detalles)
+	}
+	if got := stockBD(t, producto); got != 3 {
+		t.Errorf("stock = %d, se esperaba 3", got)
+	}
+	carrito, err := GetCarritoByClienteID(cliente)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if items, err := GetItemsByCarritoID(carrito.ID); err != nil || len(items) != 0 {
+		t.Errorf("el carrito quedó con %d ítems (%v)", len(items), err)
+	}
+	historial, err := GetHistorialPedido(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(historial) != 1 || historial[0].EstadoNuevo != EstadoPendiente {
+		t.Errorf("historial = %+v", historial)
+	}
+}
+
+func TestMySQLCheckoutSinStockNoCreaElPedido(t *testing.T) {
+	baseMySQL(t)
+	cliente := nuevoClienteBD(t)
+	producto := nuevoProductoBD(t, 1000, 1)
+
+	_, err := comprarBD(t, cliente, producto, 2)
+	var sinStock *StockInsuficienteError
+	if !errors.As(err, &sinStock) {
+		t.Fatalf("err = %v, se esperaba StockInsuficienteError", err)
+	}
+	if got := stockBD(t, producto); got != 1 {
+		t.Errorf("stock = %d, se esperaba 1", got)
+	}
+	pedidos, err := GetPedidosByClienteID(cliente)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pedidos) != 0 {
+		t.Errorf("se crearon %d pedidos", len(pedidos))
+	}
+}
+
+func TestMySQLCancelarRegistraElReembolsoPendiente(t *testing.T) {
+	baseMySQL(t)
+	cliente := nuevoClienteBD(t)
+	producto := nuevoProductoBD(t, 1500, 4)
+	id := pagadoBD(t, cliente, producto, 2, "sim_cancelar")
+
+	_, err := CambiarEstadoPedido(SolicitudCambioEstado{IDPedido: id, Estado: EstadoCancelado, IDCliente: cliente, Responsable: "Ana", Motivo: "Me equivoqué", DevolverPago: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := pedidoBD(t, id)
+	if p.Estado != EstadoCancelado || p.Reembolsado != 3000 {
+		t.Errorf("pedido = %s con %v reembolsado; se esperaba CANCELADO con 3000", p.Estado, p.Reembolsado)
+	}
+	if got := stockBD(t, producto); got != 4 {
+		t.Errorf("stock = %d, se esperaba 4", got)
+	}
+	reembolsos, err := GetReembolsosByPedidoID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reembolsos) != 1 {
+		t.Fatalf("reembolsos = %+v", reembolsos)
+	}
+	r := reembolsos[0]
+	if !r.Pendiente() || r.Operacion != OperacionReembolso || r.Monto != 3000 || r.TransaccionID != "sim_cancelar" {
+		t.Errorf("reembolso = %+v", r)
+	}
+
+	if err := RegistrarResultadoReembolso(r.ID, errors.New("sin respuesta")); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegistrarResultadoReembolso(r.ID, nil); err != nil {
+		t.Fatal(err)
+	}
+	reembolsos, err = GetReembolsosByPedidoID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reembolsos[0].Estado != ReembolsoHecho || reembolsos[0].Error != "" {
+		t.Errorf("reembolso = %+v, se esperaba HECHO sin error", reembolsos[0])
+	}
+
+	// Un pedido cancelado no admite otra transición.
+	_, err = CambiarEstadoPedido(SolicitudCambioEstado{IDPedido: id, Estado: EstadoPagado, Responsable: "Admin"})
+	if !errors.Is(err, ErrTransicionInvalida) {
+		t.Errorf("err = %v, se esperaba ErrTransicionInvalida", err)
+	}
+}
+
+func TestMySQLEnvioYDevolucionReembolsada(t *testing.T) {
+	baseMySQL(t)
+	cliente := nuevoClienteBD(t)
+	producto := nuevoProductoBD(t, 1000, 3)
+	id := pagadoBD(t, cliente, producto, 3, "sim_devolucion")
+	detalles, err := GetDetallesByPedidoID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	linea := detalles[0].ID
+
+	// Un envío parcial y otro con el resto, ya entregado.
+	if _, _, err := RegistrarEnvio(SolicitudEnvio{IDPedido: id, Transportista: "Correo", Cantidades: map[int]int{linea: 1}, Responsable: "Admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := pedidoBD(t, id); p.Estado != EstadoEnviadoParcial {
+		t.Errorf("estado = %s, se esperaba %s", p.Estado, EstadoEnviadoParcial)
+	}
+	_, _, err = RegistrarEnvio(SolicitudEnvio{IDPedido: id, Transportista: "Correo", Cantidades: map[int]int{linea: 3}, Responsable: "Admin"})
+	if !errors.Is(err, ErrEnvioPedidoInvalido) {
+		t.Errorf("err = %v, se esperaba ErrEnvioPedidoInvalido por enviar de más", err)
+	}
+	if _, _, err := RegistrarEnvio(SolicitudEnvio{IDPedido: id, Transportista: "Correo", Cantidades: map[int]int{linea: 2}, FechaEntrega: time.Now(), Responsable: "Admin"}); err != nil {
+		t.Fatal(err)
+	}
+	if p := pedidoBD(t, id); p.Estado != EstadoEntregado {
+		t.Fatalf("estado = %s, se esperaba %s", p.Estado, EstadoEntregado)
+	}
+	envios, err := GetEnviosByPedidoID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(envios) != 2 {
+		t.Errorf("envíos = %d, se esperaban 2", len(envios))
+	}
+
+	idDev, err := SolicitarDevolucion(SolicitudDevolucion{IDCliente: cliente, IDPedido: id, Motivo: "Llegó rota", Cantidades: map[int]int{linea: 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CambiarEstadoDevolucion(SolicitudEstadoDevolucion{ID: idDev, Estado: DevolucionAprobada}); err != nil {
+		t.Fatal(err)
+	}
+	dev, err := GetDevolucionByID(idDev)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := CambiarEstadoDevolucion(SolicitudEstadoDevolucion{ID: idDev, Estado: DevolucionRecibida, Reponer: []int{dev.Lineas[0].ID}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := stockBD(t, producto); got != 1 {
+		t.Errorf("stock = %d, se esperaba 1 tras reponer la unidad devuelta", got)
+	}
+	dev, err = CambiarEstadoDevolucion(SolicitudEstadoDevolucion{ID: idDev, Estado: DevolucionReembolsada, Nota: "Reembolsada"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dev.Estado != DevolucionReembolsada || dev.Monto != 1000 {
+		t.Errorf("devolución = %s por %v", dev.Estado, dev.Monto)
+	}
+	if p := pedidoBD(t, id); p.Reembolsado != 1000 {
+		t.Errorf("reembolsado = %v, se esperaba 1000", p.Reembolsado)
+	}
+	pendientes, err := GetReembolsosPendientes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var encontrado bool
+	for _, r := range pendientes {
+		if r.IDDevolucion == idDev {
+			encontrado = true
+			if r.Monto != 1000 || r.Clave() != fmt.Sprintf("devolucion-%d", idDev) {
+				t.Errorf("reembolso = %+v", r)
+			}
+		}
+	}
+	if !encontrado {
+		t.Error("la devolución no dejó un reembolso pendiente")
+	}
+
+	// Reembolsar otra vez no es una transición válida y no suma otro reembolso.
+	_, err = CambiarEstadoDevolucion(SolicitudEstadoDevolucion{ID: idDev, Estado: DevolucionReembolsada})
+	if !errors.Is(err, ErrTransicionInvalida) {
+		t.Errorf("err = %v, se esperaba ErrTransicionInvalida", err)
+	}
+	if p := pedidoBD(t, id); p.Reembolsado != 1000 {
+		t.Errorf("reembolsado = %v tras reintentar, se esperaba 1000", p.Reembolsado)
+	}
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+)
+
+// Tipos de evento de pago, ya traducidos del formato de cada pasarela.
+const (
+	PagoAprobado    = "APROBADO"
+	PagoRechazado   = "RECHAZADO"
+	PagoReembolsado = "REEMBOLSADO"
+)
+
+var (
+	// ErrTransaccionSinPedido se devuelve cuando ningún pedido tiene la
+	// transacción del evento. Puede pasar si el webhook llega antes de que
+	// el checkout registre el cobro (ver RegistrarCobro); la pasarela lo
+	// reintentará.
+	ErrTransaccionSinPedido = errors.New("ningún pedido tiene esa transacción")
+	// ErrMontoPago se devuelve cuando el monto aprobado no coincide con el
+	// total del pedido. El pedido no se marca como pagado.
+	ErrMontoPago = errors.New("el monto pagado no coincide con el total del pedido")
+)
+
+// EventoPago es una notificación verificada de la pasarela. (Proveedor,
+// IDEvento) identifica el evento: los reenvíos no se aplican dos veces.
+type EventoPago struct {
+	Proveedor     string
+	IDEvento      string
+	Tipo          string
+	TransaccionID string
+	Monto         dinero.Monto
+}
+
+// Cobro es el resultado de cobrar un pedido en la pasarela. Si Pagado es
+// false el pago queda pendiente y la pasarela lo confirmará por webhook.
+type Cobro struct {
+	Proveedor     string
+	TransaccionID string
+	Pagado        bool
+}
+
+// ResponsablePasarela es el nombre con que la pasarela figura en el
+// historial de estados.
+func ResponsablePasarela(proveedor string) string {
+	return "Pasarela de pago (" + proveedor + ")"
+}
+
+// estadoPorEventoPago decide a qué estado lleva el evento al pedido, o ""
+// si no lo cambia. Un pago aprobado pasa a PAGADO un pedido PENDIENTE y uno
+// rechazado lo cancela (con lo que se repone el stock); en otro estado, o si
+// es un reembolso, el evento solo queda registrado. `aCobrar` es lo que se
+// cobra por la pasarela (ver Pedido.ACobrar).
+func estadoPorEventoPago(e EventoPago, estado string, aCobrar dinero.Monto) (string, error) {
+	if estado != EstadoPendiente {
+		return "", nil
+	}
+	switch e.Tipo {
+	case PagoAprobado:
+		if e.Monto != aCobrar {
+			return "", fmt.Errorf("%w: se aprobaron %s y el pedido es de %s", ErrMontoPago, e.Monto.Formato(), aCobrar.Formato())
+		}
+		return EstadoPagado, nil
+	case PagoRechazado:
+		return EstadoCancelado, nil
+	}
+	return "", nil
+}
+
+// cambioPorEventoPago arma la solicitud de cambio de estado de un evento.
+func cambioPorEventoPago(e EventoPago, idPedido int, estado string) SolicitudCambioEstado {
+	motivo := "Pago aprobado"
+	if e.Tipo == PagoRechazado {
+		motivo = "Pago rechazado"
+	}
+	return SolicitudCambioEstado{
+		IDPedido:    idPedido,
+		Estado:      estado,
+		Responsable: ResponsablePasarela(e.Proveedor),
+		Motivo:      motivo + " (evento " + e.IDEvento + ")",
+	}
+}
+
+// RegistrarEventoPago aplica el evento al pedido de su transacción en una
+// transacción: bloquea el pedido, registra el evento en `pagos_eventos` (cuya
+// clave única descarta los duplicados) y cambia el estado por la máquina de
+// estados, con su entrada en el historial. Un pago aprobado de un pedido ya
+// cancelado queda como reembolso pendiente (ver Reembolso).
+func RegistrarEventoPago(e EventoPago) (bool, *CambioEstado, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return false, nil, err
+	}
+	defer tx.Rollback()
+
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE transaccion_id = ? FOR UPDATE", e.TransaccionID).Scan)
+	if err == sql.ErrNoRows {
+		return false, nil, ErrTransaccionSinPedido
+	}
+	if err != nil {
+		log.Println("Error al bloquear el pedido del pago", err)
+		return false, nil, err
+	}
+
+	result, err := tx.Exec("INSERT IGNORE INTO pagos_eventos (proveedor, id_evento, tipo, transaccion_id, id_pedido, monto) VALUES (?, ?, ?, ?, ?, ?)",
+		e.Proveedor, e.IDEvento, e.Tipo, e.TransaccionID, pedido.ID, e.Monto)
+	if err != nil {
+		log.Println("Error al registrar el evento de pago", err)
+		return false, nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil, nil
+	}
+
+	nuevo, err := estadoPorEventoPago(e, pedido.Estado, pedido.ACobrar())
+	if err != nil {
+		return false, nil, err
+	}
+	var cambio *CambioEstado
+	if nuevo != "" {
+		c, err := cambiarEstadoTx(tx, cambioPorEventoPago(e, pedido.ID, nuevo), pedido)
+		if err != nil {
+			return false, nil, err
+		}
+		cambio = &c
+	}
+	if r, ok := reembolsoPorPagoTardio(pedido, e); ok {
+		if err := registrarPagoTardio(tx, r); err != nil {
+			return false, nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return false, nil, err
+	}
+	log.Printf("Evento de pago %s (%s) registrado para el pedido %d", e.IDEvento, e.Tipo, pedido.ID)
+	return true, cambio, nil
+}
+
+// RegistrarCobro guarda en el pedido la transacción de la pasarela y, si el
+// cobro ya está pagado, pasa el pedido de PENDIENTE a PAGADO con su entrada
+// en el historial. El checkout lo llama después de confirmar el pedido: al
+// autorizar, para que los webhooks encuentren el pedido, y otra vez tras la
+// captura. Si el webhook del pago se adelantó el pedido ya no está PENDIENTE
+// y no cambia. Devuelve el cambio de estado, si hubo uno.
+func RegistrarCobro(idPedido int, c Cobro) (*CambioEstado, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	pedido, err := scanPedido(tx.QueryRow("SELECT "+columnasPedido+" FROM pedidos WHERE id_pedido = ? FOR UPDATE", idPedido).Scan)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Println("Error al bloquear el pedido", err)
+		}
+		return nil, err
+	}
+	nuevo, err := estadoPorCobro(c, pedido)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec("UPDATE pedidos SET transaccion_id = ? WHERE id_pedido = ?", c.TransaccionID, idPedido); err != nil {
+		log.Println("Error al registrar la transacción del pedido", err)
+		return nil, err
+	}
+	var cambio *CambioEstado
+	if nuevo != "" {
+		cc, err := cambiarEstadoTx(tx, cambioPorCobro(c, idPedido), pedido)
+		if err != nil {
+			return nil, err
+		}
+		cambio = &cc
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return nil, err
+	}
+	return cambio, nil
+}
+
+// estadoPorCobro decide a qué estado lleva el cobro al pedido, o "" si no lo
+// cambia. Un pedido solo admite la transacción con que se empezó a cobrar.
+func estadoPorCobro(c Cobro, pedido Pedido) (string, error) {
+	if pedido.TransaccionID != "" && pedido.TransaccionID != c.TransaccionID {
+		return "", fmt.Errorf("el pedido %d ya tiene la transacción %s", pedido.ID, pedido.TransaccionID)
+	}
+	if c.Pagado && pedido.Estado == EstadoPendiente {
+		return EstadoPagado, nil
+	}
+	return "", nil
+}
+
+// cambioPorCobro arma la solicitud de cambio de estado de un cobro aprobado.
+func cambioPorCobro(c Cobro, idPedido int) SolicitudCambioEstado {
+	return SolicitudCambioEstado{
+		IDPedido:    idPedido,
+		Estado:      EstadoPagado,
+		Responsable: ResponsablePasarela(c.Proveedor),
+		Motivo:      "Pago aprobado (transacción " + c.TransaccionID + ")",
+	}
+}
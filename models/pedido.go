@@ -1,52 +1,130 @@
 package models
 
 import (
-	"Go-Sistemas-de-Gestion-empresarial/db"
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
 	"database/sql"
 	"fmt"
 	"log"
 	"time"
 )
 
+// Estados de un pedido.
+const (
+	EstadoPendiente = "PENDIENTE"
+	EstadoPagado    = "PAGADO"
+	// EstadoEnviadoParcial: se despachó una parte de las unidades.
+	EstadoEnviadoParcial = "ENVIADO_PARCIAL"
+	EstadoEnviado        = "ENVIADO"
+	EstadoEntregado      = "ENTREGADO"
+	EstadoCancelado      = "CANCELADO"
+)
+
 type Pedido struct {
-	ID            int
-	IDCliente     int
-	Fecha         time.Time
-	Estado        string
-	Total         float64
+	ID        int
+	IDCliente int
+	Fecha     time.Time
+	Estado    string
+	// Subtotal es la suma de las líneas antes del descuento; Total es lo que
+	// se cobra.
+	Subtotal dinero.Monto
+	// DescuentoPromociones es el ahorro de las promociones automáticas y
+	// Descuento el del cupón.
+	DescuentoPromociones dinero.Monto
+	Descuento            dinero.Monto
+	Total                dinero.Monto
+	// Credito es la parte del total que se pagó con crédito a favor; el
+	// resto se cobra por la pasarela (ver ACobrar).
+	Credito dinero.Monto
+	// Reembolsado es lo que ya se devolvió al cliente por la pasarela.
+	Reembolsado   dinero.Monto
 	MetodoPago    string
 	TransaccionID string
+	// IDCupon es 0 si no se usó cupón o si el cupón se eliminó después;
+	// CodigoCupon conserva el código usado.
+	IDCupon     int
+	CodigoCupon string
+	// IDMetodoEnvio es 0 si no se eligió método o si se eliminó después;
+	// MetodoEnvio conserva su nombre. CostoEnvio ya está sumado en Total.
+	IDMetodoEnvio int
+	MetodoEnvio   string
+	CostoEnvio    dinero.Monto
+	// Impuestos es el impuesto de todas las líneas. Si ImpuestosIncluidos
+	// es false los precios no lo incluían y ya está sumado en Total.
+	Impuestos          dinero.Monto
+	ImpuestosIncluidos bool
+	// Entrega es la copia de la dirección al momento de la compra.
+	Entrega DireccionEnvio
+}
+
+// columnasPedido son las columnas que lee scanPedido, en orden.
+const columnasPedido = "id_pedido, id_cliente, fecha, estado, subtotal, descuento_promociones, descuento, total, credito, reembolsado, metodo_pago, transaccion_id, id_cupon, codigo_cupon, id_metodo_envio, metodo_envio, costo_envio, impuestos, impuestos_incluidos, envio_destinatario, envio_direccion, envio_provincia, envio_telefono"
+
+// scanPedido lee una fila con columnasPedido.
+func scanPedido(scan func(dest ...interface{}) error) (Pedido, error) {
+	var pedido Pedido
+	var metodoPago, transaccionID, codigoCupon, metodoEnvio sql.NullString
+	var destinatario, direccion, provincia, telefono sql.NullString
+	var idCupon, idMetodoEnvio sql.NullInt64
+	err := scan(&pedido.ID, &pedido.IDCliente, &pedido.Fecha, &pedido.Estado, &pedido.Subtotal, &pedido.DescuentoPromociones, &pedido.Descuento, &pedido.Total, &pedido.Credito, &pedido.Reembolsado, &metodoPago, &transaccionID, &idCupon, &codigoCupon,
+		&idMetodoEnvio, &metodoEnvio, &pedido.CostoEnvio, &pedido.Impuestos, &pedido.ImpuestosIncluidos, &destinatario, &direccion, &provincia, &telefono)
+	pedido.MetodoPago = metodoPago.String
+	pedido.TransaccionID = transaccionID.String
+	pedido.IDCupon = int(idCupon.Int64)
+	pedido.CodigoCupon = codigoCupon.String
+	pedido.IDMetodoEnvio = int(idMetodoEnvio.Int64)
+	pedido.MetodoEnvio = metodoEnvio.String
+	pedido.Entrega = DireccionEnvio{Destinatario: destinatario.String, Direccion: direccion.String, Provincia: provincia.String, Telefono: telefono.String}
+	return pedido, err
 }
 
 type DetallePedido struct {
-	ID             int
-	IDPedido       int
-	IDProducto     int
+	ID         int
+	IDPedido   int
+	IDProducto int
+	IDVariante int
+	// Variante es la descripción de la variante al momento de la compra.
+	Variante       string
 	Cantidad       int
-	PrecioUnitario float64
+	PrecioUnitario dinero.Monto
+	// DescuentoPromocion y Descuento son las partes del ahorro de las
+	// promociones y del cupón que corresponden a la línea.
+	DescuentoPromocion dinero.Monto
+	Descuento          dinero.Monto
+	// ImpuestoNombre, ImpuestoTasa e ImpuestoExento son la copia de la clase
+	// de impuesto al momento de la compra e Impuesto lo que pagó la línea.
+	ImpuestoNombre string
+	ImpuestoTasa   float64
+	ImpuestoExento bool
+	Impuesto       dinero.Monto
 	// DetallePedido representa una línea de un pedido con cantidad y precio unitario.
-	Subtotal float64
+	Subtotal dinero.Monto
 }
 
-func GetPedidoByID(id int) (Pedido, error) {
-	var pedido Pedido
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return pedido, err
+// ClaseImpuesto devuelve la copia de la clase de impuesto de la línea.
+func (d DetallePedido) ClaseImpuesto() ClaseImpuesto {
+	return ClaseImpuesto{Nombre: d.ImpuestoNombre, Tasa: d.ImpuestoTasa, Exenta: d.ImpuestoExento}
+}
+
+// Pagado es lo que se cobró por la línea: el subtotal con sus descuentos y,
+// si los precios no lo incluían, el impuesto.
+func (d DetallePedido) Pagado(impuestosIncluidos bool) dinero.Monto {
+	pagado := d.Subtotal - d.DescuentoPromocion - d.Descuento
+	if !impuestosIncluidos {
+		pagado += d.Impuesto
 	}
-	defer DB.Close()
+	return pagado
+}
 
-	stmt, err := DB.Prepare("SELECT id_pedido, id_cliente, fecha, estado, total, metodo_pago, transaccion_id FROM pedidos WHERE id_pedido = ?")
+func GetPedidoByID(id int) (Pedido, error) {
+	var pedido Pedido
+	stmt, err := pool.Prepare("SELECT " + columnasPedido + " FROM pedidos WHERE id_pedido = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return pedido, err
 	}
 	defer stmt.Close()
 
-	var metodoPago, transaccionID sql.NullString
-	row := stmt.QueryRow(id)
-	err = row.Scan(&pedido.ID, &pedido.IDCliente, &pedido.Fecha, &pedido.Estado, &pedido.Total, &metodoPago, &transaccionID)
+	pedido, err = scanPedido(stmt.QueryRow(id).Scan)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return pedido, fmt.Errorf("pedido no encontrado con ID: %d", id)
@@ -54,8 +132,6 @@ func GetPedidoByID(id int) (Pedido, error) {
 		log.Println("Error al escanear la consulta sql", err)
 		return pedido, err
 	}
-	pedido.MetodoPago = metodoPago.String
-	pedido.TransaccionID = transaccionID.String
 
 	log.Println("Pedido obtenido", pedido)
 	return pedido, nil
@@ -63,14 +139,7 @@ func GetPedidoByID(id int) (Pedido, error) {
 
 func GetAllPedidos() ([]Pedido, error) {
 	var pedidos []Pedido
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return pedidos, err
-	}
-	defer DB.Close()
-
-	rows, err := DB.Query("SELECT id_pedido, id_cliente, fecha, estado, total, metodo_pago, transaccion_id FROM pedidos")
+	rows, err := pool.Query("SELECT " + columnasPedido + " FROM pedidos")
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return pedidos, err
@@ -78,15 +147,11 @@ func GetAllPedidos() ([]Pedido, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var pedido Pedido
-		var metodoPago, transaccionID sql.NullString
-		err = rows.Scan(&pedido.ID, &pedido.IDCliente, &pedido.Fecha, &pedido.Estado, &pedido.Total, &metodoPago, &transaccionID)
+		pedido, err := scanPedido(rows.Scan)
 		if err != nil {
 			log.Println("Error al escanear la consulta sql", err)
 			return pedidos, err
 		}
-		pedido.MetodoPago = metodoPago.String
-		pedido.TransaccionID = transaccionID.String
 		pedidos = append(pedidos, pedido)
 	}
 	if err = rows.Err(); err != nil {
@@ -97,22 +162,15 @@ func GetAllPedidos() ([]Pedido, error) {
 	return pedidos, nil
 }
 
-func CreatePedido(idCliente int, total float64, metodoPago, transaccionID string) (int, error) {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return 0, err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("INSERT INTO pedidos (id_cliente, total, metodo_pago, transaccion_id, estado) VALUES (?, ?, ?, ?, 'PENDIENTE')")
+func CreatePedido(idCliente int, total dinero.Monto, metodoPago, transaccionID string) (int, error) {
+	stmt, err := pool.Prepare("INSERT INTO pedidos (id_cliente, subtotal, total, metodo_pago, transaccion_id, estado) VALUES (?, ?, ?, ?, ?, 'PENDIENTE')")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return 0, err
 	}
 	defer stmt.Close()
 
-	result, err := stmt.Exec(idCliente, total, metodoPago, transaccionID)
+	result, err := stmt.Exec(idCliente, total, total, metodoPago, transaccionID)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return 0, err
@@ -128,15 +186,8 @@ func CreatePedido(idCliente int, total float64, metodoPago, transaccionID string
 	return int(id), nil
 }
 
-func CreateDetallePedido(idPedido, idProducto, cantidad int, precioUnitario float64) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("INSERT INTO detalles_pedido (id_pedido, id_producto, cantidad, precio_unitario) VALUES (?, ?, ?, ?)")
+func CreateDetallePedido(idPedido, idProducto, cantidad int, precioUnitario dinero.Monto) error {
+	stmt, err := pool.Prepare("INSERT INTO detalles_pedido (id_pedido, id_producto, cantidad, precio_unitario) VALUES (?, ?, ?, ?)")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
@@ -153,15 +204,16 @@ func CreateDetallePedido(idPedido, idProducto, cantidad int, precioUnitario floa
 }
 
 func GetDetallesByPedidoID(idPedido int) ([]DetallePedido, error) {
-	var detalles []DetallePedido
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return detalles, err
-	}
-	defer DB.Close()
+	return getDetallesPedido(pool, idPedido)
+}
 
-	rows, err := DB.Query("SELECT id_detalle, id_pedido, id_producto, cantidad, precio_unitario, subtotal FROM detalles_pedido WHERE id_pedido = ?", idPedido)
+// getDetallesPedido lee las líneas del pedido con `q`, que puede ser el pool
+// o una transacción.
+func getDetallesPedido(q interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}, idPedido int) ([]DetallePedido, error) {
+	var detalles []DetallePedido
+	rows, err := q.Query("SELECT id_detalle, id_pedido, id_producto, id_variante, variante, cantidad, precio_unitario, descuento_promocion, descuento, impuesto_nombre, impuesto_tasa, impuesto_exento, impuesto, subtotal FROM detalles_pedido WHERE id_pedido = ?", idPedido)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return detalles, err
@@ -170,11 +222,17 @@ func GetDetallesByPedidoID(idPedido int) ([]DetallePedido, error) {
 
 	for rows.Next() {
 		var detalle DetallePedido
-		err = rows.Scan(&detalle.ID, &detalle.IDPedido, &detalle.IDProducto, &detalle.Cantidad, &detalle.PrecioUnitario, &detalle.Subtotal)
+		var idVariante sql.NullInt64
+		var variante, impuestoNombre sql.NullString
+		err = rows.Scan(&detalle.ID, &detalle.IDPedido, &detalle.IDProducto, &idVariante, &variante, &detalle.Cantidad, &detalle.PrecioUnitario, &detalle.DescuentoPromocion, &detalle.Descuento,
+			&impuestoNombre, &detalle.ImpuestoTasa, &detalle.ImpuestoExento, &detalle.Impuesto, &detalle.Subtotal)
 		if err != nil {
 			log.Println("Error al escanear la consulta sql", err)
 			return detalles, err
 		}
+		detalle.IDVariante = int(idVariante.Int64)
+		detalle.Variante = variante.String
+		detalle.ImpuestoNombre = impuestoNombre.String
 		detalles = append(detalles, detalle)
 	}
 	if err = rows.Err(); err != nil {
@@ -187,14 +245,7 @@ func GetDetallesByPedidoID(idPedido int) ([]DetallePedido, error) {
 
 func GetPedidosByClienteID(idCliente int) ([]Pedido, error) {
 	var pedidos []Pedido
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return pedidos, err
-	}
-	defer DB.Close()
-
-	rows, err := DB.Query("SELECT id_pedido, id_cliente, fecha, estado, total, metodo_pago, transaccion_id FROM pedidos WHERE id_cliente = ? ORDER BY fecha DESC", idCliente)
+	rows, err := pool.Query("SELECT "+columnasPedido+" FROM pedidos WHERE id_cliente = ? ORDER BY fecha DESC", idCliente)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return pedidos, err
@@ -202,15 +253,11 @@ func GetPedidosByClienteID(idCliente int) ([]Pedido, error) {
 	defer rows.Close()
 
 	for rows.Next() {
-		var pedido Pedido
-		var metodoPago, transaccionID sql.NullString
-		err = rows.Scan(&pedido.ID, &pedido.IDCliente, &pedido.Fecha, &pedido.Estado, &pedido.Total, &metodoPago, &transaccionID)
+		pedido, err := scanPedido(rows.Scan)
 		if err != nil {
 			log.Println("Error al escanear la consulta sql", err)
 			return pedidos, err
 		}
-		pedido.MetodoPago = metodoPago.String
-		pedido.TransaccionID = transaccionID.String
 		pedidos = append(pedidos, pedido)
 	}
 	if err = rows.Err(); err != nil {
@@ -219,27 +266,3 @@ func GetPedidosByClienteID(idCliente int) ([]Pedido, error) {
 	}
 	return pedidos, nil
 }
-
-func UpdatePedidoStatus(id int, estado string) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("UPDATE pedidos SET estado = ? WHERE id_pedido = ?")
-	if err != nil {
-		log.Println("Error al preparar la consulta sql", err)
-		return err
-	}
-	defer stmt.Close()
-
-	_, err = stmt.Exec(estado, id)
-	if err != nil {
-		log.Println("Error al ejecutar la consulta sql", err)
-		return err
-	}
-	log.Println("Estado del pedido actualizado exitosamente")
-	return nil
-}
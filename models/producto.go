@@ -1,7 +1,7 @@
 package models
 
 import (
-	"Go-Sistemas-de-Gestion-empresarial/db"
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
 	"database/sql"
 	"fmt"
 	"log"
@@ -10,14 +10,17 @@ import (
 
 // Producto representa un artículo disponible en la tienda.
 type Producto struct {
-	ID            int
-	Nombre        string
-	Descripcion   string
-	Precio        float64
-	Stock         int
-	SKU           string
-	Activo        bool
-	FechaCreacion time.Time
+	ID          int
+	Nombre      string
+	Descripcion string
+	Precio      dinero.Monto
+	Stock       int
+	Peso        float64 // En kg, para las tarifas de envío por peso
+	// IDClaseImpuesto es 0 si el producto usa la clase predeterminada.
+	IDClaseImpuesto int
+	SKU             string
+	Activo          bool
+	FechaCreacion   time.Time
 }
 
 // ProductoCategoria representa la relación entre productos y categorías.
@@ -29,14 +32,7 @@ type ProductoCategoria struct {
 // GetProductoByID devuelve un producto por su identificador o un error si no existe.
 func GetProductoByID(id int) (Producto, error) {
 	var producto Producto
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return producto, err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("SELECT id_producto, nombre, descripcion, precio, stock, sku, activo, fecha_creacion FROM productos WHERE id_producto = ?")
+	stmt, err := pool.Prepare("SELECT id_producto, nombre, descripcion, precio, stock, peso, id_clase_impuesto, sku, activo, fecha_creacion FROM productos WHERE id_producto = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return producto, err
@@ -44,8 +40,9 @@ func GetProductoByID(id int) (Producto, error) {
 	defer stmt.Close()
 
 	var descripcion, sku sql.NullString
+	var idClase sql.NullInt64
 	row := stmt.QueryRow(id)
-	err = row.Scan(&producto.ID, &producto.Nombre, &descripcion, &producto.Precio, &producto.Stock, &sku, &producto.Activo, &producto.FechaCreacion)
+	err = row.Scan(&producto.ID, &producto.Nombre, &descripcion, &producto.Precio, &producto.Stock, &producto.Peso, &idClase, &sku, &producto.Activo, &producto.FechaCreacion)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return producto, fmt.Errorf("producto no encontrado con ID: %d", id)
@@ -55,6 +52,7 @@ func GetProductoByID(id int) (Producto, error) {
 	}
 	producto.Descripcion = descripcion.String
 	producto.SKU = sku.String
+	producto.IDClaseImpuesto = int(idClase.Int64)
 
 	log.Println("Producto obtenido", producto)
 	return producto, nil
@@ -63,14 +61,7 @@ func GetProductoByID(id int) (Producto, error) {
 // GetAllProductos devuelve la lista completa de productos en la base de datos.
 func GetAllProductos() ([]Producto, error) {
 	var productos []Producto
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return productos, err
-	}
-	defer DB.Close()
-
-	rows, err := DB.Query("SELECT id_producto, nombre, descripcion, precio, stock, sku, activo, fecha_creacion FROM productos")
+	rows, err := pool.Query("SELECT id_producto, nombre, descripcion, precio, stock, peso, id_clase_impuesto, sku, activo, fecha_creacion FROM productos")
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return productos, err
@@ -80,13 +71,15 @@ func GetAllProductos() ([]Producto, error) {
 	for rows.Next() {
 		var producto Producto
 		var descripcion, sku sql.NullString
-		err = rows.Scan(&producto.ID, &producto.Nombre, &descripcion, &producto.Precio, &producto.Stock, &sku, &producto.Activo, &producto.FechaCreacion)
+		var idClase sql.NullInt64
+		err = rows.Scan(&producto.ID, &producto.Nombre, &descripcion, &producto.Precio, &producto.Stock, &producto.Peso, &idClase, &sku, &producto.Activo, &producto.FechaCreacion)
 		if err != nil {
 			log.Println("Error al escanear la consulta sql", err)
 			return productos, err
 		}
 		producto.Descripcion = descripcion.String
 		producto.SKU = sku.String
+		producto.IDClaseImpuesto = int(idClase.Int64)
 		productos = append(productos, producto)
 	}
 	if err = rows.Err(); err != nil {
@@ -97,48 +90,39 @@ func GetAllProductos() ([]Producto, error) {
 	return productos, nil
 }
 
-// CreateProducto inserta un nuevo producto en la base de datos.
-func CreateProducto(nombre, descripcion string, precio float64, stock int, sku string, activo bool) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("INSERT INTO productos (nombre, descripcion, precio, stock, sku, activo) VALUES (?, ?, ?, ?, ?, ?)")
+// CreateProducto inserta un nuevo producto en la base de datos y devuelve su ID.
+func CreateProducto(nombre, descripcion string, precio dinero.Monto, stock int, peso float64, idClaseImpuesto int, sku string, activo bool) (int, error) {
+	stmt, err := pool.Prepare("INSERT INTO productos (nombre, descripcion, precio, stock, peso, id_clase_impuesto, sku, activo) VALUES (?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
-		return err
+		return 0, err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(nombre, descripcion, precio, stock, sku, activo)
+	result, err := stmt.Exec(nombre, descripcion, precio, stock, peso, nullID(idClaseImpuesto), sku, activo)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
-		return err
+		return 0, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		log.Println("Error al obtener el ID del producto insertado", err)
+		return 0, err
 	}
 	log.Println("Producto creado exitosamente")
-	return nil
+	return int(id), nil
 }
 
 // UpdateProducto actualiza la información de un producto existente.
-func UpdateProducto(id int, nombre, descripcion string, precio float64, stock int, sku string, activo bool) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("UPDATE productos SET nombre = ?, descripcion = ?, precio = ?, stock = ?, sku = ?, activo = ? WHERE id_producto = ?")
+func UpdateProducto(id int, nombre, descripcion string, precio dinero.Monto, stock int, peso float64, idClaseImpuesto int, sku string, activo bool) error {
+	stmt, err := pool.Prepare("UPDATE productos SET nombre = ?, descripcion = ?, precio = ?, stock = ?, peso = ?, id_clase_impuesto = ?, sku = ?, activo = ? WHERE id_producto = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
 	}
 	defer stmt.Close()
 
-	_, err = stmt.Exec(nombre, descripcion, precio, stock, sku, activo, id)
+	_, err = stmt.Exec(nombre, descripcion, precio, stock, peso, nullID(idClaseImpuesto), sku, activo, id)
 	if err != nil {
 		log.Println("Error al ejecutar la consulta sql", err)
 		return err
@@ -149,14 +133,7 @@ func UpdateProducto(id int, nombre, descripcion string, precio float64, stock in
 
 // DeleteProducto elimina un producto por su ID.
 func DeleteProducto(id int) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("DELETE FROM productos WHERE id_producto = ?")
+	stmt, err := pool.Prepare("DELETE FROM productos WHERE id_producto = ?")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
@@ -174,14 +151,7 @@ func DeleteProducto(id int) error {
 
 // AsignarCategoria asigna una categoría a un producto en la tabla intermedia.
 func AsignarCategoria(idProducto, idCategoria int) error {
-	DB, err := db.Connect()
-	if err != nil {
-		log.Println("Error al conectar con la base de datos", err)
-		return err
-	}
-	defer DB.Close()
-
-	stmt, err := DB.Prepare("INSERT INTO producto_categorias (id_producto, id_categoria) VALUES (?, ?)")
+	stmt, err := pool.Prepare("INSERT INTO producto_categorias (id_producto, id_categoria) VALUES (?, ?)")
 	if err != nil {
 		log.Println("Error al preparar la consulta sql", err)
 		return err
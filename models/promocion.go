@@ -0,0 +1,598 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Tipos de promoción automática.
+const (
+	// PromocionLlevaPaga: lleva X, paga Y sobre los productos de una categoría
+	// (p. ej. 2x1). En cada grupo de X unidades salen gratis las más baratas.
+	PromocionLlevaPaga = "LLEVA_PAGA"
+	// PromocionPaquete: un precio fijo por cada juego completo de productos.
+	PromocionPaquete = "PAQUETE"
+	// PromocionVolumen: un porcentaje de descuento según la cantidad de
+	// unidades de un mismo producto.
+	PromocionVolumen = "VOLUMEN"
+	// PromocionTotal: un porcentaje sobre el carrito a partir de un importe.
+	PromocionTotal = "TOTAL"
+)
+
+// TramoVolumen es un escalón de una promoción por volumen: a partir de
+// CantidadMinima unidades, Porcentaje de descuento.
+type TramoVolumen struct {
+	CantidadMinima int
+	Porcentaje     float64
+}
+
+// Promocion es una regla que se aplica sola sobre el carrito. Cada tipo usa
+// solo algunos campos: IDCategoria, Lleva y Paga (LLEVA_PAGA); Productos y
+// PrecioPaquete (PAQUETE); Productos y Tramos (VOLUMEN); Porcentaje y
+// MinimoCompra (TOTAL). Las fechas vacías significan "sin límite".
+type Promocion struct {
+	ID            int
+	Nombre        string
+	Tipo          string
+	IDCategoria   int
+	Lleva         int
+	Paga          int
+	PrecioPaquete dinero.Monto
+	Porcentaje    float64
+	MinimoCompra  dinero.Monto
+	ValidoDesde   time.Time
+	ValidoHasta   time.Time
+	Activo        bool
+	Productos     []int
+	Tramos        []TramoVolumen
+}
+
+// PromocionAplicada es el ahorro que una promoción dio en un carrito o pedido.
+// IDPromocion es 0 si la promoción se eliminó después de la compra.
+type PromocionAplicada struct {
+	IDPromocion int
+	Nombre      string
+	Descuento   dinero.Monto
+}
+
+// Vigente indica si la promoción está activa y dentro de sus fechas.
+func (p Promocion) Vigente(ahora time.Time) bool {
+	return p.Activo &&
+		(p.ValidoDesde.IsZero() || !ahora.Before(p.ValidoDesde)) &&
+		(p.ValidoHasta.IsZero() || ahora.Before(p.ValidoHasta))
+}
+
+// ValidarPromocion comprueba los datos de una promoción antes de guardarla.
+func ValidarPromocion(p Promocion) error {
+	if p.Nombre == "" || utf8.RuneCountInString(p.Nombre) > 100 {
+		return fmt.Errorf("el nombre es obligatorio y de hasta 100 caracteres")
+	}
+	if !p.ValidoDesde.IsZero() && !p.ValidoHasta.IsZero() && !p.ValidoHasta.After(p.ValidoDesde) {
+		return fmt.Errorf("la fecha de fin debe ser posterior a la de inicio")
+	}
+	switch p.Tipo {
+	case PromocionLlevaPaga:
+		if p.IDCategoria == 0 {
+			return fmt.Errorf("elige la categoría de la promoción")
+		}
+		if p.Paga < 1 || p.Lleva <= p.Paga {
+			return fmt.Errorf("\"lleva\" debe ser mayor que \"paga\", y \"paga\" al menos 1")
+		}
+	case PromocionPaquete:
+		if len(p.Productos) < 2 {
+			return fmt.Errorf("un paquete necesita al menos dos productos")
+		}
+		if p.PrecioPaquete <= 0 {
+			return fmt.Errorf("el precio del paquete debe ser mayor que 0")
+		}
+	case PromocionVolumen:
+		if len(p.Productos) == 0 {
+			return fmt.Errorf("elige al menos un producto")
+		}
+		if len(p.Tramos) == 0 {
+			return fmt.Errorf("agrega al menos un tramo de cantidad")
+		}
+		vistas := map[int]bool{}
+		for _, t := range p.Tramos {
+			if t.CantidadMinima < 2 {
+				return fmt.Errorf("la cantidad de un tramo debe ser al menos 2")
+			}
+			if t.Porcentaje <= 0 || t.Porcentaje > 100 {
+				return fmt.Errorf("el porcentaje de un tramo debe estar entre 0 y 100")
+			}
+			if vistas[t.CantidadMinima] {
+				return fmt.Errorf("hay dos tramos para %d unidades", t.CantidadMinima)
+			}
+			vistas[t.CantidadMinima] = true
+		}
+	case PromocionTotal:
+		if p.Porcentaje <= 0 || p.Porcentaje > 100 {
+			return fmt.Errorf("el porcentaje debe estar entre 0 y 100")
+		}
+		if p.MinimoCompra < 0 {
+			return fmt.Errorf("el importe mínimo no puede ser negativo")
+		}
+	default:
+		return fmt.Errorf("tipo de promoción desconocido: %q", p.Tipo)
+	}
+	return nil
+}
+
+// LineaPromocion es una línea del carrito vista por el motor de promociones.
+type LineaPromocion struct {
+	IDProducto int
+	Categorias []int
+	Precio     dinero.Monto
+	Cantidad   int
+}
+
+// ResultadoPromociones es el ahorro de las promociones sobre un carrito:
+// por línea (en el orden recibido), por promoción y en total.
+type ResultadoPromociones struct {
+	PorLinea  []dinero.Monto
+	Aplicadas []PromocionAplicada
+	Total     dinero.Monto
+}
+
+// ordenTipos fija en qué orden se evalúan las promociones. Cada unidad recibe
+// a lo sumo una promoción de línea: los paquetes toman primero sus unidades,
+// luego los "lleva X paga Y" y por último el volumen. La promoción sobre el
+// total va al final, sobre lo que queda a pagar.
+var ordenTipos = map[string]int{PromocionPaquete: 0, PromocionLlevaPaga: 1, PromocionVolumen: 2, PromocionTotal: 3}
+
+// EvaluarPromociones calcula el ahorro de las promociones vigentes sobre las
+// líneas. `categorias` es el árbol completo, para incluir las subcategorías.
+// De las promociones sobre el total se aplica solo la de mayor ahorro. El
+// resultado es determinista: el checkout lo recalcula y lo guarda en el pedido.
+func EvaluarPromociones(promociones []Promocion, lineas []LineaPromocion, categorias []Categoria, ahora time.Time) ResultadoPromociones {
+	resultado := ResultadoPromociones{PorLinea: make([]dinero.Monto, len(lineas))}
+
+	var vigentes []Promocion
+	for _, p := range promociones {
+		if p.Vigente(ahora) {
+			vigentes = append(vigentes, p)
+		}
+	}
+	sort.SliceStable(vigentes, func(i, j int) bool {
+		if ordenTipos[vigentes[i].Tipo] != ordenTipos[vigentes[j].Tipo] {
+			return ordenTipos[vigentes[i].Tipo] < ordenTipos[vigentes[j].Tipo]
+		}
+		return vigentes[i].ID < vigentes[j].ID
+	})
+
+	// libres son las unidades de cada línea que aún no tienen promoción.
+	libres := make([]int, len(lineas))
+	for i, l := range lineas {
+		libres[i] = l.Cantidad
+	}
+
+	var mejorTotal Promocion
+	var ahorroTotal dinero.Monto
+	for _, p := range vigentes {
+		switch p.Tipo {
+		case PromocionPaquete:
+			resultado.sumar(p, p.paquete(lineas, libres))
+		case PromocionLlevaPaga:
+			resultado.sumar(p, p.llevaPaga(lineas, libres, categorias))
+		case PromocionVolumen:
+			resultado.sumar(p, p.volumen(lineas, libres))
+		case PromocionTotal:
+			// Se decide después, sobre el importe que dejan las de línea.
+		}
+	}
+
+	restante := make([]dinero.Monto, len(lineas))
+	var base dinero.Monto
+	for i, l := range lineas {
+		restante[i] = l.Precio.Por(l.Cantidad) - resultado.PorLinea[i]
+		base += restante[i]
+	}
+	for _, p := range vigentes {
+		if p.Tipo != PromocionTotal || base <= 0 || base < p.MinimoCompra {
+			continue
+		}
+		if ahorro := base.Porcentaje(p.Porcentaje); ahorro > ahorroTotal {
+			mejorTotal, ahorroTotal = p, ahorro
+		}
+	}
+	if ahorroTotal > 0 {
+		resultado.sumar(mejorTotal, repartir(ahorroTotal, restante))
+	}
+	return resultado
+}
+
+// sumar agrega el ahorro por línea de una promoción, si lo hubo.
+func (r *ResultadoPromociones) sumar(p Promocion, porLinea []dinero.Monto) {
+	var ahorro dinero.Monto
+	for i, d := range porLinea {
+		r.PorLinea[i] += d
+		ahorro += d
+	}
+	if ahorro > 0 {
+		r.Aplicadas = append(r.Aplicadas, PromocionAplicada{IDPromocion: p.ID, Nombre: p.Nombre, Descuento: ahorro})
+		r.Total += ahorro
+	}
+}
+
+// unidadPromocion es una unidad libre de una línea, con su precio.
+type unidadPromocion struct {
+	linea  int
+	precio dinero.Monto
+}
+
+// unidadesLibres devuelve las unidades libres de las líneas que cumplen
+// `incluir`, de la más cara a la más barata.
+func unidadesLibres(lineas []LineaPromocion, libres []int, incluir func(LineaPromocion) bool) []unidadPromocion {
+	var unidades []unidadPromocion
+	for i, l := range lineas {
+		if !incluir(l) {
+			continue
+		}
+		for n := 0; n < libres[i]; n++ {
+			unidades = append(unidades, unidadPromocion{linea: i, precio: l.Precio})
+		}
+	}
+	sort.SliceStable(unidades, func(i, j int) bool { return unidades[i].precio > unidades[j].precio })
+	return unidades
+}
+
+// llevaPaga arma grupos de Lleva unidades de la categoría, de la más cara a
+// la más barata, y en cada grupo descuenta las Lleva-Paga más baratas. Las
+// unidades de grupos completos dejan de estar libres.
+func (p Promocion) llevaPaga(lineas []LineaPromocion, libres []int, categorias []Categoria) []dinero.Monto {
+	if p.Lleva <= p.Paga || p.Paga < 1 {
+		return nil
+	}
+	enCategoria := map[int]bool{}
+	for _, id := range Descendientes(categorias, p.IDCategoria) {
+		enCategoria[id] = true
+	}
+	unidades := unidadesLibres(lineas, libres, func(l LineaPromocion) bool {
+		for _, id := range l.Categorias {
+			if enCategoria[id] {
+				return true
+			}
+		}
+		return false
+	})
+
+	grupos := len(unidades) / p.Lleva
+	if grupos == 0 {
+		return nil
+	}
+	porLinea := make([]dinero.Monto, len(lineas))
+	for g := 0; g < grupos; g++ {
+		grupo := unidades[g*p.Lleva : (g+1)*p.Lleva]
+		for _, u := range grupo {
+			libres[u.linea]--
+		}
+		for _, u := range grupo[p.Paga:] {
+			porLinea[u.linea] += u.precio
+		}
+	}
+	return porLinea
+}
+
+// paquete cuenta cuántos juegos completos de los productos hay entre las
+// unidades libres (tomando primero las más caras) y descuenta la diferencia
+// con el precio del paquete, repartida entre las líneas que lo forman.
+func (p Promocion) paquete(lineas []LineaPromocion, libres []int) []dinero.Monto {
+	if len(p.Productos) < 2 || p.PrecioPaquete <= 0 {
+		return nil
+	}
+	porProducto := make([][]unidadPromocion, len(p.Productos))
+	juegos := -1
+	for i, id := range p.Productos {
+		porProducto[i] = unidadesLibres(lineas, libres, func(l LineaPromocion) bool { return l.IDProducto == id })
+		if juegos < 0 || len(porProducto[i]) < juegos {
+			juegos = len(porProducto[i])
+		}
+	}
+	if juegos <= 0 {
+		return nil
+	}
+
+	importes := make([]dinero.Monto, len(lineas))
+	var normal dinero.Monto
+	for _, unidades := range porProducto {
+		for _, u := range unidades[:juegos] {
+			importes[u.linea] += u.precio
+			normal += u.precio
+		}
+	}
+	ahorro := normal - p.PrecioPaquete.Por(juegos)
+	if ahorro <= 0 {
+		return nil
+	}
+	for _, unidades := range porProducto {
+		for _, u := range unidades[:juegos] {
+			libres[u.linea]--
+		}
+	}
+	return repartir(ahorro, importes)
+}
+
+// volumen aplica, a cada producto de la promoción, el porcentaje del mayor
+// tramo que alcanzan sus unidades libres (sumando todas sus variantes).
+func (p Promocion) volumen(lineas []LineaPromocion, libres []int) []dinero.Monto {
+	var porLinea []dinero.Monto
+	for _, id := range p.Productos {
+		cantidad := 0
+		for i, l := range lineas {
+			if l.IDProducto == id {
+				cantidad += libres[i]
+			}
+		}
+		porcentaje := p.porcentajeTramo(cantidad)
+		if porcentaje == 0 {
+			continue
+		}
+		if porLinea == nil {
+			porLinea = make([]dinero.Monto, len(lineas))
+		}
+		for i, l := range lineas {
+			if l.IDProducto == id && libres[i] > 0 {
+				porLinea[i] += l.Precio.Por(libres[i]).Porcentaje(porcentaje)
+				libres[i] = 0
+			}
+		}
+	}
+	return porLinea
+}
+
+// porcentajeTramo devuelve el porcentaje del mayor tramo alcanzado por
+// `cantidad`, o 0 si no alcanza ninguno.
+func (p Promocion) porcentajeTramo(cantidad int) float64 {
+	var mejor TramoVolumen
+	for _, t := range p.Tramos {
+		if cantidad >= t.CantidadMinima && t.CantidadMinima > mejor.CantidadMinima {
+			mejor = t
+		}
+	}
+	return mejor.Porcentaje
+}
+
+// columnasPromocion son las columnas que lee scanPromocion, en orden.
+const columnasPromocion = "id_promocion, nombre, tipo, id_categoria, lleva, paga, precio_paquete, porcentaje, minimo_compra, valido_desde, valido_hasta, activo"
+
+// scanPromocion lee una fila con columnasPromocion.
+func scanPromocion(scan func(dest ...interface{}) error) (Promocion, error) {
+	var p Promocion
+	var idCategoria, lleva, paga sql.NullInt64
+	var porcentaje sql.NullFloat64
+	var desde, hasta sql.NullTime
+	err := scan(&p.ID, &p.Nombre, &p.Tipo, &idCategoria, &lleva, &paga, &p.PrecioPaquete, &porcentaje, &p.MinimoCompra, &desde, &hasta, &p.Activo)
+	p.IDCategoria = int(idCategoria.Int64)
+	p.Lleva = int(lleva.Int64)
+	p.Paga = int(paga.Int64)
+	p.Porcentaje = porcentaje.Float64
+	p.ValidoDesde = desde.Time
+	p.ValidoHasta = hasta.Time
+	return p, err
+}
+
+// argsPromocion devuelve los valores de las columnas editables, en el orden
+// de INSERT y UPDATE. Los campos que el tipo no usa se guardan como NULL.
+func argsPromocion(p Promocion) []interface{} {
+	var idCategoria, lleva, paga int
+	var precioPaquete dinero.Monto
+	var porcentaje float64
+	switch p.Tipo {
+	case PromocionLlevaPaga:
+		idCategoria, lleva, paga = p.IDCategoria, p.Lleva, p.Paga
+	case PromocionPaquete:
+		precioPaquete = p.PrecioPaquete
+	case PromocionTotal:
+		porcentaje = p.Porcentaje
+	}
+	return []interface{}{
+		p.Nombre, p.Tipo,
+		nullID(idCategoria), nullID(lleva), nullID(paga),
+		nullMonto(precioPaquete),
+		sql.NullFloat64{Float64: porcentaje, Valid: porcentaje != 0},
+		p.MinimoCompra,
+		sql.NullTime{Time: p.ValidoDesde, Valid: !p.ValidoDesde.IsZero()},
+		sql.NullTime{Time: p.ValidoHasta, Valid: !p.ValidoHasta.IsZero()},
+		p.Activo,
+	}
+}
+
+// detallePromocion carga los productos y los tramos de la promoción.
+func detallePromocion(p *Promocion) error {
+	rows, err := pool.Query("SELECT id_producto FROM promocion_productos WHERE id_promocion = ? ORDER BY id_producto", p.ID)
+	if err != nil {
+		log.Println("Error al leer los productos de la promoción", err)
+		return err
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		p.Productos = append(p.Productos, id)
+	}
+	rows.Close()
+
+	rows, err = pool.Query("SELECT cantidad_minima, porcentaje FROM promocion_tramos WHERE id_promocion = ? ORDER BY cantidad_minima", p.ID)
+	if err != nil {
+		log.Println("Error al leer los tramos de la promoción", err)
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t TramoVolumen
+		if err := rows.Scan(&t.CantidadMinima, &t.Porcentaje); err != nil {
+			return err
+		}
+		p.Tramos = append(p.Tramos, t)
+	}
+	return rows.Err()
+}
+
+// consultarPromociones devuelve las promociones de la consulta con sus
+// productos y tramos.
+func consultarPromociones(consulta string) ([]Promocion, error) {
+	var promociones []Promocion
+	rows, err := pool.Query(consulta)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return promociones, err
+	}
+	for rows.Next() {
+		p, err := scanPromocion(rows.Scan)
+		if err != nil {
+			rows.Close()
+			log.Println("Error al escanear la consulta sql", err)
+			return promociones, err
+		}
+		promociones = append(promociones, p)
+	}
+	rows.Close()
+	for i := range promociones {
+		if err := detallePromocion(&promociones[i]); err != nil {
+			return promociones, err
+		}
+	}
+	return promociones, nil
+}
+
+// GetAllPromociones devuelve todas las promociones, las más nuevas primero.
+func GetAllPromociones() ([]Promocion, error) {
+	return consultarPromociones("SELECT " + columnasPromocion + " FROM promociones ORDER BY id_promocion DESC")
+}
+
+// GetPromocionesActivas devuelve las promociones marcadas como activas. Las
+// fechas las filtra EvaluarPromociones.
+func GetPromocionesActivas() ([]Promocion, error) {
+	return consultarPromociones("SELECT " + columnasPromocion + " FROM promociones WHERE activo = 1 ORDER BY id_promocion")
+}
+
+// GetPromocionByID devuelve una promoción con sus productos y tramos.
+func GetPromocionByID(id int) (Promocion, error) {
+	p, err := scanPromocion(pool.QueryRow("SELECT "+columnasPromocion+" FROM promociones WHERE id_promocion = ?", id).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return p, fmt.Errorf("promoción no encontrada con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return p, err
+	}
+	return p, detallePromocion(&p)
+}
+
+// guardarDetallePromocion reemplaza los productos y tramos de la promoción.
+func guardarDetallePromocion(tx *sql.Tx, p Promocion) error {
+	if _, err := tx.Exec("DELETE FROM promocion_productos WHERE id_promocion = ?", p.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM promocion_tramos WHERE id_promocion = ?", p.ID); err != nil {
+		return err
+	}
+	if p.Tipo == PromocionPaquete || p.Tipo == PromocionVolumen {
+		for _, id := range p.Productos {
+			if _, err := tx.Exec("INSERT INTO promocion_productos (id_promocion, id_producto) VALUES (?, ?)", p.ID, id); err != nil {
+				return err
+			}
+		}
+	}
+	if p.Tipo == PromocionVolumen {
+		for _, t := range p.Tramos {
+			if _, err := tx.Exec("INSERT INTO promocion_tramos (id_promocion, cantidad_minima, porcentaje) VALUES (?, ?, ?)", p.ID, t.CantidadMinima, t.Porcentaje); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// CreatePromocion inserta una promoción con sus productos y tramos.
+func CreatePromocion(p Promocion) error {
+	if err := ValidarPromocion(p); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO promociones (nombre, tipo, id_categoria, lleva, paga, precio_paquete, porcentaje, minimo_compra, valido_desde, valido_hasta, activo) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)", argsPromocion(p)...)
+	if err != nil {
+		log.Println("Error al crear la promoción", err)
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	p.ID = int(id)
+	if err := guardarDetallePromocion(tx, p); err != nil {
+		log.Println("Error al guardar el detalle de la promoción", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePromocion modifica una promoción. Los pedidos ya hechos conservan el
+// ahorro que se calculó al comprar.
+func UpdatePromocion(p Promocion) error {
+	if err := ValidarPromocion(p); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	args := append(argsPromocion(p), p.ID)
+	if _, err := tx.Exec("UPDATE promociones SET nombre = ?, tipo = ?, id_categoria = ?, lleva = ?, paga = ?, precio_paquete = ?, porcentaje = ?, minimo_compra = ?, valido_desde = ?, valido_hasta = ?, activo = ? WHERE id_promocion = ?", args...); err != nil {
+		log.Println("Error al actualizar la promoción", err)
+		return err
+	}
+	if err := guardarDetallePromocion(tx, p); err != nil {
+		log.Println("Error al guardar el detalle de la promoción", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeletePromocion elimina una promoción. Los pedidos conservan su nombre y
+// el ahorro aplicado.
+func DeletePromocion(id int) error {
+	if _, err := pool.Exec("DELETE FROM promociones WHERE id_promocion = ?", id); err != nil {
+		log.Println("Error al eliminar la promoción", err)
+		return err
+	}
+	return nil
+}
+
+// GetPromocionesByPedidoID devuelve las promociones que se aplicaron al pedido.
+func GetPromocionesByPedidoID(idPedido int) ([]PromocionAplicada, error) {
+	var aplicadas []PromocionAplicada
+	rows, err := pool.Query("SELECT id_promocion, nombre, descuento FROM pedido_promociones WHERE id_pedido = ? ORDER BY id_pedido_promocion", idPedido)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return aplicadas, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var a PromocionAplicada
+		var idPromocion sql.NullInt64
+		if err := rows.Scan(&idPromocion, &a.Nombre, &a.Descuento); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return aplicadas, err
+		}
+		a.IDPromocion = int(idPromocion.Int64)
+		aplicadas = append(aplicadas, a)
+	}
+	return aplicadas, rows.Err()
+}
@@ -0,0 +1,236 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// categoriasTest es el árbol de las pruebas: Ropa (1) con la subcategoría
+// Remeras (2), y Libros (3).
+var categoriasTest = []Categoria{
+	{ID: 1, Nombre: "Ropa"},
+	{ID: 2, Nombre: "Remeras", IDPadre: 1},
+	{ID: 3, Nombre: "Libros"},
+}
+
+// ahoraTest es el momento en que se evalúan las promociones y los cupones.
+var ahoraTest = time.Date(2026, 3, 15, 12, 0, 0, 0, time.UTC)
+
+func TestPromocionVigente(t *testing.T) {
+	casos := []struct {
+		nombre   string
+		p        Promocion
+		esperado bool
+	}{
+		{"sin fechas", Promocion{Activo: true}, true},
+		{"inactiva", Promocion{}, false},
+		{"empieza ahora", Promocion{Activo: true, ValidoDesde: ahoraTest}, true},
+		{"todavía no empezó", Promocion{Activo: true, ValidoDesde: ahoraTest.Add(time.Second)}, false},
+		{"termina ahora", Promocion{Activo: true, ValidoHasta: ahoraTest}, false},
+		{"termina después", Promocion{Activo: true, ValidoDesde: ahoraTest.Add(-time.Hour), ValidoHasta: ahoraTest.Add(time.Second)}, true},
+	}
+	for _, c := range casos {
+		if got := c.p.Vigente(ahoraTest); got != c.esperado {
+			t.Errorf("%s: Vigente = %v; se esperaba %v", c.nombre, got, c.esperado)
+		}
+	}
+}
+
+func TestEvaluarPromociones(t *testing.T) {
+	combo := Promocion{ID: 4, Nombre: "Combo", Tipo: PromocionPaquete, Productos: []int{10, 11}, PrecioPaquete: 1500, Activo: true}
+	dosPorUno := Promocion{ID: 5, Nombre: "2x1 Ropa", Tipo: PromocionLlevaPaga, IDCategoria: 1, Lleva: 2, Paga: 1, Activo: true}
+	tresPorDos := Promocion{ID: 5, Nombre: "3x2 Ropa", Tipo: PromocionLlevaPaga, IDCategoria: 1, Lleva: 3, Paga: 2, Activo: true}
+	mayorista := Promocion{ID: 6, Nombre: "Mayorista", Tipo: PromocionVolumen, Productos: []int{20}, Tramos: []TramoVolumen{{5, 20}, {3, 10}}, Activo: true}
+	diez := Promocion{ID: 7, Nombre: "10% desde $50", Tipo: PromocionTotal, Porcentaje: 10, MinimoCompra: 5000, Activo: true}
+	quince := Promocion{ID: 8, Nombre: "15% desde $100", Tipo: PromocionTotal, Porcentaje: 15, MinimoCompra: 10000, Activo: true}
+
+	casos := []struct {
+		nombre      string
+		promociones []Promocion
+		lineas      []LineaPromocion
+		porLinea    []dinero.Monto
+		aplicadas   []PromocionAplicada
+	}{
+		{
+			nombre:      "lleva paga incluye las subcategorías y no otras categorías",
+			promociones: []Promocion{tresPorDos},
+			lineas:      []LineaPromocion{{1, []int{2}, 1000, 2}, {2, []int{1}, 600, 1}, {3, []int{3}, 500, 3}},
+			porLinea:    []dinero.Monto{0, 600, 0},
+			aplicadas:   []PromocionAplicada{{5, "3x2 Ropa", 600}},
+		},
+		{
+			nombre:      "lleva paga agrupa de la más cara a la más barata",
+			promociones: []Promocion{dosPorUno},
+			lineas:      []LineaPromocion{{1, []int{1}, 1000, 3}, {2, []int{1}, 400, 2}},
+			porLinea:    []dinero.Monto{1000, 400},
+			aplicadas:   []PromocionAplicada{{5, "2x1 Ropa", 1400}},
+		},
+		{
+			nombre:      "lleva paga sin un grupo completo",
+			promociones: []Promocion{tresPorDos},
+			lineas:      []LineaPromocion{{1, []int{1}, 1000, 2}},
+			porLinea:    []dinero.Monto{0},
+		},
+		{
+			nombre:      "paquete reparte el ahorro entre sus líneas",
+			promociones: []Promocion{combo},
+			lineas:      []LineaPromocion{{10, nil, 1000, 2}, {11, nil, 800, 1}},
+			porLinea:    []dinero.Monto{167, 133},
+			aplicadas:   []PromocionAplicada{{4, "Combo", 300}},
+		},
+		{
+			nombre:      "paquete más caro que los productos sueltos",
+			promociones: []Promocion{{ID: 4, Nombre: "Combo", Tipo: PromocionPaquete, Productos: []int{10, 11}, PrecioPaquete: 2000, Activo: true}},
+			lineas:      []LineaPromocion{{10, nil, 1000, 1}, {11, nil, 800, 1}},
+			porLinea:    []dinero.Monto{0, 0},
+		},
+		{
+			nombre:      "volumen aplica el mayor tramo alcanzado",
+			promociones: []Promocion{mayorista},
+			lineas:      []LineaPromocion{{20, nil, 1000, 5}},
+			porLinea:    []dinero.Monto{1000},
+			aplicadas:   []PromocionAplicada{{6, "Mayorista", 1000}},
+		},
+		{
+			nombre:      "volumen suma las unidades de todas las variantes",
+			promociones: []Promocion{mayorista},
+			lineas:      []LineaPromocion{{20, nil, 1000, 2}, {20, nil, 1200, 1}},
+			porLinea:    []dinero.Monto{200, 120},
+			aplicadas:   []PromocionAplicada{{6, "Mayorista", 320}},
+		},
+		{
+			nombre:      "volumen sin llegar al primer tramo",
+			promociones: []Promocion{mayorista},
+			lineas:      []LineaPromocion{{20, nil, 1000, 2}},
+			porLinea:    []dinero.Monto{0},
+		},
+		{
+			nombre:      "total desde el importe mínimo",
+			promociones: []Promocion{diez},
+			lineas:      []LineaPromocion{{1, nil, 3000, 2}},
+			porLinea:    []dinero.Monto{600},
+			aplicadas:   []PromocionAplicada{{7, "10% desde $50", 600}},
+		},
+		{
+			nombre:      "total por debajo del importe mínimo",
+			promociones: []Promocion{diez},
+			lineas:      []LineaPromocion{{1, nil, 2000, 2}},
+			porLinea:    []dinero.Monto{0},
+		},
+		{
+			nombre:      "de las promociones sobre el total solo la de mayor ahorro",
+			promociones: []Promocion{diez, quince},
+			lineas:      []LineaPromocion{{1, nil, 3000, 2}, {2, nil, 3000, 2}},
+			porLinea:    []dinero.Monto{900, 900},
+			aplicadas:   []PromocionAplicada{{8, "15% desde $100", 1800}},
+		},
+		{
+			nombre:      "el mínimo del total se mide después de las promociones de línea",
+			promociones: []Promocion{dosPorUno, diez},
+			lineas:      []LineaPromocion{{1, []int{1}, 3000, 2}},
+			porLinea:    []dinero.Monto{3000},
+			aplicadas:   []PromocionAplicada{{5, "2x1 Ropa", 3000}},
+		},
+		{
+			nombre:      "volumen solo sobre las unidades que deja lleva paga",
+			promociones: []Promocion{tresPorDos, {ID: 6, Nombre: "Mayorista", Tipo: PromocionVolumen, Productos: []int{10}, Tramos: []TramoVolumen{{2, 10}}, Activo: true}},
+			lineas:      []LineaPromocion{{10, []int{1}, 1000, 5}},
+			porLinea:    []dinero.Monto{1200},
+			aplicadas:   []PromocionAplicada{{5, "3x2 Ropa", 1000}, {6, "Mayorista", 200}},
+		},
+		{
+			// Recibidas en cualquier orden, se aplican paquete, lleva paga,
+			// volumen y total: el paquete toma una unidad de cada producto,
+			// el 2x1 las dos que quedan, al volumen no le queda ninguna y el
+			// total se calcula sobre los $25 restantes.
+			nombre: "orden paquete, lleva paga, volumen y total",
+			promociones: []Promocion{
+				{ID: 9, Nombre: "10% todo", Tipo: PromocionTotal, Porcentaje: 10, Activo: true},
+				{ID: 6, Nombre: "Mayorista", Tipo: PromocionVolumen, Productos: []int{10}, Tramos: []TramoVolumen{{2, 50}}, Activo: true},
+				dosPorUno,
+				combo,
+			},
+			lineas:    []LineaPromocion{{10, []int{1}, 1000, 3}, {11, []int{1}, 800, 1}},
+			porLinea:  []dinero.Monto{167 + 1000 + 183, 133 + 67},
+			aplicadas: []PromocionAplicada{{4, "Combo", 300}, {5, "2x1 Ropa", 1000}, {9, "10% todo", 250}},
+		},
+		{
+			nombre: "solo las promociones vigentes",
+			promociones: []Promocion{
+				{ID: 1, Nombre: "Futura", Tipo: PromocionTotal, Porcentaje: 10, ValidoDesde: ahoraTest.Add(time.Hour), Activo: true},
+				{ID: 2, Nombre: "Vencida", Tipo: PromocionTotal, Porcentaje: 20, ValidoHasta: ahoraTest, Activo: true},
+				{ID: 3, Nombre: "Pausada", Tipo: PromocionTotal, Porcentaje: 30},
+				{ID: 4, Nombre: "Hoy", Tipo: PromocionTotal, Porcentaje: 5, ValidoDesde: ahoraTest, ValidoHasta: ahoraTest.Add(24 * time.Hour), Activo: true},
+			},
+			lineas:    []LineaPromocion{{1, nil, 1000, 1}},
+			porLinea:  []dinero.Monto{50},
+			aplicadas: []PromocionAplicada{{4, "Hoy", 50}},
+		},
+	}
+	for _, c := range casos {
+		r := EvaluarPromociones(c.promociones, c.lineas, categoriasTest, ahoraTest)
+		if !reflect.DeepEqual(r.PorLinea, c.porLinea) {
+			t.Errorf("%s: ahorro por línea = %v; se esperaba %v", c.nombre, r.PorLinea, c.porLinea)
+		}
+		if !reflect.DeepEqual(r.Aplicadas, c.aplicadas) {
+			t.Errorf("%s: aplicadas = %+v; se esperaba %+v", c.nombre, r.Aplicadas, c.aplicadas)
+		}
+		var total dinero.Monto
+		for _, a := range c.aplicadas {
+			total += a.Descuento
+		}
+		if r.Total != total {
+			t.Errorf("%s: total = %v; se esperaba %v", c.nombre, r.Total, total)
+		}
+	}
+}
+
+func TestCuponSobreLoQueDejanLasPromociones(t *testing.T) {
+	// El 2x1 deja $10 de la primera línea; la segunda no tiene promoción.
+	promociones := []Promocion{{ID: 5, Nombre: "2x1 Ropa", Tipo: PromocionLlevaPaga, IDCategoria: 1, Lleva: 2, Paga: 1, Activo: true}}
+	casos := []struct {
+		nombre     string
+		cupon      Cupon
+		descuentos []dinero.Monto
+		invalido   bool
+	}{
+		{"porcentaje sobre lo que queda", Cupon{Codigo: "DIEZ", Tipo: CuponPorcentaje, Porcentaje: 10, Activo: true}, []dinero.Monto{100, 100}, false},
+		{"monto limitado a lo que queda de la línea elegible", Cupon{Codigo: "CINCUENTA", Tipo: CuponMonto, Monto: 5000, Productos: []int{1}, Activo: true}, []dinero.Monto{1000, 0}, false},
+		{"mínimo medido después de las promociones", Cupon{Codigo: "MINIMO", Tipo: CuponPorcentaje, Porcentaje: 10, MinimoCompra: 2500, Activo: true}, nil, true},
+	}
+	for _, c := range casos {
+		lineas := []lineaCheckout{
+			{IDProducto: 1, Categorias: []int{1}, Precio: 1000, Cantidad: 2},
+			{IDProducto: 2, Categorias: []int{3}, Precio: 500, Cantidad: 2},
+		}
+		promocion := aplicarPromocionesLineas(promociones, lineas, categoriasTest, ahoraTest)
+		if promocion.Total != 1000 || lineas[0].DescuentoPromocion != 1000 || lineas[1].DescuentoPromocion != 0 {
+			t.Fatalf("%s: promociones = %+v", c.nombre, promocion)
+		}
+
+		total, err := aplicarCuponLineas(c.cupon, lineas, categoriasTest, 0, ahoraTest)
+		if c.invalido {
+			if !errors.Is(err, ErrCuponInvalido) {
+				t.Errorf("%s: err = %v; se esperaba ErrCuponInvalido", c.nombre, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", c.nombre, err)
+			continue
+		}
+		var suma dinero.Monto
+		for i, l := range lineas {
+			if l.Descuento != c.descuentos[i] {
+				t.Errorf("%s: descuento de la línea %d = %v; se esperaba %v", c.nombre, i, l.Descuento, c.descuentos[i])
+			}
+			suma += l.Descuento
+		}
+		if total != suma {
+			t.Errorf("%s: total = %v; las líneas suman %v", c.nombre, total, suma)
+		}
+	}
+}
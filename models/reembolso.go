@@ -0,0 +1,190 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Estados de un reembolso.
+const (
+	ReembolsoPendiente = "PENDIENTE"
+	ReembolsoHecho     = "HECHO"
+)
+
+// Operaciones que un reembolso pide a la pasarela.
+const (
+	// OperacionReembolso devuelve parte o todo lo cobrado.
+	OperacionReembolso = "REEMBOLSO"
+	// OperacionAnulacion anula un cobro que todavía no se capturó.
+	OperacionAnulacion = "ANULACION"
+)
+
+// Reembolso es una devolución de dinero que hay que pedir a la pasarela. Se
+// registra PENDIENTE en la misma transacción que la cancelación o la
+// devolución que lo origina y se pide a la pasarela después de confirmarla,
+// sin el pedido bloqueado; si la pasarela falla queda pendiente, con el
+// motivo en Error, para reintentarlo. Monto ya está sumado en
+// Pedido.Reembolsado.
+type Reembolso struct {
+	ID       int
+	IDPedido int
+	// IDDevolucion es la devolución reembolsada, o 0 si el reembolso viene
+	// de cancelar el pedido.
+	IDDevolucion       int
+	Operacion          string
+	TransaccionID      string
+	Monto              dinero.Monto
+	Estado             string
+	Error              string
+	FechaCreacion      time.Time
+	FechaActualizacion time.Time
+}
+
+// Pendiente indica si todavía hay que pedir el reembolso a la pasarela.
+func (r Reembolso) Pendiente() bool {
+	return r.Estado == ReembolsoPendiente
+}
+
+// Clave es la clave de idempotencia con que se pide el reembolso a la
+// pasarela: los reintentos usan la misma y no devuelven el dinero dos veces.
+func (r Reembolso) Clave() string {
+	if r.IDDevolucion != 0 {
+		return fmt.Sprintf("devolucion-%d", r.IDDevolucion)
+	}
+	return fmt.Sprintf("reembolso-%d", r.ID)
+}
+
+// reembolsoPorCancelacion decide qué pedir a la pasarela al cancelar el
+// pedido: anular la transacción si el pago seguía pendiente o reembolsar lo
+// cobrado que quede sin devolver. Devuelve false si no hay nada que pedir.
+func reembolsoPorCancelacion(p Pedido) (Reembolso, bool) {
+	switch {
+	case p.TransaccionID == "":
+		return Reembolso{}, false
+	case p.Estado == EstadoPendiente:
+		return Reembolso{IDPedido: p.ID, Operacion: OperacionAnulacion, TransaccionID: p.TransaccionID}, true
+	case p.PorReembolsar() > 0:
+		return Reembolso{IDPedido: p.ID, Operacion: OperacionReembolso, TransaccionID: p.TransaccionID, Monto: p.PorReembolsar()}, true
+	}
+	return Reembolso{}, false
+}
+
+// reembolsoPorDevolucion es el reembolso de una devolución resuelta con
+// REEMBOLSADA. Su clave es la de la devolución, así que aunque se pida más de
+// una vez la pasarela la devuelve una sola.
+func reembolsoPorDevolucion(d Devolucion, p Pedido) Reembolso {
+	return Reembolso{IDPedido: p.ID, IDDevolucion: d.ID, Operacion: OperacionReembolso, TransaccionID: p.TransaccionID, Monto: d.Monto}
+}
+
+// reembolsoPorPagoTardio decide qué devolver cuando la pasarela aprueba el
+// pago de un pedido ya cancelado, p. ej. porque la anulación no llegó a
+// tiempo: lo aprobado que todavía no se devolvió. Devuelve false si no hay
+// nada que devolver.
+func reembolsoPorPagoTardio(p Pedido, e EventoPago) (Reembolso, bool) {
+	if e.Tipo != PagoAprobado || p.Estado != EstadoCancelado {
+		return Reembolso{}, false
+	}
+	monto := dinero.Min(e.Monto, p.PorReembolsar())
+	if monto <= 0 {
+		return Reembolso{}, false
+	}
+	return Reembolso{IDPedido: p.ID, Operacion: OperacionReembolso, TransaccionID: e.TransaccionID, Monto: monto}, true
+}
+
+// insertarReembolso registra el reembolso PENDIENTE dentro de la transacción
+// y suma su monto a lo reembolsado del pedido.
+func insertarReembolso(tx *sql.Tx, r Reembolso) error {
+	if _, err := tx.Exec("INSERT INTO reembolsos (id_pedido, id_devolucion, operacion, transaccion_id, monto, estado) VALUES (?, ?, ?, ?, ?, ?)",
+		r.IDPedido, nullID(r.IDDevolucion), r.Operacion, r.TransaccionID, r.Monto, ReembolsoPendiente); err != nil {
+		log.Println("Error al registrar el reembolso", err)
+		return err
+	}
+	if r.Monto > 0 {
+		if _, err := tx.Exec("UPDATE pedidos SET reembolsado = reembolsado + ? WHERE id_pedido = ?", r.Monto, r.IDPedido); err != nil {
+			log.Println("Error al registrar el reembolso del pedido", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// registrarPagoTardio registra, dentro de la transacción, el reembolso de
+// un pago aprobado después de cancelar el pedido: la anulación pendiente que
+// no llegó a tiempo pasa a ser ese reembolso y, si no la hay, se agrega uno.
+func registrarPagoTardio(tx *sql.Tx, r Reembolso) error {
+	result, err := tx.Exec("UPDATE reembolsos SET operacion = ?, monto = ?, error = NULL WHERE id_pedido = ? AND operacion = ? AND estado = ?",
+		r.Operacion, r.Monto, r.IDPedido, OperacionAnulacion, ReembolsoPendiente)
+	if err != nil {
+		log.Println("Error al convertir la anulación en reembolso", err)
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return insertarReembolso(tx, r)
+	}
+	if _, err := tx.Exec("UPDATE pedidos SET reembolsado = reembolsado + ? WHERE id_pedido = ?", r.Monto, r.IDPedido); err != nil {
+		log.Println("Error al registrar el reembolso del pedido", err)
+		return err
+	}
+	return nil
+}
+
+// columnasReembolso son las columnas que lee consultarReembolsos, en orden.
+const columnasReembolso = "id_reembolso, id_pedido, id_devolucion, operacion, transaccion_id, monto, estado, error, fecha_creacion, fecha_actualizacion"
+
+// consultarReembolsos lee los reembolsos que cumplen `where`, del más
+// antiguo al más reciente.
+func consultarReembolsos(where string, args ...interface{}) ([]Reembolso, error) {
+	var reembolsos []Reembolso
+	rows, err := pool.Query("SELECT "+columnasReembolso+" FROM reembolsos "+where+" ORDER BY id_reembolso", args...)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return reembolsos, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r Reembolso
+		var idDevolucion sql.NullInt64
+		var msj sql.NullString
+		if err := rows.Scan(&r.ID, &r.IDPedido, &idDevolucion, &r.Operacion, &r.TransaccionID, &r.Monto, &r.Estado, &msj, &r.FechaCreacion, &r.FechaActualizacion); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return reembolsos, err
+		}
+		r.IDDevolucion = int(idDevolucion.Int64)
+		r.Error = msj.String
+		reembolsos = append(reembolsos, r)
+	}
+	if err = rows.Err(); err != nil {
+		log.Println("Error al obtener los reembolsos", err)
+	}
+	return reembolsos, err
+}
+
+// GetReembolsosByPedidoID devuelve los reembolsos del pedido.
+func GetReembolsosByPedidoID(idPedido int) ([]Reembolso, error) {
+	return consultarReembolsos("WHERE id_pedido = ?", idPedido)
+}
+
+// GetReembolsosPendientes devuelve los reembolsos de todos los pedidos que
+// todavía no se pidieron a la pasarela.
+func GetReembolsosPendientes() ([]Reembolso, error) {
+	return consultarReembolsos("WHERE estado = ?", ReembolsoPendiente)
+}
+
+// RegistrarResultadoReembolso guarda la respuesta de la pasarela: sin error
+// el reembolso pasa a HECHO; con error sigue pendiente y se guarda el motivo.
+func RegistrarResultadoReembolso(id int, resultado error) error {
+	var err error
+	if resultado == nil {
+		_, err = pool.Exec("UPDATE reembolsos SET estado = ?, error = NULL WHERE id_reembolso = ?", ReembolsoHecho, id)
+	} else {
+		_, err = pool.Exec("UPDATE reembolsos SET error = ? WHERE id_reembolso = ? AND estado = ?", resultado.Error(), id, ReembolsoPendiente)
+	}
+	if err != nil {
+		log.Println("Error al registrar el resultado del reembolso", err)
+	}
+	return err
+}
@@ -0,0 +1,2590 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// memoria guarda en mapas los mismos datos que las tablas de MySQL. Un único
+// mutex protege todo, lo que da a Checkout la misma atomicidad que una
+// transacción. Pensado para pruebas con httptest sin servidor de base de datos.
+type memoria struct {
+	mu sync.Mutex
+
+	clientes  map[int]Cliente
+	productos map[int]Producto
+	pedidos   map[int]Pedido
+
+	categorias         map[int]Categoria
+	productoCategorias map[ProductoCategoria]bool
+	imagenes           map[int]ImagenProducto
+
+	opciones        map[int]OpcionProducto
+	valores         map[int]ValorOpcion
+	variantes       map[int]VarianteProducto
+	varianteValores map[int][]int
+
+	detalles map[int]DetallePedido
+	carritos map[int]Carrito
+	items    map[int]ItemCarrito
+	sesiones map[string]Sesion
+
+	cupones   map[int]Cupon
+	cuponUsos map[int]usoCupon
+
+	promociones       map[int]Promocion
+	pedidoPromociones map[int][]PromocionAplicada
+
+	metodosEnvio map[int]MetodoEnvio
+	zonasEnvio   map[int]ZonaEnvio
+	// envios guarda cada envío de un pedido con sus líneas.
+	envios map[int]Envio
+
+	clasesImpuesto map[int]ClaseImpuesto
+
+	// eventosPago guarda los eventos de pago ya aplicados, por proveedor e ID.
+	eventosPago   map[[2]string]bool
+	pedidoEstados map[int]CambioEstado
+
+	// devoluciones guarda cada devolución con sus líneas.
+	devoluciones map[int]Devolucion
+	creditos     map[int]creditoCliente
+	reembolsos   map[int]Reembolso
+
+	ultimoID map[string]int
+}
+
+// NewRepositoriosMemoria devuelve repositorios en memoria que comparten un
+// mismo almacén. Cada llamada crea un almacén vacío e independiente.
+func NewRepositoriosMemoria() Repositorios {
+	m := &memoria{
+		clientes:  map[int]Cliente{},
+		productos: map[int]Producto{},
+		pedidos:   map[int]Pedido{},
+
+		categorias:         map[int]Categoria{},
+		productoCategorias: map[ProductoCategoria]bool{},
+		imagenes:           map[int]ImagenProducto{},
+
+		opciones:        map[int]OpcionProducto{},
+		valores:         map[int]ValorOpcion{},
+		variantes:       map[int]VarianteProducto{},
+		varianteValores: map[int][]int{},
+
+		detalles: map[int]DetallePedido{},
+		carritos: map[int]Carrito{},
+		items:    map[int]ItemCarrito{},
+		sesiones: map[string]Sesion{},
+
+		cupones:   map[int]Cupon{},
+		cuponUsos: map[int]usoCupon{},
+
+		promociones:       map[int]Promocion{},
+		pedidoPromociones: map[int][]PromocionAplicada{},
+
+		metodosEnvio: map[int]MetodoEnvio{},
+		zonasEnvio:   map[int]ZonaEnvio{},
+		envios:       map[int]Envio{},
+
+		clasesImpuesto: map[int]ClaseImpuesto{},
+
+		eventosPago:   map[[2]string]bool{},
+		pedidoEstados: map[int]CambioEstado{},
+
+		devoluciones: map[int]Devolucion{},
+		creditos:     map[int]creditoCliente{},
+		reembolsos:   map[int]Reembolso{},
+
+		ultimoID: map[string]int{},
+	}
+	return Repositorios{
+		Clientes:     clienteMemoria{m},
+		Productos:    productoMemoria{m},
+		Categorias:   categoriaMemoria{m},
+		Imagenes:     imagenMemoria{m},
+		Variantes:    varianteMemoria{m},
+		Pedidos:      pedidoMemoria{m},
+		Devoluciones: devolucionMemoria{m},
+		Carritos:     carritoMemoria{m},
+		Cupones:      cuponMemoria{m},
+		Promociones:  promocionMemoria{m},
+		Envios:       envioMemoria{m},
+		Impuestos:    impuestoMemoria{m},
+		Sesiones:     sesionMemoria{m},
+		Estadisticas: estadisticasMemoria{m},
+	}
+}
+
+// nextID simula el AUTO_INCREMENT de la tabla indicada. Requiere m.mu tomado.
+func (m *memoria) nextID(tabla string) int {
+	m.ultimoID[tabla]++
+	return m.ultimoID[tabla]
+}
+
+// clienteMemoria implementa ClienteRepository en memoria.
+type clienteMemoria struct{ m *memoria }
+
+func (r clienteMemoria) GetByID(id int) (Cliente, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c, ok := r.m.clientes[id]
+	if !ok {
+		return Cliente{}, fmt.Errorf("cliente no encontrado con ID: %d", id)
+	}
+	return c, nil
+}
+
+func (r clienteMemoria) GetByEmail(email string) (Cliente, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, c := range r.m.clientes {
+		if c.Email == email {
+			return c, nil
+		}
+	}
+	return Cliente{}, fmt.Errorf("cliente no encontrado con email: %s", email)
+}
+
+func (r clienteMemoria) GetAll() ([]Cliente, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var clientes []Cliente
+	for _, id := range sortedKeys(r.m.clientes) {
+		clientes = append(clientes, r.m.clientes[id])
+	}
+	return clientes, nil
+}
+
+func (r clienteMemoria) Create(c Cliente) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, existente := range r.m.clientes {
+		if existente.Email == c.Email {
+			return fmt.Errorf("error ejecutando inserción: email duplicado %s", c.Email)
+		}
+	}
+	c.ID = r.m.nextID("clientes")
+	if c.Perfil == "" {
+		c.Perfil = "cliente"
+	}
+	c.FechaRegistro = time.Now()
+	c.FechaActualizacion = c.FechaRegistro
+	r.m.clientes[c.ID] = c
+	return nil
+}
+
+func (r clienteMemoria) Update(c Cliente) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	existente, ok := r.m.clientes[c.ID]
+	if !ok {
+		return nil
+	}
+	existente.Nombre = c.Nombre
+	existente.Email = c.Email
+	existente.Direccion = c.Direccion
+	existente.Telefono = c.Telefono
+	existente.FechaActualizacion = time.Now()
+	r.m.clientes[c.ID] = existente
+	return nil
+}
+
+func (r clienteMemoria) UpdatePasswordHash(id int, passwordHash string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if c, ok := r.m.clientes[id]; ok {
+		c.PasswordHash = passwordHash
+		r.m.clientes[id] = c
+	}
+	return nil
+}
+
+func (r clienteMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.clientes, id)
+	return nil
+}
+
+// productoMemoria implementa ProductoRepository en memoria.
+type productoMemoria struct{ m *memoria }
+
+func (r productoMemoria) GetByID(id int) (Producto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	p, ok := r.m.productos[id]
+	if !ok {
+		return Producto{}, fmt.Errorf("producto no encontrado con ID: %d", id)
+	}
+	return p, nil
+}
+
+func (r productoMemoria) GetAll() ([]Producto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var productos []Producto
+	for _, id := range sortedKeys(r.m.productos) {
+		productos = append(productos, r.m.productos[id])
+	}
+	return productos, nil
+}
+
+// Buscar replica BuscarProductos: cada palabra debe aparecer en el nombre, la
+// descripción o el SKU (sin distinguir mayúsculas), o el texto debe ser el SKU.
+func (r productoMemoria) Buscar(b BusquedaProductos) (ResultadoBusqueda, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	b = b.normalizar()
+	resultado := ResultadoBusqueda{Pagina: b.Pagina, PorPagina: b.PorPagina}
+
+	palabras := palabrasBusqueda(b.Texto)
+	relevancia := map[int]int{}
+	precios := map[int]dinero.Monto{}
+	var variantes []VarianteProducto
+	for _, v := range r.m.variantes {
+		variantes = append(variantes, v)
+	}
+	var encontrados []Producto
+	for _, id := range sortedKeys(r.m.productos) {
+		p := r.m.productos[id]
+		if b.Texto != "" {
+			skuExacto := p.SKU == b.Texto
+			if !skuExacto && (len(palabras) == 0 || !contieneTodas(p.Nombre+" "+p.Descripcion+" "+p.SKU, palabras)) {
+				continue
+			}
+			// Como en MySQL, el SKU exacto va primero; luego pesan las palabras del nombre.
+			if skuExacto {
+				relevancia[p.ID] += 100
+			}
+			if contieneTodas(p.Nombre, palabras) {
+				relevancia[p.ID]++
+			}
+		}
+		precio := precioDesde(p, variantes)
+		if b.PrecioMin > 0 && precio < b.PrecioMin || b.PrecioMax > 0 && precio > b.PrecioMax {
+			continue
+		}
+		if b.SoloActivos && !p.Activo || b.SoloConStock && p.Stock <= 0 {
+			continue
+		}
+		if len(b.Categorias) > 0 && !r.enCategorias(p.ID, b.Categorias) {
+			continue
+		}
+		precios[p.ID] = precio
+		encontrados = append(encontrados, p)
+	}
+
+	vendidos := map[int]int{}
+	for _, d := range r.m.detalles {
+		if r.m.pedidos[d.IDPedido].Estado != "CANCELADO" {
+			vendidos[d.IDProducto] += d.Cantidad
+		}
+	}
+	sort.SliceStable(encontrados, func(i, j int) bool {
+		a, c := encontrados[i], encontrados[j]
+		switch b.Orden {
+		case OrdenPrecioAsc:
+			if precios[a.ID] != precios[c.ID] {
+				return precios[a.ID] < precios[c.ID]
+			}
+			return a.ID < c.ID
+		case OrdenPrecioDesc:
+			if precios[a.ID] != precios[c.ID] {
+				return precios[a.ID] > precios[c.ID]
+			}
+			return a.ID < c.ID
+		case OrdenMasVendidos:
+			if vendidos[a.ID] != vendidos[c.ID] {
+				return vendidos[a.ID] > vendidos[c.ID]
+			}
+		case OrdenRelevancia:
+			if relevancia[a.ID] != relevancia[c.ID] {
+				return relevancia[a.ID] > relevancia[c.ID]
+			}
+		}
+		return a.ID > c.ID
+	})
+
+	resultado.Total = len(encontrados)
+	desde := (b.Pagina - 1) * b.PorPagina
+	if desde < len(encontrados) {
+		hasta := desde + b.PorPagina
+		if hasta > len(encontrados) {
+			hasta = len(encontrados)
+		}
+		resultado.Productos = encontrados[desde:hasta]
+	}
+	return resultado, nil
+}
+
+// contieneTodas indica si todas las palabras aparecen en el texto, sin
+// distinguir mayúsculas.
+func contieneTodas(texto string, palabras []string) bool {
+	texto = strings.ToLower(texto)
+	for _, palabra := range palabras {
+		if !strings.Contains(texto, palabra) {
+			return false
+		}
+	}
+	return true
+}
+
+// enCategorias indica si el producto está en alguna de las categorías.
+// Requiere m.mu tomado.
+func (r productoMemoria) enCategorias(idProducto int, idsCategoria []int) bool {
+	for _, idCategoria := range idsCategoria {
+		if r.m.productoCategorias[ProductoCategoria{IDProducto: idProducto, IDCategoria: idCategoria}] {
+			return true
+		}
+	}
+	return false
+}
+
+func (r productoMemoria) Create(p Producto) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.validar(p); err != nil {
+		return 0, err
+	}
+	p.ID = r.m.nextID("productos")
+	p.FechaCreacion = time.Now()
+	r.m.productos[p.ID] = p
+	return p.ID, nil
+}
+
+func (r productoMemoria) Update(p Producto) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	existente, ok := r.m.productos[p.ID]
+	if !ok {
+		return nil
+	}
+	if err := r.validar(p); err != nil {
+		return err
+	}
+	p.FechaCreacion = existente.FechaCreacion
+	r.m.productos[p.ID] = p
+	return nil
+}
+
+// validar replica las restricciones de la tabla: SKU único, precio/stock no
+// negativos y clase de impuesto existente.
+func (r productoMemoria) validar(p Producto) error {
+	if p.Precio < 0 || p.Stock < 0 || p.Peso < 0 {
+		return fmt.Errorf("precio, stock y peso no pueden ser negativos")
+	}
+	if _, ok := r.m.clasesImpuesto[p.IDClaseImpuesto]; p.IDClaseImpuesto != 0 && !ok {
+		return fmt.Errorf("la clase de impuesto %d no existe", p.IDClaseImpuesto)
+	}
+	for _, existente := range r.m.productos {
+		if p.SKU != "" && existente.SKU == p.SKU && existente.ID != p.ID {
+			return fmt.Errorf("SKU duplicado: %s", p.SKU)
+		}
+	}
+	return nil
+}
+
+func (r productoMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, item := range r.m.items {
+		if item.IDProducto == id {
+			return fmt.Errorf("el producto %d está referenciado por un carrito", id)
+		}
+	}
+	for _, d := range r.m.detalles {
+		if d.IDProducto == id {
+			return fmt.Errorf("el producto %d está referenciado por un pedido", id)
+		}
+	}
+	delete(r.m.productos, id)
+	for pc := range r.m.productoCategorias {
+		if pc.IDProducto == id {
+			delete(r.m.productoCategorias, pc)
+		}
+	}
+	for idCupon, c := range r.m.cupones {
+		c.Productos = sinID(c.Productos, id)
+		r.m.cupones[idCupon] = c
+	}
+	for idPromocion, p := range r.m.promociones {
+		p.Productos = sinID(p.Productos, id)
+		r.m.promociones[idPromocion] = p
+	}
+	for idImagen, i := range r.m.imagenes {
+		if i.IDProducto == id {
+			delete(r.m.imagenes, idImagen)
+		}
+	}
+	for idVariante, v := range r.m.variantes {
+		if v.IDProducto == id {
+			r.m.eliminarVariante(idVariante)
+		}
+	}
+	for idOpcion, o := range r.m.opciones {
+		if o.IDProducto == id {
+			r.m.eliminarOpcion(idOpcion)
+		}
+	}
+	return nil
+}
+
+// imagenMemoria implementa ImagenRepository en memoria.
+type imagenMemoria struct{ m *memoria }
+
+func (r imagenMemoria) GetByID(id int) (ImagenProducto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	i, ok := r.m.imagenes[id]
+	if !ok {
+		return ImagenProducto{}, fmt.Errorf("imagen no encontrada con ID: %d", id)
+	}
+	return i, nil
+}
+
+// deProducto devuelve las imágenes de un producto ordenadas. Requiere m.mu tomado.
+func (r imagenMemoria) deProducto(idProducto int) []ImagenProducto {
+	var imagenes []ImagenProducto
+	for _, id := range sortedKeys(r.m.imagenes) {
+		if i := r.m.imagenes[id]; i.IDProducto == idProducto {
+			imagenes = append(imagenes, i)
+		}
+	}
+	sort.SliceStable(imagenes, func(a, b int) bool { return imagenes[a].Orden < imagenes[b].Orden })
+	return imagenes
+}
+
+func (r imagenMemoria) GetByProductoID(idProducto int) ([]ImagenProducto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.deProducto(idProducto), nil
+}
+
+func (r imagenMemoria) GetPrincipales(idsProducto []int) (map[int]ImagenProducto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	buscados := map[int]bool{}
+	for _, id := range idsProducto {
+		buscados[id] = true
+	}
+	principales := map[int]ImagenProducto{}
+	for _, i := range r.m.imagenes {
+		if i.Principal && buscados[i.IDProducto] {
+			principales[i.IDProducto] = i
+		}
+	}
+	return principales, nil
+}
+
+func (r imagenMemoria) Create(idProducto int, clave, extension string) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.productos[idProducto]; !ok {
+		return 0, fmt.Errorf("producto no encontrado con ID: %d", idProducto)
+	}
+	existentes := r.deProducto(idProducto)
+	i := ImagenProducto{
+		ID:            r.m.nextID("imagenes_producto"),
+		IDProducto:    idProducto,
+		Clave:         clave,
+		Extension:     extension,
+		Principal:     true,
+		FechaCreacion: time.Now(),
+	}
+	for _, e := range existentes {
+		if e.Orden >= i.Orden {
+			i.Orden = e.Orden + 1
+		}
+		if e.Principal {
+			i.Principal = false
+		}
+	}
+	r.m.imagenes[i.ID] = i
+	return i.ID, nil
+}
+
+func (r imagenMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	i, ok := r.m.imagenes[id]
+	if !ok {
+		return fmt.Errorf("imagen no encontrada con ID: %d", id)
+	}
+	delete(r.m.imagenes, id)
+	if restantes := r.deProducto(i.IDProducto); i.Principal && len(restantes) > 0 {
+		siguiente := restantes[0]
+		siguiente.Principal = true
+		r.m.imagenes[siguiente.ID] = siguiente
+	}
+	return nil
+}
+
+func (r imagenMemoria) SetPrincipal(idProducto, idImagen int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if i, ok := r.m.imagenes[idImagen]; !ok || i.IDProducto != idProducto {
+		return fmt.Errorf("la imagen %d no pertenece al producto %d", idImagen, idProducto)
+	}
+	for _, i := range r.deProducto(idProducto) {
+		i.Principal = i.ID == idImagen
+		r.m.imagenes[i.ID] = i
+	}
+	return nil
+}
+
+func (r imagenMemoria) Reordenar(idProducto int, ids []int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for orden, id := range ids {
+		if i, ok := r.m.imagenes[id]; ok && i.IDProducto == idProducto {
+			i.Orden = orden
+			r.m.imagenes[id] = i
+		}
+	}
+	return nil
+}
+
+// varianteMemoria implementa VarianteRepository en memoria.
+type varianteMemoria struct{ m *memoria }
+
+// opcionesDe devuelve los ejes de un producto con sus valores, en orden.
+// Requiere m.mu tomado.
+func (m *memoria) opcionesDe(idProducto int) []OpcionProducto {
+	var opciones []OpcionProducto
+	for _, id := range sortedKeys(m.opciones) {
+		if o := m.opciones[id]; o.IDProducto == idProducto {
+			o.Valores = nil
+			for _, idValor := range sortedKeys(m.valores) {
+				if v := m.valores[idValor]; v.IDOpcion == o.ID {
+					v.Opcion = o.Nombre
+					o.Valores = append(o.Valores, v)
+				}
+			}
+			sort.SliceStable(o.Valores, func(i, j int) bool { return o.Valores[i].Orden < o.Valores[j].Orden })
+			opciones = append(opciones, o)
+		}
+	}
+	sort.SliceStable(opciones, func(i, j int) bool { return opciones[i].Orden < opciones[j].Orden })
+	return opciones
+}
+
+// varianteCompleta agrega a la variante sus valores ordenados por eje.
+// Requiere m.mu tomado.
+func (m *memoria) varianteCompleta(v VarianteProducto) VarianteProducto {
+	v.Valores = nil
+	usados := map[int]bool{}
+	for _, id := range m.varianteValores[v.ID] {
+		usados[id] = true
+	}
+	for _, o := range m.opcionesDe(v.IDProducto) {
+		for _, valor := range o.Valores {
+			if usados[valor.ID] {
+				v.Valores = append(v.Valores, valor)
+			}
+		}
+	}
+	return v
+}
+
+// eliminarVariante replica las claves foráneas: borra los items de carrito de
+// la variante y deja las líneas de pedido sin ella. Requiere m.mu tomado.
+func (m *memoria) eliminarVariante(id int) {
+	delete(m.variantes, id)
+	delete(m.varianteValores, id)
+	for idItem, item := range m.items {
+		if item.IDVariante == id {
+			delete(m.items, idItem)
+		}
+	}
+	for idDetalle, d := range m.detalles {
+		if d.IDVariante == id {
+			d.IDVariante = 0
+			m.detalles[idDetalle] = d
+		}
+	}
+}
+
+// eliminarValor borra un valor y lo quita de las variantes. Requiere m.mu tomado.
+func (m *memoria) eliminarValor(id int) {
+	delete(m.valores, id)
+	for idVariante, ids := range m.varianteValores {
+		var restantes []int
+		for _, idValor := range ids {
+			if idValor != id {
+				restantes = append(restantes, idValor)
+			}
+		}
+		m.varianteValores[idVariante] = restantes
+	}
+}
+
+// eliminarOpcion borra un eje con sus valores. Requiere m.mu tomado.
+func (m *memoria) eliminarOpcion(id int) {
+	delete(m.opciones, id)
+	for idValor, v := range m.valores {
+		if v.IDOpcion == id {
+			m.eliminarValor(idValor)
+		}
+	}
+}
+
+// recalcularStock replica recalcularStockProducto. Requiere m.mu tomado.
+func (m *memoria) recalcularStock(idProducto int) {
+	total, hay := 0, false
+	for _, v := range m.variantes {
+		if v.IDProducto == idProducto {
+			total += v.Stock
+			hay = true
+		}
+	}
+	if p, ok := m.productos[idProducto]; ok && hay {
+		p.Stock = total
+		m.productos[idProducto] = p
+	}
+}
+
+func (r varianteMemoria) GetOpciones(idProducto int) ([]OpcionProducto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.opcionesDe(idProducto), nil
+}
+
+func (r varianteMemoria) SetOpciones(idProducto int, opciones []OpcionProducto) error {
+	if err := ValidarOpciones(opciones); err != nil {
+		return err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.productos[idProducto]; !ok {
+		return fmt.Errorf("producto no encontrado con ID: %d", idProducto)
+	}
+	porNombre := map[string]OpcionProducto{}
+	for _, o := range r.m.opcionesDe(idProducto) {
+		porNombre[strings.ToLower(o.Nombre)] = o
+	}
+	for orden, o := range opciones {
+		existente, ok := porNombre[strings.ToLower(o.Nombre)]
+		if ok {
+			delete(porNombre, strings.ToLower(o.Nombre))
+		} else {
+			existente = OpcionProducto{ID: r.m.nextID("opciones_producto"), IDProducto: idProducto}
+		}
+		r.m.opciones[existente.ID] = OpcionProducto{ID: existente.ID, IDProducto: idProducto, Nombre: o.Nombre, Orden: orden}
+
+		valoresActuales := map[string]int{}
+		for _, v := range existente.Valores {
+			valoresActuales[strings.ToLower(v.Valor)] = v.ID
+		}
+		for ordenValor, v := range o.Valores {
+			id, ok := valoresActuales[strings.ToLower(v.Valor)]
+			if ok {
+				delete(valoresActuales, strings.ToLower(v.Valor))
+			} else {
+				id = r.m.nextID("valores_opcion")
+			}
+			r.m.valores[id] = ValorOpcion{ID: id, IDOpcion: existente.ID, Valor: v.Valor, Orden: ordenValor}
+		}
+		for _, id := range valoresActuales {
+			r.m.eliminarValor(id)
+		}
+	}
+	for _, o := range porNombre {
+		r.m.eliminarOpcion(o.ID)
+	}
+	for id, v := range r.m.variantes {
+		if v.IDProducto == idProducto && (len(opciones) == 0 || len(r.m.varianteValores[id]) != len(opciones)) {
+			r.m.eliminarVariante(id)
+		}
+	}
+	r.m.recalcularStock(idProducto)
+	return nil
+}
+
+func (r varianteMemoria) GetByID(id int) (VarianteProducto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	v, ok := r.m.variantes[id]
+	if !ok {
+		return VarianteProducto{}, fmt.Errorf("variante no encontrada con ID: %d", id)
+	}
+	return r.m.varianteCompleta(v), nil
+}
+
+func (r varianteMemoria) GetByProductoID(idProducto int) ([]VarianteProducto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var variantes []VarianteProducto
+	for _, id := range sortedKeys(r.m.variantes) {
+		if v := r.m.variantes[id]; v.IDProducto == idProducto {
+			variantes = append(variantes, r.m.varianteCompleta(v))
+		}
+	}
+	return variantes, nil
+}
+
+func (r varianteMemoria) ConVariantes(idsProducto []int) (map[int]bool, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	buscados := map[int]bool{}
+	for _, id := range idsProducto {
+		buscados[id] = true
+	}
+	conVariantes := map[int]bool{}
+	for _, v := range r.m.variantes {
+		if buscados[v.IDProducto] {
+			conVariantes[v.IDProducto] = true
+		}
+	}
+	return conVariantes, nil
+}
+
+func (r varianteMemoria) Generar(idProducto int) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	p, ok := r.m.productos[idProducto]
+	if !ok {
+		return 0, fmt.Errorf("producto no encontrado con ID: %d", idProducto)
+	}
+	usadas := map[string]bool{}
+	for _, v := range r.m.variantes {
+		if v.IDProducto == idProducto {
+			usadas[claveValores(r.m.varianteCompleta(v).Valores)] = true
+		}
+	}
+	creadas := 0
+	for _, valores := range combinaciones(r.m.opcionesDe(idProducto)) {
+		if usadas[claveValores(valores)] {
+			continue
+		}
+		v := VarianteProducto{
+			ID:         r.m.nextID("variantes_producto"),
+			IDProducto: idProducto,
+			SKU:        skuVariante(p.SKU, valores),
+			Activo:     true,
+		}
+		if err := r.validarSKU(v); err != nil {
+			return creadas, err
+		}
+		r.m.variantes[v.ID] = v
+		for _, valor := range valores {
+			r.m.varianteValores[v.ID] = append(r.m.varianteValores[v.ID], valor.ID)
+		}
+		creadas++
+	}
+	r.m.recalcularStock(idProducto)
+	return creadas, nil
+}
+
+// validarSKU replica el índice único de `variantes_producto.sku`.
+// Requiere m.mu tomado.
+func (r varianteMemoria) validarSKU(v VarianteProducto) error {
+	for _, existente := range r.m.variantes {
+		if v.SKU != "" && existente.SKU == v.SKU && existente.ID != v.ID {
+			return fmt.Errorf("SKU duplicado: %s", v.SKU)
+		}
+	}
+	return nil
+}
+
+func (r varianteMemoria) Update(v VarianteProducto) error {
+	if v.Stock < 0 || v.PrecioPropio && v.Precio < 0 {
+		return fmt.Errorf("precio y stock no pueden ser negativos")
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	existente, ok := r.m.variantes[v.ID]
+	if !ok {
+		return fmt.Errorf("variante no encontrada con ID: %d", v.ID)
+	}
+	if err := r.validarSKU(v); err != nil {
+		return err
+	}
+	existente.SKU = v.SKU
+	existente.Precio, existente.PrecioPropio = v.Precio, v.PrecioPropio
+	existente.Stock = v.Stock
+	existente.Activo = v.Activo
+	r.m.variantes[v.ID] = existente
+	r.m.recalcularStock(existente.IDProducto)
+	return nil
+}
+
+func (r varianteMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	v, ok := r.m.variantes[id]
+	if !ok {
+		return fmt.Errorf("variante no encontrada con ID: %d", id)
+	}
+	r.m.eliminarVariante(id)
+	r.m.recalcularStock(v.IDProducto)
+	return nil
+}
+
+// categoriaMemoria implementa CategoriaRepository en memoria.
+type categoriaMemoria struct{ m *memoria }
+
+func (r categoriaMemoria) GetByID(id int) (Categoria, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c, ok := r.m.categorias[id]
+	if !ok {
+		return Categoria{}, fmt.Errorf("categoría no encontrada con ID: %d", id)
+	}
+	return c, nil
+}
+
+func (r categoriaMemoria) GetAll() ([]Categoria, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	categorias := r.todas()
+	sort.SliceStable(categorias, func(i, j int) bool { return categorias[i].Nombre < categorias[j].Nombre })
+	return categorias, nil
+}
+
+// todas devuelve las categorías por ID. Requiere m.mu tomado.
+func (r categoriaMemoria) todas() []Categoria {
+	var categorias []Categoria
+	for _, id := range sortedKeys(r.m.categorias) {
+		categorias = append(categorias, r.m.categorias[id])
+	}
+	return categorias
+}
+
+// validar replica las restricciones de la tabla (nombre único) y la jerarquía.
+func (r categoriaMemoria) validar(c Categoria) error {
+	for _, existente := range r.m.categorias {
+		if existente.Nombre == c.Nombre && existente.ID != c.ID {
+			return fmt.Errorf("nombre de categoría duplicado: %s", c.Nombre)
+		}
+	}
+	return validarPadre(r.todas(), c.ID, c.IDPadre)
+}
+
+func (r categoriaMemoria) Create(c Categoria) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c.ID = 0
+	if err := r.validar(c); err != nil {
+		return err
+	}
+	c.ID = r.m.nextID("categorias")
+	r.m.categorias[c.ID] = c
+	return nil
+}
+
+func (r categoriaMemoria) Update(c Categoria) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.categorias[c.ID]; !ok {
+		return nil
+	}
+	if err := r.validar(c); err != nil {
+		return err
+	}
+	r.m.categorias[c.ID] = c
+	return nil
+}
+
+func (r categoriaMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, c := range r.m.categorias {
+		if c.IDPadre == id {
+			return ErrCategoriaConSubcategorias
+		}
+	}
+	delete(r.m.categorias, id)
+	for pc := range r.m.productoCategorias {
+		if pc.IDCategoria == id {
+			delete(r.m.productoCategorias, pc)
+		}
+	}
+	for idCupon, c := range r.m.cupones {
+		c.Categorias = sinID(c.Categorias, id)
+		r.m.cupones[idCupon] = c
+	}
+	// Como el ON DELETE CASCADE de `promociones`.
+	for idPromocion, p := range r.m.promociones {
+		if p.IDCategoria == id {
+			r.m.eliminarPromocion(idPromocion)
+		}
+	}
+	return nil
+}
+
+func (r categoriaMemoria) GetByProductoID(idProducto int) ([]Categoria, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var categorias []Categoria
+	for _, c := range r.todas() {
+		if r.m.productoCategorias[ProductoCategoria{IDProducto: idProducto, IDCategoria: c.ID}] {
+			categorias = append(categorias, c)
+		}
+	}
+	sort.SliceStable(categorias, func(i, j int) bool { return categorias[i].Nombre < categorias[j].Nombre })
+	return categorias, nil
+}
+
+func (r categoriaMemoria) SetProducto(idProducto int, idsCategoria []int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.productos[idProducto]; !ok {
+		return fmt.Errorf("producto %d inexistente", idProducto)
+	}
+	for _, idCategoria := range idsCategoria {
+		if _, ok := r.m.categorias[idCategoria]; !ok {
+			return fmt.Errorf("categoría %d inexistente", idCategoria)
+		}
+	}
+	for pc := range r.m.productoCategorias {
+		if pc.IDProducto == idProducto {
+			delete(r.m.productoCategorias, pc)
+		}
+	}
+	for _, idCategoria := range idsCategoria {
+		r.m.productoCategorias[ProductoCategoria{IDProducto: idProducto, IDCategoria: idCategoria}] = true
+	}
+	return nil
+}
+
+// pedidoMemoria implementa PedidoRepository en memoria.
+type pedidoMemoria struct{ m *memoria }
+
+func (r pedidoMemoria) GetByID(id int) (Pedido, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	p, ok := r.m.pedidos[id]
+	if !ok {
+		return Pedido{}, fmt.Errorf("pedido no encontrado con ID: %d", id)
+	}
+	return p, nil
+}
+
+func (r pedidoMemoria) GetAll() ([]Pedido, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var pedidos []Pedido
+	for _, id := range sortedKeys(r.m.pedidos) {
+		pedidos = append(pedidos, r.m.pedidos[id])
+	}
+	return pedidos, nil
+}
+
+func (r pedidoMemoria) GetByClienteID(idCliente int) ([]Pedido, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var pedidos []Pedido
+	ids := sortedKeys(r.m.pedidos)
+	// Igual que en MySQL: los más recientes primero.
+	for i := len(ids) - 1; i >= 0; i-- {
+		if p := r.m.pedidos[ids[i]]; p.IDCliente == idCliente {
+			pedidos = append(pedidos, p)
+		}
+	}
+	return pedidos, nil
+}
+
+func (r pedidoMemoria) GetDetalles(idPedido int) ([]DetallePedido, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var detalles []DetallePedido
+	for _, id := range sortedKeys(r.m.detalles) {
+		if d := r.m.detalles[id]; d.IDPedido == idPedido {
+			detalles = append(detalles, d)
+		}
+	}
+	return detalles, nil
+}
+
+func (r pedidoMemoria) GetPromociones(idPedido int) ([]PromocionAplicada, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return append([]PromocionAplicada(nil), r.m.pedidoPromociones[idPedido]...), nil
+}
+
+func (r pedidoMemoria) Checkout(s SolicitudCheckout) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	carrito, ok := carritoDeCliente(r.m, s.IDCliente)
+	if !ok {
+		return 0, ErrCarritoVacio
+	}
+
+	// Igual que lockLineasCarrito: una línea por producto y variante.
+	type claveLinea struct{ producto, variante int }
+	cantidades := map[claveLinea]int{}
+	var claves []claveLinea
+	for _, id := range sortedKeys(r.m.items) {
+		item := r.m.items[id]
+		if item.IDCarrito != carrito.ID {
+			continue
+		}
+		clave := claveLinea{item.IDProducto, item.IDVariante}
+		if _, ok := cantidades[clave]; !ok {
+			claves = append(claves, clave)
+		}
+		cantidades[clave] += item.Cantidad
+	}
+	sort.Slice(claves, func(i, j int) bool {
+		if claves[i].producto != claves[j].producto {
+			return claves[i].producto < claves[j].producto
+		}
+		return claves[i].variante < claves[j].variante
+	})
+	conVariantes := map[int]bool{}
+	for _, v := range r.m.variantes {
+		conVariantes[v.IDProducto] = true
+	}
+	var lineas []lineaCheckout
+	for _, clave := range claves {
+		p := r.m.productos[clave.producto]
+		l := lineaCheckout{
+			IDProducto:  clave.producto,
+			IDVariante:  clave.variante,
+			Cantidad:    cantidades[clave],
+			Nombre:      p.Nombre,
+			Precio:      p.Precio,
+			Peso:        p.Peso,
+			Stock:       p.Stock,
+			Activo:      p.Activo,
+			SinVariante: clave.variante == 0 && conVariantes[clave.producto],
+
+			IDClaseImpuesto: p.IDClaseImpuesto,
+		}
+		if clave.variante != 0 {
+			v := r.m.varianteCompleta(r.m.variantes[clave.variante])
+			l.Variante = v.Descripcion()
+			l.Precio = v.PrecioPara(p)
+			l.Stock = v.Stock
+			l.Activo = p.Activo && v.Activo
+		}
+		lineas = append(lineas, l)
+	}
+
+	subtotal, err := validarLineas(lineas)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range lineas {
+		lineas[i].Categorias = r.m.categoriasDe(lineas[i].IDProducto)
+	}
+	categorias := categoriaMemoria{r.m}.todas()
+	var activas []Promocion
+	for _, id := range sortedKeys(r.m.promociones) {
+		if p := r.m.promociones[id]; p.Activo {
+			activas = append(activas, p)
+		}
+	}
+	ahora := time.Now()
+	promocion := aplicarPromocionesLineas(activas, lineas, categorias, ahora)
+
+	var cupon Cupon
+	var descuento dinero.Monto
+	if codigo := NormalizarCodigo(s.CodigoCupon); codigo != "" {
+		if cupon, ok = r.m.cuponPorCodigo(codigo); !ok {
+			return 0, fmt.Errorf("%w: el cupón %s no existe", ErrCuponInvalido, codigo)
+		}
+		descuento, err = aplicarCuponLineas(cupon, lineas, categorias, r.m.usosCupon(cupon.ID, s.IDCliente), ahora)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	importe := subtotal - promocion.Total - descuento
+	impuestos := aplicarImpuestosLineas(r.m.clasesImpuestoOrdenadas(), lineas)
+	var zonas []ZonaEnvio
+	for _, id := range sortedKeys(r.m.zonasEnvio) {
+		zonas = append(zonas, r.m.zonasEnvio[id])
+	}
+	metodo, costoEnvio, entrega, err := elegirEnvio(s, r.m.metodosEnvioFiltrados(true), zonas, pesoLineas(lineas), importe)
+	if err != nil {
+		return 0, err
+	}
+	total := importe + impuestos.Adicional() + costoEnvio
+	credito := CreditoAplicable(r.m.saldoCredito(s.IDCliente), total)
+	estado := estadoInicial(total - credito)
+
+	pedido := Pedido{
+		ID:                   r.m.nextID("pedidos"),
+		IDCliente:            s.IDCliente,
+		Fecha:                ahora,
+		Estado:               estado,
+		Subtotal:             subtotal,
+		DescuentoPromociones: promocion.Total,
+		Descuento:            descuento,
+		Total:                total,
+		Credito:              credito,
+		MetodoPago:           s.MetodoPago,
+		IDCupon:              cupon.ID,
+		CodigoCupon:          cupon.Codigo,
+		IDMetodoEnvio:        metodo.ID,
+		MetodoEnvio:          metodo.Nombre,
+		CostoEnvio:           costoEnvio,
+		Impuestos:            impuestos.Total,
+		ImpuestosIncluidos:   impuestos.Incluidos,
+		Entrega:              entrega,
+	}
+	r.m.pedidos[pedido.ID] = pedido
+	r.m.registrarCambioEstado(&CambioEstado{
+		IDPedido:    pedido.ID,
+		EstadoNuevo: estado,
+		IDCliente:   s.IDCliente,
+		Responsable: r.m.clientes[s.IDCliente].Nombre,
+		Motivo:      motivoCreacion(estado),
+		Fecha:       ahora,
+	})
+	if credito > 0 {
+		r.m.creditos[r.m.nextID("creditos_clientes")] = creditoCliente{IDCliente: s.IDCliente, Monto: -credito, IDPedido: pedido.ID}
+	}
+	if len(promocion.Aplicadas) > 0 {
+		r.m.pedidoPromociones[pedido.ID] = promocion.Aplicadas
+	}
+
+	if cupon.ID != 0 {
+		cupon.Usos++
+		r.m.cupones[cupon.ID] = cupon
+		id := r.m.nextID("cupon_usos")
+		r.m.cuponUsos[id] = usoCupon{IDCupon: cupon.ID, IDCliente: s.IDCliente, IDPedido: pedido.ID}
+	}
+
+	for _, l := range lineas {
+		d := DetallePedido{
+			ID:                 r.m.nextID("detalles_pedido"),
+			IDPedido:           pedido.ID,
+			IDProducto:         l.IDProducto,
+			IDVariante:         l.IDVariante,
+			Variante:           l.Variante,
+			Cantidad:           l.Cantidad,
+			PrecioUnitario:     l.Precio,
+			DescuentoPromocion: l.DescuentoPromocion,
+			Descuento:          l.Descuento,
+			ImpuestoNombre:     l.Clase.Nombre,
+			ImpuestoTasa:       l.Clase.Tasa,
+			ImpuestoExento:     l.Clase.Exenta,
+			Impuesto:           l.Impuesto,
+			Subtotal:           l.Precio.Por(l.Cantidad),
+		}
+		r.m.detalles[d.ID] = d
+
+		p := r.m.productos[l.IDProducto]
+		p.Stock -= l.Cantidad
+		r.m.productos[p.ID] = p
+		if v, ok := r.m.variantes[l.IDVariante]; ok {
+			v.Stock -= l.Cantidad
+			r.m.variantes[v.ID] = v
+		}
+	}
+
+	for id, item := range r.m.items {
+		if item.IDCarrito == carrito.ID {
+			delete(r.m.items, id)
+		}
+	}
+	return pedido.ID, nil
+}
+
+func (r pedidoMemoria) RegistrarCobro(idPedido int, c Cobro) (*CambioEstado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	pedido, ok := r.m.pedidos[idPedido]
+	if !ok {
+		return nil, fmt.Errorf("pedido %d no encontrado", idPedido)
+	}
+	nuevo, err := estadoPorCobro(c, pedido)
+	if err != nil {
+		return nil, err
+	}
+	pedido.TransaccionID = c.TransaccionID
+	r.m.pedidos[idPedido] = pedido
+	if nuevo == "" {
+		return nil, nil
+	}
+	cambio, err := r.m.cambiarEstado(cambioPorCobro(c, idPedido))
+	if err != nil {
+		return nil, err
+	}
+	return &cambio, nil
+}
+
+func (r pedidoMemoria) AnularCheckout(idPedido int, responsable, motivo string) (CambioEstado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	pedido, ok := r.m.pedidos[idPedido]
+	if !ok {
+		return CambioEstado{}, fmt.Errorf("pedido %d no encontrado", idPedido)
+	}
+	if pedido.Estado != EstadoPendiente {
+		return CambioEstado{}, fmt.Errorf("%w: el pedido ya está %s", ErrTransicionInvalida, pedido.Estado)
+	}
+	cambio, err := r.m.cambiarEstado(SolicitudCambioEstado{IDPedido: idPedido, Estado: EstadoCancelado, Responsable: responsable, Motivo: motivo})
+	if err != nil {
+		return CambioEstado{}, err
+	}
+
+	if c, ok := r.m.cupones[pedido.IDCupon]; ok {
+		if c.Usos > 0 {
+			c.Usos--
+		}
+		r.m.cupones[c.ID] = c
+		for id, u := range r.m.cuponUsos {
+			if u.IDPedido == idPedido {
+				delete(r.m.cuponUsos, id)
+			}
+		}
+	}
+
+	carrito, ok := carritoDeCliente(r.m, pedido.IDCliente)
+	if !ok {
+		carrito = Carrito{ID: r.m.nextID("carritos"), IDCliente: pedido.IDCliente, FechaCreacion: time.Now()}
+		r.m.carritos[carrito.ID] = carrito
+	}
+	for _, d := range r.m.detallesPedido(idPedido) {
+		if d.Variante != "" && d.IDVariante == 0 {
+			continue
+		}
+		r.m.agregarItem(carrito.ID, d.IDProducto, d.IDVariante, d.Cantidad)
+	}
+	return cambio, nil
+}
+
+func (r pedidoMemoria) RegistrarEventoPago(e EventoPago) (bool, *CambioEstado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+
+	var pedido Pedido
+	encontrado := false
+	for _, p := range r.m.pedidos {
+		if p.TransaccionID == e.TransaccionID {
+			pedido, encontrado = p, true
+			break
+		}
+	}
+	if !encontrado {
+		return false, nil, ErrTransaccionSinPedido
+	}
+	clave := [2]string{e.Proveedor, e.IDEvento}
+	if r.m.eventosPago[clave] {
+		return false, nil, nil
+	}
+	nuevo, err := estadoPorEventoPago(e, pedido.Estado, pedido.ACobrar())
+	if err != nil {
+		return false, nil, err
+	}
+	var cambio *CambioEstado
+	if nuevo != "" {
+		c, err := r.m.cambiarEstado(cambioPorEventoPago(e, pedido.ID, nuevo))
+		if err != nil {
+			return false, nil, err
+		}
+		cambio = &c
+	}
+	if reembolso, ok := reembolsoPorPagoTardio(pedido, e); ok {
+		r.m.registrarPagoTardio(reembolso)
+	}
+	r.m.eventosPago[clave] = true
+	return true, cambio, nil
+}
+
+func (r pedidoMemoria) GetReembolsos(idPedido int) ([]Reembolso, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.filtrarReembolsos(func(re Reembolso) bool { return re.IDPedido == idPedido }), nil
+}
+
+func (r pedidoMemoria) GetReembolsosPendientes() ([]Reembolso, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.filtrarReembolsos(Reembolso.Pendiente), nil
+}
+
+func (r pedidoMemoria) RegistrarResultadoReembolso(id int, resultado error) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	re, ok := r.m.reembolsos[id]
+	if !ok {
+		return fmt.Errorf("reembolso %d no encontrado", id)
+	}
+	switch {
+	case resultado == nil:
+		re.Estado = ReembolsoHecho
+		re.Error = ""
+	case re.Pendiente():
+		re.Error = resultado.Error()
+	default:
+		return nil
+	}
+	re.FechaActualizacion = time.Now()
+	r.m.reembolsos[id] = re
+	return nil
+}
+
+func (r pedidoMemoria) CambiarEstado(s SolicitudCambioEstado) (CambioEstado, error) {
+	if err := validarEstadoManual(s.Estado); err != nil {
+		return CambioEstado{}, err
+	}
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.cambiarEstado(s)
+}
+
+func (r pedidoMemoria) GetHistorial(idPedido int) ([]CambioEstado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var historial []CambioEstado
+	for _, id := range sortedKeys(r.m.pedidoEstados) {
+		if c := r.m.pedidoEstados[id]; c.IDPedido == idPedido {
+			historial = append(historial, c)
+		}
+	}
+	return historial, nil
+}
+
+// cambiarEstado es CambiarEstadoPedido en memoria. Requiere m.mu tomado.
+func (m *memoria) cambiarEstado(s SolicitudCambioEstado) (CambioEstado, error) {
+	pedido, ok := m.pedidos[s.IDPedido]
+	if !ok {
+		return CambioEstado{}, fmt.Errorf("pedido %d no encontrado", s.IDPedido)
+	}
+	if err := validarTransicion(pedido.Estado, s.Estado); err != nil {
+		return CambioEstado{}, err
+	}
+	cambio := CambioEstado{
+		IDPedido:       pedido.ID,
+		EstadoAnterior: pedido.Estado,
+		EstadoNuevo:    s.Estado,
+		IDCliente:      s.IDCliente,
+		Responsable:    s.Responsable,
+		Motivo:         s.Motivo,
+		Fecha:          time.Now(),
+	}
+	if s.Estado == EstadoCancelado {
+		m.reponerStock(pedido.ID)
+		if pedido.Credito > 0 {
+			m.creditos[m.nextID("creditos_clientes")] = creditoCliente{IDCliente: pedido.IDCliente, Monto: pedido.Credito, IDPedido: pedido.ID}
+		}
+		if r, ok := reembolsoPorCancelacion(pedido); ok && s.DevolverPago {
+			m.insertarReembolso(r)
+			pedido.Reembolsado += r.Monto
+		}
+	}
+	pedido.Estado = s.Estado
+	m.pedidos[pedido.ID] = pedido
+	m.registrarCambioEstado(&cambio)
+	return cambio, nil
+}
+
+// registrarCambioEstado agrega la entrada al historial y le asigna su ID.
+// Requiere m.mu tomado.
+func (m *memoria) registrarCambioEstado(c *CambioEstado) {
+	c.ID = m.nextID("pedido_estados")
+	m.pedidoEstados[c.ID] = *c
+}
+
+// reponerStock es reponerStockPedido en memoria. Requiere m.mu tomado.
+func (m *memoria) reponerStock(idPedido int) {
+	for _, d := range m.detalles {
+		if d.IDPedido == idPedido {
+			m.reponerStockLinea(d, d.Cantidad)
+		}
+	}
+}
+
+// reponerStockLinea es reponerStockLinea en memoria. Requiere m.mu tomado.
+func (m *memoria) reponerStockLinea(d DetallePedido, cantidad int) {
+	if d.Variante != "" && d.IDVariante == 0 {
+		return
+	}
+	if v, ok := m.variantes[d.IDVariante]; ok {
+		v.Stock += cantidad
+		m.variantes[v.ID] = v
+	}
+	if p, ok := m.productos[d.IDProducto]; ok {
+		p.Stock += cantidad
+		m.productos[p.ID] = p
+	}
+}
+
+// insertarReembolso guarda el reembolso PENDIENTE y le asigna su ID. A
+// diferencia de insertarReembolso en MySQL no toca el pedido: el llamador
+// suma el monto a lo reembolsado. Requiere m.mu tomado.
+func (m *memoria) insertarReembolso(r Reembolso) {
+	r.ID = m.nextID("reembolsos")
+	r.Estado = ReembolsoPendiente
+	r.FechaCreacion = time.Now()
+	r.FechaActualizacion = r.FechaCreacion
+	m.reembolsos[r.ID] = r
+}
+
+// registrarPagoTardio es registrarPagoTardio en memoria. Requiere m.mu
+// tomado.
+func (m *memoria) registrarPagoTardio(r Reembolso) {
+	convertida := false
+	for _, id := range sortedKeys(m.reembolsos) {
+		re := m.reembolsos[id]
+		if re.IDPedido == r.IDPedido && re.Operacion == OperacionAnulacion && re.Pendiente() {
+			re.Operacion, re.Monto, re.Error = r.Operacion, r.Monto, ""
+			m.reembolsos[id] = re
+			convertida = true
+			break
+		}
+	}
+	if !convertida {
+		m.insertarReembolso(r)
+	}
+	pedido := m.pedidos[r.IDPedido]
+	pedido.Reembolsado += r.Monto
+	m.pedidos[pedido.ID] = pedido
+}
+
+// filtrarReembolsos devuelve, por ID, los reembolsos que cumplen `incluir`.
+// Requiere m.mu tomado.
+func (m *memoria) filtrarReembolsos(incluir func(Reembolso) bool) []Reembolso {
+	var reembolsos []Reembolso
+	for _, id := range sortedKeys(m.reembolsos) {
+		if r := m.reembolsos[id]; incluir(r) {
+			reembolsos = append(reembolsos, r)
+		}
+	}
+	return reembolsos
+}
+
+// creditoCliente es una fila de `creditos_clientes`.
+type creditoCliente struct {
+	IDCliente    int
+	Monto        dinero.Monto
+	IDDevolucion int
+	IDPedido     int
+}
+
+// saldoCredito es GetSaldoCredito en memoria. Requiere m.mu tomado.
+func (m *memoria) saldoCredito(idCliente int) dinero.Monto {
+	var saldo dinero.Monto
+	for _, c := range m.creditos {
+		if c.IDCliente == idCliente {
+			saldo += c.Monto
+		}
+	}
+	return saldo
+}
+
+// devolucionMemoria implementa DevolucionRepository en memoria.
+type devolucionMemoria struct{ m *memoria }
+
+func (r devolucionMemoria) GetByID(id int) (Devolucion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	d, ok := r.m.devoluciones[id]
+	if !ok {
+		return Devolucion{}, fmt.Errorf("devolución no encontrada con ID: %d", id)
+	}
+	return r.m.copiarDevolucion(d, true), nil
+}
+
+func (r devolucionMemoria) GetAll() ([]Devolucion, error) {
+	return r.filtrar(false, func(Devolucion) bool { return true }), nil
+}
+
+func (r devolucionMemoria) GetByPedidoID(idPedido int) ([]Devolucion, error) {
+	return r.filtrar(true, func(d Devolucion) bool { return d.IDPedido == idPedido }), nil
+}
+
+func (r devolucionMemoria) GetByClienteID(idCliente int) ([]Devolucion, error) {
+	return r.filtrar(false, func(d Devolucion) bool { return d.IDCliente == idCliente }), nil
+}
+
+// filtrar devuelve las devoluciones que cumplen `incluir`, de la más reciente
+// a la más antigua, como consultarDevoluciones.
+func (r devolucionMemoria) filtrar(lineas bool, incluir func(Devolucion) bool) []Devolucion {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var devoluciones []Devolucion
+	ids := sortedKeys(r.m.devoluciones)
+	for i := len(ids) - 1; i >= 0; i-- {
+		if d := r.m.devoluciones[ids[i]]; incluir(d) {
+			devoluciones = append(devoluciones, r.m.copiarDevolucion(d, lineas))
+		}
+	}
+	return devoluciones
+}
+
+// copiarDevolucion devuelve la devolución con el cliente actual del pedido
+// y, si se pide, una copia de sus líneas. Requiere m.mu tomado.
+func (m *memoria) copiarDevolucion(d Devolucion, lineas bool) Devolucion {
+	d.IDCliente = m.pedidos[d.IDPedido].IDCliente
+	if lineas {
+		d.Lineas = append([]LineaDevolucion(nil), d.Lineas...)
+	} else {
+		d.Lineas = nil
+	}
+	return d
+}
+
+// devolucionesPedido devuelve las devoluciones del pedido con sus líneas.
+// Requiere m.mu tomado.
+func (m *memoria) devolucionesPedido(idPedido int) []Devolucion {
+	var devoluciones []Devolucion
+	for _, id := range sortedKeys(m.devoluciones) {
+		if d := m.devoluciones[id]; d.IDPedido == idPedido {
+			devoluciones = append(devoluciones, d)
+		}
+	}
+	return devoluciones
+}
+
+// detallesPedido devuelve las líneas del pedido. Requiere m.mu tomado.
+func (m *memoria) detallesPedido(idPedido int) []DetallePedido {
+	var detalles []DetallePedido
+	for _, id := range sortedKeys(m.detalles) {
+		if d := m.detalles[id]; d.IDPedido == idPedido {
+			detalles = append(detalles, d)
+		}
+	}
+	return detalles
+}
+
+func (r devolucionMemoria) Solicitar(s SolicitudDevolucion) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	pedido, ok := r.m.pedidos[s.IDPedido]
+	if !ok {
+		return 0, fmt.Errorf("%w: el pedido no existe", ErrDevolucionInvalida)
+	}
+	dev, err := armarDevolucion(s, pedido, r.m.detallesPedido(pedido.ID), r.m.devolucionesPedido(pedido.ID))
+	if err != nil {
+		return 0, err
+	}
+	dev.ID = r.m.nextID("devoluciones")
+	dev.FechaSolicitud = time.Now()
+	dev.FechaActualizacion = dev.FechaSolicitud
+	for i := range dev.Lineas {
+		dev.Lineas[i].ID = r.m.nextID("detalles_devolucion")
+		dev.Lineas[i].IDDevolucion = dev.ID
+	}
+	r.m.devoluciones[dev.ID] = dev
+	return dev.ID, nil
+}
+
+func (r devolucionMemoria) CambiarEstado(s SolicitudEstadoDevolucion) (Devolucion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	dev, ok := r.m.devoluciones[s.ID]
+	if !ok {
+		return Devolucion{}, fmt.Errorf("devolución no encontrada con ID: %d", s.ID)
+	}
+	pedido := r.m.pedidos[dev.IDPedido]
+	dev.IDCliente = pedido.IDCliente
+	if err := validarTransicionDevolucion(dev.Estado, s.Estado); err != nil {
+		return Devolucion{}, err
+	}
+	if err := validarResolucion(s, dev, pedido); err != nil {
+		return Devolucion{}, err
+	}
+
+	switch s.Estado {
+	case DevolucionRecibida:
+		for i, l := range dev.Lineas {
+			if contiene(s.Reponer, l.ID) {
+				r.m.reponerStockLinea(r.m.detalles[l.IDDetalle], l.Cantidad)
+				dev.Lineas[i].ReponerStock = true
+			}
+		}
+	case DevolucionAcreditada:
+		r.m.creditos[r.m.nextID("creditos_clientes")] = creditoCliente{IDCliente: dev.IDCliente, Monto: dev.Monto, IDDevolucion: dev.ID}
+	case DevolucionReembolsada:
+		r.m.insertarReembolso(reembolsoPorDevolucion(dev, pedido))
+		pedido.Reembolsado += dev.Monto
+		r.m.pedidos[pedido.ID] = pedido
+	}
+
+	dev.Estado = s.Estado
+	if s.Nota != "" {
+		dev.Nota = s.Nota
+	}
+	dev.FechaActualizacion = time.Now()
+	r.m.devoluciones[dev.ID] = dev
+	return r.m.copiarDevolucion(dev, true), nil
+}
+
+func (r devolucionMemoria) SaldoCredito(idCliente int) (dinero.Monto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.saldoCredito(idCliente), nil
+}
+
+// carritoMemoria implementa CarritoRepository en memoria.
+type carritoMemoria struct{ m *memoria }
+
+// carritoDeCliente busca el carrito de un cliente. Requiere m.mu tomado.
+func carritoDeCliente(m *memoria, idCliente int) (Carrito, bool) {
+	for _, c := range m.carritos {
+		if c.IDCliente == idCliente {
+			return c, true
+		}
+	}
+	return Carrito{}, false
+}
+
+func (r carritoMemoria) GetByClienteID(idCliente int) (Carrito, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c, ok := carritoDeCliente(r.m, idCliente)
+	if !ok {
+		return Carrito{}, fmt.Errorf("carrito no encontrado con ID: %d", idCliente)
+	}
+	return c, nil
+}
+
+func (r carritoMemoria) Create(idCliente int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := carritoDeCliente(r.m, idCliente); ok {
+		return nil
+	}
+	if _, ok := r.m.clientes[idCliente]; !ok {
+		return fmt.Errorf("cliente %d inexistente", idCliente)
+	}
+	c := Carrito{ID: r.m.nextID("carritos"), IDCliente: idCliente, FechaCreacion: time.Now()}
+	r.m.carritos[c.ID] = c
+	return nil
+}
+
+func (r carritoMemoria) GetByToken(token string) (Carrito, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for _, c := range r.m.carritos {
+		if c.Token != "" && c.Token == token {
+			return c, nil
+		}
+	}
+	return Carrito{}, fmt.Errorf("carrito de invitado no encontrado")
+}
+
+func (r carritoMemoria) CreateInvitado(token string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c := Carrito{ID: r.m.nextID("carritos"), Token: token, FechaCreacion: time.Now()}
+	r.m.carritos[c.ID] = c
+	return nil
+}
+
+func (r carritoMemoria) Fusionar(token string, idCliente int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var invitado Carrito
+	for _, c := range r.m.carritos {
+		if c.Token != "" && c.Token == token {
+			invitado = c
+		}
+	}
+	if invitado.ID == 0 {
+		return nil
+	}
+	carrito, ok := carritoDeCliente(r.m, idCliente)
+	if !ok {
+		if _, ok := r.m.clientes[idCliente]; !ok {
+			return fmt.Errorf("cliente %d inexistente", idCliente)
+		}
+		carrito = Carrito{ID: r.m.nextID("carritos"), IDCliente: idCliente, FechaCreacion: time.Now()}
+		r.m.carritos[carrito.ID] = carrito
+	}
+
+	for _, id := range sortedKeys(r.m.items) {
+		item := r.m.items[id]
+		if item.IDCarrito != invitado.ID {
+			continue
+		}
+		producto := r.m.productos[item.IDProducto]
+		activo, stock := producto.Activo, producto.Stock
+		if item.IDVariante != 0 {
+			v := r.m.variantes[item.IDVariante]
+			activo, stock = activo && v.Activo, v.Stock
+		}
+		var existente ItemCarrito
+		for _, c := range r.m.items {
+			if c.IDCarrito == carrito.ID && c.IDProducto == item.IDProducto && c.IDVariante == item.IDVariante {
+				existente = c
+			}
+		}
+		cantidad := cantidadFusionada(existente.Cantidad, item.Cantidad, stock)
+		if !activo || cantidad == existente.Cantidad {
+			continue
+		}
+		if existente.ID == 0 {
+			existente = ItemCarrito{ID: r.m.nextID("items_carrito"), IDCarrito: carrito.ID, IDProducto: item.IDProducto, IDVariante: item.IDVariante}
+		}
+		existente.Cantidad = cantidad
+		r.m.items[existente.ID] = existente
+	}
+
+	for id, item := range r.m.items {
+		if item.IDCarrito == invitado.ID {
+			delete(r.m.items, id)
+		}
+	}
+	delete(r.m.carritos, invitado.ID)
+	return nil
+}
+
+func (r carritoMemoria) DeleteInvitadosAntiguos(antiguedad time.Duration) (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var n int64
+	limite := time.Now().Add(-antiguedad)
+	for id, c := range r.m.carritos {
+		if c.IDCliente == 0 && c.FechaCreacion.Before(limite) {
+			for idItem, item := range r.m.items {
+				if item.IDCarrito == id {
+					delete(r.m.items, idItem)
+				}
+			}
+			delete(r.m.carritos, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (r carritoMemoria) GetItems(idCarrito int) ([]ItemCarrito, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var items []ItemCarrito
+	for _, id := range sortedKeys(r.m.items) {
+		if item := r.m.items[id]; item.IDCarrito == idCarrito {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func (r carritoMemoria) AddItem(idCarrito, idProducto, idVariante, cantidad int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.carritos[idCarrito]; !ok {
+		return fmt.Errorf("carrito %d inexistente", idCarrito)
+	}
+	if _, ok := r.m.productos[idProducto]; !ok {
+		return fmt.Errorf("producto %d inexistente", idProducto)
+	}
+	if _, ok := r.m.variantes[idVariante]; idVariante != 0 && !ok {
+		return fmt.Errorf("variante %d inexistente", idVariante)
+	}
+	r.m.agregarItem(idCarrito, idProducto, idVariante, cantidad)
+	return nil
+}
+
+// agregarItem suma la cantidad a la línea del producto y la variante, o la
+// crea. Requiere m.mu tomado.
+func (m *memoria) agregarItem(idCarrito, idProducto, idVariante, cantidad int) {
+	// Igual que la clave única `carrito_producto_variante`: una sola línea
+	// por producto y variante.
+	for id, item := range m.items {
+		if item.IDCarrito == idCarrito && item.IDProducto == idProducto && item.IDVariante == idVariante {
+			item.Cantidad += cantidad
+			m.items[id] = item
+			return
+		}
+	}
+	item := ItemCarrito{ID: m.nextID("items_carrito"), IDCarrito: idCarrito, IDProducto: idProducto, IDVariante: idVariante, Cantidad: cantidad}
+	m.items[item.ID] = item
+}
+
+// esDe indica si el carrito pertenece al propietario.
+func (p PropietarioCarrito) esDe(c Carrito) bool {
+	if p.IDCliente != 0 {
+		return c.IDCliente == p.IDCliente
+	}
+	return p.Token != "" && c.Token == p.Token
+}
+
+// itemDe devuelve el item si pertenece a un carrito del propietario.
+// Requiere m.mu tomado.
+func (m *memoria) itemDe(propietario PropietarioCarrito, idItem int) (ItemCarrito, bool) {
+	item, ok := m.items[idItem]
+	if !ok || !propietario.esDe(m.carritos[item.IDCarrito]) {
+		return ItemCarrito{}, false
+	}
+	return item, true
+}
+
+func (r carritoMemoria) UpdateItem(propietario PropietarioCarrito, idItem, cantidad int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	item, ok := r.m.itemDe(propietario, idItem)
+	if !ok {
+		return ErrItemCarritoNoEncontrado
+	}
+	item.Cantidad = cantidad
+	r.m.items[idItem] = item
+	return nil
+}
+
+func (r carritoMemoria) RemoveItem(propietario PropietarioCarrito, idItem int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.itemDe(propietario, idItem); !ok {
+		return ErrItemCarritoNoEncontrado
+	}
+	delete(r.m.items, idItem)
+	return nil
+}
+
+func (r carritoMemoria) Empty(propietario PropietarioCarrito) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	for id, item := range r.m.items {
+		if propietario.esDe(r.m.carritos[item.IDCarrito]) {
+			delete(r.m.items, id)
+		}
+	}
+	return nil
+}
+
+// sesionMemoria implementa SesionRepository en memoria.
+type sesionMemoria struct{ m *memoria }
+
+func (r sesionMemoria) GetByID(id string) (Sesion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	s, ok := r.m.sesiones[id]
+	if !ok || !s.FechaExpiracion.After(time.Now()) {
+		return Sesion{}, fmt.Errorf("sesión no encontrada o expirada")
+	}
+	return s, nil
+}
+
+func (r sesionMemoria) Save(s Sesion, duracion time.Duration) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	ahora := time.Now()
+	if existente, ok := r.m.sesiones[s.ID]; ok {
+		s.FechaCreacion = existente.FechaCreacion
+	} else {
+		s.FechaCreacion = ahora
+	}
+	s.FechaExpiracion = ahora.Add(duracion)
+	r.m.sesiones[s.ID] = s
+	return nil
+}
+
+func (r sesionMemoria) Delete(id string) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.sesiones, id)
+	return nil
+}
+
+func (r sesionMemoria) DeleteExpired() (int64, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var n int64
+	ahora := time.Now()
+	for id, s := range r.m.sesiones {
+		if !s.FechaExpiracion.After(ahora) {
+			delete(r.m.sesiones, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// promocionMemoria implementa PromocionRepository en memoria.
+type promocionMemoria struct{ m *memoria }
+
+func (r promocionMemoria) GetAll() ([]Promocion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var promociones []Promocion
+	ids := sortedKeys(r.m.promociones)
+	// Igual que en MySQL: las más nuevas primero.
+	for i := len(ids) - 1; i >= 0; i-- {
+		promociones = append(promociones, copiaPromocion(r.m.promociones[ids[i]]))
+	}
+	return promociones, nil
+}
+
+func (r promocionMemoria) GetActivas() ([]Promocion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var promociones []Promocion
+	for _, id := range sortedKeys(r.m.promociones) {
+		if p := r.m.promociones[id]; p.Activo {
+			promociones = append(promociones, copiaPromocion(p))
+		}
+	}
+	return promociones, nil
+}
+
+func (r promocionMemoria) GetByID(id int) (Promocion, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	p, ok := r.m.promociones[id]
+	if !ok {
+		return Promocion{}, fmt.Errorf("promoción no encontrada con ID: %d", id)
+	}
+	return copiaPromocion(p), nil
+}
+
+func (r promocionMemoria) Create(p Promocion) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.validar(p); err != nil {
+		return err
+	}
+	p.ID = r.m.nextID("promociones")
+	r.m.promociones[p.ID] = normalizarPromocion(p)
+	return nil
+}
+
+func (r promocionMemoria) Update(p Promocion) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.promociones[p.ID]; !ok {
+		return nil
+	}
+	if err := r.validar(p); err != nil {
+		return err
+	}
+	r.m.promociones[p.ID] = normalizarPromocion(p)
+	return nil
+}
+
+func (r promocionMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	r.m.eliminarPromocion(id)
+	return nil
+}
+
+// validar replica las restricciones de la tabla: datos válidos y categoría y
+// productos existentes. Requiere m.mu tomado.
+func (r promocionMemoria) validar(p Promocion) error {
+	if err := ValidarPromocion(p); err != nil {
+		return err
+	}
+	if _, ok := r.m.categorias[p.IDCategoria]; p.Tipo == PromocionLlevaPaga && !ok {
+		return fmt.Errorf("categoría %d no encontrada", p.IDCategoria)
+	}
+	for _, id := range p.Productos {
+		if _, ok := r.m.productos[id]; !ok {
+			return fmt.Errorf("producto %d no encontrado", id)
+		}
+	}
+	return nil
+}
+
+// eliminarPromocion borra la promoción; los pedidos conservan nombre y
+// ahorro, como el ON DELETE SET NULL de `pedido_promociones`. Requiere m.mu
+// tomado.
+func (m *memoria) eliminarPromocion(id int) {
+	delete(m.promociones, id)
+	for idPedido, aplicadas := range m.pedidoPromociones {
+		for i := range aplicadas {
+			if aplicadas[i].IDPromocion == id {
+				aplicadas[i].IDPromocion = 0
+			}
+		}
+		m.pedidoPromociones[idPedido] = aplicadas
+	}
+}
+
+// normalizarPromocion deja solo los campos que el tipo usa, como hacen
+// argsPromocion y guardarDetallePromocion al guardar en MySQL.
+func normalizarPromocion(p Promocion) Promocion {
+	p = copiaPromocion(p)
+	if p.Tipo != PromocionLlevaPaga {
+		p.IDCategoria, p.Lleva, p.Paga = 0, 0, 0
+	}
+	if p.Tipo != PromocionPaquete {
+		p.PrecioPaquete = 0
+	}
+	if p.Tipo != PromocionTotal {
+		p.Porcentaje = 0
+	}
+	if p.Tipo != PromocionPaquete && p.Tipo != PromocionVolumen {
+		p.Productos = nil
+	}
+	if p.Tipo != PromocionVolumen {
+		p.Tramos = nil
+	}
+	sort.Ints(p.Productos)
+	sort.Slice(p.Tramos, func(i, j int) bool { return p.Tramos[i].CantidadMinima < p.Tramos[j].CantidadMinima })
+	return p
+}
+
+// copiaPromocion evita que quien recibe una promoción modifique las listas
+// guardadas.
+func copiaPromocion(p Promocion) Promocion {
+	p.Productos = append([]int(nil), p.Productos...)
+	p.Tramos = append([]TramoVolumen(nil), p.Tramos...)
+	return p
+}
+
+// envioMemoria implementa EnvioRepository en memoria.
+type envioMemoria struct{ m *memoria }
+
+func (r envioMemoria) GetMetodos() ([]MetodoEnvio, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.metodosEnvioFiltrados(false), nil
+}
+
+func (r envioMemoria) GetMetodosActivos() ([]MetodoEnvio, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.metodosEnvioFiltrados(true), nil
+}
+
+// metodosEnvioFiltrados devuelve copias de los métodos por ID, solo los
+// activos si `activos`. Requiere m.mu tomado.
+func (m *memoria) metodosEnvioFiltrados(activos bool) []MetodoEnvio {
+	var metodos []MetodoEnvio
+	for _, id := range sortedKeys(m.metodosEnvio) {
+		if me := m.metodosEnvio[id]; me.Activo || !activos {
+			metodos = append(metodos, copiaMetodoEnvio(me))
+		}
+	}
+	return metodos
+}
+
+func (r envioMemoria) GetMetodoByID(id int) (MetodoEnvio, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	me, ok := r.m.metodosEnvio[id]
+	if !ok {
+		return MetodoEnvio{}, fmt.Errorf("método de envío no encontrado con ID: %d", id)
+	}
+	return copiaMetodoEnvio(me), nil
+}
+
+func (r envioMemoria) CreateMetodo(me MetodoEnvio) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.validarMetodo(me); err != nil {
+		return err
+	}
+	me.ID = r.m.nextID("metodos_envio")
+	r.m.metodosEnvio[me.ID] = copiaMetodoEnvio(me)
+	return nil
+}
+
+func (r envioMemoria) UpdateMetodo(me MetodoEnvio) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.metodosEnvio[me.ID]; !ok {
+		return nil
+	}
+	if err := r.validarMetodo(me); err != nil {
+		return err
+	}
+	r.m.metodosEnvio[me.ID] = copiaMetodoEnvio(me)
+	return nil
+}
+
+// validarMetodo replica las restricciones de las tablas: datos válidos y
+// zonas existentes. Requiere m.mu tomado.
+func (r envioMemoria) validarMetodo(me MetodoEnvio) error {
+	if err := ValidarMetodoEnvio(me); err != nil {
+		return err
+	}
+	for _, t := range me.Tarifas {
+		if _, ok := r.m.zonasEnvio[t.IDZona]; t.IDZona != 0 && !ok {
+			return fmt.Errorf("zona %d no encontrada", t.IDZona)
+		}
+	}
+	return nil
+}
+
+func (r envioMemoria) DeleteMetodo(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.metodosEnvio, id)
+	// Como el ON DELETE SET NULL de `pedidos`: el pedido conserva el nombre.
+	for idPedido, p := range r.m.pedidos {
+		if p.IDMetodoEnvio == id {
+			p.IDMetodoEnvio = 0
+			r.m.pedidos[idPedido] = p
+		}
+	}
+	return nil
+}
+
+func (r envioMemoria) GetZonas() ([]ZonaEnvio, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var zonas []ZonaEnvio
+	for _, id := range sortedKeys(r.m.zonasEnvio) {
+		zonas = append(zonas, copiaZonaEnvio(r.m.zonasEnvio[id]))
+	}
+	// Igual que en MySQL: por nombre.
+	sort.SliceStable(zonas, func(i, j int) bool { return zonas[i].Nombre < zonas[j].Nombre })
+	return zonas, nil
+}
+
+func (r envioMemoria) GetZonaByID(id int) (ZonaEnvio, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	z, ok := r.m.zonasEnvio[id]
+	if !ok {
+		return ZonaEnvio{}, fmt.Errorf("zona de envío no encontrada con ID: %d", id)
+	}
+	return copiaZonaEnvio(z), nil
+}
+
+func (r envioMemoria) CreateZona(z ZonaEnvio) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.validarZona(z); err != nil {
+		return err
+	}
+	z.ID = r.m.nextID("zonas_envio")
+	r.m.zonasEnvio[z.ID] = copiaZonaEnvio(z)
+	return nil
+}
+
+func (r envioMemoria) UpdateZona(z ZonaEnvio) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.zonasEnvio[z.ID]; !ok {
+		return nil
+	}
+	if err := r.validarZona(z); err != nil {
+		return err
+	}
+	r.m.zonasEnvio[z.ID] = copiaZonaEnvio(z)
+	return nil
+}
+
+// validarZona replica las restricciones de las tablas: datos válidos, nombre
+// único y cada provincia en una sola zona. Requiere m.mu tomado.
+func (r envioMemoria) validarZona(z ZonaEnvio) error {
+	if err := ValidarZonaEnvio(z); err != nil {
+		return err
+	}
+	for _, id := range sortedKeys(r.m.zonasEnvio) {
+		otra := r.m.zonasEnvio[id]
+		if otra.ID == z.ID {
+			continue
+		}
+		if strings.EqualFold(otra.Nombre, z.Nombre) {
+			return fmt.Errorf("ya existe una zona llamada %s", z.Nombre)
+		}
+		for _, p := range z.Provincias {
+			if ZonaDeProvincia([]ZonaEnvio{otra}, p) != 0 {
+				return fmt.Errorf("la provincia %s ya está en la zona %s", p, otra.Nombre)
+			}
+		}
+	}
+	return nil
+}
+
+func (r envioMemoria) DeleteZona(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.zonasEnvio, id)
+	// Como el ON DELETE CASCADE de `tarifas_envio`.
+	for idMetodo, me := range r.m.metodosEnvio {
+		var tarifas []TarifaEnvio
+		for _, t := range me.Tarifas {
+			if t.IDZona != id {
+				tarifas = append(tarifas, t)
+			}
+		}
+		me.Tarifas = tarifas
+		r.m.metodosEnvio[idMetodo] = me
+	}
+	return nil
+}
+
+func (r envioMemoria) GetEnviosPedido(idPedido int) ([]Envio, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.enviosPedido(idPedido), nil
+}
+
+// enviosPedido devuelve copias de los envíos del pedido, ordenados como en
+// consultarEnvios. Requiere m.mu tomado.
+func (m *memoria) enviosPedido(idPedido int) []Envio {
+	var envios []Envio
+	for _, id := range sortedKeys(m.envios) {
+		if e := m.envios[id]; e.IDPedido == idPedido {
+			e.Lineas = append([]LineaEnvio(nil), e.Lineas...)
+			envios = append(envios, e)
+		}
+	}
+	sort.SliceStable(envios, func(i, j int) bool { return envios[i].FechaEnvio.Before(envios[j].FechaEnvio) })
+	return envios
+}
+
+func (r envioMemoria) RegistrarEnvio(s SolicitudEnvio) (Envio, []CambioEstado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	pedido, ok := r.m.pedidos[s.IDPedido]
+	if !ok {
+		return Envio{}, nil, fmt.Errorf("pedido no encontrado con ID: %d", s.IDPedido)
+	}
+	anteriores := r.m.enviosPedido(pedido.ID)
+	envio, err := armarEnvio(s, pedido, r.m.detallesPedido(pedido.ID), anteriores)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	envio.ID = r.m.nextID("envios")
+	cambios, err := r.m.aplicarEstadoEnvios(s, pedido, append(anteriores, envio), envio)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	r.m.envios[envio.ID] = envio
+	return envio, cambios, nil
+}
+
+func (r envioMemoria) ActualizarEnvio(s SolicitudEnvio) (Envio, []CambioEstado, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	actual, ok := r.m.envios[s.ID]
+	if !ok || actual.IDPedido != s.IDPedido {
+		return Envio{}, nil, fmt.Errorf("envío no encontrado con ID: %d", s.ID)
+	}
+	envio, err := modificarEnvio(s, actual)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	envios := r.m.enviosPedido(envio.IDPedido)
+	envios[indiceEnvio(envios, envio.ID)] = envio
+	cambios, err := r.m.aplicarEstadoEnvios(s, r.m.pedidos[envio.IDPedido], envios, envio)
+	if err != nil {
+		return Envio{}, nil, err
+	}
+	r.m.envios[envio.ID] = envio
+	return envio, cambios, nil
+}
+
+// aplicarEstadoEnvios es aplicarEstadoEnvios en memoria. Los estados de
+// envío no tienen efectos que deshacer, así que si un paso falla los
+// anteriores quedan aplicados. Requiere m.mu tomado.
+func (m *memoria) aplicarEstadoEnvios(s SolicitudEnvio, pedido Pedido, envios []Envio, envio Envio) ([]CambioEstado, error) {
+	var cambios []CambioEstado
+	for _, estado := range caminoEstado(pedido.Estado, EstadoSegunEnvios(m.detallesPedido(pedido.ID), envios)) {
+		cambio, err := m.cambiarEstado(SolicitudCambioEstado{
+			IDPedido:    pedido.ID,
+			Estado:      estado,
+			IDCliente:   s.IDCliente,
+			Responsable: s.Responsable,
+			Motivo:      motivoEnvio(envio),
+		})
+		if err != nil {
+			return nil, err
+		}
+		cambios = append(cambios, cambio)
+	}
+	return cambios, nil
+}
+
+func copiaMetodoEnvio(me MetodoEnvio) MetodoEnvio {
+	me.Tarifas = append([]TarifaEnvio(nil), me.Tarifas...)
+	return me
+}
+
+// copiaZonaEnvio copia la zona con las provincias ordenadas, como las
+// devuelve MySQL.
+func copiaZonaEnvio(z ZonaEnvio) ZonaEnvio {
+	z.Provincias = append([]string(nil), z.Provincias...)
+	sort.Strings(z.Provincias)
+	return z
+}
+
+// impuestoMemoria implementa ImpuestoRepository en memoria.
+type impuestoMemoria struct{ m *memoria }
+
+func (r impuestoMemoria) GetAll() ([]ClaseImpuesto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.clasesImpuestoOrdenadas(), nil
+}
+
+// clasesImpuestoOrdenadas devuelve las clases por nombre, como MySQL.
+// Requiere m.mu tomado.
+func (m *memoria) clasesImpuestoOrdenadas() []ClaseImpuesto {
+	var clases []ClaseImpuesto
+	for _, id := range sortedKeys(m.clasesImpuesto) {
+		clases = append(clases, m.clasesImpuesto[id])
+	}
+	sort.SliceStable(clases, func(i, j int) bool { return clases[i].Nombre < clases[j].Nombre })
+	return clases
+}
+
+func (r impuestoMemoria) GetByID(id int) (ClaseImpuesto, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c, ok := r.m.clasesImpuesto[id]
+	if !ok {
+		return ClaseImpuesto{}, fmt.Errorf("clase de impuesto no encontrada con ID: %d", id)
+	}
+	return c, nil
+}
+
+func (r impuestoMemoria) Create(c ClaseImpuesto) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.validar(c); err != nil {
+		return err
+	}
+	c.ID = r.m.nextID("clases_impuesto")
+	r.guardar(c)
+	return nil
+}
+
+func (r impuestoMemoria) Update(c ClaseImpuesto) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if _, ok := r.m.clasesImpuesto[c.ID]; !ok {
+		return nil
+	}
+	if err := r.validar(c); err != nil {
+		return err
+	}
+	r.guardar(c)
+	return nil
+}
+
+// validar replica las restricciones de la tabla: datos válidos y nombre
+// único. Requiere m.mu tomado.
+func (r impuestoMemoria) validar(c ClaseImpuesto) error {
+	if err := ValidarClaseImpuesto(c); err != nil {
+		return err
+	}
+	for _, otra := range r.m.clasesImpuesto {
+		if otra.ID != c.ID && strings.EqualFold(otra.Nombre, c.Nombre) {
+			return fmt.Errorf("ya existe una clase llamada %s", c.Nombre)
+		}
+	}
+	return nil
+}
+
+// guardar guarda la clase y, si es la predeterminada, desmarca las demás.
+// Requiere m.mu tomado.
+func (r impuestoMemoria) guardar(c ClaseImpuesto) {
+	if c.Predeterminada {
+		for id, otra := range r.m.clasesImpuesto {
+			otra.Predeterminada = false
+			r.m.clasesImpuesto[id] = otra
+		}
+	}
+	r.m.clasesImpuesto[c.ID] = c
+}
+
+func (r impuestoMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.clasesImpuesto, id)
+	// Como el ON DELETE SET NULL de `productos`.
+	for idProducto, p := range r.m.productos {
+		if p.IDClaseImpuesto == id {
+			p.IDClaseImpuesto = 0
+			r.m.productos[idProducto] = p
+		}
+	}
+	return nil
+}
+
+// usoCupon es una fila de `cupon_usos`.
+type usoCupon struct {
+	IDCupon   int
+	IDCliente int
+	IDPedido  int
+}
+
+// cuponMemoria implementa CuponRepository en memoria.
+type cuponMemoria struct{ m *memoria }
+
+func (r cuponMemoria) GetAll() ([]Cupon, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	var cupones []Cupon
+	ids := sortedKeys(r.m.cupones)
+	// Igual que en MySQL: los más nuevos primero.
+	for i := len(ids) - 1; i >= 0; i-- {
+		cupones = append(cupones, copiaCupon(r.m.cupones[ids[i]]))
+	}
+	return cupones, nil
+}
+
+func (r cuponMemoria) GetByID(id int) (Cupon, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	c, ok := r.m.cupones[id]
+	if !ok {
+		return Cupon{}, fmt.Errorf("cupón no encontrado con ID: %d", id)
+	}
+	return copiaCupon(c), nil
+}
+
+func (r cuponMemoria) GetByCodigo(codigo string) (Cupon, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	codigo = NormalizarCodigo(codigo)
+	c, ok := r.m.cuponPorCodigo(codigo)
+	if !ok {
+		return Cupon{}, fmt.Errorf("%w: el cupón %s no existe", ErrCuponInvalido, codigo)
+	}
+	return copiaCupon(c), nil
+}
+
+func (r cuponMemoria) Create(c Cupon) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	if err := r.validar(c); err != nil {
+		return err
+	}
+	c.ID = r.m.nextID("cupones")
+	c.Usos = 0
+	r.m.cupones[c.ID] = copiaCupon(c)
+	return nil
+}
+
+func (r cuponMemoria) Update(c Cupon) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	existente, ok := r.m.cupones[c.ID]
+	if !ok {
+		return nil
+	}
+	if err := r.validar(c); err != nil {
+		return err
+	}
+	c.Usos = existente.Usos
+	r.m.cupones[c.ID] = copiaCupon(c)
+	return nil
+}
+
+func (r cuponMemoria) Delete(id int) error {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	delete(r.m.cupones, id)
+	for idUso, u := range r.m.cuponUsos {
+		if u.IDCupon == id {
+			delete(r.m.cuponUsos, idUso)
+		}
+	}
+	// Como el ON DELETE SET NULL de `pedidos`: el pedido conserva el código.
+	for idPedido, p := range r.m.pedidos {
+		if p.IDCupon == id {
+			p.IDCupon = 0
+			r.m.pedidos[idPedido] = p
+		}
+	}
+	return nil
+}
+
+func (r cuponMemoria) UsosCliente(idCupon, idCliente int) (int, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	return r.m.usosCupon(idCupon, idCliente), nil
+}
+
+// validar replica las restricciones de la tabla: datos válidos, código único
+// y productos y categorías existentes. Requiere m.mu tomado.
+func (r cuponMemoria) validar(c Cupon) error {
+	if err := ValidarCupon(c); err != nil {
+		return err
+	}
+	for _, existente := range r.m.cupones {
+		if existente.Codigo == c.Codigo && existente.ID != c.ID {
+			return fmt.Errorf("código de cupón duplicado: %s", c.Codigo)
+		}
+	}
+	for _, id := range c.Productos {
+		if _, ok := r.m.productos[id]; !ok {
+			return fmt.Errorf("producto %d no encontrado", id)
+		}
+	}
+	for _, id := range c.Categorias {
+		if _, ok := r.m.categorias[id]; !ok {
+			return fmt.Errorf("categoría %d no encontrada", id)
+		}
+	}
+	return nil
+}
+
+// cuponPorCodigo busca un cupón por su código normalizado. Requiere m.mu tomado.
+func (m *memoria) cuponPorCodigo(codigo string) (Cupon, bool) {
+	for _, c := range m.cupones {
+		if c.Codigo == codigo {
+			return copiaCupon(c), true
+		}
+	}
+	return Cupon{}, false
+}
+
+// usosCupon cuenta los pedidos del cliente con el cupón. Requiere m.mu tomado.
+func (m *memoria) usosCupon(idCupon, idCliente int) int {
+	var n int
+	for _, u := range m.cuponUsos {
+		if u.IDCupon == idCupon && u.IDCliente == idCliente {
+			n++
+		}
+	}
+	return n
+}
+
+// categoriasDe devuelve los IDs de las categorías del producto. Requiere m.mu tomado.
+func (m *memoria) categoriasDe(idProducto int) []int {
+	var ids []int
+	for _, id := range sortedKeys(m.categorias) {
+		if m.productoCategorias[ProductoCategoria{IDProducto: idProducto, IDCategoria: id}] {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// copiaCupon evita que quien recibe un cupón modifique las listas guardadas.
+func copiaCupon(c Cupon) Cupon {
+	c.Productos = append([]int(nil), c.Productos...)
+	c.Categorias = append([]int(nil), c.Categorias...)
+	return c
+}
+
+// sinID devuelve los IDs sin `id`, como el ON DELETE CASCADE de las tablas
+// de relación.
+func sinID(ids []int, id int) []int {
+	var resto []int
+	for _, x := range ids {
+		if x != id {
+			resto = append(resto, x)
+		}
+	}
+	return resto
+}
+
+// estadisticasMemoria implementa EstadisticasRepository en memoria.
+type estadisticasMemoria struct{ m *memoria }
+
+func (r estadisticasMemoria) Get() (Estadisticas, error) {
+	r.m.mu.Lock()
+	defer r.m.mu.Unlock()
+	stats := Estadisticas{
+		TotalClientes:  len(r.m.clientes),
+		TotalProductos: len(r.m.productos),
+		TotalPedidos:   len(r.m.pedidos),
+	}
+	for _, p := range r.m.pedidos {
+		stats.TotalVentas += p.Total
+	}
+	return stats, nil
+}
+
+// sortedKeys devuelve las claves de un mapa en orden ascendente, para que los
+// listados en memoria sean deterministas como los de MySQL.
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	return keys
+}
@@ -0,0 +1,300 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"time"
+)
+
+// NewRepositoriosMySQL devuelve los repositorios respaldados por MySQL. Usan el
+// pool inyectado con SetDB.
+func NewRepositoriosMySQL() Repositorios {
+	return Repositorios{
+		Clientes:     clienteMySQL{},
+		Productos:    productoMySQL{},
+		Categorias:   categoriaMySQL{},
+		Imagenes:     imagenMySQL{},
+		Variantes:    varianteMySQL{},
+		Pedidos:      pedidoMySQL{},
+		Devoluciones: devolucionMySQL{},
+		Carritos:     carritoMySQL{},
+		Cupones:      cuponMySQL{},
+		Promociones:  promocionMySQL{},
+		Envios:       envioMySQL{},
+		Impuestos:    impuestoMySQL{},
+		Sesiones:     sesionMySQL{},
+		Estadisticas: estadisticasMySQL{},
+	}
+}
+
+// clienteMySQL implementa ClienteRepository sobre la tabla `clientes`.
+type clienteMySQL struct{}
+
+func (clienteMySQL) GetByID(id int) (Cliente, error)          { return GetClienteByID(id) }
+func (clienteMySQL) GetByEmail(email string) (Cliente, error) { return GetClienteByEmail(email) }
+func (clienteMySQL) GetAll() ([]Cliente, error)               { return GetAllClientes() }
+func (clienteMySQL) Delete(id int) error                      { return DeleteCliente(id) }
+
+func (clienteMySQL) Create(c Cliente) error {
+	return CreateCliente(c.Nombre, c.Email, c.PasswordHash, c.Direccion, c.Telefono)
+}
+
+func (clienteMySQL) Update(c Cliente) error {
+	return UpdateCliente(c.ID, c.Nombre, c.Email, c.Direccion, c.Telefono)
+}
+
+func (clienteMySQL) UpdatePasswordHash(id int, passwordHash string) error {
+	return UpdatePasswordHash(id, passwordHash)
+}
+
+// productoMySQL implementa ProductoRepository sobre la tabla `productos`.
+type productoMySQL struct{}
+
+func (productoMySQL) GetByID(id int) (Producto, error) { return GetProductoByID(id) }
+func (productoMySQL) GetAll() ([]Producto, error)      { return GetAllProductos() }
+func (productoMySQL) Delete(id int) error              { return DeleteProducto(id) }
+
+func (productoMySQL) Buscar(b BusquedaProductos) (ResultadoBusqueda, error) {
+	return BuscarProductos(b)
+}
+
+func (productoMySQL) Create(p Producto) (int, error) {
+	return CreateProducto(p.Nombre, p.Descripcion, p.Precio, p.Stock, p.Peso, p.IDClaseImpuesto, p.SKU, p.Activo)
+}
+
+func (productoMySQL) Update(p Producto) error {
+	return UpdateProducto(p.ID, p.Nombre, p.Descripcion, p.Precio, p.Stock, p.Peso, p.IDClaseImpuesto, p.SKU, p.Activo)
+}
+
+// categoriaMySQL implementa CategoriaRepository sobre `categorias` y
+// `producto_categorias`.
+type categoriaMySQL struct{}
+
+func (categoriaMySQL) GetByID(id int) (Categoria, error) { return GetCategoriaByID(id) }
+func (categoriaMySQL) GetAll() ([]Categoria, error)      { return GetAllCategorias() }
+func (categoriaMySQL) Delete(id int) error               { return DeleteCategoria(id) }
+
+func (categoriaMySQL) Create(c Categoria) error {
+	return CreateCategoria(c.Nombre, c.Descripcion, c.IDPadre)
+}
+
+func (categoriaMySQL) Update(c Categoria) error {
+	return UpdateCategoria(c.ID, c.Nombre, c.Descripcion, c.IDPadre)
+}
+
+func (categoriaMySQL) GetByProductoID(idProducto int) ([]Categoria, error) {
+	return GetCategoriasByProductoID(idProducto)
+}
+
+func (categoriaMySQL) SetProducto(idProducto int, idsCategoria []int) error {
+	return SetCategoriasProducto(idProducto, idsCategoria)
+}
+
+// imagenMySQL implementa ImagenRepository sobre `imagenes_producto`.
+type imagenMySQL struct{}
+
+func (imagenMySQL) GetByID(id int) (ImagenProducto, error) { return GetImagenByID(id) }
+func (imagenMySQL) Delete(id int) error                    { return DeleteImagen(id) }
+
+func (imagenMySQL) GetByProductoID(idProducto int) ([]ImagenProducto, error) {
+	return GetImagenesByProductoID(idProducto)
+}
+
+func (imagenMySQL) GetPrincipales(idsProducto []int) (map[int]ImagenProducto, error) {
+	return GetImagenesPrincipales(idsProducto)
+}
+
+func (imagenMySQL) Create(idProducto int, clave, extension string) (int, error) {
+	return CreateImagen(idProducto, clave, extension)
+}
+
+func (imagenMySQL) SetPrincipal(idProducto, idImagen int) error {
+	return SetImagenPrincipal(idProducto, idImagen)
+}
+
+func (imagenMySQL) Reordenar(idProducto int, ids []int) error {
+	return ReordenarImagenes(idProducto, ids)
+}
+
+// varianteMySQL implementa VarianteRepository sobre `opciones_producto`,
+// `valores_opcion`, `variantes_producto` y `variante_valores`.
+type varianteMySQL struct{}
+
+func (varianteMySQL) GetByID(id int) (VarianteProducto, error) { return GetVarianteByID(id) }
+func (varianteMySQL) Generar(idProducto int) (int, error)      { return GenerarVariantes(idProducto) }
+func (varianteMySQL) Update(v VarianteProducto) error          { return UpdateVariante(v) }
+func (varianteMySQL) Delete(id int) error                      { return DeleteVariante(id) }
+
+func (varianteMySQL) GetOpciones(idProducto int) ([]OpcionProducto, error) {
+	return GetOpcionesByProductoID(idProducto)
+}
+
+func (varianteMySQL) SetOpciones(idProducto int, opciones []OpcionProducto) error {
+	return SetOpcionesProducto(idProducto, opciones)
+}
+
+func (varianteMySQL) GetByProductoID(idProducto int) ([]VarianteProducto, error) {
+	return GetVariantesByProductoID(idProducto)
+}
+
+func (varianteMySQL) ConVariantes(idsProducto []int) (map[int]bool, error) {
+	return GetProductosConVariantes(idsProducto)
+}
+
+// pedidoMySQL implementa PedidoRepository sobre `pedidos` y `detalles_pedido`.
+type pedidoMySQL struct{}
+
+func (pedidoMySQL) GetByID(id int) (Pedido, error)              { return GetPedidoByID(id) }
+func (pedidoMySQL) GetAll() ([]Pedido, error)                   { return GetAllPedidos() }
+func (pedidoMySQL) GetByClienteID(id int) ([]Pedido, error)     { return GetPedidosByClienteID(id) }
+func (pedidoMySQL) GetDetalles(id int) ([]DetallePedido, error) { return GetDetallesByPedidoID(id) }
+func (pedidoMySQL) GetPromociones(id int) ([]PromocionAplicada, error) {
+	return GetPromocionesByPedidoID(id)
+}
+func (pedidoMySQL) CambiarEstado(s SolicitudCambioEstado) (CambioEstado, error) {
+	return CambiarEstadoPedido(s)
+}
+func (pedidoMySQL) GetHistorial(id int) ([]CambioEstado, error) { return GetHistorialPedido(id) }
+
+func (pedidoMySQL) Checkout(s SolicitudCheckout) (int, error) { return ProcesarCheckout(s) }
+func (pedidoMySQL) RegistrarCobro(id int, c Cobro) (*CambioEstado, error) {
+	return RegistrarCobro(id, c)
+}
+func (pedidoMySQL) AnularCheckout(id int, responsable, motivo string) (CambioEstado, error) {
+	return AnularCheckout(id, responsable, motivo)
+}
+func (pedidoMySQL) RegistrarEventoPago(e EventoPago) (bool, *CambioEstado, error) {
+	return RegistrarEventoPago(e)
+}
+func (pedidoMySQL) GetReembolsos(id int) ([]Reembolso, error) { return GetReembolsosByPedidoID(id) }
+func (pedidoMySQL) GetReembolsosPendientes() ([]Reembolso, error) {
+	return GetReembolsosPendientes()
+}
+func (pedidoMySQL) RegistrarResultadoReembolso(id int, resultado error) error {
+	return RegistrarResultadoReembolso(id, resultado)
+}
+
+// promocionMySQL implementa PromocionRepository sobre `promociones`.
+type promocionMySQL struct{}
+
+func (promocionMySQL) GetAll() ([]Promocion, error)      { return GetAllPromociones() }
+func (promocionMySQL) GetActivas() ([]Promocion, error)  { return GetPromocionesActivas() }
+func (promocionMySQL) GetByID(id int) (Promocion, error) { return GetPromocionByID(id) }
+func (promocionMySQL) Create(p Promocion) error          { return CreatePromocion(p) }
+func (promocionMySQL) Update(p Promocion) error          { return UpdatePromocion(p) }
+func (promocionMySQL) Delete(id int) error               { return DeletePromocion(id) }
+
+// envioMySQL implementa EnvioRepository sobre `metodos_envio`,
+// `tarifas_envio`, `zonas_envio` y `envios`.
+type envioMySQL struct{}
+
+func (envioMySQL) GetMetodos() ([]MetodoEnvio, error)        { return GetAllMetodosEnvio() }
+func (envioMySQL) GetMetodosActivos() ([]MetodoEnvio, error) { return GetMetodosEnvioActivos() }
+func (envioMySQL) GetMetodoByID(id int) (MetodoEnvio, error) { return GetMetodoEnvioByID(id) }
+func (envioMySQL) CreateMetodo(m MetodoEnvio) error          { return CreateMetodoEnvio(m) }
+func (envioMySQL) UpdateMetodo(m MetodoEnvio) error          { return UpdateMetodoEnvio(m) }
+func (envioMySQL) DeleteMetodo(id int) error                 { return DeleteMetodoEnvio(id) }
+func (envioMySQL) GetZonas() ([]ZonaEnvio, error)            { return GetAllZonasEnvio() }
+func (envioMySQL) GetZonaByID(id int) (ZonaEnvio, error)     { return GetZonaEnvioByID(id) }
+func (envioMySQL) CreateZona(z ZonaEnvio) error              { return CreateZonaEnvio(z) }
+func (envioMySQL) UpdateZona(z ZonaEnvio) error              { return UpdateZonaEnvio(z) }
+func (envioMySQL) DeleteZona(id int) error                   { return DeleteZonaEnvio(id) }
+func (envioMySQL) GetEnviosPedido(idPedido int) ([]Envio, error) {
+	return GetEnviosByPedidoID(idPedido)
+}
+func (envioMySQL) RegistrarEnvio(s SolicitudEnvio) (Envio, []CambioEstado, error) {
+	return RegistrarEnvio(s)
+}
+func (envioMySQL) ActualizarEnvio(s SolicitudEnvio) (Envio, []CambioEstado, error) {
+	return ActualizarEnvio(s)
+}
+
+// impuestoMySQL implementa ImpuestoRepository sobre `clases_impuesto`.
+type impuestoMySQL struct{}
+
+func (impuestoMySQL) GetAll() ([]ClaseImpuesto, error)      { return GetAllClasesImpuesto() }
+func (impuestoMySQL) GetByID(id int) (ClaseImpuesto, error) { return GetClaseImpuestoByID(id) }
+func (impuestoMySQL) Create(c ClaseImpuesto) error          { return CreateClaseImpuesto(c) }
+func (impuestoMySQL) Update(c ClaseImpuesto) error          { return UpdateClaseImpuesto(c) }
+func (impuestoMySQL) Delete(id int) error                   { return DeleteClaseImpuesto(id) }
+
+// devolucionMySQL implementa DevolucionRepository sobre `devoluciones`, sus
+// líneas y `creditos_clientes`.
+type devolucionMySQL struct{}
+
+func (devolucionMySQL) GetByID(id int) (Devolucion, error) { return GetDevolucionByID(id) }
+func (devolucionMySQL) GetAll() ([]Devolucion, error)      { return GetAllDevoluciones() }
+func (devolucionMySQL) GetByPedidoID(idPedido int) ([]Devolucion, error) {
+	return GetDevolucionesByPedidoID(idPedido)
+}
+func (devolucionMySQL) GetByClienteID(idCliente int) ([]Devolucion, error) {
+	return GetDevolucionesByClienteID(idCliente)
+}
+func (devolucionMySQL) Solicitar(s SolicitudDevolucion) (int, error) {
+	return SolicitarDevolucion(s)
+}
+func (devolucionMySQL) CambiarEstado(s SolicitudEstadoDevolucion) (Devolucion, error) {
+	return CambiarEstadoDevolucion(s)
+}
+func (devolucionMySQL) SaldoCredito(idCliente int) (dinero.Monto, error) {
+	return GetSaldoCredito(idCliente)
+}
+
+// cuponMySQL implementa CuponRepository sobre `cupones` y sus restricciones.
+type cuponMySQL struct{}
+
+func (cuponMySQL) GetAll() ([]Cupon, error)                 { return GetAllCupones() }
+func (cuponMySQL) GetByID(id int) (Cupon, error)            { return GetCuponByID(id) }
+func (cuponMySQL) GetByCodigo(codigo string) (Cupon, error) { return GetCuponByCodigo(codigo) }
+func (cuponMySQL) Create(c Cupon) error                     { return CreateCupon(c) }
+func (cuponMySQL) Update(c Cupon) error                     { return UpdateCupon(c) }
+func (cuponMySQL) Delete(id int) error                      { return DeleteCupon(id) }
+func (cuponMySQL) UsosCliente(idCupon, idCliente int) (int, error) {
+	return GetUsosCuponCliente(idCupon, idCliente)
+}
+
+// carritoMySQL implementa CarritoRepository sobre `carritos` e `items_carrito`.
+type carritoMySQL struct{}
+
+func (carritoMySQL) GetByClienteID(id int) (Carrito, error)   { return GetCarritoByClienteID(id) }
+func (carritoMySQL) Create(idCliente int) error               { return CreateCarrito(idCliente) }
+func (carritoMySQL) Empty(p PropietarioCarrito) error         { return EmptyCarrito(p) }
+func (carritoMySQL) GetByToken(token string) (Carrito, error) { return GetCarritoByToken(token) }
+func (carritoMySQL) CreateInvitado(token string) error        { return CreateCarritoInvitado(token) }
+
+func (carritoMySQL) Fusionar(token string, idCliente int) error {
+	return FusionarCarritoInvitado(token, idCliente)
+}
+
+func (carritoMySQL) DeleteInvitadosAntiguos(antiguedad time.Duration) (int64, error) {
+	return DeleteCarritosInvitadosAntiguos(antiguedad)
+}
+
+func (carritoMySQL) GetItems(idCarrito int) ([]ItemCarrito, error) {
+	return GetItemsByCarritoID(idCarrito)
+}
+
+func (carritoMySQL) AddItem(idCarrito, idProducto, idVariante, cantidad int) error {
+	return AgregarItemCarrito(idCarrito, idProducto, idVariante, cantidad)
+}
+
+func (carritoMySQL) UpdateItem(p PropietarioCarrito, idItem, cantidad int) error {
+	return UpdateItemCarrito(p, idItem, cantidad)
+}
+
+func (carritoMySQL) RemoveItem(p PropietarioCarrito, idItem int) error {
+	return RemoveItemFromCarrito(p, idItem)
+}
+
+// sesionMySQL implementa SesionRepository sobre la tabla `sesiones`.
+type sesionMySQL struct{}
+
+func (sesionMySQL) GetByID(id string) (Sesion, error) { return GetSesionByID(id) }
+func (sesionMySQL) Delete(id string) error            { return DeleteSesion(id) }
+func (sesionMySQL) DeleteExpired() (int64, error)     { return DeleteExpiredSesiones() }
+
+func (sesionMySQL) Save(s Sesion, duracion time.Duration) error { return SaveSesion(s, duracion) }
+
+// estadisticasMySQL implementa EstadisticasRepository con consultas agregadas.
+type estadisticasMySQL struct{}
+
+func (estadisticasMySQL) Get() (Estadisticas, error) { return GetEstadisticas() }
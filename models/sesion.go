@@ -0,0 +1,105 @@
+package models
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Sesion representa una sesión de usuario guardada en el servidor.
+// El navegador solo conoce el ID (firmado); los datos viven en la tabla `sesiones`.
+type Sesion struct {
+	ID              string
+	IDCliente       int // 0 si la sesión es anónima
+	Datos           []byte
+	FechaCreacion   time.Time
+	FechaExpiracion time.Time
+}
+
+// NewSesionID genera un identificador de sesión aleatorio de 256 bits en hexadecimal.
+func NewSesionID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("error generando ID de sesión: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetSesionByID obtiene una sesión vigente por su ID. Las sesiones expiradas
+// se tratan como inexistentes.
+func GetSesionByID(id string) (Sesion, error) {
+	var sesion Sesion
+	stmt, err := pool.Prepare("SELECT id_sesion, id_cliente, datos, fecha_creacion, fecha_expiracion FROM sesiones WHERE id_sesion = ? AND fecha_expiracion > NOW()")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return sesion, err
+	}
+	defer stmt.Close()
+
+	var idCliente sql.NullInt64
+	err = stmt.QueryRow(id).Scan(&sesion.ID, &idCliente, &sesion.Datos, &sesion.FechaCreacion, &sesion.FechaExpiracion)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return sesion, fmt.Errorf("sesión no encontrada o expirada")
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return sesion, err
+	}
+	sesion.IDCliente = int(idCliente.Int64)
+	return sesion, nil
+}
+
+// SaveSesion crea la sesión o actualiza sus datos, y fija su expiración a
+// `duracion` desde ahora. La fecha se calcula en MySQL para no depender del
+// reloj ni de la zona horaria del servidor de aplicaciones.
+func SaveSesion(sesion Sesion, duracion time.Duration) error {
+	stmt, err := pool.Prepare("INSERT INTO sesiones (id_sesion, id_cliente, datos, fecha_expiracion) VALUES (?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND)) ON DUPLICATE KEY UPDATE id_cliente = VALUES(id_cliente), datos = VALUES(datos), fecha_expiracion = VALUES(fecha_expiracion)")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return err
+	}
+	defer stmt.Close()
+
+	var idCliente sql.NullInt64
+	if sesion.IDCliente != 0 {
+		idCliente = sql.NullInt64{Int64: int64(sesion.IDCliente), Valid: true}
+	}
+
+	_, err = stmt.Exec(sesion.ID, idCliente, sesion.Datos, int64(duracion/time.Second))
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteSesion invalida una sesión eliminándola del almacén.
+func DeleteSesion(id string) error {
+	stmt, err := pool.Prepare("DELETE FROM sesiones WHERE id_sesion = ?")
+	if err != nil {
+		log.Println("Error al preparar la consulta sql", err)
+		return err
+	}
+	defer stmt.Close()
+
+	_, err = stmt.Exec(id)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredSesiones elimina las sesiones vencidas y devuelve cuántas se borraron.
+func DeleteExpiredSesiones() (int64, error) {
+	result, err := pool.Exec("DELETE FROM sesiones WHERE fecha_expiracion <= NOW()")
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return 0, err
+	}
+	n, _ := result.RowsAffected()
+	return n, nil
+}
@@ -0,0 +1,577 @@
+package models
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxVariantes limita las combinaciones que pueden generar los ejes de un producto.
+const MaxVariantes = 100
+
+var (
+	// ErrVarianteRequerida se devuelve al agregar al carrito un producto con
+	// variantes sin indicar cuál.
+	ErrVarianteRequerida = errors.New("elige una variante del producto")
+	// ErrVarianteInvalida se devuelve si la variante no existe o es de otro producto.
+	ErrVarianteInvalida = errors.New("la variante no corresponde al producto")
+)
+
+// ValorOpcion es uno de los valores de un eje, p. ej. "M" del eje "Talle".
+// `Opcion` lleva el nombre del eje para poder describir una variante.
+type ValorOpcion struct {
+	ID       int
+	IDOpcion int
+	Opcion   string
+	Valor    string
+	Orden    int
+}
+
+// OpcionProducto es un eje de variantes de un producto con sus valores.
+type OpcionProducto struct {
+	ID         int
+	IDProducto int
+	Nombre     string
+	Orden      int
+	Valores    []ValorOpcion
+}
+
+// VarianteProducto es una combinación de valores (un valor por eje) con SKU,
+// precio y stock propios. Sin PrecioPropio se vende al precio del producto.
+type VarianteProducto struct {
+	ID           int
+	IDProducto   int
+	SKU          string
+	Precio       dinero.Monto
+	PrecioPropio bool
+	Stock        int
+	Activo       bool
+	Valores      []ValorOpcion
+}
+
+// Descripcion devuelve la combinación legible, p. ej. "Talle: M / Color: Rojo".
+func (v VarianteProducto) Descripcion() string {
+	partes := make([]string, len(v.Valores))
+	for i, valor := range v.Valores {
+		partes[i] = valor.Opcion + ": " + valor.Valor
+	}
+	return strings.Join(partes, " / ")
+}
+
+// PrecioPara devuelve el precio de venta de la variante dentro del producto.
+func (v VarianteProducto) PrecioPara(p Producto) dinero.Monto {
+	if v.PrecioPropio {
+		return v.Precio
+	}
+	return p.Precio
+}
+
+// ValidarOpciones comprueba nombres y valores de los ejes y que no generen
+// más de MaxVariantes combinaciones.
+func ValidarOpciones(opciones []OpcionProducto) error {
+	nombres := map[string]bool{}
+	combinaciones := 1
+	for _, o := range opciones {
+		clave := strings.ToLower(o.Nombre)
+		if o.Nombre == "" || utf8.RuneCountInString(o.Nombre) > 50 {
+			return fmt.Errorf("cada opción necesita un nombre de hasta 50 caracteres")
+		}
+		if nombres[clave] {
+			return fmt.Errorf("la opción %q está repetida", o.Nombre)
+		}
+		nombres[clave] = true
+		if len(o.Valores) == 0 {
+			return fmt.Errorf("la opción %q no tiene valores", o.Nombre)
+		}
+		valores := map[string]bool{}
+		for _, v := range o.Valores {
+			if v.Valor == "" || utf8.RuneCountInString(v.Valor) > 50 {
+				return fmt.Errorf("los valores de %q deben tener entre 1 y 50 caracteres", o.Nombre)
+			}
+			if valores[strings.ToLower(v.Valor)] {
+				return fmt.Errorf("el valor %q de %q está repetido", v.Valor, o.Nombre)
+			}
+			valores[strings.ToLower(v.Valor)] = true
+		}
+		combinaciones *= len(o.Valores)
+		if combinaciones > MaxVariantes {
+			return fmt.Errorf("las opciones generan más de %d combinaciones", MaxVariantes)
+		}
+	}
+	return nil
+}
+
+// combinaciones devuelve el producto cartesiano de los valores de los ejes,
+// en el orden de los ejes. Sin ejes no hay combinaciones.
+func combinaciones(opciones []OpcionProducto) [][]ValorOpcion {
+	if len(opciones) == 0 {
+		return nil
+	}
+	resultado := [][]ValorOpcion{{}}
+	for _, o := range opciones {
+		var siguiente [][]ValorOpcion
+		for _, parcial := range resultado {
+			for _, v := range o.Valores {
+				combinacion := append(append([]ValorOpcion(nil), parcial...), v)
+				siguiente = append(siguiente, combinacion)
+			}
+		}
+		resultado = siguiente
+	}
+	return resultado
+}
+
+// claveValores identifica una combinación por los IDs de sus valores.
+func claveValores(valores []ValorOpcion) string {
+	ids := make([]int, len(valores))
+	for i, v := range valores {
+		ids[i] = v.ID
+	}
+	sort.Ints(ids)
+	partes := make([]string, len(ids))
+	for i, id := range ids {
+		partes[i] = strconv.Itoa(id)
+	}
+	return strings.Join(partes, ",")
+}
+
+// skuVariante arma el SKU sugerido de una combinación a partir del SKU del
+// producto, p. ej. "REM-01-M-ROJO". Sin SKU de producto no se sugiere ninguno.
+func skuVariante(skuProducto string, valores []ValorOpcion) string {
+	if skuProducto == "" {
+		return ""
+	}
+	partes := []string{skuProducto}
+	for _, v := range valores {
+		partes = append(partes, strings.ToUpper(strings.ReplaceAll(v.Valor, " ", "")))
+	}
+	sku := strings.Join(partes, "-")
+	if utf8.RuneCountInString(sku) > 50 {
+		sku = sku[:50]
+	}
+	return sku
+}
+
+// GetOpcionesByProductoID devuelve los ejes de un producto con sus valores, en orden.
+func GetOpcionesByProductoID(idProducto int) ([]OpcionProducto, error) {
+	rows, err := pool.Query(`SELECT o.id_opcion, o.nombre, o.orden, v.id_valor, v.valor, v.orden
+		FROM opciones_producto o JOIN valores_opcion v ON v.id_opcion = o.id_opcion
+		WHERE o.id_producto = ? ORDER BY o.orden, o.id_opcion, v.orden, v.id_valor`, idProducto)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var opciones []OpcionProducto
+	for rows.Next() {
+		var o OpcionProducto
+		var v ValorOpcion
+		if err := rows.Scan(&o.ID, &o.Nombre, &o.Orden, &v.ID, &v.Valor, &v.Orden); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		if n := len(opciones); n == 0 || opciones[n-1].ID != o.ID {
+			o.IDProducto = idProducto
+			opciones = append(opciones, o)
+		}
+		v.IDOpcion, v.Opcion = o.ID, o.Nombre
+		actual := &opciones[len(opciones)-1]
+		actual.Valores = append(actual.Valores, v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error al obtener las opciones del producto", err)
+		return nil, err
+	}
+	return opciones, nil
+}
+
+// SetOpcionesProducto reemplaza los ejes del producto conservando los ejes y
+// valores que siguen existiendo (por nombre). Las variantes que pierden alguno
+// de sus valores, o a las que les falta un eje nuevo, se eliminan.
+func SetOpcionesProducto(idProducto int, opciones []OpcionProducto) error {
+	if err := ValidarOpciones(opciones); err != nil {
+		return err
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := bloquearProducto(tx, idProducto); err != nil {
+		return err
+	}
+	actuales, err := GetOpcionesByProductoID(idProducto)
+	if err != nil {
+		return err
+	}
+	porNombre := map[string]OpcionProducto{}
+	for _, o := range actuales {
+		porNombre[strings.ToLower(o.Nombre)] = o
+	}
+
+	for orden, o := range opciones {
+		existente, ok := porNombre[strings.ToLower(o.Nombre)]
+		idOpcion := existente.ID
+		if ok {
+			delete(porNombre, strings.ToLower(o.Nombre))
+			if _, err := tx.Exec("UPDATE opciones_producto SET nombre = ?, orden = ? WHERE id_opcion = ?", o.Nombre, orden, idOpcion); err != nil {
+				log.Println("Error al actualizar la opción", err)
+				return err
+			}
+		} else {
+			result, err := tx.Exec("INSERT INTO opciones_producto (id_producto, nombre, orden) VALUES (?, ?, ?)", idProducto, o.Nombre, orden)
+			if err != nil {
+				log.Println("Error al crear la opción", err)
+				return err
+			}
+			id, _ := result.LastInsertId()
+			idOpcion = int(id)
+		}
+
+		valoresActuales := map[string]int{}
+		for _, v := range existente.Valores {
+			valoresActuales[strings.ToLower(v.Valor)] = v.ID
+		}
+		for ordenValor, v := range o.Valores {
+			if idValor, ok := valoresActuales[strings.ToLower(v.Valor)]; ok {
+				delete(valoresActuales, strings.ToLower(v.Valor))
+				_, err = tx.Exec("UPDATE valores_opcion SET valor = ?, orden = ? WHERE id_valor = ?", v.Valor, ordenValor, idValor)
+			} else {
+				_, err = tx.Exec("INSERT INTO valores_opcion (id_opcion, valor, orden) VALUES (?, ?, ?)", idOpcion, v.Valor, ordenValor)
+			}
+			if err != nil {
+				log.Println("Error al guardar el valor de la opción", err)
+				return err
+			}
+		}
+		for _, idValor := range valoresActuales {
+			if _, err := tx.Exec("DELETE FROM valores_opcion WHERE id_valor = ?", idValor); err != nil {
+				log.Println("Error al eliminar el valor de la opción", err)
+				return err
+			}
+		}
+	}
+	for _, o := range porNombre {
+		if _, err := tx.Exec("DELETE FROM opciones_producto WHERE id_opcion = ?", o.ID); err != nil {
+			log.Println("Error al eliminar la opción", err)
+			return err
+		}
+	}
+
+	// Una variante válida tiene exactamente un valor por eje.
+	_, err = tx.Exec(`DELETE FROM variantes_producto WHERE id_producto = ? AND
+		(? = 0 OR (SELECT COUNT(*) FROM variante_valores vv WHERE vv.id_variante = variantes_producto.id_variante) <> ?)`,
+		idProducto, len(opciones), len(opciones))
+	if err != nil {
+		log.Println("Error al eliminar variantes incompletas", err)
+		return err
+	}
+	if err := recalcularStockProducto(tx, idProducto); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return err
+	}
+	return nil
+}
+
+// bloquearProducto toma el bloqueo de la fila del producto hasta el fin de la
+// transacción, para serializar los cambios de opciones y variantes.
+func bloquearProducto(tx *sql.Tx, idProducto int) error {
+	var id int
+	if err := tx.QueryRow("SELECT id_producto FROM productos WHERE id_producto = ? FOR UPDATE", idProducto).Scan(&id); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("producto no encontrado con ID: %d", idProducto)
+		}
+		log.Println("Error al bloquear el producto", err)
+		return err
+	}
+	return nil
+}
+
+// recalcularStockProducto deja en `productos.stock` la suma del stock de sus
+// variantes. Los productos sin variantes conservan su stock.
+func recalcularStockProducto(tx *sql.Tx, idProducto int) error {
+	_, err := tx.Exec(`UPDATE productos SET stock = (SELECT COALESCE(SUM(stock), 0) FROM variantes_producto WHERE id_producto = ?)
+		WHERE id_producto = ? AND EXISTS (SELECT 1 FROM variantes_producto WHERE id_producto = ?)`, idProducto, idProducto, idProducto)
+	if err != nil {
+		log.Println("Error al recalcular el stock del producto", err)
+	}
+	return err
+}
+
+const columnasVariante = "id_variante, id_producto, sku, precio, stock, activo"
+
+func scanVariante(scan func(dest ...interface{}) error) (VarianteProducto, error) {
+	var v VarianteProducto
+	var sku sql.NullString
+	var precio sql.Null[dinero.Monto]
+	if err := scan(&v.ID, &v.IDProducto, &sku, &precio, &v.Stock, &v.Activo); err != nil {
+		return v, err
+	}
+	v.SKU = sku.String
+	v.Precio, v.PrecioPropio = precio.V, precio.Valid
+	return v, nil
+}
+
+// valoresDeVariantes devuelve los valores de cada variante del producto,
+// ordenados por eje, indexados por ID de variante.
+func valoresDeVariantes(idProducto int) (map[int][]ValorOpcion, error) {
+	rows, err := pool.Query(`SELECT vv.id_variante, v.id_valor, v.id_opcion, o.nombre, v.valor, v.orden
+		FROM variante_valores vv
+		JOIN valores_opcion v ON v.id_valor = vv.id_valor
+		JOIN opciones_producto o ON o.id_opcion = v.id_opcion
+		WHERE o.id_producto = ? ORDER BY o.orden, o.id_opcion`, idProducto)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return nil, err
+	}
+	defer rows.Close()
+	valores := map[int][]ValorOpcion{}
+	for rows.Next() {
+		var idVariante int
+		var v ValorOpcion
+		if err := rows.Scan(&idVariante, &v.ID, &v.IDOpcion, &v.Opcion, &v.Valor, &v.Orden); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		valores[idVariante] = append(valores[idVariante], v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error al obtener los valores de las variantes", err)
+		return nil, err
+	}
+	return valores, nil
+}
+
+// GetVariantesByProductoID devuelve las variantes de un producto con sus valores.
+func GetVariantesByProductoID(idProducto int) ([]VarianteProducto, error) {
+	rows, err := pool.Query("SELECT "+columnasVariante+" FROM variantes_producto WHERE id_producto = ? ORDER BY id_variante", idProducto)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return nil, err
+	}
+	defer rows.Close()
+	var variantes []VarianteProducto
+	for rows.Next() {
+		v, err := scanVariante(rows.Scan)
+		if err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return nil, err
+		}
+		variantes = append(variantes, v)
+	}
+	if err := rows.Err(); err != nil {
+		log.Println("Error al obtener las variantes", err)
+		return nil, err
+	}
+	if len(variantes) == 0 {
+		return variantes, nil
+	}
+	valores, err := valoresDeVariantes(idProducto)
+	if err != nil {
+		return nil, err
+	}
+	for i := range variantes {
+		variantes[i].Valores = valores[variantes[i].ID]
+	}
+	return variantes, nil
+}
+
+// GetVarianteByID devuelve una variante con sus valores.
+func GetVarianteByID(id int) (VarianteProducto, error) {
+	v, err := scanVariante(pool.QueryRow("SELECT "+columnasVariante+" FROM variantes_producto WHERE id_variante = ?", id).Scan)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return v, fmt.Errorf("variante no encontrada con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return v, err
+	}
+	valores, err := valoresDeVariantes(v.IDProducto)
+	if err != nil {
+		return v, err
+	}
+	v.Valores = valores[v.ID]
+	return v, nil
+}
+
+// GetProductosConVariantes indica cuáles de los productos tienen variantes.
+func GetProductosConVariantes(idsProducto []int) (map[int]bool, error) {
+	conVariantes := map[int]bool{}
+	if len(idsProducto) == 0 {
+		return conVariantes, nil
+	}
+	args := make([]interface{}, len(idsProducto))
+	for i, id := range idsProducto {
+		args[i] = id
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?,", len(args)), ",")
+	rows, err := pool.Query("SELECT DISTINCT id_producto FROM variantes_producto WHERE id_producto IN ("+placeholders+")", args...)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return conVariantes, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			log.Println("Error al escanear la consulta sql", err)
+			return conVariantes, err
+		}
+		conVariantes[id] = true
+	}
+	return conVariantes, rows.Err()
+}
+
+// GenerarVariantes crea, sin stock, las combinaciones de ejes que aún no
+// tienen variante. Devuelve cuántas creó.
+func GenerarVariantes(idProducto int) (int, error) {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var skuProducto sql.NullString
+	if err := tx.QueryRow("SELECT sku FROM productos WHERE id_producto = ? FOR UPDATE", idProducto).Scan(&skuProducto); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, fmt.Errorf("producto no encontrado con ID: %d", idProducto)
+		}
+		log.Println("Error al bloquear el producto", err)
+		return 0, err
+	}
+	opciones, err := GetOpcionesByProductoID(idProducto)
+	if err != nil {
+		return 0, err
+	}
+	existentes, err := GetVariantesByProductoID(idProducto)
+	if err != nil {
+		return 0, err
+	}
+	usadas := map[string]bool{}
+	for _, v := range existentes {
+		usadas[claveValores(v.Valores)] = true
+	}
+
+	creadas := 0
+	for _, valores := range combinaciones(opciones) {
+		if usadas[claveValores(valores)] {
+			continue
+		}
+		sku := skuVariante(skuProducto.String, valores)
+		result, err := tx.Exec("INSERT INTO variantes_producto (id_producto, sku, stock, activo) VALUES (?, ?, 0, 1)", idProducto, sql.NullString{String: sku, Valid: sku != ""})
+		if err != nil {
+			log.Println("Error al crear la variante", err)
+			return 0, err
+		}
+		id, _ := result.LastInsertId()
+		for _, v := range valores {
+			if _, err := tx.Exec("INSERT INTO variante_valores (id_variante, id_valor) VALUES (?, ?)", id, v.ID); err != nil {
+				log.Println("Error al asignar el valor a la variante", err)
+				return 0, err
+			}
+		}
+		creadas++
+	}
+	if err := recalcularStockProducto(tx, idProducto); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return 0, err
+	}
+	return creadas, nil
+}
+
+// UpdateVariante modifica SKU, precio, stock y estado de una variante y
+// actualiza el stock total del producto.
+func UpdateVariante(v VarianteProducto) error {
+	if v.Stock < 0 || v.PrecioPropio && v.Precio < 0 {
+		return fmt.Errorf("precio y stock no pueden ser negativos")
+	}
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var idProducto int
+	if err := tx.QueryRow("SELECT id_producto FROM variantes_producto WHERE id_variante = ?", v.ID).Scan(&idProducto); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("variante no encontrada con ID: %d", v.ID)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return err
+	}
+	if err := bloquearProducto(tx, idProducto); err != nil {
+		return err
+	}
+	// Sin precio propio la columna queda NULL; un precio propio de 0 es
+	// válido.
+	var precio interface{}
+	if v.PrecioPropio {
+		precio = v.Precio
+	}
+	_, err = tx.Exec("UPDATE variantes_producto SET sku = ?, precio = ?, stock = ?, activo = ? WHERE id_variante = ?",
+		sql.NullString{String: v.SKU, Valid: v.SKU != ""}, precio, v.Stock, v.Activo, v.ID)
+	if err != nil {
+		log.Println("Error al ejecutar la consulta sql", err)
+		return err
+	}
+	if err := recalcularStockProducto(tx, idProducto); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteVariante elimina una variante; los items de carrito que la usaban se
+// borran en cascada y las líneas de pedido conservan su descripción.
+func DeleteVariante(id int) error {
+	tx, err := pool.Begin()
+	if err != nil {
+		log.Println("Error al iniciar la transacción", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	var idProducto int
+	if err := tx.QueryRow("SELECT id_producto FROM variantes_producto WHERE id_variante = ?", id).Scan(&idProducto); err != nil {
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("variante no encontrada con ID: %d", id)
+		}
+		log.Println("Error al escanear la consulta sql", err)
+		return err
+	}
+	if err := bloquearProducto(tx, idProducto); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM variantes_producto WHERE id_variante = ?", id); err != nil {
+		log.Println("Error al eliminar la variante", err)
+		return err
+	}
+	if err := recalcularStockProducto(tx, idProducto); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		log.Println("Error al confirmar la transacción", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+// Package notificaciones avisa a los clientes de lo que pasa con sus pedidos.
+// Los handlers solo conocen la interfaz Notificador: en desarrollo los avisos
+// se escriben en el log y en producción se envían por SMTP.
+package notificaciones
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+	"sync"
+)
+
+// Mensaje es un aviso de texto para un destinatario.
+type Mensaje struct {
+	Para   string
+	Asunto string
+	Cuerpo string
+}
+
+// Notificador envía avisos.
+type Notificador interface {
+	Enviar(m Mensaje) error
+}
+
+// Log escribe los avisos en el log en lugar de enviarlos.
+type Log struct{}
+
+func (Log) Enviar(m Mensaje) error {
+	log.Printf("Notificación para %s: %s\n%s", m.Para, m.Asunto, m.Cuerpo)
+	return nil
+}
+
+// Memoria guarda los avisos enviados. Pensado para pruebas con httptest.
+type Memoria struct {
+	mu       sync.Mutex
+	enviados []Mensaje
+}
+
+func (n *Memoria) Enviar(m Mensaje) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.enviados = append(n.enviados, m)
+	return nil
+}
+
+// Enviados devuelve una copia de los avisos enviados, en orden.
+func (n *Memoria) Enviados() []Mensaje {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return append([]Mensaje(nil), n.enviados...)
+}
+
+// SMTP envía los avisos como correos de texto plano.
+type SMTP struct {
+	direccion string
+	auth      smtp.Auth
+	remitente string
+}
+
+// NewSMTP crea el notificador para el servidor `host:puerto`. Si `usuario`
+// está vacío no se autentica.
+func NewSMTP(host, puerto, usuario, clave, remitente string) *SMTP {
+	var auth smtp.Auth
+	if usuario != "" {
+		auth = smtp.PlainAuth("", usuario, clave, host)
+	}
+	return &SMTP{direccion: host + ":" + puerto, auth: auth, remitente: remitente}
+}
+
+func (s *SMTP) Enviar(m Mensaje) error {
+	if strings.ContainsAny(m.Para+m.Asunto, "\r\n") {
+		return fmt.Errorf("destinatario o asunto con saltos de línea")
+	}
+	cuerpo := "From: " + s.remitente + "\r\n" +
+		"To: " + m.Para + "\r\n" +
+		"Subject: " + m.Asunto + "\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain; charset=UTF-8\r\n" +
+		"\r\n" + strings.ReplaceAll(m.Cuerpo, "\n", "\r\n")
+	return smtp.SendMail(s.direccion, s.auth, s.remitente, []string{m.Para}, []byte(cuerpo))
+}
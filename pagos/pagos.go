@@ -0,0 +1,155 @@
+// Package pagos cobra los pedidos a través de una pasarela de pago. Los
+// handlers solo conocen la interfaz PaymentGateway, así que el proveedor
+// simulado puede reemplazarse por uno real (Stripe, Mercado Pago...) sin tocar
+// el resto del código.
+package pagos
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrPagoRechazado se devuelve cuando la pasarela rechaza el cobro. El
+	// error envuelto trae el motivo que informó el proveedor.
+	ErrPagoRechazado = errors.New("pago rechazado")
+	// ErrTransaccionDesconocida se devuelve al operar sobre una transacción que
+	// la pasarela no conoce.
+	ErrTransaccionDesconocida = errors.New("transacción desconocida")
+	// ErrOperacionInvalida se devuelve cuando el estado de la transacción no
+	// admite la operación (p. ej. reembolsar algo no capturado).
+	ErrOperacionInvalida = errors.New("operación no válida para la transacción")
+	// ErrFirmaInvalida se devuelve cuando un webhook no trae una firma válida
+	// o está fuera de la ventana de tolerancia.
+	ErrFirmaInvalida = errors.New("firma de webhook inválida")
+)
+
+// Estados de una transacción.
+const (
+	EstadoAutorizada  = "AUTORIZADA"
+	EstadoPendiente   = "PENDIENTE"
+	EstadoCapturada   = "CAPTURADA"
+	EstadoReembolsada = "REEMBOLSADA"
+	EstadoAnulada     = "ANULADA"
+)
+
+// Tipos de evento que llegan por webhook.
+const (
+	EventoAprobado    = "pago.aprobado"
+	EventoRechazado   = "pago.rechazado"
+	EventoReembolsado = "pago.reembolsado"
+)
+
+// Cargo es lo que se pide cobrar. `Referencia` identifica la compra del lado
+// de la tienda y la pasarela la devuelve tal cual.
+type Cargo struct {
+	Monto      dinero.Monto
+	Metodo     string
+	Referencia string
+}
+
+// Transaccion es el estado de un cobro en la pasarela.
+type Transaccion struct {
+	ID          string
+	Estado      string
+	Monto       dinero.Monto
+	Reembolsado dinero.Monto
+}
+
+// Evento es una notificación de la pasarela ya verificada.
+type Evento struct {
+	ID            string
+	Tipo          string
+	TransaccionID string
+	Monto         dinero.Monto
+}
+
+// PaymentGateway es una pasarela de pago. Un cobro se autoriza y luego se
+// captura; si la autorización queda PENDIENTE, el resultado llega más tarde
+// por webhook.
+type PaymentGateway interface {
+	// Nombre identifica al proveedor en la URL del webhook
+	// (`/webhooks/pagos/{nombre}`).
+	Nombre() string
+	// Authorize reserva el monto. Devuelve ErrPagoRechazado si el proveedor
+	// lo rechaza.
+	Authorize(cargo Cargo) (Transaccion, error)
+	// Capture cobra una transacción autorizada.
+	Capture(transaccionID string) (Transaccion, error)
+	// Refund devuelve total o parcialmente una transacción capturada.
+	// `clave` identifica el reembolso del lado de la tienda: repetir la
+	// llamada con la misma clave no devuelve el dinero otra vez y responde
+	// como la primera.
+	Refund(transaccionID string, monto dinero.Monto, clave string) (Transaccion, error)
+	// Void anula una autorización que todavía no se capturó. Anular una
+	// transacción ya anulada no es un error.
+	Void(transaccionID string) error
+	// ParseWebhook verifica la firma de la notificación y la interpreta.
+	ParseWebhook(cabeceras http.Header, cuerpo []byte) (Evento, error)
+}
+
+// nuevoID genera un identificador aleatorio con el prefijo indicado.
+func nuevoID(prefijo string) string {
+	b := make([]byte, 12)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return prefijo + hex.EncodeToString(b)
+}
+
+// Firmar calcula la cabecera de firma de un webhook: `t=<unix>,v1=<hex>`,
+// donde v1 es el HMAC-SHA256 de `<unix>.<cuerpo>` con el secreto compartido.
+// Incluir la hora en lo firmado impide reenviar una notificación vieja.
+func Firmar(secreto, cuerpo []byte, ahora time.Time) string {
+	t := strconv.FormatInt(ahora.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(firma(secreto, t, cuerpo))
+}
+
+// VerificarFirma comprueba una cabecera generada con Firmar. Rechaza las
+// firmas con más de `tolerancia` de diferencia con `ahora`.
+func VerificarFirma(secreto, cuerpo []byte, cabecera string, ahora time.Time, tolerancia time.Duration) error {
+	var t string
+	var firmas [][]byte
+	for _, parte := range strings.Split(cabecera, ",") {
+		clave, valor, _ := strings.Cut(strings.TrimSpace(parte), "=")
+		switch clave {
+		case "t":
+			t = valor
+		case "v1":
+			if f, err := hex.DecodeString(valor); err == nil {
+				firmas = append(firmas, f)
+			}
+		}
+	}
+	segundos, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || len(firmas) == 0 {
+		return fmt.Errorf("%w: cabecera mal formada", ErrFirmaInvalida)
+	}
+	if d := ahora.Sub(time.Unix(segundos, 0)); d > tolerancia || d < -tolerancia {
+		return fmt.Errorf("%w: fuera de la ventana de tolerancia", ErrFirmaInvalida)
+	}
+	esperada := firma(secreto, t, cuerpo)
+	for _, f := range firmas {
+		if hmac.Equal(f, esperada) {
+			return nil
+		}
+	}
+	return ErrFirmaInvalida
+}
+
+func firma(secreto []byte, t string, cuerpo []byte) []byte {
+	mac := hmac.New(sha256.New, secreto)
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(cuerpo)
+	return mac.Sum(nil)
+}
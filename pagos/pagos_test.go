@@ -0,0 +1,66 @@
+package pagos
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFirmar(t *testing.T) {
+	ahora := time.Unix(1767225600, 0)
+	cabecera := Firmar([]byte("secreto"), []byte(`{"id":"evt_1"}`), ahora)
+	if !regexp.MustCompile(`^t=1767225600,v1=[0-9a-f]{64}$`).MatchString(cabecera) {
+		t.Errorf("Firmar = %q", cabecera)
+	}
+	if otra := Firmar([]byte("secreto"), []byte(`{"id":"evt_1"}`), ahora.Add(time.Second)); otra == cabecera {
+		t.Error("la firma no cambia con la hora")
+	}
+}
+
+func TestVerificarFirma(t *testing.T) {
+	secreto := []byte("secreto")
+	cuerpo := []byte(`{"id":"evt_1","tipo":"pago.aprobado"}`)
+	firmado := time.Unix(1767225600, 0)
+	cabecera := Firmar(secreto, cuerpo, firmado)
+	_, v1, _ := strings.Cut(cabecera, ",v1=")
+	ts := strconv.FormatInt(firmado.Unix(), 10)
+
+	casos := []struct {
+		nombre   string
+		secreto  []byte
+		cuerpo   []byte
+		cabecera string
+		ahora    time.Time
+		valida   bool
+	}{
+		{"recién firmada", secreto, cuerpo, cabecera, firmado, true},
+		{"en el límite de la tolerancia", secreto, cuerpo, cabecera, firmado.Add(ToleranciaFirma), true},
+		{"más vieja que la tolerancia", secreto, cuerpo, cabecera, firmado.Add(ToleranciaFirma + time.Second), false},
+		{"reloj del proveedor adelantado", secreto, cuerpo, cabecera, firmado.Add(-ToleranciaFirma), true},
+		{"demasiado en el futuro", secreto, cuerpo, cabecera, firmado.Add(-ToleranciaFirma - time.Second), false},
+		{"cuerpo alterado", secreto, []byte(`{"id":"evt_1","tipo":"pago.rechazado"}`), cabecera, firmado, false},
+		{"otro secreto", []byte("otro"), cuerpo, cabecera, firmado, false},
+		{"hora alterada", secreto, cuerpo, "t=" + strconv.FormatInt(firmado.Unix()+1, 10) + ",v1=" + v1, firmado, false},
+		{"con espacios", secreto, cuerpo, "t=" + ts + ", v1=" + v1, firmado, true},
+		{"varias firmas, una válida", secreto, cuerpo, "t=" + ts + ",v1=" + strings.Repeat("0", 64) + ",v1=" + v1, firmado, true},
+		{"vacía", secreto, cuerpo, "", firmado, false},
+		{"sin t", secreto, cuerpo, "v1=" + v1, firmado, false},
+		{"sin v1", secreto, cuerpo, "t=" + ts, firmado, false},
+		{"t no numérico", secreto, cuerpo, "t=ayer,v1=" + v1, firmado, false},
+		{"v1 no hexadecimal", secreto, cuerpo, "t=" + ts + ",v1=zz", firmado, false},
+		{"v1 vacío", secreto, cuerpo, "t=" + ts + ",v1=", firmado, false},
+		{"otro esquema", secreto, cuerpo, "t=" + ts + ",v0=" + v1, firmado, false},
+	}
+	for _, c := range casos {
+		err := VerificarFirma(c.secreto, c.cuerpo, c.cabecera, c.ahora, ToleranciaFirma)
+		switch {
+		case c.valida && err != nil:
+			t.Errorf("%s: %v", c.nombre, err)
+		case !c.valida && !errors.Is(err, ErrFirmaInvalida):
+			t.Errorf("%s: err = %v; se esperaba ErrFirmaInvalida", c.nombre, err)
+		}
+	}
+}
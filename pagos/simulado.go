@@ -0,0 +1,263 @@
+package pagos
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Modos del proveedor simulado.
+const (
+	// ModoAprobar autoriza todos los cobros al instante.
+	ModoAprobar = "aprobar"
+	// ModoRechazar rechaza todos los cobros.
+	ModoRechazar = "rechazar"
+	// ModoDiferir deja los cobros PENDIENTES y los aprueba pasado el retraso
+	// configurado, avisando por webhook (como una transferencia bancaria).
+	ModoDiferir = "diferir"
+)
+
+// CabeceraFirmaSimulado es la cabecera con la firma de los webhooks del
+// proveedor simulado.
+const CabeceraFirmaSimulado = "X-Pago-Firma"
+
+// ToleranciaFirma es la antigüedad máxima aceptada de un webhook firmado.
+const ToleranciaFirma = 5 * time.Minute
+
+// ConfigSimulado configura el proveedor simulado.
+type ConfigSimulado struct {
+	Modo string
+	// Secreto firma y verifica los webhooks.
+	Secreto []byte
+	// Retraso es lo que tarda en aprobarse un cobro en ModoDiferir.
+	Retraso time.Duration
+	// URLWebhook es adonde se envían las notificaciones. Vacía: no se envían
+	// y los cobros diferidos quedan pendientes.
+	URLWebhook string
+}
+
+// Simulado es una pasarela en memoria para desarrollo y pruebas. Genera
+// identificadores de transacción reales, respeta las transiciones de estado
+// de una pasarela verdadera y firma sus webhooks igual que lo haría un
+// proveedor externo.
+type Simulado struct {
+	cfg     ConfigSimulado
+	cliente *http.Client
+
+	mu            sync.Mutex
+	modo          string
+	transacciones map[string]*Transaccion
+	// reembolsos guarda la respuesta de cada Refund por su clave.
+	reembolsos map[string]Transaccion
+}
+
+// NewSimulado crea el proveedor simulado. El modo vacío equivale a
+// ModoAprobar.
+func NewSimulado(cfg ConfigSimulado) (*Simulado, error) {
+	if cfg.Modo == "" {
+		cfg.Modo = ModoAprobar
+	}
+	if err := validarModo(cfg.Modo); err != nil {
+		return nil, err
+	}
+	if len(cfg.Secreto) == 0 {
+		return nil, fmt.Errorf("el proveedor simulado necesita un secreto para firmar los webhooks")
+	}
+	return &Simulado{
+		cfg:           cfg,
+		cliente:       &http.Client{Timeout: 10 * time.Second},
+		modo:          cfg.Modo,
+		transacciones: map[string]*Transaccion{},
+		reembolsos:    map[string]Transaccion{},
+	}, nil
+}
+
+func validarModo(modo string) error {
+	switch modo {
+	case ModoAprobar, ModoRechazar, ModoDiferir:
+		return nil
+	}
+	return fmt.Errorf("modo de pago simulado desconocido: %q", modo)
+}
+
+// SetModo cambia el comportamiento para los cobros siguientes.
+func (s *Simulado) SetModo(modo string) error {
+	if err := validarModo(modo); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.modo = modo
+	return nil
+}
+
+func (s *Simulado) Nombre() string { return "simulado" }
+
+func (s *Simulado) Authorize(cargo Cargo) (Transaccion, error) {
+	if cargo.Monto <= 0 {
+		return Transaccion{}, fmt.Errorf("%w: el monto debe ser mayor que 0", ErrOperacionInvalida)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch s.modo {
+	case ModoRechazar:
+		return Transaccion{}, fmt.Errorf("%w: fondos insuficientes", ErrPagoRechazado)
+	case ModoDiferir:
+		t := &Transaccion{ID: nuevoID("sim_"), Estado: EstadoPendiente, Monto: cargo.Monto}
+		s.transacciones[t.ID] = t
+		time.AfterFunc(s.cfg.Retraso, func() { s.aprobarDiferido(t.ID) })
+		return *t, nil
+	}
+	t := &Transaccion{ID: nuevoID("sim_"), Estado: EstadoAutorizada, Monto: cargo.Monto}
+	s.transacciones[t.ID] = t
+	return *t, nil
+}
+
+// aprobarDiferido captura un cobro pendiente y lo notifica, salvo que se haya
+// anulado mientras tanto.
+func (s *Simulado) aprobarDiferido(id string) {
+	s.mu.Lock()
+	t, ok := s.transacciones[id]
+	if !ok || t.Estado != EstadoPendiente {
+		s.mu.Unlock()
+		return
+	}
+	t.Estado = EstadoCapturada
+	evento := Evento{ID: nuevoID("evt_"), Tipo: EventoAprobado, TransaccionID: t.ID, Monto: t.Monto}
+	s.mu.Unlock()
+	s.notificar(evento)
+}
+
+func (s *Simulado) Capture(transaccionID string) (Transaccion, error) {
+	s.mu.Lock()
+	t, ok := s.transacciones[transaccionID]
+	if !ok {
+		s.mu.Unlock()
+		return Transaccion{}, ErrTransaccionDesconocida
+	}
+	if t.Estado != EstadoAutorizada {
+		s.mu.Unlock()
+		return Transaccion{}, fmt.Errorf("%w: la transacción está %s", ErrOperacionInvalida, t.Estado)
+	}
+	t.Estado = EstadoCapturada
+	capturada := *t
+	s.mu.Unlock()
+
+	go s.notificar(Evento{ID: nuevoID("evt_"), Tipo: EventoAprobado, TransaccionID: capturada.ID, Monto: capturada.Monto})
+	return capturada, nil
+}
+
+func (s *Simulado) Refund(transaccionID string, monto dinero.Monto, clave string) (Transaccion, error) {
+	s.mu.Lock()
+	if previa, ok := s.reembolsos[clave]; ok && clave != "" {
+		s.mu.Unlock()
+		return previa, nil
+	}
+	t, ok := s.transacciones[transaccionID]
+	if !ok {
+		s.mu.Unlock()
+		return Transaccion{}, ErrTransaccionDesconocida
+	}
+	if t.Estado != EstadoCapturada {
+		s.mu.Unlock()
+		return Transaccion{}, fmt.Errorf("%w: la transacción está %s", ErrOperacionInvalida, t.Estado)
+	}
+	if monto <= 0 || monto > t.Monto-t.Reembolsado {
+		s.mu.Unlock()
+		return Transaccion{}, fmt.Errorf("%w: se pueden devolver hasta %s", ErrOperacionInvalida, (t.Monto - t.Reembolsado).Formato())
+	}
+	t.Reembolsado += monto
+	if t.Reembolsado == t.Monto {
+		t.Estado = EstadoReembolsada
+	}
+	reembolsada := *t
+	if clave != "" {
+		s.reembolsos[clave] = reembolsada
+	}
+	s.mu.Unlock()
+
+	go s.notificar(Evento{ID: nuevoID("evt_"), Tipo: EventoReembolsado, TransaccionID: reembolsada.ID, Monto: monto})
+	return reembolsada, nil
+}
+
+func (s *Simulado) Void(transaccionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	t, ok := s.transacciones[transaccionID]
+	if !ok {
+		return ErrTransaccionDesconocida
+	}
+	if t.Estado == EstadoAnulada {
+		return nil
+	}
+	if t.Estado != EstadoAutorizada && t.Estado != EstadoPendiente {
+		return fmt.Errorf("%w: la transacción está %s", ErrOperacionInvalida, t.Estado)
+	}
+	t.Estado = EstadoAnulada
+	return nil
+}
+
+// eventoSimulado es el cuerpo JSON de los webhooks del proveedor simulado.
+type eventoSimulado struct {
+	ID            string       `json:"id"`
+	Tipo          string       `json:"tipo"`
+	TransaccionID string       `json:"transaccion_id"`
+	Monto         dinero.Monto `json:"monto"`
+}
+
+func (s *Simulado) ParseWebhook(cabeceras http.Header, cuerpo []byte) (Evento, error) {
+	if err := VerificarFirma(s.cfg.Secreto, cuerpo, cabeceras.Get(CabeceraFirmaSimulado), time.Now(), ToleranciaFirma); err != nil {
+		return Evento{}, err
+	}
+	var e eventoSimulado
+	if err := json.Unmarshal(cuerpo, &e); err != nil {
+		return Evento{}, fmt.Errorf("cuerpo del webhook inválido: %w", err)
+	}
+	if e.ID == "" || e.TransaccionID == "" {
+		return Evento{}, fmt.Errorf("cuerpo del webhook inválido: faltan el id o la transacción")
+	}
+	return Evento{ID: e.ID, Tipo: e.Tipo, TransaccionID: e.TransaccionID, Monto: e.Monto}, nil
+}
+
+// Webhook arma el cuerpo y la cabecera de firma de una notificación, como
+// la enviaría el proveedor. Sirve también para reenviar eventos a mano.
+func (s *Simulado) Webhook(e Evento) ([]byte, http.Header) {
+	cuerpo, _ := json.Marshal(eventoSimulado{ID: e.ID, Tipo: e.Tipo, TransaccionID: e.TransaccionID, Monto: e.Monto})
+	cabeceras := http.Header{}
+	cabeceras.Set("Content-Type", "application/json")
+	cabeceras.Set(CabeceraFirmaSimulado, Firmar(s.cfg.Secreto, cuerpo, time.Now()))
+	return cuerpo, cabeceras
+}
+
+// notificar envía el evento a URLWebhook, con hasta tres intentos. Una
+// respuesta 2xx da el evento por entregado.
+func (s *Simulado) notificar(e Evento) {
+	if s.cfg.URLWebhook == "" {
+		return
+	}
+	for intento := 1; intento <= 3; intento++ {
+		cuerpo, cabeceras := s.Webhook(e)
+		req, err := http.NewRequest(http.MethodPost, s.cfg.URLWebhook, bytes.NewReader(cuerpo))
+		if err != nil {
+			log.Println("Error preparando webhook de pago:", err)
+			return
+		}
+		req.Header = cabeceras
+		res, err := s.cliente.Do(req)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode/100 == 2 {
+				return
+			}
+			err = fmt.Errorf("respuesta %s", res.Status)
+		}
+		log.Printf("Error enviando webhook de pago %s (intento %d): %v", e.ID, intento, err)
+		time.Sleep(time.Duration(intento) * time.Second)
+	}
+}
@@ -0,0 +1,209 @@
+package pagos
+
+import (
+	"Go-Sistemas-de-Gestion-empresarial/dinero"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// nuevoSimulado crea un proveedor simulado sin webhooks en `modo`.
+func nuevoSimulado(t *testing.T, modo string) *Simulado {
+	t.Helper()
+	s, err := NewSimulado(ConfigSimulado{Modo: modo, Secreto: []byte("secreto"), Retraso: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// capturada autoriza y captura un cobro de `monto`.
+func capturada(t *testing.T, s *Simulado, monto dinero.Monto) Transaccion {
+	t.Helper()
+	a, err := s.Authorize(Cargo{Monto: monto, Metodo: "tarjeta", Referencia: "pedido-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := s.Capture(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRefundConLaMismaClaveNoDevuelveDosVeces(t *testing.T) {
+	s := nuevoSimulado(t, ModoAprobar)
+	c := capturada(t, s, dinero.Pesos(10))
+
+	for i := 0; i < 2; i++ {
+		r, err := s.Refund(c.ID, dinero.Pesos(4), "devolucion-1")
+		if err != nil {
+			t.Fatalf("intento %d: %v", i+1, err)
+		}
+		if r.Reembolsado != dinero.Pesos(4) {
+			t.Errorf("intento %d: reembolsado %s, se esperaba 4.00", i+1, r.Reembolsado)
+		}
+	}
+	r, err := s.Refund(c.ID, dinero.Pesos(6), "devolucion-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Reembolsado != dinero.Pesos(10) || r.Estado != EstadoReembolsada {
+		t.Errorf("transacción %s con %s reembolsado, se esperaba REEMBOLSADA con 10.00", r.Estado, r.Reembolsado)
+	}
+	if _, err := s.Refund(c.ID, dinero.Pesos(1), "devolucion-3"); !errors.Is(err, ErrOperacionInvalida) {
+		t.Errorf("reembolsar una transacción ya devuelta: %v, se esperaba ErrOperacionInvalida", err)
+	}
+}
+
+func TestVoidRepetidoNoEsError(t *testing.T) {
+	s := nuevoSimulado(t, ModoDiferir)
+	a, err := s.Authorize(Cargo{Monto: dinero.Pesos(10), Metodo: "transferencia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := s.Void(a.ID); err != nil {
+			t.Errorf("intento %d: %v", i+1, err)
+		}
+	}
+	if _, err := s.Capture(a.ID); !errors.Is(err, ErrOperacionInvalida) {
+		t.Errorf("capturar una transacción anulada: %v, se esperaba ErrOperacionInvalida", err)
+	}
+}
+
+func TestNewSimuladoValidaLaConfiguracion(t *testing.T) {
+	if _, err := NewSimulado(ConfigSimulado{Modo: "regalar", Secreto: []byte("secreto")}); err == nil {
+		t.Error("se aceptó un modo desconocido")
+	}
+	if _, err := NewSimulado(ConfigSimulado{}); err == nil {
+		t.Error("se aceptó un proveedor sin secreto")
+	}
+	s := nuevoSimulado(t, "")
+	if err := s.SetModo("regalar"); err == nil {
+		t.Error("SetModo aceptó un modo desconocido")
+	}
+	if _, err := s.Authorize(Cargo{Monto: 0}); !errors.Is(err, ErrOperacionInvalida) {
+		t.Errorf("autorizar 0: %v, se esperaba ErrOperacionInvalida", err)
+	}
+}
+
+func TestModoAprobar(t *testing.T) {
+	s := nuevoSimulado(t, "")
+	a, err := s.Authorize(Cargo{Monto: dinero.Pesos(10), Metodo: "tarjeta"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Estado != EstadoAutorizada || a.Monto != dinero.Pesos(10) {
+		t.Errorf("autorización %s por %s, se esperaba AUTORIZADA por 10.00", a.Estado, a.Monto)
+	}
+	c, err := s.Capture(a.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.ID != a.ID || c.Estado != EstadoCapturada {
+		t.Errorf("captura %s %s, se esperaba %s CAPTURADA", c.ID, c.Estado, a.ID)
+	}
+	if _, err := s.Capture(a.ID); !errors.Is(err, ErrOperacionInvalida) {
+		t.Errorf("capturar dos veces: %v, se esperaba ErrOperacionInvalida", err)
+	}
+	if err := s.Void(a.ID); !errors.Is(err, ErrOperacionInvalida) {
+		t.Errorf("anular una captura: %v, se esperaba ErrOperacionInvalida", err)
+	}
+	if _, err := s.Capture("sim_no_existe"); !errors.Is(err, ErrTransaccionDesconocida) {
+		t.Errorf("capturar una transacción desconocida: %v", err)
+	}
+}
+
+func TestModoRechazar(t *testing.T) {
+	s := nuevoSimulado(t, ModoRechazar)
+	if _, err := s.Authorize(Cargo{Monto: dinero.Pesos(10), Metodo: "tarjeta"}); !errors.Is(err, ErrPagoRechazado) {
+		t.Errorf("err = %v, se esperaba ErrPagoRechazado", err)
+	}
+	if len(s.transacciones) != 0 {
+		t.Errorf("el rechazo dejó %d transacciones", len(s.transacciones))
+	}
+
+	// El modo se puede cambiar para los cobros siguientes.
+	if err := s.SetModo(ModoAprobar); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Authorize(Cargo{Monto: dinero.Pesos(10), Metodo: "tarjeta"}); err != nil {
+		t.Errorf("tras volver a aprobar: %v", err)
+	}
+}
+
+func TestModoDiferirApruebaYAvisaPorWebhook(t *testing.T) {
+	eventos := make(chan Evento, 1)
+	var s *Simulado
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cuerpo, _ := io.ReadAll(r.Body)
+		e, err := s.ParseWebhook(r.Header, cuerpo)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		eventos <- e
+	}))
+	defer srv.Close()
+	s, err := NewSimulado(ConfigSimulado{Modo: ModoDiferir, Secreto: []byte("secreto"), Retraso: 10 * time.Millisecond, URLWebhook: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a, err := s.Authorize(Cargo{Monto: dinero.Pesos(25), Metodo: "transferencia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Estado != EstadoPendiente {
+		t.Errorf("autorización %s, se esperaba PENDIENTE", a.Estado)
+	}
+	select {
+	case e := <-eventos:
+		if e.Tipo != EventoAprobado || e.TransaccionID != a.ID || e.Monto != dinero.Pesos(25) {
+			t.Errorf("evento = %+v", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no llegó el webhook de la aprobación")
+	}
+}
+
+func TestModoDiferirNoApruebaLoAnulado(t *testing.T) {
+	s := nuevoSimulado(t, ModoDiferir)
+	a, err := s.Authorize(Cargo{Monto: dinero.Pesos(10), Metodo: "transferencia"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Capture(a.ID); !errors.Is(err, ErrOperacionInvalida) {
+		t.Errorf("capturar un cobro pendiente: %v, se esperaba ErrOperacionInvalida", err)
+	}
+	if err := s.Void(a.ID); err != nil {
+		t.Fatal(err)
+	}
+	s.aprobarDiferido(a.ID)
+	if estado := s.transacciones[a.ID].Estado; estado != EstadoAnulada {
+		t.Errorf("estado = %s, se esperaba ANULADA", estado)
+	}
+}
+
+func TestParseWebhook(t *testing.T) {
+	s := nuevoSimulado(t, "")
+	e := Evento{ID: "evt_1", Tipo: EventoReembolsado, TransaccionID: "sim_1", Monto: dinero.Centavos(1050)}
+	cuerpo, cabeceras := s.Webhook(e)
+	got, err := s.ParseWebhook(cabeceras, cuerpo)
+	if err != nil || got != e {
+		t.Errorf("ParseWebhook = %+v, %v; se esperaba %+v", got, err, e)
+	}
+
+	alterado := []byte(`{"id":"evt_1","tipo":"pago.reembolsado","transaccion_id":"sim_1","monto":1050.00}`)
+	if _, err := s.ParseWebhook(cabeceras, alterado); !errors.Is(err, ErrFirmaInvalida) {
+		t.Errorf("cuerpo alterado: %v, se esperaba ErrFirmaInvalida", err)
+	}
+	incompleto, cabeceras := s.Webhook(Evento{Tipo: EventoAprobado, TransaccionID: "sim_1"})
+	if _, err := s.ParseWebhook(cabeceras, incompleto); err == nil {
+		t.Error("se aceptó un evento sin id")
+	}
+}